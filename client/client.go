@@ -0,0 +1,226 @@
+// Package client talks to a MoDB server over the protocol package's wire
+// protocol:
+//
+//	c, err := client.Dial(ctx, "localhost:7070")
+//	defer c.Close()
+//	c.Exec(ctx, "USE shop")
+//	cur, err := c.Select(ctx, "", "items", protocol.Match("price", protocol.PredicateLt, db.Int64Value(10)))
+//	res, err := cur.Get(ctx, "name", "price")
+//
+// A Client sends one request at a time over a single connection, so the
+// database selected with USE applies to all of its later requests. It is
+// safe for concurrent use, with requests taking turns.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/moh-osman3/MoDb/protocol"
+)
+
+// ServerError is an error the server answered a request with. The
+// connection stays usable after it.
+type ServerError struct {
+	Msg string
+}
+
+func (e *ServerError) Error() string {
+	return e.Msg
+}
+
+// Client is a connection to a server.
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	lock sync.Mutex
+	// err is set once the connection failed or a request was interrupted
+	// half way, after which the client cannot tell responses apart.
+	err error
+}
+
+// Dial connects to the server at the TCP address addr.
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return New(conn), nil
+}
+
+// New returns a client speaking over an established connection.
+func New(conn net.Conn) *Client {
+	return &Client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// Close closes the connection. The server releases the cursors of the
+// connection.
+func (c *Client) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err != nil {
+		// already closed, by Close or when the connection broke
+		c.err = net.ErrClosed
+		return nil
+	}
+	c.err = net.ErrClosed
+	return c.conn.Close()
+}
+
+// roundTrip sends req and waits for its response, giving up when ctx ends.
+// A response with an error is returned as a *ServerError.
+func (c *Client) roundTrip(ctx context.Context, req *protocol.Request) (*protocol.Response, error) {
+	var buf bytes.Buffer
+	if err := protocol.WriteRequest(&buf, req); err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	deadline, _ := ctx.Deadline()
+	c.conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	_, err := c.conn.Write(buf.Bytes())
+	var resp *protocol.Response
+	if err == nil {
+		resp, err = protocol.ReadResponse(c.r)
+	}
+	if err != nil {
+		// the socket deadline can pass just before ctx notices its own
+		if _, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) {
+			err = context.DeadlineExceeded
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		c.err = fmt.Errorf("connection broken: %w", err)
+		c.conn.Close()
+		return nil, err
+	}
+
+	if resp.Err != "" {
+		return nil, &ServerError{Msg: resp.Err}
+	}
+	return resp, nil
+}
+
+func result(resp *protocol.Response) *db.Result {
+	return &db.Result{Columns: resp.Columns, Types: resp.Types, Rows: resp.Rows, RowsAffected: resp.RowsAffected}
+}
+
+// Exec runs a SQL statement, see db.Session.Exec.
+func (c *Client) Exec(ctx context.Context, sql string) (*db.Result, error) {
+	resp, err := c.roundTrip(ctx, &protocol.Request{Op: protocol.OpExec, SQL: sql})
+	if err != nil {
+		return nil, err
+	}
+	return result(resp), nil
+}
+
+func (c *Client) CreateDb(ctx context.Context, dbName string) error {
+	_, err := c.roundTrip(ctx, &protocol.Request{Op: protocol.OpCreateDb, Db: dbName})
+	return err
+}
+
+func (c *Client) DropDb(ctx context.Context, dbName string) error {
+	_, err := c.roundTrip(ctx, &protocol.Request{Op: protocol.OpDropDb, Db: dbName})
+	return err
+}
+
+// CreateTable creates a table with a schema of cols in dbName, or in the
+// database selected with USE if dbName is empty.
+func (c *Client) CreateTable(ctx context.Context, dbName string, tblName string, cols []protocol.Column, primaryKey ...string) error {
+	_, err := c.roundTrip(ctx, &protocol.Request{
+		Op:         protocol.OpCreateTable,
+		Db:         dbName,
+		Table:      tblName,
+		Columns:    cols,
+		PrimaryKey: primaryKey,
+	})
+	return err
+}
+
+func (c *Client) DropTable(ctx context.Context, dbName string, tblName string) error {
+	_, err := c.roundTrip(ctx, &protocol.Request{Op: protocol.OpDropTable, Db: dbName, Table: tblName})
+	return err
+}
+
+// Insert inserts rows of values for colNames atomically and returns the
+// number of rows inserted.
+func (c *Client) Insert(ctx context.Context, dbName string, tblName string, colNames []string, rows [][]db.Value) (int64, error) {
+	resp, err := c.roundTrip(ctx, &protocol.Request{
+		Op:       protocol.OpInsert,
+		Db:       dbName,
+		Table:    tblName,
+		ColNames: colNames,
+		Rows:     rows,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resp.RowsAffected, nil
+}
+
+// Select matches the rows of a table that f matches, every row if f is
+// nil. The server keeps the matched rows until the cursor is released or
+// the connection closed.
+func (c *Client) Select(ctx context.Context, dbName string, tblName string, f *protocol.Filter) (*Cursor, error) {
+	resp, err := c.roundTrip(ctx, &protocol.Request{Op: protocol.OpSelect, Db: dbName, Table: tblName, Filter: f})
+	if err != nil {
+		return nil, err
+	}
+	return &Cursor{c: c, handle: resp.Handle, Count: resp.RowsAffected}, nil
+}
+
+// Cursor refers to the rows matched by a Select.
+type Cursor struct {
+	c      *Client
+	handle uint64
+	// Count is the number of rows matched.
+	Count int64
+}
+
+// Get reads the named columns of the matched rows that are still live, by
+// default all columns.
+func (cur *Cursor) Get(ctx context.Context, colNames ...string) (*db.Result, error) {
+	resp, err := cur.c.roundTrip(ctx, &protocol.Request{Op: protocol.OpGet, Handle: cur.handle, ColNames: colNames})
+	if err != nil {
+		return nil, err
+	}
+	return result(resp), nil
+}
+
+// Delete deletes the matched rows that are still live and returns how many
+// it deleted.
+func (cur *Cursor) Delete(ctx context.Context) (int64, error) {
+	resp, err := cur.c.roundTrip(ctx, &protocol.Request{Op: protocol.OpDelete, Handle: cur.handle})
+	if err != nil {
+		return 0, err
+	}
+	return resp.RowsAffected, nil
+}
+
+// Release frees the matched rows on the server.
+func (cur *Cursor) Release(ctx context.Context) error {
+	_, err := cur.c.roundTrip(ctx, &protocol.Request{Op: protocol.OpRelease, Handle: cur.handle})
+	return err
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/moh-osman3/MoDb/protocol"
+	"github.com/moh-osman3/MoDb/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func startServer(t *testing.T) string {
+	dbm := db.NewDefaultManager(zap.NewNop())
+	require.NoError(t, dbm.Start(context.Background()))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := server.New(dbm, zap.NewNop())
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return l.Addr().String()
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c, err := Dial(ctx, startServer(t))
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.CreateDb(ctx, "shop"))
+	err = c.CreateTable(ctx, "shop", "items", []protocol.Column{
+		{Name: "id", Type: db.TypeInt64, NotNull: true},
+		{Name: "name", Type: db.TypeString},
+		{Name: "price", Type: db.TypeFloat64},
+	}, "id")
+	require.NoError(t, err)
+
+	n, err := c.Insert(ctx, "shop", "items", []string{"id", "name", "price"}, [][]db.Value{
+		{db.Int64Value(1), db.StringValue("fig"), db.Float64Value(2.5)},
+		{db.Int64Value(2), db.StringValue("kiwi"), db.NullValue()},
+		{db.Int64Value(3), db.NullValue(), db.Float64Value(10)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	t.Run("select and get", func(t *testing.T) {
+		cur, err := c.Select(ctx, "shop", "items", protocol.Or(
+			protocol.Match("price", protocol.PredicateLt, db.Float64Value(5)),
+			protocol.IsNull("name"),
+		))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), cur.Count)
+
+		res, err := cur.Get(ctx, "name", "id")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"name", "id"}, res.Columns)
+		assert.Equal(t, []db.ColumnType{db.TypeString, db.TypeInt64}, res.Types)
+		assert.Equal(t, [][]db.Value{{db.StringValue("fig"), db.Int64Value(1)}, {db.NullValue(), db.Int64Value(3)}}, res.Rows)
+
+		res, err = cur.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"id", "name", "price"}, res.Columns)
+		require.NoError(t, cur.Release(ctx))
+		_, err = cur.Get(ctx)
+		assert.ErrorContains(t, err, "unknown handle")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		cur, err := c.Select(ctx, "shop", "items", protocol.Not(protocol.Match("id", protocol.PredicateIn, db.Int64Value(1), db.Int64Value(3))))
+		require.NoError(t, err)
+		deleted, err := cur.Delete(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+		res, err := cur.Get(ctx, "id")
+		require.NoError(t, err)
+		assert.Empty(t, res.Rows)
+
+		res, err = c.Exec(ctx, "SELECT id FROM shop.items")
+		require.NoError(t, err)
+		assert.Equal(t, [][]db.Value{{db.Int64Value(1)}, {db.Int64Value(3)}}, res.Rows)
+	})
+
+	t.Run("server errors", func(t *testing.T) {
+		_, err := c.Insert(ctx, "shop", "items", []string{"id"}, [][]db.Value{{db.Int64Value(1)}})
+		var serverErr *ServerError
+		assert.ErrorAs(t, err, &serverErr)
+		assert.ErrorContains(t, err, "duplicate")
+
+		err = c.CreateDb(ctx, "shop")
+		assert.ErrorContains(t, err, "already exists")
+		_, err = c.Select(ctx, "shop", "missing", nil)
+		assert.EqualError(t, err, "Cannot get table with name missing: does not exist")
+		_, err = c.Select(ctx, "shop", "items", protocol.Match("id", protocol.PredicateEq, db.StringValue("x")))
+		assert.ErrorContains(t, err, "type mismatch")
+
+		// the client is still usable after server errors
+		res, err := c.Exec(ctx, "SELECT COUNT FROM shop.items")
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		require.NoError(t, c.DropTable(ctx, "shop", "items"))
+		require.NoError(t, c.DropDb(ctx, "shop"))
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		_, err := c.Insert(ctx, "shop", "items", []string{"id", "name"}, [][]db.Value{{db.Int64Value(1)}})
+		assert.EqualError(t, err, "insert has 2 columns but row 1 has 1 values")
+		assert.NoError(t, c.CreateDb(ctx, "other"))
+	})
+}
+
+func TestClientContext(t *testing.T) {
+	// a server that never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			io.Copy(io.Discard, conn)
+			conn.Close()
+		}
+	}()
+
+	c, err := Dial(context.Background(), l.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = c.Exec(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the response could still arrive, so the connection is unusable
+	_, err = c.Exec(context.Background(), "SELECT 1")
+	assert.ErrorContains(t, err, "connection broken")
+	assert.NoError(t, c.Close())
+	assert.NoError(t, c.Close())
+}
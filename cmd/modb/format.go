@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/moh-osman3/MoDb/db"
+)
+
+// formatResult prints a query result as an aligned table, or the number of
+// rows a write changed.
+func formatResult(w io.Writer, res *db.Result) {
+	if len(res.Columns) == 0 {
+		if res.RowsAffected == 0 {
+			fmt.Fprintln(w, "OK")
+		} else {
+			fmt.Fprintf(w, "OK, %s affected\n", plural(res.RowsAffected, "row"))
+		}
+		return
+	}
+
+	header := res.Columns
+	cells := make([][]string, len(res.Rows))
+	for r, row := range res.Rows {
+		cells[r] = make([]string, len(row))
+		for i, val := range row {
+			cells[r][i] = val.String()
+		}
+	}
+	formatTable(w, header, cells, func(i int) bool {
+		return i < len(res.Types) && (res.Types[i] == db.TypeInt64 || res.Types[i] == db.TypeFloat64)
+	})
+	fmt.Fprintf(w, "(%s)\n", plural(int64(len(res.Rows)), "row"))
+}
+
+// formatTable prints rows of cells under a header, padding each column to
+// its widest cell. Columns for which rightAlign returns true are aligned to
+// the right, like numbers in psql.
+func formatTable(w io.Writer, header []string, rows [][]string, rightAlign func(i int) bool) {
+	widths := make([]int, len(header))
+	for i, name := range header {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	line := func(cells []string, right func(i int) bool) {
+		parts := make([]string, len(cells))
+		for i, cell := range cells {
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if right(i) {
+				parts[i] = pad + cell
+			} else {
+				parts[i] = cell + pad
+			}
+		}
+		fmt.Fprintln(w, " "+strings.TrimRight(strings.Join(parts, " | "), " "))
+	}
+
+	line(header, func(int) bool { return false })
+	rules := make([]string, len(widths))
+	for i, width := range widths {
+		rules[i] = strings.Repeat("-", width+2)
+	}
+	fmt.Fprintln(w, strings.Join(rules, "+"))
+	for _, row := range rows {
+		line(row, rightAlign)
+	}
+}
+
+func plural(n int64, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatResult(t *testing.T) {
+	var out strings.Builder
+	formatResult(&out, &db.Result{
+		Columns: []string{"id", "name", "price"},
+		Types:   []db.ColumnType{db.TypeInt64, db.TypeString, db.TypeFloat64},
+		Rows: [][]db.Value{
+			{db.Int64Value(1), db.StringValue("crème"), db.Float64Value(0.5)},
+			{db.Int64Value(100), db.NullValue(), db.Float64Value(12.25)},
+		},
+	})
+	assert.Equal(t, ""+
+		" id  | name  | price\n"+
+		"-----+-------+-------\n"+
+		"   1 | crème |   0.5\n"+
+		" 100 | NULL  | 12.25\n"+
+		"(2 rows)\n", out.String())
+
+	out.Reset()
+	formatResult(&out, &db.Result{Columns: []string{"id"}, Types: []db.ColumnType{db.TypeInt64}})
+	assert.Equal(t, " id\n----\n(0 rows)\n", out.String())
+
+	out.Reset()
+	formatResult(&out, &db.Result{RowsAffected: 1})
+	formatResult(&out, &db.Result{})
+	assert.Equal(t, "OK, 1 row affected\nOK\n", out.String())
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxHistory bounds the number of lines kept in the history file.
+const maxHistory = 1000
+
+// errInterrupt is returned by readLine when the user presses Ctrl-C.
+var errInterrupt = errors.New("interrupt")
+
+// lineReader reads input one line at a time.
+type lineReader interface {
+	// readLine returns the next line without its line ending, or io.EOF.
+	readLine(prompt string) (string, error)
+}
+
+// history keeps the lines entered so far, optionally backed by a file.
+type history struct {
+	lines []string
+	path  string
+}
+
+// loadHistory reads the history file at path, if it exists. An empty path
+// keeps the history in memory only.
+func loadHistory(path string) (*history, error) {
+	h := &history{path: path}
+	if path == "" {
+		return h, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load history: %v", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+	}
+	return h, nil
+}
+
+// add records a line, skipping blank lines and repeats of the previous one.
+func (h *history) add(line string) error {
+	if strings.TrimSpace(line) == "" || (len(h.lines) > 0 && h.lines[len(h.lines)-1] == line) {
+		return nil
+	}
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+	}
+	if h.path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("cannot save history: %v", err)
+	}
+	_, err = fmt.Fprintln(f, line)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot save history: %v", err)
+	}
+	return nil
+}
+
+// plainReader reads lines from a pipe or file. It prints prompts only when
+// interactive, so scripts piped into modb produce just their output.
+type plainReader struct {
+	scanner     *bufio.Scanner
+	out         io.Writer
+	interactive bool
+}
+
+func newPlainReader(in io.Reader, out io.Writer, interactive bool) *plainReader {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1<<20)
+	return &plainReader{scanner: scanner, out: out, interactive: interactive}
+}
+
+func (r *plainReader) readLine(prompt string) (string, error) {
+	if r.interactive {
+		fmt.Fprint(r.out, prompt)
+	}
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return strings.TrimSuffix(r.scanner.Text(), "\r"), nil
+}
+
+// editor is a minimal readline: it edits a line in place and recalls
+// history with the arrow keys. It expects a terminal in raw mode, so it
+// echoes input itself. The supported keys are the arrows, Home, End,
+// Delete, Backspace, Ctrl-A, Ctrl-E, Ctrl-K, Ctrl-U, Ctrl-C and Ctrl-D.
+type editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *history
+	// raw switches the terminal to raw mode for the duration of a read,
+	// returning a function that restores it.
+	raw func() (restore func(), err error)
+}
+
+func (e *editor) readLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	var line []rune
+	cursor := 0
+	// pos indexes the history entry being shown; len(lines) is the line
+	// being edited, kept in draft while browsing
+	pos := len(e.history.lines)
+	var draft []rune
+
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - cursor; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	recall := func(to int) {
+		if to < 0 || to > len(e.history.lines) || to == pos {
+			return
+		}
+		if pos == len(e.history.lines) {
+			draft = line
+		}
+		pos = to
+		if pos == len(e.history.lines) {
+			line = draft
+		} else {
+			line = []rune(e.history.lines[pos])
+		}
+		cursor = len(line)
+		redraw()
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return string(line), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupt
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if cursor < len(line) {
+				line = append(line[:cursor], line[cursor+1:]...)
+			}
+		case 127, 8: // Backspace
+			if cursor > 0 {
+				line = append(line[:cursor-1], line[cursor:]...)
+				cursor--
+			}
+		case 1: // Ctrl-A
+			cursor = 0
+		case 5: // Ctrl-E
+			cursor = len(line)
+		case 11: // Ctrl-K
+			line = line[:cursor]
+		case 21: // Ctrl-U
+			line = append([]rune(nil), line[cursor:]...)
+			cursor = 0
+		case 27: // escape sequence
+			seq := e.escapeSequence()
+			switch seq {
+			case "[A":
+				recall(pos - 1)
+				continue
+			case "[B":
+				recall(pos + 1)
+				continue
+			case "[C":
+				if cursor < len(line) {
+					cursor++
+				}
+			case "[D":
+				if cursor > 0 {
+					cursor--
+				}
+			case "[H", "[1~", "OH":
+				cursor = 0
+			case "[F", "[4~", "OF":
+				cursor = len(line)
+			case "[3~":
+				if cursor < len(line) {
+					line = append(line[:cursor], line[cursor+1:]...)
+				}
+			}
+		default:
+			if r < ' ' {
+				continue
+			}
+			line = append(line[:cursor], append([]rune{r}, line[cursor:]...)...)
+			cursor++
+		}
+		redraw()
+	}
+}
+
+// escapeSequence reads the rest of an escape sequence, e.g. "[A" for the up
+// arrow: an introducer followed by parameters up to a final letter or ~.
+func (e *editor) escapeSequence() string {
+	var seq []byte
+	for len(seq) < 8 {
+		b, err := e.in.ReadByte()
+		if err != nil {
+			break
+		}
+		seq = append(seq, b)
+		if len(seq) > 1 && (b == '~' || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z')) {
+			break
+		}
+	}
+	return string(seq)
+}
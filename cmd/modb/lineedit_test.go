@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditor(t *testing.T) {
+	h := &history{lines: []string{"SELECT 1;", "SELECT 2;"}}
+	newEditor := func(input string) *editor {
+		return &editor{in: bufio.NewReader(strings.NewReader(input)), out: io.Discard, history: h}
+	}
+
+	tests := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{"plain", "abc\r", "abc"},
+		{"backspace", "abd\x7fc\r", "abc"},
+		{"left arrow insert", "ac\x1b[Db\r", "abc"},
+		{"home and end", "bc\x1b[Ha\x1b[Fd\r", "abcd"},
+		{"ctrl-a and ctrl-e", "bc\x01a\x05d\r", "abcd"},
+		{"delete key", "abxc\x1b[D\x1b[D\x1b[3~\r", "abc"},
+		{"ctrl-k", "abcxyz\x1b[D\x1b[D\x1b[D\x0b\r", "abc"},
+		{"ctrl-u", "xyzabc\x1b[D\x1b[D\x1b[D\x15\r", "abc"},
+		{"history up", "\x1b[A\r", "SELECT 2;"},
+		{"history up twice", "\x1b[A\x1b[A\r", "SELECT 1;"},
+		{"history stops at oldest", "\x1b[A\x1b[A\x1b[A\r", "SELECT 1;"},
+		{"history edit", "\x1b[A\x7f\x7f3;\r", "SELECT 3;"},
+		{"history back to draft", "draft\x1b[A\x1b[B\r", "draft"},
+		{"unicode", "héllo\x1b[D\x7f\r", "hélo"},
+		{"end of input", "partial", "partial"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := newEditor(tt.input).readLine("> ")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, line)
+		})
+	}
+
+	_, err := newEditor("abc\x03").readLine("> ")
+	assert.ErrorIs(t, err, errInterrupt)
+	_, err = newEditor("\x04").readLine("> ")
+	assert.ErrorIs(t, err, io.EOF)
+	line, err := newEditor("ab\x01\x04\r").readLine("> ")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", line)
+}
+
+func TestEditorEcho(t *testing.T) {
+	var out strings.Builder
+	e := &editor{in: bufio.NewReader(strings.NewReader("ab\x1b[D\r")), out: &out, history: &history{}}
+	_, err := e.readLine("> ")
+	assert.NoError(t, err)
+	assert.Equal(t, "> \r> a\x1b[K\r> ab\x1b[K\r> ab\x1b[K\x1b[1D\r\n", out.String())
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, err := loadHistory(path)
+	assert.NoError(t, err)
+	assert.Empty(t, h.lines)
+
+	for _, line := range []string{"SELECT 1;", "SELECT 1;", "  ", `\dbs`} {
+		assert.NoError(t, h.add(line))
+	}
+	assert.Equal(t, []string{"SELECT 1;", `\dbs`}, h.lines)
+
+	reloaded, err := loadHistory(path)
+	assert.NoError(t, err)
+	assert.Equal(t, h.lines, reloaded.lines)
+
+	// the file keeps growing but only the newest entries are loaded
+	for i := 0; i < maxHistory; i++ {
+		assert.NoError(t, h.add(strings.Repeat("x", i+1)))
+	}
+	reloaded, err = loadHistory(path)
+	assert.NoError(t, err)
+	assert.Len(t, reloaded.lines, maxHistory)
+	assert.Equal(t, "x", reloaded.lines[0])
+
+	assert.NoError(t, os.WriteFile(path, nil, 0o000))
+	if _, err := os.ReadFile(path); err != nil {
+		_, err = loadHistory(path)
+		assert.ErrorContains(t, err, "cannot load history")
+	}
+
+	inMemory, err := loadHistory("")
+	assert.NoError(t, err)
+	assert.NoError(t, inMemory.add("SELECT 1;"))
+	assert.Equal(t, []string{"SELECT 1;"}, inMemory.lines)
+}
@@ -0,0 +1,95 @@
+// Command modb is an interactive shell for MoDB. It runs SQL statements
+// and backslash commands against in-memory databases or a data directory:
+//
+//	modb -data ./data
+//	modb=> CREATE DATABASE shop;
+//	modb=> USE shop;
+//	shop=> CREATE TABLE items (id INT PRIMARY KEY, name TEXT);
+//	shop=> SELECT * FROM items WHERE id > 1;
+//	shop=> \stats items
+//
+// When stdin is not a terminal modb runs it as a script, exiting with
+// status 1 if any statement failed.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
+
+func main() {
+	dataDir := flag.String("data", "", "data directory to load at start and checkpoint on exit, in-memory if empty")
+	historyPath := flag.String("history", defaultHistoryPath(), "file to keep input history in, none if empty")
+	verbose := flag.Bool("v", false, "log database events to stderr")
+	flag.Parse()
+
+	logger := zap.NewNop()
+	if *verbose {
+		var err error
+		if logger, err = zap.NewDevelopment(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	os.Exit(run(*dataDir, *historyPath, logger))
+}
+
+func run(dataDir string, historyPath string, logger *zap.Logger) int {
+	interactive := isTerminal(int(os.Stdin.Fd()))
+
+	var h *history
+	var in lineReader
+	if interactive {
+		var err error
+		if h, err = loadHistory(historyPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			h = &history{}
+		}
+		in = &editor{
+			in:      bufio.NewReader(os.Stdin),
+			out:     os.Stdout,
+			history: h,
+			raw: func() (func(), error) {
+				return makeRaw(int(os.Stdin.Fd()))
+			},
+		}
+		fmt.Println(`modb - enter \help for help`)
+	} else {
+		// scripts do not pollute the history
+		h = &history{}
+		in = newPlainReader(os.Stdin, os.Stdout, false)
+	}
+
+	ctx := context.Background()
+	r := newRepl(in, os.Stdout, h, logger)
+	if err := r.open(ctx, dataDir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	err := r.run(ctx)
+	if closeErr := r.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if !interactive && r.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".modb_history")
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/moh-osman3/MoDb/db"
+	"go.uber.org/zap"
+)
+
+const helpText = `Enter SQL statements terminated by ; or one of these commands:
+  \dbs               list databases
+  \tables [db]       list the tables of a database, by default the current one
+  \stats [db.]table  show row counts and column statistics of a table
+  \open dir          load a data directory, replacing the databases in memory
+  \save              checkpoint the databases to the data directory
+  \history           show previous input
+  \help              show this help
+  \q                 quit
+`
+
+// repl reads statements and commands, runs them against a manager and
+// prints their results.
+type repl struct {
+	in      lineReader
+	out     io.Writer
+	logger  *zap.Logger
+	history *history
+	dbm     db.Manager
+	session *db.Session
+	dataDir string
+	// failed counts the statements and commands that returned an error.
+	failed int
+}
+
+func newRepl(in lineReader, out io.Writer, h *history, logger *zap.Logger) *repl {
+	return &repl{in: in, out: out, history: h, logger: logger}
+}
+
+// open replaces the current manager with one backed by dataDir, or an
+// in-memory one if dataDir is empty. The current manager is ended first,
+// which checkpoints it if it has a data directory.
+func (r *repl) open(ctx context.Context, dataDir string) error {
+	if r.dbm != nil {
+		if err := r.dbm.End(); err != nil {
+			return err
+		}
+	}
+
+	var opts []db.ManagerOption
+	if dataDir != "" {
+		opts = append(opts, db.WithDataDir(dataDir))
+	}
+	dbm := db.NewDefaultManager(r.logger, opts...)
+	if err := dbm.Start(ctx); err != nil {
+		r.dbm = nil
+		return err
+	}
+	r.dbm = dbm
+	r.session = dbm.NewSession()
+	r.dataDir = dataDir
+	return nil
+}
+
+// close ends the manager, checkpointing it if it has a data directory.
+func (r *repl) close() error {
+	if r.dbm == nil {
+		return nil
+	}
+	err := r.dbm.End()
+	r.dbm = nil
+	return err
+}
+
+func (r *repl) prompt(continued bool) string {
+	name := "modb"
+	if r.session != nil && r.session.Database() != "" {
+		name = r.session.Database()
+	}
+	if continued {
+		return name + "-> "
+	}
+	return name + "=> "
+}
+
+// run processes input until \q or the end of input. SQL statements may span
+// lines and run once a line ends with a semicolon.
+func (r *repl) run(ctx context.Context) error {
+	var pending []string
+	for {
+		line, err := r.in.readLine(r.prompt(len(pending) > 0))
+		if errors.Is(err, errInterrupt) {
+			pending = nil
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			if len(pending) > 0 {
+				r.execSQL(ctx, pending)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if len(pending) == 0 {
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, `\`) {
+				r.addHistory(trimmed)
+				if quit := r.command(ctx, trimmed); quit {
+					return nil
+				}
+				continue
+			}
+		}
+
+		pending = append(pending, line)
+		if strings.HasSuffix(trimmed, ";") {
+			r.execSQL(ctx, pending)
+			pending = nil
+		}
+	}
+}
+
+func (r *repl) addHistory(line string) {
+	if err := r.history.add(line); err != nil {
+		r.logger.Warn("cannot record history", zap.Error(err))
+	}
+}
+
+// execSQL runs every statement in the given lines, reporting each error
+// and carrying on with the next statement.
+func (r *repl) execSQL(ctx context.Context, lines []string) {
+	trimmed := make([]string, len(lines))
+	for i, line := range lines {
+		trimmed[i] = strings.TrimSpace(line)
+	}
+	r.addHistory(strings.Join(trimmed, " "))
+
+	stmts, err := db.SplitSQL(strings.Join(lines, "\n"))
+	if err != nil {
+		r.printError(err)
+		return
+	}
+	for _, stmt := range stmts {
+		res, err := r.session.Exec(ctx, stmt)
+		if err != nil {
+			r.printError(err)
+			continue
+		}
+		formatResult(r.out, res)
+	}
+}
+
+func (r *repl) printError(err error) {
+	r.failed++
+	fmt.Fprintf(r.out, "ERROR: %v\n", err)
+}
+
+// command runs a backslash command, reporting whether it asks to quit.
+func (r *repl) command(ctx context.Context, line string) bool {
+	fields := strings.Fields(line)
+	name, args := fields[0], fields[1:]
+
+	var err error
+	switch name {
+	case `\q`, `\quit`:
+		return true
+	case `\help`, `\?`:
+		fmt.Fprint(r.out, helpText)
+	case `\dbs`:
+		err = r.listDbs(args)
+	case `\tables`:
+		err = r.listTables(args)
+	case `\stats`:
+		err = r.stats(args)
+	case `\open`:
+		if len(args) != 1 {
+			err = fmt.Errorf(`usage: \open dir`)
+			break
+		}
+		if err = r.open(ctx, args[0]); err == nil {
+			fmt.Fprintf(r.out, "opened %s with %s\n", args[0], plural(int64(len(r.dbm.DbNames())), "database"))
+		}
+	case `\save`:
+		if r.dataDir == "" {
+			err = fmt.Errorf(`no data directory to save to, open one with \open dir`)
+			break
+		}
+		if err = r.dbm.Save(); err == nil {
+			fmt.Fprintf(r.out, "saved to %s\n", r.dataDir)
+		}
+	case `\history`:
+		for i, entry := range r.history.lines {
+			fmt.Fprintf(r.out, "%5d  %s\n", i+1, entry)
+		}
+	default:
+		err = fmt.Errorf(`unknown command %s, try \help`, name)
+	}
+	if err != nil {
+		r.printError(err)
+	}
+	return false
+}
+
+func (r *repl) listDbs(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf(`usage: \dbs`)
+	}
+	var rows [][]string
+	for _, name := range r.dbm.DbNames() {
+		d, err := r.dbm.GetDb(name)
+		if err != nil {
+			continue
+		}
+		rows = append(rows, []string{name, fmt.Sprint(len(d.TableNames()))})
+	}
+	formatTable(r.out, []string{"database", "tables"}, rows, func(i int) bool { return i == 1 })
+	return nil
+}
+
+func (r *repl) listTables(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf(`usage: \tables [db]`)
+	}
+	dbName := r.session.Database()
+	if len(args) == 1 {
+		dbName = args[0]
+	}
+	if dbName == "" {
+		return fmt.Errorf("no database selected: name one or USE it first")
+	}
+	d, err := r.dbm.GetDb(dbName)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	for _, name := range d.TableNames() {
+		tbl, err := d.GetTable(name)
+		if err != nil {
+			continue
+		}
+		stats := tbl.Stats()
+		rows = append(rows, []string{name, fmt.Sprint(len(stats.Columns)), fmt.Sprint(stats.LiveRows)})
+	}
+	formatTable(r.out, []string{"table", "columns", "rows"}, rows, func(i int) bool { return i > 0 })
+	return nil
+}
+
+func (r *repl) stats(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(`usage: \stats [db.]table`)
+	}
+	dbName, tblName := r.session.Database(), args[0]
+	if before, after, ok := strings.Cut(args[0], "."); ok {
+		dbName, tblName = before, after
+	}
+	if dbName == "" {
+		return fmt.Errorf("no database selected: qualify the table as db.%s or USE a database", tblName)
+	}
+	d, err := r.dbm.GetDb(dbName)
+	if err != nil {
+		return err
+	}
+	tbl, err := d.GetTable(tblName)
+	if err != nil {
+		return err
+	}
+
+	stats := tbl.Stats()
+	fmt.Fprintf(r.out, "%s.%s: %s live, %s deleted\n", dbName, tblName, plural(stats.LiveRows, "row"), plural(stats.DeletedRows, "row"))
+	if schema := tbl.Schema(); schema != nil {
+		fmt.Fprintf(r.out, "schema: %s\n", schema)
+	}
+	rows := make([][]string, len(stats.Columns))
+	for i, col := range stats.Columns {
+		distinct := ""
+		if col.Type == db.TypeString {
+			distinct = fmt.Sprint(col.Distinct)
+		}
+		rows[i] = []string{col.Name, col.Type.String(), fmt.Sprint(col.NullCount), distinct}
+	}
+	formatTable(r.out, []string{"column", "type", "nulls", "distinct"}, rows, func(i int) bool { return i >= 2 })
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// runScript runs input through a repl opened on dataDir and returns its
+// output.
+func runScript(t *testing.T, dataDir string, input string) (string, *repl) {
+	var out strings.Builder
+	r := newRepl(newPlainReader(strings.NewReader(input), &out, false), &out, &history{}, zap.NewNop())
+	assert.NoError(t, r.open(context.Background(), dataDir))
+	assert.NoError(t, r.run(context.Background()))
+	assert.NoError(t, r.close())
+	return out.String(), r
+}
+
+func TestRepl(t *testing.T) {
+	out, r := runScript(t, "", `
+CREATE DATABASE shop; USE shop;
+CREATE TABLE items (
+	id INT PRIMARY KEY,
+	name TEXT
+);
+INSERT INTO items VALUES (1, 'apple'), (2, 'fig');
+SELECT name
+  FROM items
+ WHERE id = 2;
+\tables
+\stats items
+\stats nope
+\dbs
+\bogus
+SELECT * FROM items WHERE id = 'x';
+DELETE FROM items WHERE id = 1
+`)
+	assert.Equal(t, `OK
+OK
+OK
+OK, 2 rows affected
+ name
+------
+ fig
+(1 row)
+ table | columns | rows
+-------+---------+------
+ items |       2 |    2
+shop.items: 2 rows live, 0 rows deleted
+schema: (id int64 NOT NULL, name string, PRIMARY KEY (id))
+ column | type   | nulls | distinct
+--------+--------+-------+----------
+ id     | int64  |     0 |
+ name   | string |     0 |        2
+ERROR: Cannot get table with name nope: does not exist
+ database | tables
+----------+--------
+ shop     |      1
+ERROR: unknown command \bogus, try \help
+ERROR: type mismatch: column id has type int64, got string
+OK, 1 row affected
+`, out)
+	assert.Equal(t, 3, r.failed)
+
+	// statements are recorded on one line each
+	assert.Equal(t, []string{
+		"CREATE DATABASE shop; USE shop;",
+		"CREATE TABLE items ( id INT PRIMARY KEY, name TEXT );",
+		"INSERT INTO items VALUES (1, 'apple'), (2, 'fig');",
+		"SELECT name FROM items WHERE id = 2;",
+		`\tables`,
+		`\stats items`,
+		`\stats nope`,
+		`\dbs`,
+		`\bogus`,
+		"SELECT * FROM items WHERE id = 'x';",
+		"DELETE FROM items WHERE id = 1",
+	}, r.history.lines)
+}
+
+func TestReplPrompt(t *testing.T) {
+	var out strings.Builder
+	input := "CREATE DATABASE shop;\nUSE shop;\nSELECT *\n\\q\n;\n"
+	r := newRepl(newPlainReader(strings.NewReader(input), &out, true), &out, &history{}, zap.NewNop())
+	assert.NoError(t, r.open(context.Background(), ""))
+	assert.NoError(t, r.run(context.Background()))
+
+	// \q inside a statement is part of it, so the statement fails to parse
+	assert.Equal(t, "modb=> OK\nmodb=> OK\nshop=> shop-> shop-> ERROR: syntax error at position 9: unexpected character '\\\\'\nshop=> ", out.String())
+}
+
+func TestReplDataDir(t *testing.T) {
+	dir := t.TempDir()
+	out, _ := runScript(t, "", `
+\save
+\open `+dir+`
+CREATE DATABASE shop;
+CREATE TABLE shop.items (id INT);
+INSERT INTO shop.items VALUES (1), (2);
+\save
+\q
+SELECT * FROM shop.items;
+`)
+	assert.Equal(t, `ERROR: no data directory to save to, open one with \open dir
+opened `+dir+` with 0 databases
+OK
+OK
+OK, 2 rows affected
+saved to `+dir+`
+`, out)
+
+	out, _ = runScript(t, dir, "SELECT * FROM shop.items WHERE id > 1;\n\\open "+dir+"\n\\history\n")
+	assert.Equal(t, ` id
+----
+  2
+(1 row)
+opened `+dir+` with 1 database
+    1  SELECT * FROM shop.items WHERE id > 1;
+    2  \open `+dir+`
+    3  \history
+`, out)
+}
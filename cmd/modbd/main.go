@@ -0,0 +1,141 @@
+// Command modbd serves MoDB databases over TCP with the wire protocol of
+// the protocol package:
+//
+//	modbd -addr :7070 -data ./data
+//
+// With -http it also serves the JSON REST API of the httpapi package, and
+// with -pg the PostgreSQL protocol of the pgwire package, e.g. for psql:
+//
+//	modbd -pg :5432 &
+//	psql -h localhost -d shop
+//
+// On SIGINT or SIGTERM it stops accepting connections, lets running
+// requests finish for up to -shutdown-timeout and checkpoints the data
+// directory.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/moh-osman3/MoDb/httpapi"
+	"github.com/moh-osman3/MoDb/pgwire"
+	"github.com/moh-osman3/MoDb/server"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// config holds the command line flags.
+type config struct {
+	addr            string
+	httpAddr        string
+	pgAddr          string
+	dataDir         string
+	maxConns        int
+	shutdownTimeout time.Duration
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.addr, "addr", ":7070", "TCP address to listen on")
+	flag.StringVar(&cfg.httpAddr, "http", "", "address to serve the JSON REST API on, disabled if empty")
+	flag.StringVar(&cfg.pgAddr, "pg", "", "address to serve the PostgreSQL protocol on, disabled if empty")
+	flag.StringVar(&cfg.dataDir, "data", "", "data directory to load at start and checkpoint on exit, in-memory if empty")
+	flag.IntVar(&cfg.maxConns, "max-connections", server.DefaultMaxConnections, "connections served at once by each protocol, unlimited if 0")
+	flag.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 10*time.Second, "time running requests get to finish on shutdown")
+	flag.Parse()
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	if err := run(cfg, logger); err != nil {
+		logger.Error("modbd failed", zap.Error(err))
+		os.Exit(1)
+	}
+}
+
+func run(cfg config, logger *zap.Logger) error {
+	var opts []db.ManagerOption
+	if cfg.dataDir != "" {
+		opts = append(opts, db.WithDataDir(cfg.dataDir))
+	}
+	dbm := db.NewDefaultManager(logger, opts...)
+	if err := dbm.Start(context.Background()); err != nil {
+		return err
+	}
+
+	srv := server.New(dbm, logger, server.WithMaxConnections(cfg.maxConns))
+	served := make(chan error, 3)
+	go func() {
+		served <- srv.ListenAndServe(cfg.addr)
+	}()
+	logger.Info("serving", zap.String("addr", cfg.addr))
+
+	var httpSrv *http.Server
+	if cfg.httpAddr != "" {
+		httpSrv = &http.Server{Addr: cfg.httpAddr, Handler: httpapi.NewHandler(dbm, logger)}
+		go func() {
+			if err := httpSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				served <- err
+			}
+		}()
+		logger.Info("serving HTTP", zap.String("addr", cfg.httpAddr))
+	}
+
+	var pgSrv *pgwire.Server
+	if cfg.pgAddr != "" {
+		pgSrv = pgwire.New(dbm, logger, pgwire.WithMaxConnections(cfg.maxConns))
+		go func() {
+			if err := pgSrv.ListenAndServe(cfg.pgAddr); !errors.Is(err, pgwire.ErrServerClosed) {
+				served <- err
+			}
+		}()
+		logger.Info("serving PostgreSQL", zap.String("addr", cfg.pgAddr))
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case sig := <-signals:
+		logger.Info("shutting down", zap.Stringer("signal", sig))
+	case err := <-served:
+		// a listener failed, still end the manager cleanly
+		if httpSrv != nil {
+			httpSrv.Close()
+		}
+		if pgSrv != nil {
+			pgSrv.Shutdown(context.Background())
+		}
+		srv.Shutdown(context.Background())
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+	// stop the HTTP and PostgreSQL servers first, srv.Shutdown ends the
+	// manager
+	var err error
+	if httpSrv != nil {
+		err = httpSrv.Shutdown(ctx)
+	}
+	if pgSrv != nil {
+		err = multierr.Append(err, pgSrv.Shutdown(ctx))
+	}
+	err = multierr.Append(err, srv.Shutdown(ctx))
+	if servedErr := <-served; !errors.Is(servedErr, server.ErrServerClosed) {
+		err = multierr.Append(err, servedErr)
+	}
+	return err
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// ErrOverflow is returned when the SUM of an int64 column does not fit in
+// an int64.
+var ErrOverflow = errors.New("integer overflow")
+
+// AggregateFunc is an aggregate function over the items of a column.
+type AggregateFunc uint8
+
+const (
+	// AggCount counts the items that are not null.
+	AggCount AggregateFunc = iota + 1
+	// AggSum adds the int64 or float64 items.
+	AggSum
+	// AggMin and AggMax return the smallest and largest item of any type.
+	AggMin
+	AggMax
+	// AggAvg returns the mean of the int64 or float64 items as a float64.
+	AggAvg
+)
+
+func (fn AggregateFunc) String() string {
+	switch fn {
+	case AggCount:
+		return "COUNT"
+	case AggSum:
+		return "SUM"
+	case AggMin:
+		return "MIN"
+	case AggMax:
+		return "MAX"
+	case AggAvg:
+		return "AVG"
+	}
+	return fmt.Sprintf("AggregateFunc(%d)", uint8(fn))
+}
+
+// checkAggregate checks that fn applies to items of type typ.
+func checkAggregate(fn AggregateFunc, colName string, typ ColumnType) error {
+	switch fn {
+	case AggCount, AggMin, AggMax:
+		return nil
+	case AggSum, AggAvg:
+		if typ == TypeInt64 || typ == TypeFloat64 {
+			return nil
+		}
+		return fmt.Errorf("Cannot compute %s(%s): column has type %s, want int64 or float64", fn, colName, typ)
+	}
+	return fmt.Errorf("Cannot aggregate column %s: unknown aggregate %s", colName, fn)
+}
+
+// aggState accumulates an aggregate over the words of a column, skipping
+// nulls. Like in SQL, every aggregate but COUNT is null when no item is
+// added.
+type aggState struct {
+	fn    AggregateFunc
+	count int64
+	// hi and lo hold the sum of int64 items as a 128-bit two's complement
+	// integer, which cannot overflow before 2^63 items are added.
+	hi   int64
+	lo   uint64
+	fsum float64
+	// word is the smallest or largest word so far.
+	word int64
+}
+
+// add adds the item at idx of col, which must not be null. COUNT takes a
+// nil col to count rows. The caller must hold the column lock.
+func (a *aggState) add(col *column, idx int64) {
+	a.count++
+	if a.fn == AggCount {
+		return
+	}
+	word := col.data[idx]
+	switch a.fn {
+	case AggSum, AggAvg:
+		if col.typ == TypeFloat64 {
+			a.fsum += decodeFloat(word)
+			return
+		}
+		var carry uint64
+		a.lo, carry = bits.Add64(a.lo, uint64(word), 0)
+		a.hi += int64(carry) + word>>63
+	case AggMin, AggMax:
+		if a.count == 1 {
+			a.word = word
+			return
+		}
+		cmp := compareWords(word, a.word)
+		if col.typ == TypeString {
+			cmp = compareStrings(col.dict[word], col.dict[a.word])
+		}
+		if (a.fn == AggMin && cmp < 0) || (a.fn == AggMax && cmp > 0) {
+			a.word = word
+		}
+	}
+}
+
+// result returns the value of the aggregate. The caller must hold the
+// column lock.
+func (a *aggState) result(col *column) (Value, error) {
+	if a.fn == AggCount {
+		return Int64Value(a.count), nil
+	}
+	if a.count == 0 {
+		return NullValue(), nil
+	}
+
+	switch a.fn {
+	case AggSum:
+		if col.typ == TypeFloat64 {
+			return Float64Value(a.fsum), nil
+		}
+		if a.hi != int64(a.lo)>>63 {
+			return Value{}, fmt.Errorf("Cannot compute SUM(%s): %w", col.name, ErrOverflow)
+		}
+		return Int64Value(int64(a.lo)), nil
+	case AggAvg:
+		if col.typ == TypeFloat64 {
+			return Float64Value(a.fsum / float64(a.count)), nil
+		}
+		sum := float64(int64(a.lo))
+		if a.hi != int64(a.lo)>>63 {
+			sum = float64(a.hi)*math.Exp2(64) + float64(a.lo)
+		}
+		return Float64Value(sum / float64(a.count)), nil
+	}
+	if col.typ == TypeString {
+		return StringValue(col.dict[a.word]), nil
+	}
+	return fixedValue(col.typ, a.word), nil
+}
+
+func compareStrings(a string, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Aggregate computes fn over the items of col in the live rows c matches,
+// reading the column words in place. Null items are skipped, and every
+// aggregate but AggCount is null when no item is left.
+func (tbl *table) Aggregate(c *condition, fn AggregateFunc, col *column) (Value, error) {
+	if err := checkAggregate(fn, col.name, col.typ); err != nil {
+		return Value{}, err
+	}
+
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	if tbl.cols[col.name] != col {
+		return Value{}, fmt.Errorf("Cannot aggregate column %s: column not found", col.name)
+	}
+	if err := tbl.checkGeneration(c); err != nil {
+		return Value{}, err
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	col.lock.Lock()
+	defer col.lock.Unlock()
+
+	agg := &aggState{fn: fn}
+	c.ids.andNot(tbl.deletes).forEach(func(id int64) bool {
+		if id >= tbl.numRows {
+			return false
+		}
+		if !col.isNull(id) {
+			agg.add(col, id)
+		}
+		return true
+	})
+	return agg.result(col)
+}
+
+// CountRows returns the number of live rows c matches.
+func (tbl *table) CountRows(c *condition) (int64, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	if err := tbl.checkGeneration(c); err != nil {
+		return 0, err
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var count int64
+	c.ids.andNot(tbl.deletes).forEach(func(id int64) bool {
+		if id >= tbl.numRows {
+			return false
+		}
+		count++
+		return true
+	})
+	return count, nil
+}
+
+// Count returns the number of items of col that are not null in the live
+// rows c matches.
+func (tbl *table) Count(c *condition, col *column) (int64, error) {
+	res, err := tbl.Aggregate(c, AggCount, col)
+	if err != nil {
+		return 0, err
+	}
+	return res.Int64(), nil
+}
+
+// Sum adds the items of an int64 or float64 column in the live rows c
+// matches. The sum of an int64 column fails with ErrOverflow if it does not
+// fit in an int64.
+func (tbl *table) Sum(c *condition, col *column) (Value, error) {
+	return tbl.Aggregate(c, AggSum, col)
+}
+
+// Min returns the smallest item of col in the live rows c matches.
+func (tbl *table) Min(c *condition, col *column) (Value, error) {
+	return tbl.Aggregate(c, AggMin, col)
+}
+
+// Max returns the largest item of col in the live rows c matches.
+func (tbl *table) Max(c *condition, col *column) (Value, error) {
+	return tbl.Aggregate(c, AggMax, col)
+}
+
+// Avg returns the mean of the items of an int64 or float64 column in the
+// live rows c matches.
+func (tbl *table) Avg(c *condition, col *column) (Value, error) {
+	return tbl.Aggregate(c, AggAvg, col)
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregate(t *testing.T) {
+	schema, err := NewSchema(
+		NewColumnDef("qty", TypeInt64),
+		NewColumnDef("price", TypeFloat64),
+		NewColumnDef("name", TypeString),
+		NewColumnDef("added", TypeTimestamp),
+	)
+	require.NoError(t, err)
+	tbl := NewTable(WithSchema(schema))
+	day := func(d int) Value { return TimestampValue(time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)) }
+	require.NoError(t, tbl.InsertValueRows([]string{"qty", "price", "name", "added"}, [][]Value{
+		{Int64Value(3), Float64Value(1.5), StringValue("pear"), day(3)},
+		{Int64Value(-1), NullValue(), StringValue("apple"), day(1)},
+		{NullValue(), Float64Value(2.5), StringValue("zucchini"), NullValue()},
+		{Int64Value(10), Float64Value(-4), StringValue("fig"), day(9)},
+	}))
+	// deleted rows are not aggregated
+	require.NoError(t, tbl.DeleteRows([]int64{3}))
+
+	qty, _ := tbl.GetColumn("qty")
+	price, _ := tbl.GetColumn("price")
+	name, _ := tbl.GetColumn("name")
+	added, _ := tbl.GetColumn("added")
+	all := tbl.Not(NewCondition())
+
+	count, err := tbl.CountRows(all)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	n, err := tbl.Count(all, qty)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	tests := []struct {
+		fn     AggregateFunc
+		col    *column
+		expect Value
+	}{
+		{AggSum, qty, Int64Value(2)},
+		{AggSum, price, Float64Value(4)},
+		{AggAvg, qty, Float64Value(1)},
+		{AggAvg, price, Float64Value(2)},
+		{AggMin, qty, Int64Value(-1)},
+		{AggMax, qty, Int64Value(3)},
+		{AggMin, price, Float64Value(1.5)},
+		{AggMin, name, StringValue("apple")},
+		{AggMax, name, StringValue("zucchini")},
+		{AggMax, added, day(3)},
+		{AggCount, added, Int64Value(2)},
+	}
+	for _, tt := range tests {
+		res, err := tbl.Aggregate(all, tt.fn, tt.col)
+		assert.NoError(t, err, "%s(%s)", tt.fn, tt.col.name)
+		assert.Equal(t, tt.expect, res, "%s(%s)", tt.fn, tt.col.name)
+	}
+
+	// only the matched rows are aggregated
+	c, err := tbl.SelectValues(qty, Int64Value(0), Int64Value(100))
+	require.NoError(t, err)
+	res, err := tbl.Sum(c, price)
+	assert.NoError(t, err)
+	assert.Equal(t, Float64Value(1.5), res)
+
+	// aggregates of no items are null, but their count is zero
+	none := NewCondition()
+	for _, fn := range []AggregateFunc{AggSum, AggMin, AggMax, AggAvg} {
+		res, err := tbl.Aggregate(none, fn, qty)
+		assert.NoError(t, err)
+		assert.True(t, res.IsNull(), "%s of no rows", fn)
+	}
+	n, err = tbl.Count(none, qty)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	_, err = tbl.Sum(all, name)
+	assert.EqualError(t, err, "Cannot compute SUM(name): column has type string, want int64 or float64")
+	_, err = tbl.Avg(all, added)
+	assert.EqualError(t, err, "Cannot compute AVG(added): column has type timestamp, want int64 or float64")
+	_, err = tbl.Max(all, NewColumn("qty"))
+	assert.EqualError(t, err, "Cannot aggregate column qty: column not found")
+}
+
+func TestAggregateOverflow(t *testing.T) {
+	tbl := NewTable()
+	col, err := tbl.CreateColumn("n")
+	require.NoError(t, err)
+	require.NoError(t, tbl.InsertRows([]string{"n"}, [][]int64{{math.MaxInt64}, {math.MaxInt64}, {-math.MaxInt64}}))
+	all := tbl.Not(NewCondition())
+
+	// the sum comes back in range before the end
+	res, err := tbl.Sum(all, col)
+	assert.NoError(t, err)
+	assert.Equal(t, Int64Value(math.MaxInt64), res)
+
+	neg, err := tbl.Select(col, math.MinInt64, 0)
+	require.NoError(t, err)
+	c := tbl.Not(neg)
+	_, err = tbl.Sum(c, col)
+	assert.ErrorIs(t, err, ErrOverflow)
+	assert.EqualError(t, err, "Cannot compute SUM(n): integer overflow")
+	res, err = tbl.Avg(c, col)
+	assert.NoError(t, err)
+	assert.Equal(t, Float64Value(math.MaxInt64), res)
+
+	require.NoError(t, tbl.InsertRows([]string{"n"}, [][]int64{{math.MinInt64}, {math.MinInt64}}))
+	c, err = tbl.Select(col, math.MinInt64, 0)
+	require.NoError(t, err)
+	_, err = tbl.Sum(c, col)
+	assert.ErrorIs(t, err, ErrOverflow)
+	res, err = tbl.Avg(c, col)
+	assert.NoError(t, err)
+	assert.InEpsilon(t, float64(math.MinInt64), res.Float64(), 1e-15)
+}
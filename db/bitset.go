@@ -0,0 +1,56 @@
+package db
+
+import "math/bits"
+
+// bitset is a growable set of non-negative integers packed into words.
+type bitset []uint64
+
+func (b bitset) test(i int64) bool {
+	word := i >> 6
+	return word < int64(len(b)) && b[word]&(1<<(uint64(i)&63)) != 0
+}
+
+func (b *bitset) set(i int64) {
+	word := i >> 6
+	for word >= int64(len(*b)) {
+		*b = append(*b, 0)
+	}
+	(*b)[word] |= 1 << (uint64(i) & 63)
+}
+
+func (b *bitset) clear(i int64) {
+	word := i >> 6
+	if word < int64(len(*b)) {
+		(*b)[word] &^= 1 << (uint64(i) & 63)
+	}
+}
+
+// setRange sets every bit in [0, n).
+func (b *bitset) setRange(n int64) {
+	for i := int64(0); i < n; i += 64 {
+		if n-i >= 64 {
+			word := i >> 6
+			for word >= int64(len(*b)) {
+				*b = append(*b, 0)
+			}
+			(*b)[word] = ^uint64(0)
+			continue
+		}
+		for j := i; j < n; j++ {
+			b.set(j)
+		}
+	}
+}
+
+// count returns the number of set bits in [0, n).
+func (b bitset) count(n int64) int64 {
+	var total int64
+	for word := int64(0); word < int64(len(b)) && word<<6 < n; word++ {
+		w := b[word]
+		if remaining := n - word<<6; remaining < 64 {
+			w &= (1 << uint64(remaining)) - 1
+		}
+		total += int64(bits.OnesCount64(w))
+	}
+	return total
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitset(t *testing.T) {
+	var b bitset
+	b.set(3)
+	b.set(64)
+	b.set(200)
+	assert.True(t, b.test(3))
+	assert.True(t, b.test(64))
+	assert.True(t, b.test(200))
+	assert.False(t, b.test(4))
+	assert.False(t, b.test(1000))
+	assert.Equal(t, int64(3), b.count(201))
+	assert.Equal(t, int64(2), b.count(200))
+
+	b.clear(64)
+	b.clear(5000)
+	assert.False(t, b.test(64))
+	assert.Equal(t, int64(2), b.count(1000))
+
+	var full bitset
+	full.setRange(130)
+	assert.Equal(t, int64(130), full.count(1000))
+	assert.True(t, full.test(129))
+	assert.False(t, full.test(130))
+}
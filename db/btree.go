@@ -0,0 +1,213 @@
+package db
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+// btreeOrder is the most entries a leaf holds and the most children an
+// inner node has.
+const btreeOrder = 64
+
+// btreeKey is the key of an item in a B+tree: its word, whose order is the
+// order of the values of fixed width types, or its string for string
+// columns, whose dictionary ids are not ordered.
+type btreeKey struct {
+	word int64
+	str  string
+}
+
+// btreeEntry maps a key to a row holding it. Entries are ordered by key
+// and then by row id, so every entry of a tree is unique.
+type btreeEntry struct {
+	key btreeKey
+	id  int64
+}
+
+// btree is a B+tree of entries. Inner nodes only route searches and the
+// leaves hold every entry, linked in order for range scans. Deletes leave
+// leaves underfull rather than merging them, which keeps routing correct;
+// the tree is rebuilt compact whenever the table is reindexed.
+type btree struct {
+	strs bool
+	root *btreeNode
+	len  int
+}
+
+type btreeNode struct {
+	// entries of a leaf are its items in order. entries of an inner node
+	// are separators: entries[i] is not above any entry under
+	// children[i+1] and is above every entry under children[i].
+	entries  []btreeEntry
+	children []*btreeNode
+	// next is the leaf after this one.
+	next *btreeNode
+}
+
+func newBtree(strs bool) *btree {
+	return &btree{strs: strs, root: &btreeNode{}}
+}
+
+// buildBtree builds a tree from entries already in order, filling leaves
+// to three quarters so that inserts do not split them at once.
+func buildBtree(strs bool, entries []btreeEntry) *btree {
+	t := newBtree(strs)
+	if len(entries) == 0 {
+		return t
+	}
+	t.len = len(entries)
+
+	fill := btreeOrder * 3 / 4
+	var level []*btreeNode
+	var lows []btreeEntry
+	var prev *btreeNode
+	for start := 0; start < len(entries); start += fill {
+		leaf := &btreeNode{entries: slices.Clone(entries[start:min(start+fill, len(entries))])}
+		if prev != nil {
+			prev.next = leaf
+		}
+		prev = leaf
+		level = append(level, leaf)
+		lows = append(lows, leaf.entries[0])
+	}
+
+	for len(level) > 1 {
+		var parents []*btreeNode
+		var parentLows []btreeEntry
+		for start := 0; start < len(level); start += fill {
+			end := min(start+fill, len(level))
+			parents = append(parents, &btreeNode{
+				entries:  slices.Clone(lows[start+1 : end]),
+				children: slices.Clone(level[start:end]),
+			})
+			parentLows = append(parentLows, lows[start])
+		}
+		level, lows = parents, parentLows
+	}
+	t.root = level[0]
+	return t
+}
+
+func (t *btree) compareKeys(a btreeKey, b btreeKey) int {
+	if t.strs {
+		return compareStrings(a.str, b.str)
+	}
+	return compareWords(a.word, b.word)
+}
+
+func (t *btree) compare(a btreeEntry, b btreeEntry) int {
+	if cmp := t.compareKeys(a.key, b.key); cmp != 0 {
+		return cmp
+	}
+	return compareWords(a.id, b.id)
+}
+
+// childIndex returns the child of inner node n whose range holds e.
+func (t *btree) childIndex(n *btreeNode, e btreeEntry) int {
+	return sort.Search(len(n.entries), func(i int) bool {
+		return t.compare(n.entries[i], e) > 0
+	})
+}
+
+// entryIndex returns the position of the first entry of leaf n not below e.
+func (t *btree) entryIndex(n *btreeNode, e btreeEntry) int {
+	return sort.Search(len(n.entries), func(i int) bool {
+		return t.compare(n.entries[i], e) >= 0
+	})
+}
+
+// insert adds e to the tree unless it is there already.
+func (t *btree) insert(e btreeEntry) {
+	sep, right := t.insertAt(t.root, e)
+	if right != nil {
+		t.root = &btreeNode{entries: []btreeEntry{sep}, children: []*btreeNode{t.root, right}}
+	}
+}
+
+// insertAt inserts e under n. If n splits, it returns the new node to the
+// right of n and the separator between them.
+func (t *btree) insertAt(n *btreeNode, e btreeEntry) (btreeEntry, *btreeNode) {
+	if n.children == nil {
+		i := t.entryIndex(n, e)
+		if i < len(n.entries) && t.compare(n.entries[i], e) == 0 {
+			return btreeEntry{}, nil
+		}
+		n.entries = slices.Insert(n.entries, i, e)
+		t.len++
+		if len(n.entries) <= btreeOrder {
+			return btreeEntry{}, nil
+		}
+		mid := len(n.entries) / 2
+		right := &btreeNode{entries: slices.Clone(n.entries[mid:]), next: n.next}
+		n.entries = n.entries[:mid]
+		n.next = right
+		return right.entries[0], right
+	}
+
+	i := t.childIndex(n, e)
+	sep, child := t.insertAt(n.children[i], e)
+	if child == nil {
+		return btreeEntry{}, nil
+	}
+	n.entries = slices.Insert(n.entries, i, sep)
+	n.children = slices.Insert(n.children, i+1, child)
+	if len(n.children) <= btreeOrder {
+		return btreeEntry{}, nil
+	}
+	// the middle separator moves up between n and the new node
+	mid := len(n.entries) / 2
+	up := n.entries[mid]
+	right := &btreeNode{
+		entries:  slices.Clone(n.entries[mid+1:]),
+		children: slices.Clone(n.children[mid+1:]),
+	}
+	n.entries = n.entries[:mid]
+	n.children = n.children[:mid+1]
+	return up, right
+}
+
+// delete removes e from the tree, reporting whether it was there.
+func (t *btree) delete(e btreeEntry) bool {
+	n := t.root
+	for n.children != nil {
+		n = n.children[t.childIndex(n, e)]
+	}
+	i := t.entryIndex(n, e)
+	if i == len(n.entries) || t.compare(n.entries[i], e) != 0 {
+		return false
+	}
+	n.entries = slices.Delete(n.entries, i, i+1)
+	t.len--
+	return true
+}
+
+// ascend calls f with the entries in order, starting from the first whose
+// key is not below lower or from the first entry if lower is nil, until f
+// returns false.
+func (t *btree) ascend(lower *btreeKey, f func(e btreeEntry) bool) {
+	start := btreeEntry{id: math.MinInt64}
+	if lower != nil {
+		start.key = *lower
+	}
+	n := t.root
+	for n.children != nil {
+		if lower == nil {
+			n = n.children[0]
+		} else {
+			n = n.children[t.childIndex(n, start)]
+		}
+	}
+
+	i := 0
+	if lower != nil {
+		i = t.entryIndex(n, start)
+	}
+	for ; n != nil; n, i = n.next, 0 {
+		for _, e := range n.entries[i:] {
+			if !f(e) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// btreeEntries returns every entry of t in order.
+func btreeEntries(t *btree) []btreeEntry {
+	var entries []btreeEntry
+	t.ascend(nil, func(e btreeEntry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	return entries
+}
+
+func TestBtree(t *testing.T) {
+	tree := newBtree(false)
+	rng := rand.New(rand.NewSource(1))
+	var expect []btreeEntry
+	for i := range int64(5000) {
+		e := btreeEntry{key: btreeKey{word: rng.Int63n(300)}, id: i}
+		tree.insert(e)
+		expect = append(expect, e)
+	}
+	// inserting an entry twice keeps one
+	tree.insert(expect[10])
+	slices.SortFunc(expect, tree.compare)
+	assert.Equal(t, 5000, tree.len)
+	assert.Equal(t, expect, btreeEntries(tree))
+
+	// deletes may empty whole leaves
+	rng.Shuffle(len(expect), func(i, j int) { expect[i], expect[j] = expect[j], expect[i] })
+	for _, e := range expect[:4000] {
+		require.True(t, tree.delete(e))
+	}
+	assert.False(t, tree.delete(expect[0]))
+	expect = expect[4000:]
+	slices.SortFunc(expect, tree.compare)
+	assert.Equal(t, 1000, tree.len)
+	assert.Equal(t, expect, btreeEntries(tree))
+
+	// ascend starts at the first entry of a key
+	lower := btreeKey{word: 150}
+	var got []btreeEntry
+	tree.ascend(&lower, func(e btreeEntry) bool {
+		got = append(got, e)
+		return len(got) < 3
+	})
+	start, _ := slices.BinarySearchFunc(expect, btreeEntry{key: lower, id: -1}, tree.compare)
+	assert.Equal(t, expect[start:start+3], got)
+
+	// a tree built in bulk holds the same entries and keeps taking inserts
+	built := buildBtree(false, expect)
+	assert.Equal(t, expect, btreeEntries(built))
+	built.insert(btreeEntry{key: btreeKey{word: -1}, id: 7})
+	assert.Equal(t, btreeEntry{key: btreeKey{word: -1}, id: 7}, btreeEntries(built)[0])
+	assert.Empty(t, btreeEntries(buildBtree(false, nil)))
+}
+
+func TestBtreeStrings(t *testing.T) {
+	tree := newBtree(true)
+	for i, s := range []string{"pear", "apple", "fig", "apple", "kiwi"} {
+		tree.insert(btreeEntry{key: btreeKey{str: s}, id: int64(i)})
+	}
+	lower := btreeKey{str: "b"}
+	var ids []int64
+	tree.ascend(&lower, func(e btreeEntry) bool {
+		ids = append(ids, e.id)
+		return true
+	})
+	assert.Equal(t, []int64{2, 4, 0}, ids)
+}
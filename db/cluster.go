@@ -0,0 +1,145 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// ClusterBy sorts the rows of the table by colName, with nulls last, and
+// keeps them in that order: selects on the column binary search the sorted
+// rows rather than scanning them. Rows inserted or updated out of order are
+// left in an unsorted tail that selects scan until the next vacuum sorts it
+// in. Like a vacuum, clustering removes deleted rows and renumbers the
+// rest, so conditions built before it must not be reused after it.
+func (tbl *table) ClusterBy(colName string) error {
+	return tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		col, ok := tbl.cols[colName]
+		if !ok {
+			return 0, fmt.Errorf("Cannot cluster table on column %s: %w", colName, ErrNotExist)
+		}
+		return tbl.logAndApply(tbl.record(walClusterBy, []string{colName}), func() {
+			if prev, ok := tbl.cols[tbl.clusterKey]; ok {
+				prev.lock.Lock()
+				prev.clustered, prev.sorted = false, 0
+				prev.lock.Unlock()
+			}
+			tbl.clusterKey = colName
+			col.lock.Lock()
+			col.clustered = true
+			col.rebuildSorted()
+			col.lock.Unlock()
+			tbl.vacuum()
+		})
+	})
+}
+
+// unsortedRows returns the number of rows in the unsorted tail of a
+// clustered table. The caller must hold the table lock.
+func (tbl *table) unsortedRows() int64 {
+	col, ok := tbl.cols[tbl.clusterKey]
+	if !ok {
+		return 0
+	}
+	col.lock.Lock()
+	defer col.lock.Unlock()
+	return col.numItems - col.sorted
+}
+
+// clusterOrder sorts the ascending row ids keep into the order of the
+// cluster key, keeping rows with equal keys in id order. The caller must
+// hold the table lock.
+func (tbl *table) clusterOrder(keep []int64) {
+	col, ok := tbl.cols[tbl.clusterKey]
+	if !ok {
+		return
+	}
+	col.lock.Lock()
+	defer col.lock.Unlock()
+	// rows that all lie in the sorted prefix are already in order
+	sorted, _ := slices.BinarySearch(keep, col.sorted)
+	if sorted == len(keep) {
+		return
+	}
+	slices.SortStableFunc(keep, func(a, b int64) int {
+		return compareItems(col, a, b)
+	})
+}
+
+// compareKey compares the item at idx with key, ordering null items after
+// every key. The caller must hold the column lock.
+func (col *column) compareKey(idx int64, key btreeKey) int {
+	if col.isNull(idx) {
+		return 1
+	}
+	if col.typ == TypeString {
+		return compareStrings(col.dict[col.data[idx]], key.str)
+	}
+	return compareWords(col.data[idx], key.word)
+}
+
+// extendSorted grows the sorted prefix of a clustered column over the item
+// just appended if it is in order. The caller must hold the column lock.
+func (col *column) extendSorted() {
+	last := col.numItems - 1
+	if col.clustered && col.sorted == last && (last == 0 || compareItems(col, last-1, last) <= 0) {
+		col.sorted++
+	}
+}
+
+// truncateSorted shrinks the sorted prefix of a clustered column to end at
+// idx if the item just set there is out of order. The caller must hold the
+// column lock.
+func (col *column) truncateSorted(idx int64) {
+	if !col.clustered || idx >= col.sorted {
+		return
+	}
+	if (idx > 0 && compareItems(col, idx-1, idx) > 0) || (idx+1 < col.sorted && compareItems(col, idx, idx+1) > 0) {
+		col.sorted = idx
+	}
+}
+
+// rebuildSorted recomputes the sorted prefix of a clustered column. The
+// caller must hold the column lock.
+func (col *column) rebuildSorted() {
+	col.sorted = 0
+	if !col.clustered {
+		return
+	}
+	for col.sorted < col.numItems && (col.sorted == 0 || compareItems(col, col.sorted-1, col.sorted) <= 0) {
+		col.sorted++
+	}
+}
+
+// searchSorted returns the ids of the items in the sorted prefix of a
+// clustered column that fall in one of ranges, each found by binary search
+// as a run of ids. Null items never match. The caller must hold the column
+// lock.
+func (col *column) searchSorted(ranges []keyRange) *rowBitmap {
+	// the first item at or above key, or above it if exclusive
+	search := func(key *btreeKey, exclusive bool) int64 {
+		return int64(sort.Search(int(col.sorted), func(i int) bool {
+			if key == nil {
+				return col.isNull(int64(i))
+			}
+			cmp := col.compareKey(int64(i), *key)
+			return cmp > 0 || (cmp == 0 && !exclusive)
+		}))
+	}
+
+	ids := newRowBitmap()
+	for _, r := range ranges {
+		start := int64(0)
+		if r.lower != nil {
+			start = search(r.lower, r.lowerExclusive)
+		}
+		end := search(r.upper, !r.upperExclusive)
+		if start < end {
+			ids = ids.or(rangeBitmap(start, end))
+		}
+	}
+	return ids
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scanIds returns the ids of the live rows whose item of col matches, read
+// one item at a time.
+func scanIds(tbl *table, col *column, match func(val Value) bool) []int64 {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	col.lock.Lock()
+	defer col.lock.Unlock()
+	var ids []int64
+	for id := int64(0); id < tbl.numRows; id++ {
+		if val := col.value(id); !tbl.deletes.contains(id) && !val.null && match(val) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func TestClusterBy(t *testing.T) {
+	tbl := NewTable()
+	rng := rand.New(rand.NewSource(1))
+	ts := make([]int64, 5000)
+	seq := make([]int64, len(ts))
+	for i := range ts {
+		ts[i] = rng.Int63n(1000)
+		seq[i] = int64(i)
+	}
+	require.NoError(t, tbl.LoadColumns([]string{"ts", "seq"}, ts, seq))
+	require.NoError(t, tbl.DeleteRows([]int64{0}))
+	col, _ := tbl.GetColumn("ts")
+	seqCol, _ := tbl.GetColumn("seq")
+
+	assert.ErrorIs(t, tbl.ClusterBy("missing"), ErrNotExist)
+	require.NoError(t, tbl.ClusterBy("ts"))
+	stats := tbl.Stats()
+	assert.Equal(t, "ts", stats.ClusterKey)
+	assert.Equal(t, int64(0), stats.UnsortedRows)
+	assert.Equal(t, int64(4999), stats.LiveRows)
+	assert.Equal(t, int64(4999), col.sorted)
+
+	// rows are sorted by key and then by their old id
+	all, err := tbl.Get(tbl.Not(NewCondition()), []*column{col, seqCol})
+	require.NoError(t, err)
+	for i := 1; i < len(all[0]); i++ {
+		require.True(t, all[0][i-1] < all[0][i] || (all[0][i-1] == all[0][i] && all[1][i-1] < all[1][i]))
+	}
+
+	assertSelects := func(t *testing.T) {
+		t.Helper()
+		c, err := tbl.Select(col, 100, 200)
+		require.NoError(t, err)
+		assert.Equal(t, scanIds(tbl, col, func(val Value) bool { return val.i >= 100 && val.i < 200 }), tbl.matchingIds(c))
+		c, err = tbl.SelectWhere(col, In(Int64Value(-1), Int64Value(7), Int64Value(7), Int64Value(998)))
+		require.NoError(t, err)
+		assert.Equal(t, scanIds(tbl, col, func(val Value) bool { return val.i == 7 || val.i == 998 || val.i == -1 }), tbl.matchingIds(c))
+		c, err = tbl.SelectWhere(col, Gt(Int64Value(990)))
+		require.NoError(t, err)
+		assert.Equal(t, scanIds(tbl, col, func(val Value) bool { return val.i > 990 }), tbl.matchingIds(c))
+		c, err = tbl.SelectWhere(col, Le(Int64Value(3)))
+		require.NoError(t, err)
+		assert.Equal(t, scanIds(tbl, col, func(val Value) bool { return val.i <= 3 }), tbl.matchingIds(c))
+		c, err = tbl.SelectWhere(col, Ne(Int64Value(3)))
+		require.NoError(t, err)
+		assert.Equal(t, scanIds(tbl, col, func(val Value) bool { return val.i != 3 }), tbl.matchingIds(c))
+	}
+	assertSelects(t)
+
+	// a select on the sorted rows neither scans nor prunes blocks
+	c := NewCondition()
+	require.NoError(t, c.Select(col, 500, 501))
+	assert.Equal(t, int64(0), col.PrunedBlocks())
+
+	// inserts in order stay sorted, nulls last
+	require.NoError(t, tbl.InsertValues([]string{"ts"}, []Value{Int64Value(1000)}))
+	require.NoError(t, tbl.InsertValues([]string{"ts"}, []Value{NullValue()}))
+	assert.Equal(t, int64(0), tbl.Stats().UnsortedRows)
+	assertSelects(t)
+
+	// inserts and updates out of order are buffered in the unsorted tail
+	require.NoError(t, tbl.InsertRow([]string{"ts", "seq"}, []int64{150, -1}))
+	require.NoError(t, tbl.InsertRow([]string{"ts", "seq"}, []int64{999, -2}))
+	assert.Equal(t, int64(2), tbl.Stats().UnsortedRows)
+	assertSelects(t)
+	c, err = tbl.Select(seqCol, 2000, 2001)
+	require.NoError(t, err)
+	require.NoError(t, tbl.UpdateValues(c, []string{"ts"}, []Value{Int64Value(-5)}))
+	assert.Greater(t, tbl.Stats().UnsortedRows, int64(2))
+	assertSelects(t)
+	c, err = tbl.SelectWhere(col, Eq(Int64Value(-5)))
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.NumResults())
+
+	// a vacuum sorts them in
+	vacuumed, err := tbl.Vacuum()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), vacuumed.RowsRemoved)
+	assert.Equal(t, int64(0), tbl.Stats().UnsortedRows)
+	vals, err := tbl.GetValues(tbl.Not(NewCondition()), []*column{col, seqCol})
+	require.NoError(t, err)
+	assert.Equal(t, Int64Value(-5), vals[0][0])
+	assert.Equal(t, Int64Value(2000), vals[1][0])
+	assert.True(t, vals[0][len(vals[0])-1].IsNull())
+	assertSelects(t)
+
+	// dropping the key unclusters the table
+	require.NoError(t, tbl.DeleteColumn("ts"))
+	assert.Equal(t, "", tbl.Stats().ClusterKey)
+}
+
+func TestClusterByStrings(t *testing.T) {
+	tbl := NewTable()
+	days := make([]Value, 3000)
+	for i := range days {
+		days[i] = StringValue(fmt.Sprintf("day%02d", (i*7)%30))
+	}
+	days[5] = NullValue()
+	require.NoError(t, tbl.LoadValues([]string{"day"}, days))
+	require.NoError(t, tbl.ClusterBy("day"))
+	col, _ := tbl.GetColumn("day")
+
+	for _, p := range []Predicate{
+		Eq(StringValue("day07")), Between(StringValue("day10"), StringValue("day12")),
+		Lt(StringValue("day02")), Ge(StringValue("day29")), In(StringValue("day03"), NullValue()),
+	} {
+		c, err := tbl.SelectWhere(col, p)
+		require.NoError(t, err)
+		assert.Equal(t, scanIds(tbl, col, func(val Value) bool {
+			return p.test(func(i int) int { return val.Compare(p.vals[i]) })
+		}), tbl.matchingIds(c), p.String())
+	}
+	c, err := tbl.SelectValues(col, StringValue("day05"), StringValue("day06"))
+	require.NoError(t, err)
+	// one of the rows of day05 is null
+	assert.Equal(t, 99, c.NumResults())
+	ids := tbl.matchingIds(c)
+	assert.Equal(t, int64(98), ids[len(ids)-1]-ids[0])
+}
+
+func TestClusterByPersistence(t *testing.T) {
+	dir := t.TempDir()
+	manager := startManager(t, dir)
+	db1, err := manager.CreateDb("testdb1")
+	require.NoError(t, err)
+	tbl, err := db1.CreateTable("tbl1")
+	require.NoError(t, err)
+	require.NoError(t, tbl.LoadColumns([]string{"a"}, []int64{3, 1, 2}))
+	require.NoError(t, tbl.ClusterBy("a"))
+	require.NoError(t, tbl.InsertRow([]string{"a"}, []int64{0}))
+
+	reopen := func(manager *defaultManager) *table {
+		d, err := manager.GetDb("testdb1")
+		require.NoError(t, err)
+		tbl, err := d.GetTable("tbl1")
+		require.NoError(t, err)
+		return tbl
+	}
+	// the log replays the clustering and the buffered insert
+	restarted := startManager(t, dir)
+	rtbl := reopen(restarted)
+	assert.Equal(t, "a", rtbl.Stats().ClusterKey)
+	assert.Equal(t, int64(1), rtbl.Stats().UnsortedRows)
+	_, err = rtbl.Vacuum()
+	require.NoError(t, err)
+
+	// and the snapshot keeps the table clustered
+	require.NoError(t, restarted.End())
+	again := startManager(t, dir)
+	atbl := reopen(again)
+	col, _ := atbl.GetColumn("a")
+	assert.True(t, col.clustered)
+	assert.Equal(t, int64(0), atbl.Stats().UnsortedRows)
+	vals, err := atbl.Get(atbl.Not(NewCondition()), []*column{col})
+	require.NoError(t, err)
+	assert.Equal(t, [][]int64{{0, 1, 2, 3}}, vals)
+	assert.NoError(t, again.End())
+}
@@ -1,53 +1,379 @@
 package db
 
 import (
+	"math"
+	"slices"
 	"sync"
 )
 
 const defaultColumnSize = 10000
 
+// zoneSize is the number of items in a block of a zone map. It is a
+// multiple of 64 so that blocks line up with the words of bitmaps.
+const zoneSize = 1024
+
+// zone bounds the words of the items that are not null in one block of a
+// column. Updates only ever widen a zone, so its bounds may be loose until
+// the zones are rebuilt but never exclude an item. A block of nulls has lo
+// above hi.
+type zone struct {
+	lo, hi int64
+}
+
+func emptyZone() zone {
+	return zone{lo: math.MaxInt64, hi: math.MinInt64}
+}
+
+func (z *zone) widen(word int64) {
+	z.lo, z.hi = min(z.lo, word), max(z.hi, word)
+}
+
+// overlaps reports whether the block may hold a word in [lo, hi].
+func (z zone) overlaps(lo int64, hi int64) bool {
+	return z.lo <= z.hi && z.lo <= hi && lo <= z.hi
+}
+
 type column struct {
 	name     string
+	typ      ColumnType
+	def      ColumnDef
 	data     []int64
 	numItems int64
-	lock     sync.Mutex
+	// dict and dictIds dictionary encode string columns: data holds the
+	// index of each value in dict.
+	dict    []string
+	dictIds map[string]int64
+	// validity has a bit set for every item that is not null. It stays nil
+	// until the first null is stored.
+	validity bitset
+	// zones is the zone map of the column: the bounds of the words of each
+	// block of zoneSize items, which lets selects skip blocks that cannot
+	// match. Trailing blocks of nulls may have no zone. prunedBlocks counts
+	// the blocks selects skipped.
+	zones        []zone
+	prunedBlocks int64
+	// clustered is set on the cluster key of a table, whose first sorted
+	// items are in order with nulls last.
+	clustered bool
+	sorted    int64
+	lock      sync.Mutex
 }
 
 func NewColumn(colName string) *column {
-	return &column{
-		name:     colName,
+	return NewTypedColumn(colName, TypeInt64)
+}
+
+func NewTypedColumn(colName string, colType ColumnType) *column {
+	return newColumnFromDef(NewColumnDef(colName, colType))
+}
+
+func newColumnFromDef(def ColumnDef) *column {
+	col := &column{
+		name:     def.name,
+		typ:      def.typ,
+		def:      def,
 		data:     make([]int64, defaultColumnSize),
 		numItems: 0,
 	}
+	if def.typ == TypeString {
+		col.dictIds = make(map[string]int64)
+	}
+	return col
+}
+
+func (col *column) Type() ColumnType {
+	return col.typ
+}
+
+func (col *column) checkType(typ ColumnType) error {
+	if col.typ != typ {
+		return typeMismatchError(col.name, col.typ, typ)
+	}
+	return nil
+}
+
+// checkValue checks that val matches the column type and satisfies its
+// constraints.
+func (col *column) checkValue(val Value) error {
+	return col.def.validate(val)
+}
+
+// checkItems checks int64 items against the column type and constraints.
+func (col *column) checkItems(items []int64) error {
+	if err := col.checkType(TypeInt64); err != nil {
+		return err
+	}
+	if col.def.checkMin == nil && col.def.checkMax == nil {
+		return nil
+	}
+	for _, item := range items {
+		if err := col.checkValue(Int64Value(item)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (col *column) LoadColumn(vals []int64) error {
 	col.lock.Lock()
 	defer col.lock.Unlock()
 
-	if len(vals) > len(col.data) {
-		col.data = make([]int64, 2*len(vals))
+	if err := col.checkItems(vals); err != nil {
+		return err
 	}
+
+	col.loadWords(vals)
+	return nil
+}
+
+// LoadValues replaces the contents of the column with vals, which must all
+// match the column type and constraints.
+func (col *column) LoadValues(vals []Value) error {
+	col.lock.Lock()
+	defer col.lock.Unlock()
+
+	for _, val := range vals {
+		if err := col.checkValue(val); err != nil {
+			return err
+		}
+	}
+
+	col.loadValues(vals)
+	return nil
+}
+
+// loadValues replaces the contents of the column with values that have
+// already been checked. The caller must hold the column lock.
+func (col *column) loadValues(vals []Value) {
+	words := make([]int64, len(vals))
 	for i, val := range vals {
-		col.data[i] = val
+		if !val.null {
+			words[i] = col.word(val)
+		}
 	}
+	col.loadWords(words)
 
-	col.numItems = int64(len(vals))
+	hasNulls := false
+	for i, val := range vals {
+		if val.null {
+			col.markNull(int64(i))
+			hasNulls = true
+		}
+	}
+	// the zones were built with the placeholder words of the nulls
+	if hasNulls {
+		col.rebuildZones()
+		col.rebuildSorted()
+	}
+}
 
-	return nil
+func (col *column) loadWords(words []int64) {
+	if len(words) > len(col.data) {
+		col.data = make([]int64, 2*len(words))
+	}
+	for i, word := range words {
+		col.data[i] = word
+	}
+
+	col.numItems = int64(len(words))
+	col.validity = nil
+	col.rebuildZones()
+	col.rebuildSorted()
 }
 
 func (col *column) InsertItem(item int64) error {
 	col.lock.Lock()
 	defer col.lock.Unlock()
 
+	if err := col.checkItems([]int64{item}); err != nil {
+		return err
+	}
+
+	col.insertWord(item)
+	return nil
+}
+
+// InsertValue appends val, which must match the column type and
+// constraints.
+func (col *column) InsertValue(val Value) error {
+	col.lock.Lock()
+	defer col.lock.Unlock()
+
+	if err := col.checkValue(val); err != nil {
+		return err
+	}
+
+	col.insertValue(val)
+	return nil
+}
+
+func (col *column) insertWord(word int64) {
+	col.widenZone(col.numItems, word)
+	col.appendWord(word)
+	col.extendSorted()
+}
+
+// appendWord appends an item without widening its zone.
+func (col *column) appendWord(word int64) {
 	if int(col.numItems+1) > len(col.data) {
 		col.resizeData(int64(2 * len(col.data)))
 	}
-	col.data[int(col.numItems)] = item
+	col.data[int(col.numItems)] = word
+	if col.validity != nil {
+		col.validity.set(col.numItems)
+	}
 	col.numItems += 1
+}
 
-	return nil
+// insertNull appends a null item. The caller must hold the column lock.
+func (col *column) insertNull() {
+	col.appendWord(0)
+	col.markNull(col.numItems - 1)
+	col.extendSorted()
+}
+
+// insertValue appends a value that has already been checked. The caller
+// must hold the column lock.
+func (col *column) insertValue(val Value) {
+	if val.null {
+		col.insertNull()
+		return
+	}
+	col.insertWord(col.word(val))
+}
+
+// setValue overwrites the item at idx with a value that has already been
+// checked. The caller must hold the column lock.
+func (col *column) setValue(idx int64, val Value) {
+	if val.null {
+		col.data[idx] = 0
+		col.markNull(idx)
+	} else {
+		col.data[idx] = col.word(val)
+		col.widenZone(idx, col.data[idx])
+		if col.validity != nil {
+			col.validity.set(idx)
+		}
+	}
+	col.truncateSorted(idx)
+}
+
+// insertMissing appends n items for rows that omit the column: its default
+// if it has one and null otherwise. The caller must hold the column lock.
+func (col *column) insertMissing(n int64) {
+	val := col.def.missing()
+	for i := int64(0); i < n; i++ {
+		col.insertValue(val)
+	}
+}
+
+// markNull records that the item at idx is null, allocating the validity
+// bitmap on the first null.
+func (col *column) markNull(idx int64) {
+	if col.validity == nil {
+		col.validity = make(bitset, 0, (len(col.data)+63)/64)
+		col.validity.setRange(col.numItems)
+	}
+	col.validity.clear(idx)
+}
+
+// isNull reports whether the item at idx is null. The caller must hold the
+// column lock.
+func (col *column) isNull(idx int64) bool {
+	return col.validity != nil && !col.validity.test(idx)
+}
+
+// NullCount returns the number of null items in the column.
+func (col *column) NullCount() int64 {
+	col.lock.Lock()
+	defer col.lock.Unlock()
+
+	if col.validity == nil {
+		return 0
+	}
+	return col.numItems - col.validity.count(col.numItems)
+}
+
+// compact keeps only the items at the indexes keep, in that order,
+// returning the bytes of words and validity bitmap it freed. The caller
+// must hold the column lock.
+func (col *column) compact(keep []int64) int64 {
+	before := col.numItems + int64(len(col.validity))
+
+	// when keep is ascending every item moves down, never over one still
+	// to be read, but reordered items are read from a copy
+	src := col.data
+	if !slices.IsSorted(keep) {
+		src = slices.Clone(col.data[:col.numItems])
+	}
+	var validity bitset
+	hasNulls := false
+	for i, idx := range keep {
+		if col.isNull(idx) {
+			hasNulls = true
+		} else if col.validity != nil {
+			validity.set(int64(i))
+		}
+		col.data[i] = src[idx]
+	}
+	col.numItems = int64(len(keep))
+	col.validity = nil
+	if hasNulls {
+		col.validity = validity
+		// trailing null items leave their bitmap words unallocated
+		for int64(len(col.validity))<<6 < col.numItems {
+			col.validity = append(col.validity, 0)
+		}
+	}
+
+	if len(col.data) > defaultColumnSize && int64(len(col.data)) > 4*col.numItems {
+		col.resizeData(max(defaultColumnSize, 2*col.numItems))
+	}
+	col.rebuildZones()
+	col.rebuildSorted()
+	return (before - col.numItems - int64(len(col.validity))) * 8
+}
+
+// zone returns the zone of block b. The caller must hold the column lock.
+func (col *column) zone(b int64) zone {
+	if b < int64(len(col.zones)) {
+		return col.zones[b]
+	}
+	return emptyZone()
+}
+
+// widenZone widens the zone of the item at idx to hold word. The caller
+// must hold the column lock.
+func (col *column) widenZone(idx int64, word int64) {
+	b := idx / zoneSize
+	for int64(len(col.zones)) <= b {
+		col.zones = append(col.zones, emptyZone())
+	}
+	col.zones[b].widen(word)
+}
+
+// rebuildZones recomputes the zone map from the items, tightening the
+// bounds updates left loose. The caller must hold the column lock.
+func (col *column) rebuildZones() {
+	col.zones = make([]zone, (col.numItems+zoneSize-1)/zoneSize)
+	for b := range col.zones {
+		z := emptyZone()
+		for idx := int64(b) * zoneSize; idx < min(int64(b+1)*zoneSize, col.numItems); idx++ {
+			if !col.isNull(idx) {
+				z.widen(col.data[idx])
+			}
+		}
+		col.zones[b] = z
+	}
+}
+
+// PrunedBlocks returns the number of blocks of the column that selects
+// skipped because their zone could not match.
+func (col *column) PrunedBlocks() int64 {
+	col.lock.Lock()
+	defer col.lock.Unlock()
+
+	return col.prunedBlocks
 }
 
 func (col *column) resizeData(newLength int64) {
@@ -59,3 +385,32 @@ func (col *column) resizeData(newLength int64) {
 
 	col.data = newData
 }
+
+// word encodes val for storage, adding strings to the dictionary. The
+// caller must hold the column lock and have checked the type.
+func (col *column) word(val Value) int64 {
+	if col.typ != TypeString {
+		return val.fixedWord()
+	}
+
+	id, ok := col.dictIds[val.s]
+	if !ok {
+		id = int64(len(col.dict))
+		col.dict = append(col.dict, val.s)
+		col.dictIds[val.s] = id
+	}
+	return id
+}
+
+// value decodes the item at idx. The caller must hold the column lock.
+func (col *column) value(idx int64) Value {
+	if col.isNull(idx) {
+		return NullValue()
+	}
+
+	word := col.data[idx]
+	if col.typ == TypeString {
+		return StringValue(col.dict[word])
+	}
+	return fixedValue(col.typ, word)
+}
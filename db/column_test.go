@@ -1,7 +1,9 @@
 package db
 
 import (
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
@@ -91,3 +93,88 @@ func TestInsertItem(t *testing.T) {
 	assert.Equal(t, 2*(defaultColumnSize), len(col1.data))
 	assert.Equal(t, vals1, col1.data[0:defaultColumnSize+1])
 }
+
+func TestTypedColumn(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	floats := NewTypedColumn("floats", TypeFloat64)
+	assert.NoError(t, floats.LoadValues([]Value{Float64Value(1.5), Float64Value(-2)}))
+	assert.NoError(t, floats.InsertValue(Float64Value(0.25)))
+	assert.Equal(t, int64(3), floats.numItems)
+	assert.Equal(t, Float64Value(-2), floats.value(1))
+
+	strs := NewTypedColumn("strs", TypeString)
+	assert.NoError(t, strs.InsertValue(StringValue("a")))
+	assert.NoError(t, strs.InsertValue(StringValue("b")))
+	assert.NoError(t, strs.InsertValue(StringValue("a")))
+	assert.Equal(t, []string{"a", "b"}, strs.dict)
+	assert.Equal(t, []int64{0, 1, 0}, strs.data[:3])
+	assert.Equal(t, StringValue("b"), strs.value(1))
+
+	times := NewTypedColumn("times", TypeTimestamp)
+	assert.NoError(t, times.InsertValue(TimestampValue(ts)))
+	assert.Equal(t, ts, times.value(0).Time())
+
+	bools := NewTypedColumn("bools", TypeBool)
+	assert.NoError(t, bools.InsertValue(BoolValue(true)))
+	assert.True(t, bools.value(0).Bool())
+
+	// mismatched values are rejected without modifying the column
+	assert.ErrorContains(t, floats.InsertItem(1), "type mismatch: column floats has type float64, got int64")
+	assert.ErrorContains(t, floats.LoadColumn([]int64{1}), "type mismatch")
+	assert.ErrorContains(t, strs.LoadValues([]Value{StringValue("c"), Int64Value(1)}), "type mismatch")
+	assert.ErrorContains(t, bools.InsertValue(StringValue("true")), "type mismatch")
+	assert.Equal(t, int64(3), floats.numItems)
+	assert.Equal(t, int64(3), strs.numItems)
+}
+
+func TestColumnNulls(t *testing.T) {
+	col := NewColumn("col1")
+	assert.NoError(t, col.InsertItem(0))
+	assert.NoError(t, col.InsertValue(NullValue()))
+	assert.NoError(t, col.InsertItem(2))
+
+	assert.False(t, col.isNull(0))
+	assert.True(t, col.isNull(1))
+	assert.False(t, col.isNull(2))
+	assert.Equal(t, int64(1), col.NullCount())
+	assert.Equal(t, Int64Value(0), col.value(0))
+	assert.True(t, col.value(1).IsNull())
+
+	strs := NewTypedColumn("strs", TypeString)
+	assert.NoError(t, strs.LoadValues([]Value{StringValue("a"), NullValue(), NullValue()}))
+	assert.Equal(t, int64(2), strs.NullCount())
+	assert.Equal(t, []string{"a"}, strs.dict)
+
+	// loading plain values clears previous nulls
+	assert.NoError(t, col.LoadColumn([]int64{1, 2}))
+	assert.Equal(t, int64(0), col.NullCount())
+}
+
+func TestColumnZones(t *testing.T) {
+	col := NewColumn("col1")
+	for i := range int64(2*zoneSize + 10) {
+		assert.NoError(t, col.InsertItem(i))
+	}
+	assert.Equal(t, []zone{{0, zoneSize - 1}, {zoneSize, 2*zoneSize - 1}, {2 * zoneSize, 2*zoneSize + 9}}, col.zones)
+
+	// nulls do not widen a zone and a block of nulls has an empty zone
+	assert.NoError(t, col.InsertValue(NullValue()))
+	assert.Equal(t, zone{2 * zoneSize, 2*zoneSize + 9}, col.zones[2])
+	assert.Equal(t, emptyZone(), col.zone(3))
+	assert.False(t, col.zone(3).overlaps(math.MinInt64, math.MaxInt64))
+
+	// updates widen zones, which rebuilding tightens again
+	col.setValue(5, Int64Value(-100))
+	col.setValue(6, NullValue())
+	assert.Equal(t, zone{-100, zoneSize - 1}, col.zones[0])
+	col.setValue(5, Int64Value(5))
+	col.rebuildZones()
+	assert.Equal(t, zone{0, zoneSize - 1}, col.zones[0])
+
+	vals := []Value{NullValue(), Int64Value(7), Int64Value(-3)}
+	assert.NoError(t, col.LoadValues(vals))
+	assert.Equal(t, []zone{{-3, 7}}, col.zones)
+	col.compact([]int64{0})
+	assert.Equal(t, []zone{emptyZone()}, col.zones)
+}
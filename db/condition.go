@@ -1,68 +1,259 @@
 package db
 
 import (
-	"sort"
+	"fmt"
+	"math"
 	"sync"
 )
 
+// condition is the set of row ids matched by selects, kept as a compressed
+// bitmap so that combining conditions works a word at a time and matching
+// ids always come out in ascending order.
 type condition struct {
-	ids        map[int64]bool
-	numResults int
-	cols       []string
+	ids  *rowBitmap
+	cols []string
+	// generation is the table generation Filter matched the ids in, or 0.
+	generation uint64
 	lock       sync.RWMutex
 }
 
 func NewCondition() *condition {
 	return &condition{
-		numResults: 0,
-		ids:        make(map[int64]bool),
+		ids: newRowBitmap(),
 	}
 }
 
-// Get will fetch the ids that match the condition in the provided column names.
-func (c *condition) Get(cols []*column) [][]int64 {
+// NumResults returns the number of matching ids.
+func (c *condition) NumResults() int {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 
-	if c.numResults == 0 {
-		return [][]int64{}
+	return c.ids.cardinality()
+}
+
+// Get will fetch the ids that match the condition in the provided column
+// names. Every column must hold int64 values and matching items must not be
+// null; use GetValues for other types and nullable results.
+func (c *condition) Get(cols []*column) ([][]int64, error) {
+	for _, col := range cols {
+		if err := col.checkType(TypeInt64); err != nil {
+			return nil, fmt.Errorf("Get: %w", err)
+		}
 	}
 
-	sortedIds := make([]int64, len(c.ids))
-	i := 0
-	for key := range c.ids {
-		sortedIds[i] = key
-		i += 1
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	numResults := c.ids.cardinality()
+	if numResults == 0 {
+		return [][]int64{}, nil
 	}
-	sort.Slice(sortedIds, func(i, j int) bool { return sortedIds[i] < sortedIds[j] })
 
 	res := make([][]int64, len(cols))
 	for k, col := range cols {
-		colRes := make([]int64, c.numResults)
-		for i := 0; i < c.numResults; i++ {
-			resIdx := sortedIds[i]
-			colRes[i] = col.data[resIdx]
+		col.lock.Lock()
+		colRes := make([]int64, 0, numResults)
+		var err error
+		c.ids.forEach(func(resIdx int64) bool {
+			if col.isNull(resIdx) {
+				err = fmt.Errorf("Get: column %s is null at row %d, use GetValues to fetch nulls", col.name, resIdx)
+				return false
+			}
+			colRes = append(colRes, col.data[resIdx])
+			return true
+		})
+		col.lock.Unlock()
+		if err != nil {
+			return nil, err
 		}
 		res[k] = colRes
 	}
 
+	return res, nil
+}
+
+// GetValues is like Get but decodes the matching items of columns of any
+// type, returning null items as null Values.
+func (c *condition) GetValues(cols []*column) [][]Value {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	numResults := c.ids.cardinality()
+	if numResults == 0 {
+		return [][]Value{}
+	}
+
+	res := make([][]Value, len(cols))
+	for k, col := range cols {
+		col.lock.Lock()
+		colRes := make([]Value, 0, numResults)
+		c.ids.forEach(func(resIdx int64) bool {
+			colRes = append(colRes, col.value(resIdx))
+			return true
+		})
+		col.lock.Unlock()
+		res[k] = colRes
+	}
+
 	return res
 }
 
-func (c *condition) Select(col *column, lower int64, upper int64) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+// Select adds the ids of items in [lower, upper) of an int64 column. Null
+// items never match.
+func (c *condition) Select(col *column, lower int64, upper int64) error {
+	if err := col.checkType(TypeInt64); err != nil {
+		return fmt.Errorf("Select: %w", err)
+	}
+
+	lowerKey, upperKey := btreeKey{word: lower}, btreeKey{word: upper}
+	ranges := []keyRange{{lower: &lowerKey, upper: &upperKey, upperExclusive: true}}
+	c.selectWords(col, ranges, func(z zone) bool {
+		return z.lo < upper && z.hi >= lower
+	}, func(word int64) bool {
+		return word >= lower && word < upper
+	})
+	return nil
+}
 
+// SelectValues adds the ids of items in [lower, upper) of a column of any
+// type. Both bounds must match the column type.
+func (c *condition) SelectValues(col *column, lower Value, upper Value) error {
+	if err := checkRange(col, lower, upper); err != nil {
+		return err
+	}
+
+	lowerKey, upperKey := btreeKeyOf(lower), btreeKeyOf(upper)
+	ranges := []keyRange{{lower: &lowerKey, upper: &upperKey, upperExclusive: true}}
+	if col.typ != TypeString {
+		lowerWord, upperWord := lower.fixedWord(), upper.fixedWord()
+		c.selectWords(col, ranges, func(z zone) bool {
+			return z.lo < upperWord && z.hi >= lowerWord
+		}, func(word int64) bool {
+			return word >= lowerWord && word < upperWord
+		})
+		return nil
+	}
+
+	c.selectStrings(col, ranges, func(s string) bool {
+		return s >= lower.s && s < upper.s
+	})
+	return nil
+}
+
+// checkRange validates the bounds of a range select on col.
+func checkRange(col *column, lower Value, upper Value) error {
+	for _, bound := range []Value{lower, upper} {
+		if bound.null {
+			return fmt.Errorf("Select: bounds of column %s must not be null", col.name)
+		}
+		if err := col.checkType(bound.typ); err != nil {
+			return fmt.Errorf("Select: %w", err)
+		}
+	}
+	return nil
+}
+
+// SelectWhere adds the ids of the items of col that match p. The operands
+// of p must match the column type.
+func (c *condition) SelectWhere(col *column, p Predicate) error {
+	if err := p.check(col); err != nil {
+		return err
+	}
+
+	// Ne has no ranges and scans every item
+	ranges, _ := predicateRanges(p)
+	if col.typ != TypeString {
+		c.selectWords(col, ranges, p.zoneMatcher(), p.wordMatcher())
+		return nil
+	}
+
+	c.selectStrings(col, ranges, func(s string) bool {
+		val := StringValue(s)
+		return p.test(func(i int) int {
+			return val.Compare(p.vals[i])
+		})
+	})
+	return nil
+}
+
+// SelectNull adds the ids of null items, i.e. IS NULL.
+func (c *condition) SelectNull(col *column) {
+	c.selectItems(col, nil, nil, func(idx int64) bool {
+		return col.isNull(idx)
+	})
+}
+
+// SelectNotNull adds the ids of items that are not null, i.e. IS NOT NULL.
+func (c *condition) SelectNotNull(col *column) {
+	c.selectItems(col, nil, nil, func(idx int64) bool {
+		return !col.isNull(idx)
+	})
+}
+
+// selectStrings adds the ids of the items of a string column whose value
+// matches. Strings are compared once per dictionary entry rather than per
+// item, and blocks are skipped unless their zone overlaps the ids of the
+// matching entries.
+func (c *condition) selectStrings(col *column, ranges []keyRange, match func(s string) bool) {
 	col.lock.Lock()
-	defer col.lock.Unlock()
+	matches := make([]bool, len(col.dict))
+	lo, hi := int64(math.MaxInt64), int64(math.MinInt64)
+	for id, s := range col.dict {
+		if matches[id] = match(s); matches[id] {
+			lo, hi = min(lo, int64(id)), max(hi, int64(id))
+		}
+	}
+	col.lock.Unlock()
 
-	for i := 0; i < int(col.numItems); i++ {
-		item := col.data[i]
-		if item >= lower && item < upper {
-			c.ids[int64(i)] = true
-			c.numResults += 1
+	c.selectWords(col, ranges, func(z zone) bool {
+		return z.overlaps(lo, hi)
+	}, func(word int64) bool {
+		return word < int64(len(matches)) && matches[word]
+	})
+}
+
+func (c *condition) selectWords(col *column, ranges []keyRange, mayMatch func(z zone) bool, match func(word int64) bool) {
+	c.selectItems(col, ranges, mayMatch, func(idx int64) bool {
+		return !col.isNull(idx) && match(col.data[idx])
+	})
+}
+
+// selectItems adds the ids of the items of col for which match returns true.
+// If ranges is not nil, they hold every value match accepts, and the sorted
+// items of a clustered column are binary searched for them rather than
+// scanned. Blocks whose zone mayMatch rejects are skipped, unless mayMatch
+// is nil. Matches are gathered into words of 64 ids, which are merged into
+// the condition a chunk at a time. match is called with the column lock
+// held.
+func (c *condition) selectItems(col *column, ranges []keyRange, mayMatch func(z zone) bool, match func(idx int64) bool) {
+	col.lock.Lock()
+	matched := newRowBitmap()
+	from := int64(0)
+	if ranges != nil && col.clustered {
+		matched, from = col.searchSorted(ranges), col.sorted
+	}
+	bb := newBitmapBuilder()
+	for start := from / zoneSize * zoneSize; max(start, from) < col.numItems; start += zoneSize {
+		if mayMatch != nil && !mayMatch(col.zone(start/zoneSize)) {
+			col.prunedBlocks++
+			continue
+		}
+		for base, end := max(start, from/64*64), min(start+zoneSize, col.numItems); base < end; base += 64 {
+			var word uint64
+			for i, n := max(0, from-base), min(64, end-base); i < n; i++ {
+				if match(base + i) {
+					word |= 1 << i
+				}
+			}
+			bb.addWord(base, word)
 		}
 	}
+	col.lock.Unlock()
+
+	matched = matched.or(bb.bitmap())
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ids = c.ids.or(matched)
 }
 
 func (c *condition) Or(newCond *condition) {
@@ -76,12 +267,7 @@ func (c *condition) Or(newCond *condition) {
 
 	newCond.lock.RLock()
 	defer newCond.lock.RUnlock()
-	for newId := range newCond.ids {
-		if _, ok := c.ids[newId]; !ok {
-			c.ids[newId] = true
-			c.numResults += 1
-		}
-	}
+	c.ids = c.ids.or(newCond.ids)
 }
 
 func (c *condition) And(newCond *condition) {
@@ -95,10 +281,5 @@ func (c *condition) And(newCond *condition) {
 
 	newCond.lock.RLock()
 	defer newCond.lock.RUnlock()
-	for id := range c.ids {
-		if _, ok := newCond.ids[id]; !ok {
-			delete(c.ids, id)
-			c.numResults -= 1
-		}
-	}
+	c.ids = c.ids.and(newCond.ids)
 }
@@ -2,6 +2,8 @@ package db
 
 import (
 	"fmt"
+	"math/rand"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -45,12 +47,13 @@ func TestCondition(t *testing.T) {
 
 		expectIds := []int64{1, 2, 3, 4}
 		actualIds := []int64{}
-		for key := range c.ids {
+		for key := range c.ids.All() {
 			actualIds = append(actualIds, key)
 		}
 		assert.ElementsMatch(t, expectIds, actualIds)
 		expectVals := [][]int64{vals2[1:5]}
-		actualVals := c.Get([]*column{col2})
+		actualVals, err := c.Get([]*column{col2})
+		assert.NoError(t, err)
 
 		assert.EqualValues(t, expectVals, actualVals)
 	})
@@ -60,7 +63,7 @@ func TestCondition(t *testing.T) {
 		c2.Select(col2, 30, 81)
 		expectIds := []int64{5, 6, 7}
 		actualIds := []int64{}
-		for key := range c2.ids {
+		for key := range c2.ids.All() {
 			actualIds = append(actualIds, key)
 		}
 		assert.ElementsMatch(t, expectIds, actualIds)
@@ -68,12 +71,13 @@ func TestCondition(t *testing.T) {
 		c.Or(c2)
 		expectIds = []int64{1, 2, 3, 4, 5, 6, 7}
 		actualIds = []int64{}
-		for key := range c.ids {
+		for key := range c.ids.All() {
 			actualIds = append(actualIds, key)
 		}
 		assert.ElementsMatch(t, expectIds, actualIds)
 		expectVals := [][]int64{vals1[1:8], vals2[1:8]}
-		actualVals := c.Get([]*column{col1, col2})
+		actualVals, err := c.Get([]*column{col1, col2})
+		assert.NoError(t, err)
 
 		assert.EqualValues(t, expectVals, actualVals)
 	})
@@ -82,13 +86,239 @@ func TestCondition(t *testing.T) {
 		c.And(c2)
 		expectIds := []int64{5, 6, 7}
 		actualIds := []int64{}
-		for key := range c2.ids {
+		for key := range c2.ids.All() {
 			actualIds = append(actualIds, key)
 		}
 		assert.ElementsMatch(t, expectIds, actualIds)
 		expectVals := [][]int64{vals1[5:8], vals2[5:8]}
-		actualVals := c.Get([]*column{col1, col2})
+		actualVals, err := c.Get([]*column{col1, col2})
+		assert.NoError(t, err)
 
 		assert.EqualValues(t, expectVals, actualVals)
 	})
 }
+
+func TestConditionTyped(t *testing.T) {
+	tbl := NewTable()
+	err := tbl.LoadValues([]string{"price", "name"},
+		[]Value{Float64Value(-1.5), Float64Value(0), Float64Value(2.25), Float64Value(10)},
+		[]Value{StringValue("pear"), StringValue("apple"), StringValue("fig"), StringValue("apple")})
+	assert.NoError(t, err)
+
+	price := tbl.cols["price"]
+	name := tbl.cols["name"]
+
+	c := NewCondition()
+	assert.NoError(t, c.SelectValues(price, Float64Value(-2), Float64Value(2.25)))
+	assert.Equal(t, [][]Value{{StringValue("pear"), StringValue("apple")}}, c.GetValues([]*column{name}))
+
+	c2 := NewCondition()
+	assert.NoError(t, c2.SelectValues(name, StringValue("b"), StringValue("g")))
+	assert.Equal(t, [][]Value{{Float64Value(2.25)}}, c2.GetValues([]*column{price}))
+
+	assert.ErrorContains(t, c.Select(price, 0, 1), "type mismatch")
+	assert.ErrorContains(t, c.SelectValues(name, StringValue("a"), Int64Value(1)), "type mismatch")
+
+	_, err = c.Get([]*column{price})
+	assert.ErrorContains(t, err, "column price has type float64")
+}
+
+func TestConditionNulls(t *testing.T) {
+	tbl := NewTable()
+	_, err := tbl.CreateColumn("col1")
+	assert.NoError(t, err)
+	_, err = tbl.CreateColumn("col2")
+	assert.NoError(t, err)
+
+	assert.NoError(t, tbl.InsertRow([]string{"col1", "col2"}, []int64{0, 10}))
+	assert.NoError(t, tbl.InsertRow([]string{"col2"}, []int64{20}))
+	assert.NoError(t, tbl.InsertRow([]string{"col1", "col2"}, []int64{2, 30}))
+
+	col1 := tbl.cols["col1"]
+	col2 := tbl.cols["col2"]
+
+	t.Run("select ignores nulls", func(t *testing.T) {
+		c := NewCondition()
+		assert.NoError(t, c.Select(col1, -10, 10))
+		res, err := c.Get([]*column{col2})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]int64{{10, 30}}, res)
+	})
+
+	t.Run("is null", func(t *testing.T) {
+		c := NewCondition()
+		c.SelectNull(col1)
+		res, err := c.Get([]*column{col2})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]int64{{20}}, res)
+
+		_, err = c.Get([]*column{col1})
+		assert.ErrorContains(t, err, "column col1 is null at row 1")
+		assert.Equal(t, [][]Value{{NullValue()}}, c.GetValues([]*column{col1}))
+	})
+
+	t.Run("is not null", func(t *testing.T) {
+		c := NewCondition()
+		c.SelectNotNull(col1)
+		assert.Equal(t, [][]Value{{Int64Value(0), Int64Value(2)}}, c.GetValues([]*column{col1}))
+	})
+
+	t.Run("null bounds", func(t *testing.T) {
+		c := NewCondition()
+		assert.ErrorContains(t, c.SelectValues(col1, NullValue(), Int64Value(1)), "must not be null")
+	})
+}
+
+const benchRows = 1 << 20
+
+func benchColumn(b *testing.B) *column {
+	col := NewColumn("col1")
+	vals := make([]int64, benchRows)
+	rng := rand.New(rand.NewSource(1))
+	for i := range vals {
+		vals[i] = rng.Int63n(100)
+	}
+	assert.NoError(b, col.LoadColumn(vals))
+	return col
+}
+
+// mapSelect is the map[int64]bool representation conditions used before
+// bitmaps, kept as the baseline for the benchmarks.
+func mapSelect(col *column, lower int64, upper int64) map[int64]bool {
+	ids := make(map[int64]bool)
+	for i := int64(0); i < col.numItems; i++ {
+		if word := col.data[i]; word >= lower && word < upper {
+			ids[i] = true
+		}
+	}
+	return ids
+}
+
+func mapSortedIds(ids map[int64]bool) []int64 {
+	sorted := make([]int64, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func BenchmarkConditionSelect(b *testing.B) {
+	col := benchColumn(b)
+	b.Run("bitmap", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			c := NewCondition()
+			assert.NoError(b, c.Select(col, 0, 50))
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			mapSelect(col, 0, 50)
+		}
+	})
+}
+
+func BenchmarkConditionAndOr(b *testing.B) {
+	col := benchColumn(b)
+	b.Run("bitmap", func(b *testing.B) {
+		c1, c2 := NewCondition(), NewCondition()
+		assert.NoError(b, c1.Select(col, 0, 50))
+		assert.NoError(b, c2.Select(col, 25, 75))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			c1.ids.and(c2.ids)
+			c1.ids.or(c2.ids)
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		ids1, ids2 := mapSelect(col, 0, 50), mapSelect(col, 25, 75)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			and := make(map[int64]bool)
+			for id := range ids1 {
+				if ids2[id] {
+					and[id] = true
+				}
+			}
+			or := make(map[int64]bool, len(ids1))
+			for id := range ids1 {
+				or[id] = true
+			}
+			for id := range ids2 {
+				or[id] = true
+			}
+		}
+	})
+}
+
+func BenchmarkConditionGet(b *testing.B) {
+	col := benchColumn(b)
+	b.Run("bitmap", func(b *testing.B) {
+		c := NewCondition()
+		assert.NoError(b, c.Select(col, 0, 50))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_, err := c.Get([]*column{col})
+			assert.NoError(b, err)
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		ids := mapSelect(col, 0, 50)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sorted := mapSortedIds(ids)
+			res := make([]int64, len(sorted))
+			for j, id := range sorted {
+				res[j] = col.data[id]
+			}
+		}
+	})
+}
+
+func TestConditionZones(t *testing.T) {
+	vals := make([]int64, 10*zoneSize)
+	for i := range vals {
+		vals[i] = int64(i / 10)
+	}
+	tbl := setupTable(t, [][]int64{vals})
+	col := tbl.cols["col1"]
+
+	c := NewCondition()
+	assert.NoError(t, c.Select(col, 150, 250))
+	assert.Equal(t, 1000, c.NumResults())
+	assert.Equal(t, int64(8), col.PrunedBlocks())
+
+	// a range spanning two blocks reads both
+	c = NewCondition()
+	assert.NoError(t, c.SelectWhere(col, Between(Int64Value(100), Int64Value(103))))
+	assert.Equal(t, 40, c.NumResults())
+	assert.Equal(t, int64(16), col.PrunedBlocks())
+	c = NewCondition()
+	assert.NoError(t, c.SelectWhere(col, In(Int64Value(5), NullValue(), Int64Value(2000))))
+	assert.Equal(t, 10, c.NumResults())
+	assert.Equal(t, int64(25), col.PrunedBlocks())
+
+	// predicates with no bounds read every block
+	c = NewCondition()
+	assert.NoError(t, c.SelectWhere(col, Ne(Int64Value(5))))
+	assert.Equal(t, 10*zoneSize-10, c.NumResults())
+	c.SelectNotNull(col)
+	assert.Equal(t, int64(25), col.PrunedBlocks())
+
+	// string blocks are pruned by the dictionary ids of matching values
+	strs := NewTypedColumn("strs", TypeString)
+	for i := range 3 * zoneSize {
+		assert.NoError(t, strs.InsertValue(StringValue(fmt.Sprintf("day%d", i/zoneSize))))
+	}
+	c = NewCondition()
+	assert.NoError(t, c.SelectValues(strs, StringValue("day1"), StringValue("day2")))
+	assert.Equal(t, zoneSize, c.NumResults())
+	assert.Equal(t, int64(2), strs.PrunedBlocks())
+	c = NewCondition()
+	assert.NoError(t, c.SelectWhere(strs, Eq(StringValue("none"))))
+	assert.Equal(t, 0, c.NumResults())
+	assert.Equal(t, int64(5), strs.PrunedBlocks())
+
+	assert.Equal(t, int64(25), tbl.Stats().Columns[0].PrunedBlocks)
+	assert.Equal(t, int64(10), tbl.Stats().Columns[0].Blocks)
+}
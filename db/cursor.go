@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"iter"
+)
+
+// cursorBatch is the number of rows Next reads at a time.
+const cursorBatch = 1024
+
+// Cursor iterates over the rows of a condition, reading a vector of rows
+// at a time so a scan never holds the whole result:
+//
+//	cur, err := tbl.Cursor(ctx, c, cols)
+//	defer cur.Close()
+//	for cur.Next() {
+//		row := cur.Row()
+//	}
+//	err = cur.Err()
+//
+// The matched ids are fixed when the cursor opens, but the items are read
+// as the cursor reaches them, so a row deleted before then is skipped and
+// an update is seen. A vacuum renumbers the rows, after which the cursor
+// stops with an error. A cursor must be closed unless it ran to the end.
+type Cursor struct {
+	ctx  context.Context
+	tbl  *table
+	cols []*column
+	// generation is the table generation the ids were matched in.
+	generation uint64
+	next       func() (int64, bool)
+	stop       func()
+	// rows are the rows read ahead of Next, from rows[pos] on.
+	rows [][]Value
+	pos  int
+	row  []Value
+	err  error
+	done bool
+}
+
+// Cursor opens a cursor over the items of cols in the live rows c matches,
+// in row order. It stops with ctx.Err() once ctx is done.
+func (tbl *table) Cursor(ctx context.Context, c *condition, cols []*column) (*Cursor, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	for _, col := range cols {
+		if tbl.cols[col.name] != col {
+			return nil, fmt.Errorf("Could not fetch column %s: column not found", col.name)
+		}
+	}
+	if err := tbl.checkGeneration(c); err != nil {
+		return nil, err
+	}
+
+	c.lock.RLock()
+	ids := c.ids.andNot(tbl.deletes)
+	c.lock.RUnlock()
+
+	next, stop := iter.Pull(ids.All())
+	return &Cursor{ctx: ctx, tbl: tbl, cols: cols, generation: tbl.generation, next: next, stop: stop}, nil
+}
+
+// Next advances to the next row, returning false at the end of the rows or
+// on an error, which Err reports.
+func (cur *Cursor) Next() bool {
+	if cur.pos >= len(cur.rows) {
+		cur.rows, cur.pos = cur.read(cursorBatch), 0
+		if len(cur.rows) == 0 {
+			cur.row = nil
+			return false
+		}
+	}
+	cur.row = cur.rows[cur.pos]
+	cur.pos++
+	return true
+}
+
+// Row returns the items of the current row, one per column.
+func (cur *Cursor) Row() []Value {
+	return cur.row
+}
+
+// NextBatch returns up to n of the next rows, each holding one item per
+// column. It returns no rows at the end of the rows or on an error, which
+// Err reports.
+func (cur *Cursor) NextBatch(n int) [][]Value {
+	cur.row = nil
+	if n <= 0 {
+		return nil
+	}
+	batch := cur.rows[cur.pos:min(cur.pos+n, len(cur.rows))]
+	cur.pos += len(batch)
+	if len(batch) < n {
+		batch = append(batch[:len(batch):len(batch)], cur.read(n-len(batch))...)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return batch
+}
+
+// Err returns the error that stopped the cursor, if any.
+func (cur *Cursor) Err() error {
+	return cur.err
+}
+
+// Close stops the cursor. It is safe to call more than once.
+func (cur *Cursor) Close() error {
+	cur.finish()
+	cur.rows, cur.pos, cur.row = nil, 0, nil
+	return nil
+}
+
+func (cur *Cursor) finish() {
+	if !cur.done {
+		cur.done = true
+		cur.stop()
+	}
+}
+
+func (cur *Cursor) fail(err error) {
+	cur.err = err
+	cur.finish()
+}
+
+// read reads up to n rows with the table locked, a column at a time.
+func (cur *Cursor) read(n int) [][]Value {
+	if cur.done {
+		return nil
+	}
+	if err := cur.ctx.Err(); err != nil {
+		cur.fail(err)
+		return nil
+	}
+
+	tbl := cur.tbl
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	if tbl.generation != cur.generation {
+		cur.fail(fmt.Errorf("Cannot read cursor: the table was vacuumed after it opened"))
+		return nil
+	}
+	for _, col := range cur.cols {
+		if tbl.cols[col.name] != col {
+			cur.fail(fmt.Errorf("Could not fetch column %s: column deleted", col.name))
+			return nil
+		}
+	}
+
+	var ids []int64
+	for len(ids) < n {
+		if len(ids)%cursorBatch == cursorBatch-1 {
+			if err := cur.ctx.Err(); err != nil {
+				cur.fail(err)
+				return nil
+			}
+		}
+		id, ok := cur.next()
+		if !ok || id >= tbl.numRows {
+			cur.finish()
+			break
+		}
+		if !tbl.deletes.contains(id) {
+			ids = append(ids, id)
+		}
+	}
+
+	k := len(cur.cols)
+	items := make([]Value, len(ids)*k)
+	rows := make([][]Value, len(ids))
+	for i := range rows {
+		rows[i] = items[i*k : (i+1)*k : (i+1)*k]
+	}
+	for j, col := range cur.cols {
+		col.lock.Lock()
+		for i, id := range ids {
+			rows[i][j] = col.value(id)
+		}
+		col.lock.Unlock()
+	}
+	return rows
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor(t *testing.T) {
+	tbl := NewTable()
+	n, err := tbl.CreateColumn("n")
+	require.NoError(t, err)
+	sq, err := tbl.CreateColumn("sq")
+	require.NoError(t, err)
+	rows := make([][]int64, 3000)
+	for i := range rows {
+		rows[i] = []int64{int64(i), int64(i * i)}
+	}
+	require.NoError(t, tbl.InsertRows([]string{"n", "sq"}, rows))
+	c, err := tbl.Select(n, 1000, 2500)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("next", func(t *testing.T) {
+		cur, err := tbl.Cursor(ctx, c, []*column{n, sq})
+		require.NoError(t, err)
+		defer cur.Close()
+		expect := int64(1000)
+		for cur.Next() {
+			assert.Equal(t, []Value{Int64Value(expect), Int64Value(expect * expect)}, cur.Row())
+			expect++
+		}
+		assert.NoError(t, cur.Err())
+		assert.Equal(t, int64(2500), expect)
+		assert.False(t, cur.Next())
+		assert.Nil(t, cur.Row())
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		cur, err := tbl.Cursor(ctx, c, []*column{sq})
+		require.NoError(t, err)
+		defer cur.Close()
+		require.True(t, cur.Next())
+		assert.Equal(t, []Value{Int64Value(1000 * 1000)}, cur.Row())
+
+		// a batch takes the rows Next read ahead first
+		batch := cur.NextBatch(1200)
+		require.Len(t, batch, 1200)
+		assert.Equal(t, []Value{Int64Value(1001 * 1001)}, batch[0])
+		assert.Equal(t, []Value{Int64Value(2200 * 2200)}, batch[1199])
+		assert.Len(t, cur.NextBatch(1000), 299)
+		assert.Nil(t, cur.NextBatch(10))
+		assert.NoError(t, cur.Err())
+	})
+
+	t.Run("writes after open", func(t *testing.T) {
+		cur, err := tbl.Cursor(ctx, c, []*column{n})
+		require.NoError(t, err)
+		defer cur.Close()
+		require.NoError(t, tbl.DeleteRows([]int64{1001}))
+		batch := cur.NextBatch(2)
+		assert.Equal(t, [][]Value{{Int64Value(1000)}, {Int64Value(1002)}}, batch)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cur, err := tbl.Cursor(cancelCtx, c, []*column{n})
+		require.NoError(t, err)
+		defer cur.Close()
+		require.True(t, cur.Next())
+		cancel()
+		// the rows read ahead are still returned, then the cursor stops
+		for cur.Next() {
+		}
+		assert.ErrorIs(t, cur.Err(), context.Canceled)
+		assert.Nil(t, cur.NextBatch(1))
+	})
+
+	t.Run("close", func(t *testing.T) {
+		cur, err := tbl.Cursor(ctx, c, []*column{n})
+		require.NoError(t, err)
+		require.True(t, cur.Next())
+		assert.NoError(t, cur.Close())
+		assert.NoError(t, cur.Close())
+		assert.False(t, cur.Next())
+		assert.NoError(t, cur.Err())
+	})
+
+	t.Run("deleted column", func(t *testing.T) {
+		other := NewTable()
+		col, err := other.CreateColumn("x")
+		require.NoError(t, err)
+		require.NoError(t, other.InsertRow([]string{"x"}, []int64{1}))
+		cur, err := other.Cursor(ctx, other.Not(NewCondition()), []*column{col})
+		require.NoError(t, err)
+		defer cur.Close()
+		require.NoError(t, other.DeleteColumn("x"))
+		assert.False(t, cur.Next())
+		assert.EqualError(t, cur.Err(), "Could not fetch column x: column deleted")
+
+		_, err = other.Cursor(ctx, NewCondition(), []*column{col})
+		assert.EqualError(t, err, "Could not fetch column x: column not found")
+	})
+
+	t.Run("vacuum", func(t *testing.T) {
+		other := NewTable()
+		col, err := other.CreateColumn("x")
+		require.NoError(t, err)
+		require.NoError(t, other.InsertRows([]string{"x"}, [][]int64{{1}, {2}}))
+		filtered, err := other.Filter(Match("x", Eq(Int64Value(2))))
+		require.NoError(t, err)
+		cur, err := other.Cursor(ctx, other.Not(NewCondition()), []*column{col})
+		require.NoError(t, err)
+		defer cur.Close()
+		require.NoError(t, other.DeleteRows([]int64{0}))
+		_, err = other.Vacuum()
+		require.NoError(t, err)
+		assert.False(t, cur.Next())
+		assert.EqualError(t, cur.Err(), "Cannot read cursor: the table was vacuumed after it opened")
+
+		_, err = other.Cursor(ctx, filtered, []*column{col})
+		assert.ErrorContains(t, err, "the table was vacuumed after it was filtered")
+	})
+}
@@ -2,68 +2,139 @@ package db
 
 import (
 	"fmt"
+	"sort"
 	"sync"
-
-	"go.uber.org/multierr"
 )
 
 type db struct {
+	name      string
 	tables    map[string]*table
 	numTables int64
-	lock      sync.Mutex
+	// dropped is set once the db is deleted, like table.dropped.
+	dropped bool
+	wal     *wal
+	lock    sync.Mutex
 }
 
 func NewDb() *db {
+	return newDb("", nil)
+}
+
+func newDb(name string, w *wal) *db {
 	return &db{
+		name:      name,
 		tables:    make(map[string]*table),
 		numTables: 0,
+		wal:       w,
+	}
+}
+
+func (db *db) CreateTable(tblName string, opts ...TableOption) (*table, error) {
+	var cfg tableConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var tbl *table
+	err := db.wal.logged(func() (int64, error) {
+		db.lock.Lock()
+		defer db.lock.Unlock()
+		if _, ok := db.tables[tblName]; ok {
+			return 0, fmt.Errorf("Can't create db with name %s: Table %w", tblName, ErrAlreadyExists)
+		}
+
+		return db.logAndApply(&walRecord{op: walCreateTable, dbName: db.name, tblName: tblName, schema: cfg.schema}, func() {
+			tbl = newTable(db.name, tblName, db.wal, cfg)
+			db.tables[tblName] = tbl
+			db.numTables += 1
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tbl, nil
+}
+
+// logAndApply appends rec to the write-ahead log and only then applies a
+// validated write. The caller must hold the db lock.
+func (db *db) logAndApply(rec *walRecord, apply func()) (int64, error) {
+	if db.dropped {
+		return 0, fmt.Errorf("Cannot write to db %s: %w", db.name, ErrNotExist)
 	}
+	return db.wal.logAndApply(rec, apply)
 }
 
-func (db *db) CreateTable(tblName string) (*table, error) {
+func (db *db) GetTable(tblName string) (*table, error) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
-	if _, ok := db.tables[tblName]; ok {
-		return nil, fmt.Errorf("Can't create db with name %s: Table already exists", tblName)
-	}
 
-	tbl := NewTable()
-	db.tables[tblName] = tbl
-	db.numTables += 1
+	tbl, ok := db.tables[tblName]
+	if !ok {
+		return nil, fmt.Errorf("Cannot get table with name %s: %w", tblName, ErrNotExist)
+	}
 	return tbl, nil
 }
-func (db *db) DeleteTable(tblName string) error {
+
+// TableNames returns the names of all tables in sorted order.
+func (db *db) TableNames() []string {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
-	return db.DeleteTableInternal(tblName)
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (db *db) DeleteTable(tblName string) error {
+	return db.wal.logged(func() (int64, error) {
+		db.lock.Lock()
+		defer db.lock.Unlock()
+
+		if _, ok := db.tables[tblName]; !ok {
+			return 0, fmt.Errorf("Cannot delete table with name %s: %w", tblName, ErrNotExist)
+		}
+		return db.logAndApply(&walRecord{op: walDeleteTable, dbName: db.name, tblName: tblName}, func() {
+			db.dropTable(tblName)
+		})
+	})
 }
 
 func (db *db) DeleteTableInternal(tblName string) error {
 	if _, ok := db.tables[tblName]; !ok {
-		return fmt.Errorf("Cannot delete table with name %s: does not exist", tblName)
+		return fmt.Errorf("Cannot delete table with name %s: %w", tblName, ErrNotExist)
 	}
+	db.dropTable(tblName)
+	return nil
+}
 
-	err := db.tables[tblName].DeleteColumns()
-	if err != nil {
-		return fmt.Errorf("Cannot delete table with name %s: %v", tblName, err)
-	}
+// dropTable removes the existing table tblName. The caller must hold the
+// db lock.
+func (db *db) dropTable(tblName string) {
+	tbl := db.tables[tblName]
+	tbl.lock.Lock()
+	tbl.dropColumns()
+	tbl.dropped = true
+	tbl.lock.Unlock()
 
 	delete(db.tables, tblName)
 	db.numTables -= 1
-	return nil
 }
 
 func (db *db) DeleteTables() error {
-	db.lock.Lock()
-	defer db.lock.Unlock()
+	return db.wal.logged(func() (int64, error) {
+		db.lock.Lock()
+		defer db.lock.Unlock()
+
+		return db.logAndApply(&walRecord{op: walDeleteTables, dbName: db.name}, db.dropTables)
+	})
+}
 
-	var err, errors error
-	for name, tbl := range db.tables {
-		err = tbl.DeleteColumns()
-		errors = multierr.Append(errors, err)
-		err = db.DeleteTableInternal(name)
-		errors = multierr.Append(errors, err)
+// dropTables removes every table. The caller must hold the db lock.
+func (db *db) dropTables() {
+	for name := range db.tables {
+		db.dropTable(name)
 	}
-	return errors
 }
@@ -34,6 +34,7 @@ func TestCreateTable(t *testing.T) {
 	assert.Equal(t, 2, len(db2.tables))
 	assert.Equal(t, tbl3, db2.tables["tbl1"])
 	assert.Equal(t, tbl4, db2.tables["tbl2"])
+	assert.Equal(t, []string{"tbl1", "tbl2"}, db2.TableNames())
 }
 
 func TestDeleteTables(t *testing.T) {
@@ -68,6 +69,7 @@ func TestDeleteTable(t *testing.T) {
 
 	err = db1.DeleteTable("tbl1")
 	assert.ErrorContains(t, err, "does not exist")
+	assert.ErrorIs(t, err, ErrNotExist)
 
 	assert.Equal(t, int64(1), db1.numTables)
 	assert.Equal(t, 1, len(db1.tables))
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"fmt"
+	"math"
+)
+
+// Expr computes a value from the columns of a row, e.g. col + 1. Build
+// expressions with Col, Lit and the arithmetic constructors.
+type Expr interface {
+	// eval computes the expression for a row, reading columns through
+	// valueOf.
+	eval(valueOf func(colName string) (Value, error)) (Value, error)
+	String() string
+}
+
+type colExpr struct {
+	name string
+}
+
+// Col is the value of a column in the current row.
+func Col(colName string) Expr {
+	return colExpr{name: colName}
+}
+
+func (e colExpr) eval(valueOf func(colName string) (Value, error)) (Value, error) {
+	return valueOf(e.name)
+}
+
+func (e colExpr) String() string {
+	return e.name
+}
+
+type litExpr struct {
+	val Value
+}
+
+// Lit is a constant value.
+func Lit(val Value) Expr {
+	return litExpr{val: val}
+}
+
+func (e litExpr) eval(func(colName string) (Value, error)) (Value, error) {
+	return e.val, nil
+}
+
+func (e litExpr) String() string {
+	if e.val.typ == TypeString && !e.val.null {
+		return fmt.Sprintf("%q", e.val.s)
+	}
+	return e.val.String()
+}
+
+type arithOp byte
+
+const (
+	opAdd arithOp = '+'
+	opSub arithOp = '-'
+	opMul arithOp = '*'
+	opDiv arithOp = '/'
+)
+
+type arithExpr struct {
+	op    arithOp
+	left  Expr
+	right Expr
+}
+
+// Add, Sub, Mul and Div combine two int64 or two float64 operands. A null
+// operand makes the result null, and int64 overflow and division by zero
+// are errors.
+func Add(left Expr, right Expr) Expr {
+	return arithExpr{op: opAdd, left: left, right: right}
+}
+
+func Sub(left Expr, right Expr) Expr {
+	return arithExpr{op: opSub, left: left, right: right}
+}
+
+func Mul(left Expr, right Expr) Expr {
+	return arithExpr{op: opMul, left: left, right: right}
+}
+
+func Div(left Expr, right Expr) Expr {
+	return arithExpr{op: opDiv, left: left, right: right}
+}
+
+func (e arithExpr) String() string {
+	return fmt.Sprintf("(%s %c %s)", e.left, e.op, e.right)
+}
+
+func (e arithExpr) eval(valueOf func(colName string) (Value, error)) (Value, error) {
+	left, err := e.left.eval(valueOf)
+	if err != nil {
+		return Value{}, err
+	}
+	right, err := e.right.eval(valueOf)
+	if err != nil {
+		return Value{}, err
+	}
+	if left.null || right.null {
+		return NullValue(), nil
+	}
+
+	if left.typ != right.typ || (left.typ != TypeInt64 && left.typ != TypeFloat64) {
+		return Value{}, fmt.Errorf("cannot evaluate %s: %s %c %s", e, left.typ, e.op, right.typ)
+	}
+
+	if left.typ == TypeFloat64 {
+		switch e.op {
+		case opAdd:
+			return Float64Value(left.f + right.f), nil
+		case opSub:
+			return Float64Value(left.f - right.f), nil
+		case opMul:
+			return Float64Value(left.f * right.f), nil
+		}
+		if right.f == 0 {
+			return Value{}, fmt.Errorf("cannot evaluate %s: division by zero", e)
+		}
+		return Float64Value(left.f / right.f), nil
+	}
+
+	res, ok := int64Arith(e.op, left.i, right.i)
+	if !ok {
+		if e.op == opDiv && right.i == 0 {
+			return Value{}, fmt.Errorf("cannot evaluate %s: division by zero", e)
+		}
+		return Value{}, fmt.Errorf("cannot evaluate %s: int64 overflow", e)
+	}
+	return Int64Value(res), nil
+}
+
+// int64Arith applies op to a and b, reporting false on overflow or division
+// by zero.
+func int64Arith(op arithOp, a int64, b int64) (int64, bool) {
+	switch op {
+	case opAdd:
+		res := a + b
+		// overflow flips the sign away from that of both operands
+		return res, (res > a) == (b > 0)
+	case opSub:
+		res := a - b
+		return res, (res < a) == (b > 0)
+	case opMul:
+		if a == 0 || b == 0 {
+			return 0, true
+		}
+		res := a * b
+		return res, res/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64)
+	}
+	if b == 0 || (a == math.MinInt64 && b == -1) {
+		return 0, false
+	}
+	return a / b, true
+}
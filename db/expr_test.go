@@ -0,0 +1,78 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExprEval(t *testing.T) {
+	row := map[string]Value{
+		"a": Int64Value(7),
+		"b": Int64Value(2),
+		"f": Float64Value(1.5),
+		"s": StringValue("x"),
+		"n": NullValue(),
+	}
+	valueOf := func(colName string) (Value, error) {
+		val, ok := row[colName]
+		if !ok {
+			return Value{}, fmt.Errorf("no column %s", colName)
+		}
+		return val, nil
+	}
+	one := Lit(Int64Value(1))
+
+	tests := []struct {
+		expr Expr
+		want Value
+		err  string
+	}{
+		{Add(Col("a"), one), Int64Value(8), ""},
+		{Sub(Col("a"), Col("b")), Int64Value(5), ""},
+		{Mul(Col("a"), Col("b")), Int64Value(14), ""},
+		{Div(Col("a"), Col("b")), Int64Value(3), ""},
+		{Mul(Add(Col("f"), Lit(Float64Value(0.5))), Lit(Float64Value(3))), Float64Value(6), ""},
+		{Add(Col("a"), Col("n")), NullValue(), ""},
+		{Add(Col("a"), Col("f")), Value{}, "cannot evaluate (a + f): int64 + float64"},
+		{Add(Col("s"), Col("s")), Value{}, "cannot evaluate (s + s): string + string"},
+		{Div(Col("a"), Lit(Int64Value(0))), Value{}, "division by zero"},
+		{Div(Col("f"), Lit(Float64Value(0))), Value{}, "division by zero"},
+		{Add(Lit(Int64Value(math.MaxInt64)), one), Value{}, "int64 overflow"},
+		{Sub(Lit(Int64Value(math.MinInt64)), one), Value{}, "int64 overflow"},
+		{Mul(Lit(Int64Value(math.MinInt64)), Lit(Int64Value(-1))), Value{}, "int64 overflow"},
+		{Div(Lit(Int64Value(math.MinInt64)), Lit(Int64Value(-1))), Value{}, "int64 overflow"},
+		{Mul(Lit(Int64Value(1<<32)), Lit(Int64Value(1<<31))), Value{}, "int64 overflow"},
+		{Add(Col("missing"), one), Value{}, "no column missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr.String(), func(t *testing.T) {
+			got, err := tt.expr.eval(valueOf)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestInt64Arith(t *testing.T) {
+	res, ok := int64Arith(opAdd, math.MaxInt64-1, 1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(math.MaxInt64), res)
+	res, ok = int64Arith(opSub, math.MinInt64+1, 1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(math.MinInt64), res)
+	res, ok = int64Arith(opMul, -1, math.MaxInt64)
+	assert.True(t, ok)
+	assert.Equal(t, int64(-math.MaxInt64), res)
+	_, ok = int64Arith(opAdd, math.MinInt64, -1)
+	assert.False(t, ok)
+	_, ok = int64Arith(opSub, math.MaxInt64, -1)
+	assert.False(t, ok)
+	assert.Equal(t, `(a + "x")`, Add(Col("a"), Lit(StringValue("x"))).String())
+}
@@ -0,0 +1,307 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Filter is a tree of predicates on the columns of a table. Build filters
+// with Match, IsNull, IsNotNull, And, Or and Not and run them with
+// table.Filter:
+//
+//	f := And(Match("price", Lt(Int64Value(10))), Not(Match("name", In(StringValue("a"), StringValue("b")))))
+//	c, err := tbl.Filter(f)
+//
+// Like in SQL, a row whose column is null matches neither a predicate on
+// that column nor its negation.
+type Filter interface {
+	apply(tbl *table) (*condition, error)
+	// negate returns the filter matching the rows where the filter is
+	// false, which excludes the rows where it is unknown because of nulls.
+	negate() Filter
+	String() string
+}
+
+// Match matches the rows where the column named colName matches p.
+func Match(colName string, p Predicate) Filter {
+	return &predicateFilter{col: colName, pred: p}
+}
+
+// IsNull matches the rows where the column named colName is null.
+func IsNull(colName string) Filter {
+	return &nullFilter{col: colName}
+}
+
+// IsNotNull matches the rows where the column named colName is not null.
+func IsNotNull(colName string) Filter {
+	return &nullFilter{col: colName, not: true}
+}
+
+// And matches the rows that all filters match, every row if there are none.
+func And(filters ...Filter) Filter {
+	if len(filters) == 0 {
+		return &constFilter{match: true}
+	}
+	res := filters[0]
+	for _, f := range filters[1:] {
+		res = &andFilter{left: res, right: f}
+	}
+	return res
+}
+
+// Or matches the rows that any of filters match, no row if there are none.
+func Or(filters ...Filter) Filter {
+	if len(filters) == 0 {
+		return &constFilter{match: false}
+	}
+	res := filters[0]
+	for _, f := range filters[1:] {
+		res = &orFilter{left: res, right: f}
+	}
+	return res
+}
+
+// Not matches the rows where f is false. Rows where f is unknown because
+// a column it tests is null match neither f nor Not(f).
+func Not(f Filter) Filter {
+	return f.negate()
+}
+
+// Filter returns a condition matching the live rows of the table that f
+// matches. After a vacuum or ClusterBy renumbers the rows, every table
+// method that reads or changes the rows of the condition rejects it rather
+// than use the wrong rows.
+func (tbl *table) Filter(f Filter) (*condition, error) {
+	c, err := f.apply(tbl)
+	if err != nil {
+		return nil, err
+	}
+
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ids = c.ids.andNot(tbl.deletes)
+	c.generation = tbl.generation
+	return c, nil
+}
+
+// Query returns the columns named colNames of the live rows f matches, by
+// default all columns in ColumnNames order.
+func (tbl *table) Query(f Filter, colNames []string) (*Result, error) {
+	if len(colNames) == 0 {
+		colNames = tbl.ColumnNames()
+	}
+	types := make([]ColumnType, len(colNames))
+	for i, colName := range colNames {
+		var err error
+		if types[i], err = tbl.ColumnType(colName); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := tbl.Filter(f)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := tbl.GetColumns(c, colNames)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Columns: colNames, Types: types, Rows: make([][]Value, c.NumResults())}
+	for r := range res.Rows {
+		row := make([]Value, len(cols))
+		for i, col := range cols {
+			row[i] = col[r]
+		}
+		res.Rows[r] = row
+	}
+	return res, nil
+}
+
+// DeleteWhere deletes the live rows f matches and returns how many it
+// deleted.
+func (tbl *table) DeleteWhere(f Filter) (int64, error) {
+	c, err := tbl.Filter(f)
+	if err != nil {
+		return 0, err
+	}
+	return tbl.DeleteMatching(c)
+}
+
+type predicateFilter struct {
+	col  string
+	pred Predicate
+}
+
+func (f *predicateFilter) apply(tbl *table) (*condition, error) {
+	col, err := tbl.GetColumn(f.col)
+	if err != nil {
+		return nil, err
+	}
+	return tbl.SelectWhere(col, f.pred)
+}
+
+func (f *predicateFilter) negate() Filter {
+	vals := f.pred.vals
+	switch f.pred.op {
+	case predicateEq:
+		return Match(f.col, Ne(vals[0]))
+	case predicateNe:
+		return Match(f.col, Eq(vals[0]))
+	case predicateLt:
+		return Match(f.col, Ge(vals[0]))
+	case predicateLe:
+		return Match(f.col, Gt(vals[0]))
+	case predicateGt:
+		return Match(f.col, Le(vals[0]))
+	case predicateGe:
+		return Match(f.col, Lt(vals[0]))
+	case predicateBetween:
+		return Or(Match(f.col, Lt(vals[0])), Match(f.col, Gt(vals[1])))
+	}
+	return &notInFilter{col: f.col, in: f.pred}
+}
+
+func (f *predicateFilter) String() string {
+	return fmt.Sprintf("%s %s", f.col, f.pred)
+}
+
+type nullFilter struct {
+	col string
+	not bool
+}
+
+func (f *nullFilter) apply(tbl *table) (*condition, error) {
+	col, err := tbl.GetColumn(f.col)
+	if err != nil {
+		return nil, err
+	}
+	if f.not {
+		return tbl.SelectNotNull(col)
+	}
+	return tbl.SelectNull(col)
+}
+
+func (f *nullFilter) negate() Filter {
+	return &nullFilter{col: f.col, not: !f.not}
+}
+
+func (f *nullFilter) String() string {
+	return fmt.Sprintf("%s IS %sNULL", f.col, notString(f.not))
+}
+
+// notInFilter matches the items of col that are not null and not in the
+// list of an IN predicate. It keeps the predicate, rather than reducing a
+// list with a null to FALSE, so that negating it again gives the IN back.
+type notInFilter struct {
+	col string
+	in  Predicate
+}
+
+func (f *notInFilter) apply(tbl *table) (*condition, error) {
+	col, err := tbl.GetColumn(f.col)
+	if err != nil {
+		return nil, err
+	}
+	for _, val := range f.in.vals {
+		// x NOT IN (.., NULL) is never true
+		if val.null {
+			return NewCondition(), nil
+		}
+	}
+	c, err := tbl.SelectWhere(col, f.in)
+	if err != nil {
+		return nil, err
+	}
+	notNull, err := tbl.SelectNotNull(col)
+	if err != nil {
+		return nil, err
+	}
+	res := tbl.Not(c)
+	res.And(notNull)
+	return res, nil
+}
+
+func (f *notInFilter) negate() Filter {
+	return Match(f.col, f.in)
+}
+
+func (f *notInFilter) String() string {
+	return fmt.Sprintf("%s NOT %s", f.col, f.in)
+}
+
+type andFilter struct {
+	left  Filter
+	right Filter
+}
+
+func (f *andFilter) apply(tbl *table) (*condition, error) {
+	left, err := f.left.apply(tbl)
+	if err != nil {
+		return nil, err
+	}
+	right, err := f.right.apply(tbl)
+	if err != nil {
+		return nil, err
+	}
+	left.And(right)
+	return left, nil
+}
+
+// negate applies De Morgan: NOT (a AND b) is NOT a OR NOT b.
+func (f *andFilter) negate() Filter {
+	return &orFilter{left: f.left.negate(), right: f.right.negate()}
+}
+
+func (f *andFilter) String() string {
+	return fmt.Sprintf("(%s AND %s)", f.left, f.right)
+}
+
+type orFilter struct {
+	left  Filter
+	right Filter
+}
+
+func (f *orFilter) apply(tbl *table) (*condition, error) {
+	left, err := f.left.apply(tbl)
+	if err != nil {
+		return nil, err
+	}
+	right, err := f.right.apply(tbl)
+	if err != nil {
+		return nil, err
+	}
+	left.Or(right)
+	return left, nil
+}
+
+func (f *orFilter) negate() Filter {
+	return &andFilter{left: f.left.negate(), right: f.right.negate()}
+}
+
+func (f *orFilter) String() string {
+	return fmt.Sprintf("(%s OR %s)", f.left, f.right)
+}
+
+// constFilter matches every live row or none, e.g. for a missing WHERE
+// clause or a comparison with NULL.
+type constFilter struct {
+	match bool
+}
+
+func (f *constFilter) apply(tbl *table) (*condition, error) {
+	if f.match {
+		return tbl.Not(NewCondition()), nil
+	}
+	return NewCondition(), nil
+}
+
+func (f *constFilter) negate() Filter {
+	return &constFilter{match: !f.match}
+}
+
+func (f *constFilter) String() string {
+	return strings.ToUpper(fmt.Sprint(f.match))
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	tbl := NewTable()
+	err := tbl.LoadValues([]string{"num", "name"},
+		[]Value{Int64Value(1), Int64Value(5), NullValue(), Int64Value(7), Int64Value(9), Int64Value(3)},
+		[]Value{StringValue("pear"), StringValue("apple"), StringValue("fig"), NullValue(), StringValue("kiwi"), StringValue("fig")})
+	assert.NoError(t, err)
+	assert.NoError(t, tbl.DeleteRows([]int64{5}))
+
+	tests := []struct {
+		name   string
+		filter Filter
+		expect []int64
+		str    string
+	}{
+		{"match", Match("num", Ge(Int64Value(5))), []int64{1, 3, 4}, "num >= 5"},
+		{"is null", IsNull("num"), []int64{2}, "num IS NULL"},
+		{"is not null", IsNotNull("name"), []int64{0, 1, 2, 4}, "name IS NOT NULL"},
+		{"and", And(Match("num", Gt(Int64Value(1))), IsNotNull("name")), []int64{1, 4}, "(num > 1 AND name IS NOT NULL)"},
+		{"or", Or(Match("num", Eq(Int64Value(1))), Match("name", Eq(StringValue("fig")))), []int64{0, 2}, "(num = 1 OR name = fig)"},
+		{"empty and", And(), []int64{0, 1, 2, 3, 4}, "TRUE"},
+		{"empty or", Or(), []int64{}, "FALSE"},
+		{"not skips nulls", Not(Match("num", Lt(Int64Value(7)))), []int64{3, 4}, "num >= 7"},
+		{"not between", Not(Match("num", Between(Int64Value(2), Int64Value(8)))), []int64{0, 4}, "(num < 2 OR num > 8)"},
+		{"not in", Not(Match("name", In(StringValue("fig"), StringValue("kiwi")))), []int64{0, 1}, "name NOT IN (fig, kiwi)"},
+		{"not in with null", Not(Match("name", In(StringValue("fig"), NullValue()))), []int64{}, "name NOT IN (fig, NULL)"},
+		{"de morgan", Not(And(Match("num", Gt(Int64Value(1))), IsNull("name"))), []int64{0, 1, 2, 4}, "(num <= 1 OR name IS NOT NULL)"},
+		{"double not", Not(Not(Match("name", In(StringValue("pear"))))), []int64{0}, "name IN (pear)"},
+		{"double not in with null", Not(Not(Match("name", In(StringValue("pear"), NullValue())))), []int64{0}, "name IN (pear, NULL)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tbl.Filter(tt.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, append([]int64{}, c.ids.toSlice()...))
+			assert.Equal(t, tt.str, tt.filter.String())
+		})
+	}
+
+	_, err = tbl.Filter(Match("other", Eq(Int64Value(1))))
+	assert.ErrorContains(t, err, "Cannot get column with name other: does not exist")
+	_, err = tbl.Filter(Or(IsNull("num"), Match("name", Eq(Int64Value(1)))))
+	assert.ErrorContains(t, err, "type mismatch")
+}
+
+func TestGetColumns(t *testing.T) {
+	tbl := NewTable()
+	err := tbl.LoadValues([]string{"num", "name"},
+		[]Value{Int64Value(1), Int64Value(5), Int64Value(7)},
+		[]Value{StringValue("pear"), NullValue(), StringValue("fig")})
+	assert.NoError(t, err)
+
+	c, err := tbl.Filter(Match("num", Gt(Int64Value(1))))
+	assert.NoError(t, err)
+	vals, err := tbl.GetColumns(c, []string{"name", "num"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{{NullValue(), StringValue("fig")}, {Int64Value(5), Int64Value(7)}}, vals)
+
+	_, err = tbl.GetColumns(c, []string{"num", "other"})
+	assert.ErrorContains(t, err, "Could not fetch column other: column not found")
+}
+
+func TestDeleteMatching(t *testing.T) {
+	tbl := NewTable()
+	err := tbl.LoadValues([]string{"num"},
+		[]Value{Int64Value(1), Int64Value(5), NullValue(), Int64Value(7)})
+	assert.NoError(t, err)
+	assert.NoError(t, tbl.DeleteRows([]int64{3}))
+
+	c, err := tbl.SelectWhere(tbl.cols["num"], Ge(Int64Value(5)))
+	assert.NoError(t, err)
+	numDeleted, err := tbl.DeleteMatching(c)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), numDeleted)
+	assert.Equal(t, int64(2), tbl.Stats().LiveRows)
+
+	numDeleted, err = tbl.DeleteMatching(c)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), numDeleted)
+}
+
+func TestQuery(t *testing.T) {
+	tbl := NewTable()
+	err := tbl.LoadValues([]string{"num", "name"},
+		[]Value{Int64Value(1), Int64Value(5), Int64Value(7)},
+		[]Value{StringValue("pear"), NullValue(), StringValue("fig")})
+	assert.NoError(t, err)
+
+	res, err := tbl.Query(Match("num", Ge(Int64Value(5))), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &Result{
+		Columns: []string{"name", "num"},
+		Types:   []ColumnType{TypeString, TypeInt64},
+		Rows:    [][]Value{{NullValue(), Int64Value(5)}, {StringValue("fig"), Int64Value(7)}},
+	}, res)
+
+	numDeleted, err := tbl.DeleteWhere(IsNull("name"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), numDeleted)
+	res, err = tbl.Query(And(), []string{"num"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{{Int64Value(1)}, {Int64Value(7)}}, res.Rows)
+
+	_, err = tbl.Query(And(), []string{"other"})
+	assert.ErrorIs(t, err, ErrNotExist)
+	_, err = tbl.ColumnType("other")
+	assert.EqualError(t, err, "Cannot get column with name other: does not exist")
+}
@@ -0,0 +1,333 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"os"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	defaultMaxGroups = 1 << 18
+	// spillPartitions is the number of files the rows of groups that do not
+	// fit in memory are spread over.
+	spillPartitions = 16
+	// maxSpillDepth bounds how often a partition is split again. Past it
+	// the groups of a partition are kept in memory however many there are.
+	maxSpillDepth = 4
+)
+
+// Aggregation is an aggregate of a group by: Func over the items of Col in
+// each group. An AggCount with a nil Col counts the rows of each group.
+type Aggregation struct {
+	Func AggregateFunc
+	Col  *column
+}
+
+// Group is a group of rows with the same key: the values of the key columns
+// followed by the value of each aggregation.
+type Group struct {
+	Key    []Value
+	Values []Value
+}
+
+// GroupByOption configures how a group by uses memory.
+type GroupByOption func(*groupByConfig)
+
+type groupByConfig struct {
+	maxGroups int
+	spillDir  string
+}
+
+// WithMaxGroups sets how many groups are aggregated in memory at a time.
+// The rows of further groups are spilled to temporary files and aggregated
+// once the groups in memory are done.
+func WithMaxGroups(n int) GroupByOption {
+	return func(cfg *groupByConfig) {
+		cfg.maxGroups = n
+	}
+}
+
+// WithSpillDir sets the directory of the temporary files of a group by. It
+// defaults to os.TempDir.
+func WithSpillDir(dir string) GroupByOption {
+	return func(cfg *groupByConfig) {
+		cfg.spillDir = dir
+	}
+}
+
+// GroupBy groups the live rows c matches by the values of the key columns
+// and computes aggs over each group. Rows with null keys are grouped
+// together, as in SQL. Groups come in no particular order.
+func (tbl *table) GroupBy(c *condition, keys []*column, aggs []Aggregation, opts ...GroupByOption) ([]Group, error) {
+	var groups []Group
+	err := tbl.GroupByFunc(c, keys, aggs, func(g Group) bool {
+		groups = append(groups, g)
+		return true
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// GroupByFunc is like GroupBy but passes each group to fn as soon as it is
+// complete, stopping early if fn returns false. Only the groups being
+// aggregated are held in memory. fn runs with the table locked, so it must
+// not use the table.
+func (tbl *table) GroupByFunc(c *condition, keys []*column, aggs []Aggregation, fn func(Group) bool, opts ...GroupByOption) error {
+	cfg := groupByConfig{maxGroups: defaultMaxGroups}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("Cannot group by: no key columns")
+	}
+	for _, agg := range aggs {
+		if agg.Col == nil {
+			if agg.Func != AggCount {
+				return fmt.Errorf("Cannot compute %s(*): only COUNT takes no column", agg.Func)
+			}
+			continue
+		}
+		if err := checkAggregate(agg.Func, agg.Col.name, agg.Col.typ); err != nil {
+			return err
+		}
+	}
+
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	if err := tbl.checkGeneration(c); err != nil {
+		return err
+	}
+
+	cols := append([]*column{}, keys...)
+	for _, agg := range aggs {
+		if agg.Col != nil {
+			cols = append(cols, agg.Col)
+		}
+	}
+	unlock, err := tbl.lockColumns("Cannot group by", cols...)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	g := &groupBy{
+		keys: keys,
+		aggs: aggs,
+		cfg:  cfg,
+		seed: maphash.MakeSeed(),
+		emit: fn,
+	}
+	return g.run(func(yield func(id int64) bool) error {
+		c.ids.andNot(tbl.deletes).forEach(func(id int64) bool {
+			return id < tbl.numRows && yield(id)
+		})
+		return nil
+	}, 0)
+}
+
+// groupBy is a hash aggregation. Each pass aggregates the groups that fit
+// in memory and spills the ids of the rows of other groups to partitions
+// by the hash of their key, and every partition is then aggregated by a
+// pass of its own.
+type groupBy struct {
+	keys    []*column
+	aggs    []Aggregation
+	cfg     groupByConfig
+	seed    maphash.Seed
+	emit    func(Group) bool
+	stopped bool
+}
+
+// groupState is the state of a group being aggregated. The key values are
+// read back from the first row of the group.
+type groupState struct {
+	firstId int64
+	aggs    []aggState
+}
+
+// rowIds calls yield with each row id of a pass until it returns false.
+type rowIds func(yield func(id int64) bool) error
+
+func (g *groupBy) run(ids rowIds, depth int) (err error) {
+	groups := make(map[string]*groupState)
+	var parts []*spillFile
+	defer func() {
+		for _, part := range parts {
+			err = multierr.Append(err, part.remove())
+		}
+	}()
+
+	var key []byte
+	readErr := ids(func(id int64) bool {
+		key = g.key(key[:0], id)
+		st, ok := groups[string(key)]
+		if !ok && len(groups) >= g.cfg.maxGroups && depth < maxSpillDepth {
+			if parts == nil {
+				if parts, err = newSpillFiles(g.cfg.spillDir); err != nil {
+					return false
+				}
+			}
+			err = parts[g.partition(key, depth)].write(id)
+			return err == nil
+		}
+		if !ok {
+			st = &groupState{firstId: id, aggs: make([]aggState, len(g.aggs))}
+			for i, agg := range g.aggs {
+				st.aggs[i].fn = agg.Func
+			}
+			groups[string(key)] = st
+		}
+		for i, agg := range g.aggs {
+			if agg.Col == nil || !agg.Col.isNull(id) {
+				st.aggs[i].add(agg.Col, id)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if readErr != nil {
+		return readErr
+	}
+
+	for _, st := range groups {
+		if err := g.emitGroup(st); err != nil || g.stopped {
+			return err
+		}
+	}
+	// let the groups go before the partitions are aggregated
+	groups = nil
+
+	for _, part := range parts {
+		if part.n == 0 {
+			continue
+		}
+		if err := part.rewind(); err != nil {
+			return err
+		}
+		if err := g.run(part.read, depth+1); err != nil || g.stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// key appends the key of row id to buf: a null flag and the word of each
+// key column.
+func (g *groupBy) key(buf []byte, id int64) []byte {
+	for _, col := range g.keys {
+		if col.isNull(id) {
+			buf = append(buf, 0)
+			continue
+		}
+		buf = append(buf, 1)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(col.data[id]))
+	}
+	return buf
+}
+
+// partition hashes a key with the depth of the pass, so that the groups of
+// a partition spread over new partitions when it spills again.
+func (g *groupBy) partition(key []byte, depth int) int {
+	var h maphash.Hash
+	h.SetSeed(g.seed)
+	h.WriteByte(byte(depth))
+	h.Write(key)
+	return int(h.Sum64() % spillPartitions)
+}
+
+func (g *groupBy) emitGroup(st *groupState) error {
+	group := Group{
+		Key:    make([]Value, len(g.keys)),
+		Values: make([]Value, len(g.aggs)),
+	}
+	for i, col := range g.keys {
+		group.Key[i] = col.value(st.firstId)
+	}
+	for i, agg := range g.aggs {
+		val, err := st.aggs[i].result(agg.Col)
+		if err != nil {
+			return err
+		}
+		group.Values[i] = val
+	}
+	g.stopped = !g.emit(group)
+	return nil
+}
+
+// spillFile is a temporary file of row ids.
+type spillFile struct {
+	f *os.File
+	w *bufio.Writer
+	n int64
+}
+
+func newSpillFiles(dir string) ([]*spillFile, error) {
+	parts := make([]*spillFile, 0, spillPartitions)
+	for range spillPartitions {
+		f, err := os.CreateTemp(dir, "modb-groupby-*")
+		if err != nil {
+			for _, part := range parts {
+				err = multierr.Append(err, part.remove())
+			}
+			return nil, fmt.Errorf("Could not spill group by: %w", err)
+		}
+		parts = append(parts, &spillFile{f: f, w: bufio.NewWriter(f)})
+	}
+	return parts, nil
+}
+
+func (s *spillFile) write(id int64) error {
+	s.n++
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(id))
+	if _, err := s.w.Write(buf[:]); err != nil {
+		return fmt.Errorf("Could not spill group by: %w", err)
+	}
+	return nil
+}
+
+// rewind flushes the ids written so far and seeks back to the first one.
+func (s *spillFile) rewind() error {
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("Could not spill group by: %w", err)
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("Could not read spilled group by: %w", err)
+	}
+	return nil
+}
+
+func (s *spillFile) read(yield func(id int64) bool) error {
+	r := bufio.NewReader(s.f)
+	var buf [8]byte
+	for i := int64(0); i < s.n; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return fmt.Errorf("Could not read spilled group by: %w", err)
+		}
+		if !yield(int64(binary.LittleEndian.Uint64(buf[:]))) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *spillFile) remove() error {
+	err := s.f.Close()
+	if rmErr := os.Remove(s.f.Name()); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+		err = multierr.Append(err, rmErr)
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sortGroups orders groups by key, nulls first, for comparison.
+func sortGroups(groups []Group) {
+	sort.Slice(groups, func(i, j int) bool {
+		for k := range groups[i].Key {
+			a, b := groups[i].Key[k], groups[j].Key[k]
+			if a.IsNull() || b.IsNull() {
+				if a.IsNull() != b.IsNull() {
+					return a.IsNull()
+				}
+				continue
+			}
+			if cmp := a.Compare(b); cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+}
+
+func TestGroupBy(t *testing.T) {
+	schema, err := NewSchema(
+		NewColumnDef("customer", TypeString),
+		NewColumnDef("region", TypeInt64),
+		NewColumnDef("amount", TypeFloat64),
+	)
+	require.NoError(t, err)
+	tbl := NewTable(WithSchema(schema))
+	require.NoError(t, tbl.InsertValueRows([]string{"customer", "region", "amount"}, [][]Value{
+		{StringValue("ann"), Int64Value(1), Float64Value(10)},
+		{StringValue("bob"), Int64Value(1), Float64Value(5)},
+		{StringValue("ann"), Int64Value(2), NullValue()},
+		{StringValue("ann"), Int64Value(1), Float64Value(2.5)},
+		{NullValue(), Int64Value(1), Float64Value(1)},
+		{StringValue("bob"), Int64Value(1), Float64Value(100)},
+	}))
+	require.NoError(t, tbl.DeleteRows([]int64{5}))
+
+	customer, _ := tbl.GetColumn("customer")
+	region, _ := tbl.GetColumn("region")
+	amount, _ := tbl.GetColumn("amount")
+	all := tbl.Not(NewCondition())
+	aggs := []Aggregation{{Func: AggCount}, {Func: AggSum, Col: amount}, {Func: AggMax, Col: amount}}
+
+	groups, err := tbl.GroupBy(all, []*column{customer}, aggs)
+	require.NoError(t, err)
+	sortGroups(groups)
+	assert.Equal(t, []Group{
+		{Key: []Value{NullValue()}, Values: []Value{Int64Value(1), Float64Value(1), Float64Value(1)}},
+		{Key: []Value{StringValue("ann")}, Values: []Value{Int64Value(3), Float64Value(12.5), Float64Value(10)}},
+		{Key: []Value{StringValue("bob")}, Values: []Value{Int64Value(1), Float64Value(5), Float64Value(5)}},
+	}, groups)
+
+	// several keys, and a key that is also aggregated
+	c, err := tbl.SelectWhere(customer, Eq(StringValue("ann")))
+	require.NoError(t, err)
+	groups, err = tbl.GroupBy(c, []*column{customer, region}, []Aggregation{{Func: AggCount, Col: amount}, {Func: AggMin, Col: customer}})
+	require.NoError(t, err)
+	sortGroups(groups)
+	assert.Equal(t, []Group{
+		{Key: []Value{StringValue("ann"), Int64Value(1)}, Values: []Value{Int64Value(2), StringValue("ann")}},
+		{Key: []Value{StringValue("ann"), Int64Value(2)}, Values: []Value{Int64Value(0), StringValue("ann")}},
+	}, groups)
+
+	groups, err = tbl.GroupBy(NewCondition(), []*column{region}, aggs)
+	assert.NoError(t, err)
+	assert.Empty(t, groups)
+
+	_, err = tbl.GroupBy(all, nil, aggs)
+	assert.EqualError(t, err, "Cannot group by: no key columns")
+	_, err = tbl.GroupBy(all, []*column{region}, []Aggregation{{Func: AggSum}})
+	assert.EqualError(t, err, "Cannot compute SUM(*): only COUNT takes no column")
+	_, err = tbl.GroupBy(all, []*column{region}, []Aggregation{{Func: AggAvg, Col: customer}})
+	assert.EqualError(t, err, "Cannot compute AVG(customer): column has type string, want int64 or float64")
+	_, err = tbl.GroupBy(all, []*column{NewColumn("region")}, aggs)
+	assert.EqualError(t, err, "Cannot group by column region: column not found")
+}
+
+func TestGroupBySpill(t *testing.T) {
+	tbl := NewTable()
+	key, err := tbl.CreateColumn("key")
+	require.NoError(t, err)
+	val, err := tbl.CreateColumn("val")
+	require.NoError(t, err)
+	rows := make([][]int64, 0, 3000)
+	for i := range int64(3000) {
+		rows = append(rows, []int64{i % 1000, i})
+	}
+	require.NoError(t, tbl.InsertRows([]string{"key", "val"}, rows))
+	all := tbl.Not(NewCondition())
+	aggs := []Aggregation{{Func: AggCount}, {Func: AggSum, Col: val}}
+
+	expect, err := tbl.GroupBy(all, []*column{key}, aggs)
+	require.NoError(t, err)
+	require.Len(t, expect, 1000)
+	sortGroups(expect)
+	for i, g := range expect {
+		assert.Equal(t, []Value{Int64Value(3), Int64Value(3*int64(i) + 3000)}, g.Values, "key %d", i)
+	}
+
+	// a single group in memory spills through every depth
+	for _, maxGroups := range []int{1, 10, 999} {
+		t.Run(fmt.Sprint(maxGroups), func(t *testing.T) {
+			dir := t.TempDir()
+			groups, err := tbl.GroupBy(all, []*column{key}, aggs, WithMaxGroups(maxGroups), WithSpillDir(dir))
+			require.NoError(t, err)
+			sortGroups(groups)
+			assert.Equal(t, expect, groups)
+
+			files, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Empty(t, files)
+		})
+	}
+
+	// stopping early removes the spill files too
+	dir := t.TempDir()
+	n := 0
+	err = tbl.GroupByFunc(all, []*column{key}, aggs, func(g Group) bool {
+		n++
+		return n < 5
+	}, WithMaxGroups(2), WithSpillDir(dir))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	_, err = tbl.GroupBy(all, []*column{key}, aggs, WithMaxGroups(2), WithSpillDir(dir+"/missing"))
+	assert.ErrorContains(t, err, "Could not spill group by")
+}
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// hashIndex maps the key of every live row to its row id, enforcing a
+// PRIMARY KEY or UNIQUE constraint. Rows with a null key column are not
+// indexed.
+type hashIndex struct {
+	cols    []string
+	primary bool
+	rows    map[string]int64
+}
+
+func newHashIndex(cols []string, primary bool) *hashIndex {
+	return &hashIndex{
+		cols:    cols,
+		primary: primary,
+		rows:    make(map[string]int64),
+	}
+}
+
+func (idx *hashIndex) String() string {
+	if idx.primary {
+		return "PRIMARY KEY (" + strings.Join(idx.cols, ", ") + ")"
+	}
+	return "UNIQUE (" + strings.Join(idx.cols, ", ") + ")"
+}
+
+// key encodes the key of a row given the value of each key column. ok is
+// false when a key column is null.
+func (idx *hashIndex) key(valueOf func(colName string) Value) (key string, ok bool) {
+	var buf []byte
+	for _, name := range idx.cols {
+		val := valueOf(name)
+		if val.null {
+			return "", false
+		}
+		buf = append(buf, byte(val.typ))
+		if val.typ == TypeString {
+			buf = binary.AppendUvarint(buf, uint64(len(val.s)))
+			buf = append(buf, val.s...)
+			continue
+		}
+		buf = binary.BigEndian.AppendUint64(buf, uint64(val.fixedWord()))
+	}
+	return string(buf), true
+}
+
+// duplicateError reports a row whose key is already taken.
+func (idx *hashIndex) duplicateError(op string, valueOf func(colName string) Value) error {
+	vals := make([]string, len(idx.cols))
+	for i, name := range idx.cols {
+		vals[i] = valueOf(name).String()
+	}
+	return constraintErrorf("%s: duplicate key (%s) violates %s", op, strings.Join(vals, ", "), idx)
+}
+
+// indexSelectivity is how selective a range must be for a select to use an
+// ordered index: it gives up on the index and scans the column once the
+// range holds more than a 1/indexSelectivity share of the rows.
+const indexSelectivity = 8
+
+// CreateIndex builds an ordered index over the items of colName. The index
+// is kept up to date by every write to the table, and Select, SelectValues
+// and SelectWhere use it for ranges and equalities that match few rows.
+// Null items are not indexed.
+func (tbl *table) CreateIndex(colName string) error {
+	return tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		col, ok := tbl.cols[colName]
+		if !ok {
+			return 0, fmt.Errorf("Cannot create index on column %s: %w", colName, ErrNotExist)
+		}
+		if _, ok := tbl.btrees[colName]; ok {
+			return 0, fmt.Errorf("Cannot create index on column %s: index %w", colName, ErrAlreadyExists)
+		}
+		return tbl.logAndApply(tbl.record(walCreateIndex, []string{colName}), func() {
+			tbl.btrees[colName] = tbl.buildBtree(col)
+		})
+	})
+}
+
+// buildBtree indexes the items of col in the live rows. The caller must
+// hold the table lock.
+func (tbl *table) buildBtree(col *column) *btree {
+	col.lock.Lock()
+	defer col.lock.Unlock()
+
+	entries := make([]btreeEntry, 0, tbl.numRows)
+	for id := int64(0); id < tbl.numRows; id++ {
+		if !col.isNull(id) && !tbl.deletes.contains(id) {
+			entries = append(entries, btreeEntry{key: btreeKeyAt(col, id), id: id})
+		}
+	}
+	t := newBtree(col.typ == TypeString)
+	slices.SortFunc(entries, t.compare)
+	return buildBtree(t.strs, entries)
+}
+
+// rebuildBtrees rebuilds every ordered index from the rows of the table.
+// The caller must hold the table lock.
+func (tbl *table) rebuildBtrees() {
+	for name := range tbl.btrees {
+		tbl.btrees[name] = tbl.buildBtree(tbl.cols[name])
+	}
+}
+
+// indexItems adds the items of col in rows ids to its ordered index, if it
+// has one. The caller must hold the table lock but not the column lock.
+func (tbl *table) indexItems(col *column, ids []int64) {
+	t, ok := tbl.btrees[col.name]
+	if !ok {
+		return
+	}
+	col.lock.Lock()
+	defer col.lock.Unlock()
+	for _, id := range ids {
+		if !col.isNull(id) {
+			t.insert(btreeEntry{key: btreeKeyAt(col, id), id: id})
+		}
+	}
+}
+
+// unindexItems removes the items of col in rows ids from its ordered index,
+// if it has one. The caller must hold the table lock but not the column
+// lock.
+func (tbl *table) unindexItems(col *column, ids []int64) {
+	t, ok := tbl.btrees[col.name]
+	if !ok {
+		return
+	}
+	col.lock.Lock()
+	defer col.lock.Unlock()
+	for _, id := range ids {
+		if !col.isNull(id) {
+			t.delete(btreeEntry{key: btreeKeyAt(col, id), id: id})
+		}
+	}
+}
+
+func btreeKeyAt(col *column, id int64) btreeKey {
+	if col.typ == TypeString {
+		return btreeKey{str: col.dict[col.data[id]]}
+	}
+	return btreeKey{word: col.data[id]}
+}
+
+func btreeKeyOf(val Value) btreeKey {
+	if val.typ == TypeString {
+		return btreeKey{str: val.s}
+	}
+	return btreeKey{word: val.fixedWord()}
+}
+
+// keyRange is a range of keys of an ordered index. A nil bound leaves that
+// end open, and an exclusive bound is not part of the range.
+type keyRange struct {
+	lower, upper                   *btreeKey
+	lowerExclusive, upperExclusive bool
+}
+
+func pointRange(val Value) keyRange {
+	key := btreeKeyOf(val)
+	return keyRange{lower: &key, upper: &key}
+}
+
+// predicateRanges returns the ranges of keys that match p, or false if p is
+// not a range, as Ne is not.
+func predicateRanges(p Predicate) ([]keyRange, bool) {
+	bound := func(i int) *btreeKey {
+		key := btreeKeyOf(p.vals[i])
+		return &key
+	}
+	switch p.op {
+	case predicateEq:
+		return []keyRange{pointRange(p.vals[0])}, true
+	case predicateLt:
+		return []keyRange{{upper: bound(0), upperExclusive: true}}, true
+	case predicateLe:
+		return []keyRange{{upper: bound(0)}}, true
+	case predicateGt:
+		return []keyRange{{lower: bound(0), lowerExclusive: true}}, true
+	case predicateGe:
+		return []keyRange{{lower: bound(0)}}, true
+	case predicateBetween:
+		return []keyRange{{lower: bound(0), upper: bound(1)}}, true
+	case predicateIn:
+		ranges := []keyRange{}
+		for _, val := range p.vals {
+			if !val.null {
+				ranges = append(ranges, pointRange(val))
+			}
+		}
+		return ranges, true
+	}
+	return nil, false
+}
+
+// indexSelect returns a condition matching the live rows whose item of col
+// falls in one of ranges, read from the ordered index of col. It returns
+// false if col has no index or the ranges match too many rows for the
+// index to beat a scan. The caller must hold the table lock.
+func (tbl *table) indexSelect(col *column, ranges []keyRange) (*condition, bool) {
+	t, ok := tbl.btrees[col.name]
+	if !ok {
+		return nil, false
+	}
+
+	limit := tbl.numRows / indexSelectivity
+	var ids []int64
+	for _, r := range ranges {
+		t.ascend(r.lower, func(e btreeEntry) bool {
+			if r.lowerExclusive && t.compareKeys(e.key, *r.lower) == 0 {
+				return true
+			}
+			if r.upper != nil {
+				cmp := t.compareKeys(e.key, *r.upper)
+				if cmp > 0 || (cmp == 0 && r.upperExclusive) {
+					return false
+				}
+			}
+			ids = append(ids, e.id)
+			return int64(len(ids)) <= limit
+		})
+		if int64(len(ids)) > limit {
+			return nil, false
+		}
+	}
+
+	slices.Sort(ids)
+	c := NewCondition()
+	for _, id := range ids {
+		c.ids.add(id)
+	}
+	return c, true
+}
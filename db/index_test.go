@@ -0,0 +1,191 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashIndexKey(t *testing.T) {
+	idx := newHashIndex([]string{"a", "b"}, false)
+	keyOf := func(a Value, b Value) (string, bool) {
+		return idx.key(func(colName string) Value {
+			if colName == "a" {
+				return a
+			}
+			return b
+		})
+	}
+
+	k1, ok := keyOf(StringValue("ab"), StringValue("c"))
+	assert.True(t, ok)
+	k2, ok := keyOf(StringValue("a"), StringValue("bc"))
+	assert.True(t, ok)
+	assert.NotEqual(t, k1, k2)
+
+	k3, ok := keyOf(Int64Value(1), BoolValue(true))
+	assert.True(t, ok)
+	k4, ok := keyOf(Int64Value(1), Int64Value(1))
+	assert.True(t, ok)
+	assert.NotEqual(t, k3, k4)
+
+	k5, ok := keyOf(Float64Value(0), Float64Value(1.5))
+	assert.True(t, ok)
+	k6, _ := keyOf(Float64Value(0), Float64Value(1.5))
+	assert.Equal(t, k5, k6)
+
+	_, ok = keyOf(Int64Value(1), NullValue())
+	assert.False(t, ok)
+
+	assert.Equal(t, "UNIQUE (a, b)", idx.String())
+	assert.Equal(t, "PRIMARY KEY (id)", newHashIndex([]string{"id"}, true).String())
+}
+
+// assertIndexed checks that the ordered index of colName holds exactly the
+// entries a rebuild would.
+func assertIndexed(t *testing.T, tbl *table, colName string) {
+	t.Helper()
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	tree, ok := tbl.btrees[colName]
+	require.True(t, ok, "column %s has no index", colName)
+	assert.Equal(t, btreeEntries(tbl.buildBtree(tbl.cols[colName])), btreeEntries(tree))
+}
+
+func TestCreateIndex(t *testing.T) {
+	schema, err := NewSchema(NewColumnDef("n", TypeInt64), NewColumnDef("name", TypeString))
+	require.NoError(t, err)
+	tbl := NewTable(WithSchema(schema))
+	rows := make([][]Value, 1000)
+	for i := range rows {
+		rows[i] = []Value{Int64Value(int64(i % 500)), StringValue(fmt.Sprintf("name%03d", i%100))}
+	}
+	rows[7][0] = NullValue()
+	require.NoError(t, tbl.InsertValueRows([]string{"n", "name"}, rows))
+	n, _ := tbl.GetColumn("n")
+	name, _ := tbl.GetColumn("name")
+
+	require.NoError(t, tbl.CreateIndex("n"))
+	require.NoError(t, tbl.CreateIndex("name"))
+	assert.ErrorIs(t, tbl.CreateIndex("n"), ErrAlreadyExists)
+	assert.ErrorIs(t, tbl.CreateIndex("missing"), ErrNotExist)
+	assert.True(t, tbl.Stats().Columns[0].Indexed)
+
+	// selects through the index match scans
+	scan := func(sel func(c *condition) error) []int64 {
+		c := NewCondition()
+		require.NoError(t, sel(c))
+		return tbl.matchingIds(c)
+	}
+	assertSame := func(expect []int64, c *condition, err error) {
+		t.Helper()
+		require.NoError(t, err)
+		assert.Equal(t, expect, tbl.matchingIds(c))
+	}
+	c, err := tbl.Select(n, 10, 13)
+	assertSame(scan(func(c *condition) error { return c.Select(n, 10, 13) }), c, err)
+	assert.Len(t, tbl.matchingIds(c), 6)
+	for _, p := range []Predicate{
+		Eq(Int64Value(7)), Le(Int64Value(3)), Lt(Int64Value(3)), Gt(Int64Value(495)), Ge(Int64Value(495)),
+		Between(Int64Value(100), Int64Value(110)), In(Int64Value(1), NullValue(), Int64Value(499)),
+	} {
+		c, err := tbl.SelectWhere(n, p)
+		assertSame(scan(func(c *condition) error { return c.SelectWhere(n, p) }), c, err)
+	}
+	c, err = tbl.SelectValues(name, StringValue("name010"), StringValue("name012"))
+	assertSame(scan(func(c *condition) error { return c.SelectValues(name, StringValue("name010"), StringValue("name012")) }), c, err)
+	assert.Len(t, tbl.matchingIds(c), 20)
+
+	// the index is used only when few rows match
+	tbl.lock.Lock()
+	_, ok := tbl.indexSelect(n, []keyRange{pointRange(Int64Value(3))})
+	assert.True(t, ok)
+	_, ok = tbl.indexSelect(n, []keyRange{{upper: &btreeKey{word: 200}}})
+	assert.False(t, ok)
+	tbl.lock.Unlock()
+	c, err = tbl.SelectWhere(n, Lt(Int64Value(200)))
+	assertSame(scan(func(c *condition) error { return c.SelectWhere(n, Lt(Int64Value(200))) }), c, err)
+	c, err = tbl.SelectWhere(n, Ne(Int64Value(3)))
+	assertSame(scan(func(c *condition) error { return c.SelectWhere(n, Ne(Int64Value(3))) }), c, err)
+	_, err = tbl.SelectWhere(n, Eq(StringValue("x")))
+	assert.EqualError(t, err, "Select: type mismatch: column n has type int64, got string")
+
+	// every write keeps the indexes up to date
+	require.NoError(t, tbl.InsertValues([]string{"n", "name"}, []Value{Int64Value(-5), StringValue("new")}))
+	c, err = tbl.SelectWhere(n, Eq(Int64Value(-5)))
+	assertSame([]int64{1000}, c, err)
+	c, err = tbl.SelectWhere(n, Eq(Int64Value(3)))
+	require.NoError(t, err)
+	require.NoError(t, tbl.UpdateValues(c, []string{"n", "name"}, []Value{Int64Value(9000), NullValue()}))
+	c, err = tbl.SelectWhere(n, Eq(Int64Value(3)))
+	assertSame(nil, c, err)
+	c, err = tbl.SelectWhere(n, Eq(Int64Value(9000)))
+	assertSame([]int64{3, 503}, c, err)
+	require.NoError(t, tbl.DeleteRows([]int64{503, 4}))
+	c, err = tbl.SelectWhere(n, Eq(Int64Value(9000)))
+	assertSame([]int64{3}, c, err)
+	_, err = tbl.DeleteMatching(c)
+	require.NoError(t, err)
+	assertIndexed(t, tbl, "n")
+	assertIndexed(t, tbl, "name")
+
+	_, err = tbl.Vacuum()
+	require.NoError(t, err)
+	assertIndexed(t, tbl, "n")
+	c, err = tbl.SelectWhere(n, Eq(Int64Value(-5)))
+	assertSame([]int64{997}, c, err)
+}
+
+func TestIndexLoadAndDelete(t *testing.T) {
+	tbl := NewTable()
+	_, err := tbl.CreateColumn("a")
+	require.NoError(t, err)
+	require.NoError(t, tbl.CreateIndex("a"))
+	vals := make([]int64, 100)
+	for i := range vals {
+		vals[i] = int64(100 - i)
+	}
+	require.NoError(t, tbl.LoadColumns([]string{"a"}, vals))
+	assertIndexed(t, tbl, "a")
+	require.NoError(t, tbl.InsertRows([]string{"a"}, [][]int64{{1}, {1}}))
+	assertIndexed(t, tbl, "a")
+
+	// deleting the column drops its index
+	require.NoError(t, tbl.DeleteColumn("a"))
+	assert.Empty(t, tbl.btrees)
+}
+
+func TestIndexPersistence(t *testing.T) {
+	dir := t.TempDir()
+	manager := startManager(t, dir)
+	db1, err := manager.CreateDb("testdb1")
+	require.NoError(t, err)
+	tbl, err := db1.CreateTable("tbl1")
+	require.NoError(t, err)
+	_, err = tbl.CreateColumn("a")
+	require.NoError(t, err)
+	require.NoError(t, tbl.InsertRows([]string{"a"}, [][]int64{{3}, {1}, {2}}))
+	require.NoError(t, tbl.CreateIndex("a"))
+	require.NoError(t, tbl.InsertRow([]string{"a"}, []int64{0}))
+
+	// the index is replayed from the log after a crash
+	restarted := startManager(t, dir)
+	rdb1, err := restarted.GetDb("testdb1")
+	require.NoError(t, err)
+	rtbl, err := rdb1.GetTable("tbl1")
+	require.NoError(t, err)
+	assertIndexed(t, rtbl, "a")
+	assert.Len(t, btreeEntries(rtbl.btrees["a"]), 4)
+
+	// and restored from the snapshot after a checkpoint
+	require.NoError(t, restarted.End())
+	again := startManager(t, dir)
+	adb1, err := again.GetDb("testdb1")
+	require.NoError(t, err)
+	atbl, err := adb1.GetTable("tbl1")
+	require.NoError(t, err)
+	assertIndexed(t, atbl, "a")
+	assert.NoError(t, again.End())
+}
@@ -0,0 +1,356 @@
+package db
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// JoinType is the kind of an equi-join.
+type JoinType uint8
+
+const (
+	// InnerJoin pairs every left row with every right row of equal key.
+	InnerJoin JoinType = iota
+	// LeftJoin is like InnerJoin but also keeps the left rows without a
+	// match, paired with no right row.
+	LeftJoin
+	// SemiJoin keeps the left rows with at least one match.
+	SemiJoin
+	// AntiJoin keeps the left rows without a match.
+	AntiJoin
+)
+
+func (typ JoinType) String() string {
+	switch typ {
+	case InnerJoin:
+		return "INNER"
+	case LeftJoin:
+		return "LEFT"
+	case SemiJoin:
+		return "SEMI"
+	case AntiJoin:
+		return "ANTI"
+	}
+	return fmt.Sprintf("JoinType(%d)", uint8(typ))
+}
+
+// JoinSide is an input of a join: the live rows of Table that Cond matches,
+// or all of them if Cond is nil, keyed by the items of Col.
+type JoinSide struct {
+	Table *table
+	Cond  *condition
+	Col   *column
+}
+
+// JoinResult holds the rows a join matched as pairs of row ids. Right is
+// -1 for the left rows a left join keeps without a match, and nil for semi
+// and anti joins, which only return left rows. A vacuum of either table
+// renumbers its rows, after which Values fails.
+type JoinResult struct {
+	Left  []int64
+	Right []int64
+	left  *table
+	right *table
+	// leftGeneration and rightGeneration are the table generations the
+	// ids were read in.
+	leftGeneration  uint64
+	rightGeneration uint64
+}
+
+// Len returns the number of rows of the result.
+func (res *JoinResult) Len() int {
+	return len(res.Left)
+}
+
+// Join joins left and right where the key of the left row equals the key
+// of the right row. It is a merge join when both keys are already in row
+// order, as in tables loaded sorted by key, and a hash join otherwise.
+func Join(left JoinSide, right JoinSide, typ JoinType) (*JoinResult, error) {
+	return join(left, right, typ, nil)
+}
+
+// HashJoin joins left and right by building a hash table of the right keys
+// and probing it with each left row. Pairs come in left row order, then
+// right row order.
+func HashJoin(left JoinSide, right JoinSide, typ JoinType) (*JoinResult, error) {
+	hash := true
+	return join(left, right, typ, &hash)
+}
+
+// MergeJoin joins left and right by walking both in key order, sorting a
+// side first unless its keys are already in row order. Pairs come in key
+// order, and the left rows a left or anti join keeps for their null keys
+// come last.
+func MergeJoin(left JoinSide, right JoinSide, typ JoinType) (*JoinResult, error) {
+	hash := false
+	return join(left, right, typ, &hash)
+}
+
+// join runs a hash join if hash is true, a merge join if it is false, and
+// picks one if it is nil.
+func join(left JoinSide, right JoinSide, typ JoinType, hash *bool) (*JoinResult, error) {
+	if typ > AntiJoin {
+		return nil, fmt.Errorf("Cannot join: unknown join type %s", typ)
+	}
+	if left.Col.typ != right.Col.typ {
+		return nil, fmt.Errorf("Cannot join column %s of type %s with column %s of type %s",
+			left.Col.name, left.Col.typ, right.Col.name, right.Col.typ)
+	}
+
+	var res *JoinResult
+	var err error
+	if left.Col.typ == TypeString {
+		res, err = joinKeys(left, right, typ, hash, func(col *column, id int64) string {
+			return col.dict[col.data[id]]
+		})
+	} else {
+		res, err = joinKeys(left, right, typ, hash, func(col *column, id int64) int64 {
+			return col.data[id]
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.left, res.right = left.Table, right.Table
+	if typ == SemiJoin || typ == AntiJoin {
+		res.Right = nil
+	}
+	return res, nil
+}
+
+// joinKeys reads the keys of both sides with key and joins them. The words
+// of fixed types are compared as they are, and strings by value since the
+// dictionaries of two columns differ.
+func joinKeys[K cmp.Ordered](left JoinSide, right JoinSide, typ JoinType, hash *bool, key func(col *column, id int64) K) (*JoinResult, error) {
+	l, err := readJoinInput(left, key)
+	if err != nil {
+		return nil, err
+	}
+	r, err := readJoinInput(right, key)
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		useHash := !l.sorted() || !r.sorted()
+		hash = &useHash
+	}
+	var res *JoinResult
+	if *hash {
+		res = hashJoin(l, r, typ)
+	} else {
+		res = mergeJoin(l, r, typ)
+	}
+	res.leftGeneration, res.rightGeneration = l.generation, r.generation
+	return res, nil
+}
+
+// joinInput holds the keys of the rows of a side, in row order. Rows with
+// a null key never match and are kept apart.
+type joinInput[K cmp.Ordered] struct {
+	ids   []int64
+	keys  []K
+	nulls []int64
+	// generation is the table generation the ids were read in.
+	generation uint64
+}
+
+// readJoinInput reads the keys of a side with its table locked, so that
+// the join itself never holds the locks of both tables.
+func readJoinInput[K cmp.Ordered](side JoinSide, key func(col *column, id int64) K) (*joinInput[K], error) {
+	tbl, col := side.Table, side.Col
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	if tbl.cols[col.name] != col {
+		return nil, fmt.Errorf("Cannot join on column %s: column not found", col.name)
+	}
+	if side.Cond != nil {
+		if err := tbl.checkGeneration(side.Cond); err != nil {
+			return nil, err
+		}
+	}
+	col.lock.Lock()
+	defer col.lock.Unlock()
+
+	in := &joinInput[K]{generation: tbl.generation}
+	add := func(id int64) {
+		if col.isNull(id) {
+			in.nulls = append(in.nulls, id)
+			return
+		}
+		in.ids = append(in.ids, id)
+		in.keys = append(in.keys, key(col, id))
+	}
+	if side.Cond == nil {
+		for id := int64(0); id < tbl.numRows; id++ {
+			if !tbl.deletes.contains(id) {
+				add(id)
+			}
+		}
+		return in, nil
+	}
+	for _, id := range tbl.liveIds(side.Cond) {
+		add(id)
+	}
+	return in, nil
+}
+
+func (in *joinInput[K]) sorted() bool {
+	return slices.IsSorted(in.keys)
+}
+
+// sort orders the rows by key, keeping rows of equal key in row order.
+func (in *joinInput[K]) sort() {
+	if in.sorted() {
+		return
+	}
+	order := make([]int, len(in.ids))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(in.keys[a], in.keys[b])
+	})
+	ids, keys := make([]int64, len(order)), make([]K, len(order))
+	for i, pos := range order {
+		ids[i], keys[i] = in.ids[pos], in.keys[pos]
+	}
+	in.ids, in.keys = ids, keys
+}
+
+// joinOutput collects the pairs of a join.
+type joinOutput struct {
+	typ JoinType
+	res *JoinResult
+}
+
+// matched adds left row id paired with the right rows of rightIds.
+func (out *joinOutput) matched(id int64, rightIds []int64) {
+	switch out.typ {
+	case InnerJoin, LeftJoin:
+		for _, rightId := range rightIds {
+			out.res.Left = append(out.res.Left, id)
+			out.res.Right = append(out.res.Right, rightId)
+		}
+	case SemiJoin:
+		out.res.Left = append(out.res.Left, id)
+	}
+}
+
+// unmatched adds left row id, which has no match.
+func (out *joinOutput) unmatched(id int64) {
+	switch out.typ {
+	case LeftJoin:
+		out.res.Left = append(out.res.Left, id)
+		out.res.Right = append(out.res.Right, -1)
+	case AntiJoin:
+		out.res.Left = append(out.res.Left, id)
+	}
+}
+
+func hashJoin[K cmp.Ordered](l *joinInput[K], r *joinInput[K], typ JoinType) *JoinResult {
+	table := make(map[K][]int64)
+	for i, k := range r.keys {
+		table[k] = append(table[k], r.ids[i])
+	}
+
+	out := &joinOutput{typ: typ, res: &JoinResult{}}
+	nulls := l.nulls
+	for i, id := range l.ids {
+		// keep the left rows in row order by merging in the null ones
+		for len(nulls) > 0 && nulls[0] < id {
+			out.unmatched(nulls[0])
+			nulls = nulls[1:]
+		}
+		if rightIds, ok := table[l.keys[i]]; ok {
+			out.matched(id, rightIds)
+		} else {
+			out.unmatched(id)
+		}
+	}
+	for _, id := range nulls {
+		out.unmatched(id)
+	}
+	return out.res
+}
+
+func mergeJoin[K cmp.Ordered](l *joinInput[K], r *joinInput[K], typ JoinType) *JoinResult {
+	l.sort()
+	r.sort()
+
+	out := &joinOutput{typ: typ, res: &JoinResult{}}
+	i, j := 0, 0
+	for i < len(l.ids) {
+		for j < len(r.ids) && r.keys[j] < l.keys[i] {
+			j++
+		}
+		// r.ids[j:end] are the right rows with the key of left row i
+		end := j
+		for end < len(r.ids) && r.keys[end] == l.keys[i] {
+			end++
+		}
+		for k := l.keys[i]; i < len(l.ids) && l.keys[i] == k; i++ {
+			if end > j {
+				out.matched(l.ids[i], r.ids[j:end])
+			} else {
+				out.unmatched(l.ids[i])
+			}
+		}
+		j = end
+	}
+	for _, id := range l.nulls {
+		out.unmatched(id)
+	}
+	return out.res
+}
+
+// Values returns the items of the left columns followed by the right
+// columns for each row of the result, one slice per column as GetValues
+// does. The right items of the unmatched rows of a left join are null.
+func (res *JoinResult) Values(leftCols []*column, rightCols []*column) ([][]Value, error) {
+	if len(rightCols) > 0 && res.Right == nil {
+		return nil, fmt.Errorf("Cannot project right columns: the join returned only left rows")
+	}
+	vals, err := projectColumns(res.left, res.leftGeneration, res.Left, leftCols)
+	if err != nil {
+		return nil, err
+	}
+	rightVals, err := projectColumns(res.right, res.rightGeneration, res.Right, rightCols)
+	if err != nil {
+		return nil, err
+	}
+	return append(vals, rightVals...), nil
+}
+
+// projectColumns reads the items of cols at ids, with null items at id -1,
+// unless a vacuum renumbered the rows since generation.
+func projectColumns(tbl *table, generation uint64, ids []int64, cols []*column) ([][]Value, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	if len(cols) > 0 && tbl.generation != generation {
+		return nil, fmt.Errorf("Cannot project columns: the table was vacuumed after the join")
+	}
+
+	res := make([][]Value, 0, len(cols))
+	for _, col := range cols {
+		if tbl.cols[col.name] != col {
+			return nil, fmt.Errorf("Could not fetch column %s: column not found", col.name)
+		}
+		col.lock.Lock()
+		colRes := make([]Value, len(ids))
+		for i, id := range ids {
+			if id >= tbl.numRows {
+				col.lock.Unlock()
+				return nil, fmt.Errorf("Could not fetch column %s: row %d no longer exists", col.name, id)
+			}
+			if id < 0 {
+				colRes[i] = NullValue()
+				continue
+			}
+			colRes[i] = col.value(id)
+		}
+		col.lock.Unlock()
+		res = append(res, colRes)
+	}
+	return res, nil
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoin(t *testing.T) {
+	customers := NewTable()
+	id, err := customers.CreateTypedColumn("id", TypeInt64)
+	require.NoError(t, err)
+	name, err := customers.CreateTypedColumn("name", TypeString)
+	require.NoError(t, err)
+	require.NoError(t, customers.InsertValueRows([]string{"id", "name"}, [][]Value{
+		{Int64Value(3), StringValue("cy")},
+		{Int64Value(1), StringValue("ann")},
+		{NullValue(), StringValue("nobody")},
+		{Int64Value(2), StringValue("bob")},
+	}))
+
+	orders := NewTable()
+	customerId, err := orders.CreateTypedColumn("customer_id", TypeInt64)
+	require.NoError(t, err)
+	amount, err := orders.CreateTypedColumn("amount", TypeFloat64)
+	require.NoError(t, err)
+	require.NoError(t, orders.InsertValueRows([]string{"customer_id", "amount"}, [][]Value{
+		{Int64Value(1), Float64Value(10)},
+		{Int64Value(3), Float64Value(5)},
+		{Int64Value(1), Float64Value(2.5)},
+		{NullValue(), Float64Value(7)},
+		{Int64Value(9), Float64Value(1)},
+		{Int64Value(3), Float64Value(4)},
+	}))
+	// deleted rows do not join
+	require.NoError(t, orders.DeleteRows([]int64{5}))
+
+	left := JoinSide{Table: customers, Col: id}
+	right := JoinSide{Table: orders, Col: customerId}
+
+	tests := []struct {
+		typ   JoinType
+		hash  *JoinResult
+		merge *JoinResult
+	}{
+		{
+			typ:   InnerJoin,
+			hash:  &JoinResult{Left: []int64{0, 1, 1}, Right: []int64{1, 0, 2}},
+			merge: &JoinResult{Left: []int64{1, 1, 0}, Right: []int64{0, 2, 1}},
+		},
+		{
+			typ:   LeftJoin,
+			hash:  &JoinResult{Left: []int64{0, 1, 1, 2, 3}, Right: []int64{1, 0, 2, -1, -1}},
+			merge: &JoinResult{Left: []int64{1, 1, 3, 0, 2}, Right: []int64{0, 2, -1, 1, -1}},
+		},
+		{
+			typ:   SemiJoin,
+			hash:  &JoinResult{Left: []int64{0, 1}},
+			merge: &JoinResult{Left: []int64{1, 0}},
+		},
+		{
+			typ:   AntiJoin,
+			hash:  &JoinResult{Left: []int64{2, 3}},
+			merge: &JoinResult{Left: []int64{3, 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ.String(), func(t *testing.T) {
+			res, err := HashJoin(left, right, tt.typ)
+			require.NoError(t, err)
+			assert.Equal(t, tt.hash.Left, res.Left)
+			assert.Equal(t, tt.hash.Right, res.Right)
+
+			res, err = MergeJoin(left, right, tt.typ)
+			require.NoError(t, err)
+			assert.Equal(t, tt.merge.Left, res.Left)
+			assert.Equal(t, tt.merge.Right, res.Right)
+
+			// the keys are not sorted, so Join hashes
+			res, err = Join(left, right, tt.typ)
+			require.NoError(t, err)
+			assert.Equal(t, tt.hash.Left, res.Left)
+		})
+	}
+
+	t.Run("values", func(t *testing.T) {
+		res, err := HashJoin(left, right, LeftJoin)
+		require.NoError(t, err)
+		assert.Equal(t, 5, res.Len())
+		vals, err := res.Values([]*column{name}, []*column{amount})
+		require.NoError(t, err)
+		assert.Equal(t, [][]Value{
+			{StringValue("cy"), StringValue("ann"), StringValue("ann"), StringValue("nobody"), StringValue("bob")},
+			{Float64Value(5), Float64Value(10), Float64Value(2.5), NullValue(), NullValue()},
+		}, vals)
+
+		res, err = HashJoin(left, right, SemiJoin)
+		require.NoError(t, err)
+		_, err = res.Values([]*column{name}, []*column{amount})
+		assert.EqualError(t, err, "Cannot project right columns: the join returned only left rows")
+		_, err = res.Values([]*column{amount}, nil)
+		assert.EqualError(t, err, "Could not fetch column amount: column not found")
+	})
+
+	t.Run("vacuum", func(t *testing.T) {
+		a, b := NewTable(), NewTable()
+		require.NoError(t, a.LoadColumns([]string{"k"}, []int64{1, 2, 3}))
+		require.NoError(t, b.LoadColumns([]string{"k"}, []int64{3, 2, 1}))
+		ak, _ := a.GetColumn("k")
+		bk, _ := b.GetColumn("k")
+		res, err := HashJoin(JoinSide{Table: a, Col: ak}, JoinSide{Table: b, Col: bk}, InnerJoin)
+		require.NoError(t, err)
+		require.NoError(t, b.DeleteRows([]int64{0}))
+		_, err = b.Vacuum()
+		require.NoError(t, err)
+
+		// the left table kept its ids
+		_, err = res.Values([]*column{ak}, nil)
+		assert.NoError(t, err)
+		_, err = res.Values([]*column{ak}, []*column{bk})
+		assert.EqualError(t, err, "Cannot project columns: the table was vacuumed after the join")
+	})
+
+	t.Run("conditions", func(t *testing.T) {
+		big, err := orders.SelectValues(amount, Float64Value(5), Float64Value(100))
+		require.NoError(t, err)
+		notCy, err := customers.SelectWhere(name, Ne(StringValue("cy")))
+		require.NoError(t, err)
+		res, err := HashJoin(JoinSide{Table: customers, Cond: notCy, Col: id}, JoinSide{Table: orders, Cond: big, Col: customerId}, InnerJoin)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1}, res.Left)
+		assert.Equal(t, []int64{0}, res.Right)
+	})
+
+	t.Run("strings", func(t *testing.T) {
+		// the dictionaries of the two columns differ
+		other := NewTable()
+		nick, err := other.CreateTypedColumn("nick", TypeString)
+		require.NoError(t, err)
+		require.NoError(t, other.InsertValueRows([]string{"nick"}, [][]Value{{StringValue("bob")}, {StringValue("zed")}, {StringValue("ann")}}))
+		res, err := Join(JoinSide{Table: other, Col: nick}, JoinSide{Table: customers, Col: name}, InnerJoin)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{0, 2}, res.Left)
+		assert.Equal(t, []int64{3, 1}, res.Right)
+	})
+
+	t.Run("self join", func(t *testing.T) {
+		res, err := Join(right, right, InnerJoin)
+		require.NoError(t, err)
+		assert.Equal(t, 6, res.Len())
+	})
+
+	_, err = Join(JoinSide{Table: customers, Col: name}, right, InnerJoin)
+	assert.EqualError(t, err, "Cannot join column name of type string with column customer_id of type int64")
+	_, err = Join(JoinSide{Table: customers, Col: customerId}, right, InnerJoin)
+	assert.EqualError(t, err, "Cannot join on column customer_id: column not found")
+}
+
+func TestMergeJoinSorted(t *testing.T) {
+	left, right := NewTable(), NewTable()
+	lcol, err := left.CreateColumn("k")
+	require.NoError(t, err)
+	rcol, err := right.CreateColumn("k")
+	require.NoError(t, err)
+	require.NoError(t, left.LoadColumns([]string{"k"}, []int64{1, 2, 2, 4, 6}))
+	require.NoError(t, right.LoadColumns([]string{"k"}, []int64{2, 2, 3, 4, 4, 7}))
+
+	for _, typ := range []JoinType{InnerJoin, LeftJoin, SemiJoin, AntiJoin} {
+		hash, err := HashJoin(JoinSide{Table: left, Col: lcol}, JoinSide{Table: right, Col: rcol}, typ)
+		require.NoError(t, err)
+		// sorted keys merge in row order, so both agree
+		merge, err := Join(JoinSide{Table: left, Col: lcol}, JoinSide{Table: right, Col: rcol}, typ)
+		require.NoError(t, err)
+		assert.Equal(t, hash.Left, merge.Left, typ.String())
+		assert.Equal(t, hash.Right, merge.Right, typ.String())
+	}
+
+	res, err := MergeJoin(JoinSide{Table: left, Col: lcol}, JoinSide{Table: right, Col: rcol}, InnerJoin)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 1, 2, 2, 3, 3}, res.Left)
+	assert.Equal(t, []int64{0, 1, 0, 1, 3, 4}, res.Right)
+}
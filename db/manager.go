@@ -2,69 +2,330 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// ErrAlreadyExists is wrapped by the errors of creating a database, table
+// or column with a name that is taken, and ErrNotExist by those of getting
+// or deleting one that does not exist. ErrConstraint matches the errors of
+// values that have the wrong type for their column or violate one of its
+// constraints, and ErrInvalidArgument those of other malformed writes, such
+// as columns of different lengths.
+var (
+	ErrAlreadyExists   = errors.New("already exists")
+	ErrNotExist        = errors.New("does not exist")
+	ErrConstraint      = errors.New("constraint violation")
+	ErrInvalidArgument = errors.New("invalid argument")
+)
+
 type Manager interface {
 	Start(ctx context.Context) error
 	End() error
+	Save() error
 	CreateDb(dbName string) (*db, error)
+	GetDb(dbName string) (*db, error)
 	DeleteDb(dbName string) error
+	DbNames() []string
+	Exec(ctx context.Context, sql string) (*Result, error)
+	NewSession() *Session
 }
 
 type defaultManager struct {
-	dbs    map[string]*db
-	numDbs int64
-	logger *zap.Logger
-	lock   sync.Mutex
+	dbs     map[string]*db
+	numDbs  int64
+	dataDir string
+	// loaded is set once Start has restored the data directory. Until
+	// then a snapshot of the manager would overwrite it with no dbs.
+	loaded            bool
+	wal               *wal
+	walSyncMode       WalSyncMode
+	groupCommitWindow time.Duration
+	vacuumInterval    time.Duration
+	// stopVacuum stops the background vacuum started by Start, if any.
+	stopVacuum func()
+	logger     *zap.Logger
+	lock       sync.Mutex
+}
+
+// ManagerOption configures optional behaviour of a defaultManager.
+type ManagerOption func(*defaultManager)
+
+// WithDataDir sets the directory that Save writes snapshots to and that
+// Start reloads them from. Without a data directory the manager is purely
+// in-memory.
+func WithDataDir(dir string) ManagerOption {
+	return func(dbm *defaultManager) {
+		dbm.dataDir = dir
+	}
 }
 
-func NewDefaultManager(logger *zap.Logger) *defaultManager {
-	return &defaultManager{
-		dbs:    make(map[string]*db),
-		numDbs: 0,
-		logger: logger,
+func NewDefaultManager(logger *zap.Logger, opts ...ManagerOption) *defaultManager {
+	dbm := &defaultManager{
+		dbs:               make(map[string]*db),
+		numDbs:            0,
+		walSyncMode:       WalSyncAlways,
+		groupCommitWindow: defaultGroupCommitWindow,
+		logger:            logger,
+	}
+	for _, opt := range opts {
+		opt(dbm)
 	}
+	return dbm
 }
 
-func (dbm *defaultManager) Start(_ context.Context) error {
+// Start reloads every db, table and column from the data directory if one
+// is configured, replays the write-ahead log on top of the last snapshot
+// and starts logging new operations. It then starts the background vacuum,
+// if configured, which runs until End or until ctx is done.
+func (dbm *defaultManager) Start(ctx context.Context) error {
+	if dbm.dataDir != "" {
+		if err := dbm.load(); err != nil {
+			return err
+		}
+	}
+
+	dbm.startVacuum(ctx)
 	return nil
 }
 
+// load restores the data directory into the manager and opens the
+// write-ahead log.
+func (dbm *defaultManager) load() error {
+	if err := os.MkdirAll(dbm.dataDir, 0o755); err != nil {
+		return fmt.Errorf("Cannot start manager: %v", err)
+	}
+
+	w, err := openWal(filepath.Join(dbm.dataDir, walFileName), dbm.walSyncMode, dbm.groupCommitWindow, dbm.logger)
+	if err != nil {
+		return fmt.Errorf("Cannot start manager: %v", err)
+	}
+
+	dbs, checkpointLsn, err := readSnapshot(dbm.dataDir, w)
+	if err != nil {
+		w.close()
+		return fmt.Errorf("Cannot start manager: %v", err)
+	}
+
+	dbm.lock.Lock()
+	dbm.dbs = dbs
+	dbm.numDbs = int64(len(dbs))
+	dbm.wal = w
+	dbm.lock.Unlock()
+
+	applied, err := w.replay(checkpointLsn, dbm.applyWalRecord)
+	if err != nil {
+		return fmt.Errorf("Cannot start manager: %v", err)
+	}
+
+	dbm.lock.Lock()
+	dbm.loaded = true
+	dbm.lock.Unlock()
+
+	dbm.logger.Info("loaded data directory",
+		zap.String("dataDir", dbm.dataDir),
+		zap.Int64("numDbs", int64(len(dbm.dbs))),
+		zap.Int("replayedRecords", applied))
+	return nil
+}
+
+// End stops the background vacuum, checkpoints the current state to the
+// data directory, if configured and loaded by Start, and closes the
+// write-ahead log.
 func (dbm *defaultManager) End() error {
+	if dbm.stopVacuum != nil {
+		dbm.stopVacuum()
+		dbm.stopVacuum = nil
+	}
+
+	if dbm.dataDir == "" {
+		return nil
+	}
+	dbm.lock.Lock()
+	loaded := dbm.loaded
+	dbm.lock.Unlock()
+	if !loaded {
+		// leave the data directory as it is, closing the log a failed
+		// Start may have opened
+		return dbm.wal.close()
+	}
+
+	err := dbm.Save()
+	if err != nil {
+		return err
+	}
+	return dbm.wal.close()
+}
+
+// Save writes every db, table and column to the data directory and then
+// truncates the write-ahead log, whose records the snapshot now covers.
+func (dbm *defaultManager) Save() error {
+	dbm.wal.beginCheckpoint()
+	defer dbm.wal.endCheckpoint()
+
+	dbm.lock.Lock()
+	defer dbm.lock.Unlock()
+
+	if dbm.dataDir == "" {
+		return fmt.Errorf("Cannot save: no data directory configured")
+	}
+	if !dbm.loaded {
+		return fmt.Errorf("Cannot save: the data directory is not loaded, Start the manager first")
+	}
+
+	err := writeSnapshot(dbm.dataDir, dbm.dbs, dbm.wal.lastLsn())
+	if err != nil {
+		return fmt.Errorf("Cannot save: %v", err)
+	}
+
+	err = dbm.wal.truncate()
+	if err != nil {
+		return fmt.Errorf("Cannot save: truncating write-ahead log: %v", err)
+	}
 	return nil
 }
 
 func (dbm *defaultManager) CreateDb(dbName string) (*db, error) {
+	var db *db
+	err := dbm.wal.logged(func() (int64, error) {
+		dbm.lock.Lock()
+		defer dbm.lock.Unlock()
+		if _, ok := dbm.dbs[dbName]; ok {
+			return 0, fmt.Errorf("Can't create db with name %s: Db %w", dbName, ErrAlreadyExists)
+		}
+
+		return dbm.wal.logAndApply(&walRecord{op: walCreateDb, dbName: dbName}, func() {
+			db = newDb(dbName, dbm.wal)
+			dbm.dbs[dbName] = db
+			dbm.numDbs += 1
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (dbm *defaultManager) GetDb(dbName string) (*db, error) {
 	dbm.lock.Lock()
 	defer dbm.lock.Unlock()
-	if _, ok := dbm.dbs[dbName]; ok {
-		return nil, fmt.Errorf("Can't create db with name %s: Db already exists", dbName)
-	}
 
-	db := NewDb()
-	dbm.dbs[dbName] = db
-	dbm.numDbs += 1
+	db, ok := dbm.dbs[dbName]
+	if !ok {
+		return nil, fmt.Errorf("Cannot get db with name %s: %w", dbName, ErrNotExist)
+	}
 	return db, nil
 }
 
-func (dbm *defaultManager) DeleteDb(dbName string) error {
+// DbNames returns the names of all dbs in sorted order.
+func (dbm *defaultManager) DbNames() []string {
 	dbm.lock.Lock()
 	defer dbm.lock.Unlock()
 
-	if _, ok := dbm.dbs[dbName]; !ok {
-		return fmt.Errorf("Cannot delete db with name %s: does not exist", dbName)
+	names := make([]string, 0, len(dbm.dbs))
+	for name := range dbm.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (dbm *defaultManager) DeleteDb(dbName string) error {
+	return dbm.wal.logged(func() (int64, error) {
+		dbm.lock.Lock()
+		defer dbm.lock.Unlock()
+
+		if _, ok := dbm.dbs[dbName]; !ok {
+			return 0, fmt.Errorf("Cannot delete db with name %s: %w", dbName, ErrNotExist)
+		}
+
+		return dbm.wal.logAndApply(&walRecord{op: walDeleteDb, dbName: dbName}, func() {
+			db := dbm.dbs[dbName]
+			db.lock.Lock()
+			db.dropTables()
+			db.dropped = true
+			db.lock.Unlock()
+
+			delete(dbm.dbs, dbName)
+			dbm.numDbs -= 1
+		})
+	})
+}
+
+func (dbm *defaultManager) walTable(rec *walRecord) (*table, error) {
+	db, err := dbm.GetDb(rec.dbName)
+	if err != nil {
+		return nil, err
 	}
+	return db.GetTable(rec.tblName)
+}
 
-	err := dbm.dbs[dbName].DeleteTables()
+// applyWalRecord re-runs a logged operation through the public API. The
+// wal drops the records these calls append while it is replaying.
+func (dbm *defaultManager) applyWalRecord(rec *walRecord) error {
+	switch rec.op {
+	case walCreateDb:
+		_, err := dbm.CreateDb(rec.dbName)
+		return err
+	case walDeleteDb:
+		return dbm.DeleteDb(rec.dbName)
+	case walCreateTable, walDeleteTable, walDeleteTables:
+		db, err := dbm.GetDb(rec.dbName)
+		if err != nil {
+			return err
+		}
+		switch rec.op {
+		case walCreateTable:
+			_, err = db.CreateTable(rec.tblName, WithSchema(rec.schema))
+		case walDeleteTable:
+			err = db.DeleteTable(rec.tblName)
+		default:
+			err = db.DeleteTables()
+		}
+		return err
+	}
+
+	tbl, err := dbm.walTable(rec)
 	if err != nil {
-		return fmt.Errorf("Cannot delete db with name %s: %v", dbName, err)
+		return err
 	}
 
-	delete(dbm.dbs, dbName)
-	dbm.numDbs -= 1
-	return nil
+	switch rec.op {
+	case walCreateColumn:
+		_, err = tbl.CreateTypedColumn(rec.colNames[0], rec.colType)
+	case walDeleteColumn:
+		err = tbl.DeleteColumn(rec.colNames[0])
+	case walDeleteColumns:
+		err = tbl.DeleteColumns()
+	case walInsertRow:
+		err = tbl.InsertRow(rec.colNames, rec.vals[0])
+	case walInsertRows:
+		err = tbl.InsertRows(rec.colNames, rec.vals)
+	case walLoadColumns:
+		err = tbl.LoadColumns(rec.colNames, rec.vals...)
+	case walInsertValues:
+		err = tbl.InsertValueRows(rec.colNames, rec.values)
+	case walLoadValues:
+		err = tbl.LoadValues(rec.colNames, rec.values...)
+	case walUpdateRows:
+		err = tbl.UpdateRows(rec.vals[0], rec.colNames, rec.values)
+	case walDeleteRows:
+		err = tbl.DeleteRows(rec.vals[0])
+	case walVacuum:
+		_, err = tbl.Vacuum()
+	case walCreateIndex:
+		err = tbl.CreateIndex(rec.colNames[0])
+	case walClusterBy:
+		err = tbl.ClusterBy(rec.colNames[0])
+	default:
+		err = fmt.Errorf("unknown op %d", rec.op)
+	}
+	return err
 }
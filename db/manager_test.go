@@ -20,6 +20,7 @@ func TestCreateDb(t *testing.T) {
 
 	assert.Equal(t, db1, manager.dbs["testdb1"])
 	assert.Equal(t, db2, manager.dbs["testdb2"])
+	assert.Equal(t, []string{"testdb1", "testdb2"}, manager.DbNames())
 }
 
 func TestDeleteDb(t *testing.T) {
@@ -35,9 +36,29 @@ func TestDeleteDb(t *testing.T) {
 
 	err = manager.DeleteDb("testdb1")
 	assert.ErrorContains(t, err, "does not exist")
+	assert.ErrorIs(t, err, ErrNotExist)
 
 	assert.Equal(t, int64(1), manager.numDbs)
 	assert.Equal(t, 1, len(manager.dbs))
 
 	assert.Equal(t, db2, manager.dbs["testdb2"])
 }
+
+func TestGetDb(t *testing.T) {
+	manager := NewDefaultManager(zap.NewNop())
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+
+	res, err := manager.GetDb("testdb1")
+	assert.NoError(t, err)
+	assert.Equal(t, db1, res)
+
+	_, err = manager.GetDb("testdb2")
+	assert.ErrorContains(t, err, "does not exist")
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	_, err = manager.CreateDb("testdb1")
+	assert.EqualError(t, err, "Can't create db with name testdb1: Db already exists")
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// NoLimit asks for every row after the offset.
+const NoLimit = -1
+
+// SortKey orders rows by the items of Col, from the largest down if Desc.
+// Nulls are larger than any item, so they come last in ascending order and
+// first in descending order.
+type SortKey struct {
+	Col  *column
+	Desc bool
+}
+
+// SortedIds returns the ids of the live rows c matches ordered by keys,
+// skipping the first offset rows and returning at most limit rows, or all
+// of them for NoLimit. Rows that tie on every key stay in row order. With a
+// limit only the first offset+limit rows are kept in a heap instead of
+// sorting every row.
+func (tbl *table) SortedIds(c *condition, keys []SortKey, offset int64, limit int64) ([]int64, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	if err := tbl.checkGeneration(c); err != nil {
+		return nil, err
+	}
+
+	unlock, err := tbl.lockSortKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return tbl.sortedIds(c, keys, offset, limit)
+}
+
+// GetSorted is like GetValues but returns the rows in the order of keys
+// and pages through them with offset and limit as SortedIds does.
+func (tbl *table) GetSorted(c *condition, cols []*column, keys []SortKey, offset int64, limit int64) ([][]Value, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	if err := tbl.checkGeneration(c); err != nil {
+		return nil, err
+	}
+
+	all := make([]*column, 0, len(cols)+len(keys))
+	all = append(all, cols...)
+	for _, key := range keys {
+		all = append(all, key.Col)
+	}
+	unlock, err := tbl.lockColumns("Could not sort by", all...)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	ids, err := tbl.sortedIds(c, keys, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([][]Value, len(cols))
+	for k, col := range cols {
+		res[k] = make([]Value, len(ids))
+		for i, id := range ids {
+			res[k][i] = col.value(id)
+		}
+	}
+	return res, nil
+}
+
+func (tbl *table) lockSortKeys(keys []SortKey) (func(), error) {
+	cols := make([]*column, len(keys))
+	for i, key := range keys {
+		cols[i] = key.Col
+	}
+	return tbl.lockColumns("Could not sort by", cols...)
+}
+
+// sortedIds implements SortedIds. The caller must hold the table lock and
+// the locks of the key columns.
+func (tbl *table) sortedIds(c *condition, keys []SortKey, offset int64, limit int64) ([]int64, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("Cannot sort: negative offset %d", offset)
+	}
+	if limit < 0 && limit != NoLimit {
+		return nil, fmt.Errorf("Cannot sort: negative limit %d", limit)
+	}
+	if limit == 0 {
+		return []int64{}, nil
+	}
+	if limit > math.MaxInt64-offset {
+		limit = NoLimit
+	}
+
+	cmp := rowComparer(keys)
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	ids := c.ids.andNot(tbl.deletes)
+
+	var sorted []int64
+	if limit == NoLimit {
+		sorted = make([]int64, 0, ids.cardinality())
+		ids.forEach(func(id int64) bool {
+			if id >= tbl.numRows {
+				return false
+			}
+			sorted = append(sorted, id)
+			return true
+		})
+		slices.SortFunc(sorted, cmp)
+	} else {
+		top := &topK{k: offset + limit, cmp: cmp}
+		ids.forEach(func(id int64) bool {
+			if id >= tbl.numRows {
+				return false
+			}
+			top.add(id)
+			return true
+		})
+		sorted = top.sorted()
+	}
+
+	if offset >= int64(len(sorted)) {
+		return []int64{}, nil
+	}
+	return sorted[offset:], nil
+}
+
+// rowComparer returns a comparison of row ids by keys, then by id.
+func rowComparer(keys []SortKey) func(a, b int64) int {
+	return func(a, b int64) int {
+		for _, key := range keys {
+			cmp := compareItems(key.Col, a, b)
+			if key.Desc {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp
+			}
+		}
+		return compareWords(a, b)
+	}
+}
+
+// compareItems compares the items at a and b of col, with nulls larger
+// than any item. The caller must hold the column lock.
+func compareItems(col *column, a int64, b int64) int {
+	aNull, bNull := col.isNull(a), col.isNull(b)
+	switch {
+	case aNull && bNull:
+		return 0
+	case aNull:
+		return 1
+	case bNull:
+		return -1
+	}
+	if col.typ == TypeString {
+		return compareStrings(col.dict[col.data[a]], col.dict[col.data[b]])
+	}
+	return compareWords(col.data[a], col.data[b])
+}
+
+// topK keeps the k smallest row ids by cmp in a heap whose root is the
+// largest of them, so each row costs at most O(log k).
+type topK struct {
+	k   int64
+	cmp func(a, b int64) int
+	ids []int64
+}
+
+func (t *topK) add(id int64) {
+	if int64(len(t.ids)) < t.k {
+		heap.Push(t, id)
+		return
+	}
+	if t.cmp(id, t.ids[0]) < 0 {
+		t.ids[0] = id
+		heap.Fix(t, 0)
+	}
+}
+
+// sorted returns the kept ids in ascending order.
+func (t *topK) sorted() []int64 {
+	slices.SortFunc(t.ids, t.cmp)
+	return t.ids
+}
+
+func (t *topK) Len() int           { return len(t.ids) }
+func (t *topK) Less(i, j int) bool { return t.cmp(t.ids[i], t.ids[j]) > 0 }
+func (t *topK) Swap(i, j int)      { t.ids[i], t.ids[j] = t.ids[j], t.ids[i] }
+func (t *topK) Push(x any)         { t.ids = append(t.ids, x.(int64)) }
+func (t *topK) Pop() any {
+	id := t.ids[len(t.ids)-1]
+	t.ids = t.ids[:len(t.ids)-1]
+	return id
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSorted(t *testing.T) {
+	schema, err := NewSchema(
+		NewColumnDef("name", TypeString),
+		NewColumnDef("score", TypeFloat64),
+		NewColumnDef("team", TypeInt64),
+	)
+	require.NoError(t, err)
+	tbl := NewTable(WithSchema(schema))
+	require.NoError(t, tbl.InsertValueRows([]string{"name", "score", "team"}, [][]Value{
+		{StringValue("cy"), Float64Value(7), Int64Value(1)},
+		{StringValue("ann"), Float64Value(9.5), Int64Value(2)},
+		{StringValue("dee"), NullValue(), Int64Value(1)},
+		{StringValue("bob"), Float64Value(7), Int64Value(2)},
+		{StringValue("eve"), Float64Value(-1), Int64Value(1)},
+		{StringValue("gone"), Float64Value(100), Int64Value(1)},
+	}))
+	require.NoError(t, tbl.DeleteRows([]int64{5}))
+
+	name, _ := tbl.GetColumn("name")
+	score, _ := tbl.GetColumn("score")
+	team, _ := tbl.GetColumn("team")
+	all := tbl.Not(NewCondition())
+	names := func(vals [][]Value) []string {
+		var res []string
+		for _, val := range vals[0] {
+			res = append(res, val.Str())
+		}
+		return res
+	}
+
+	tests := []struct {
+		name   string
+		keys   []SortKey
+		offset int64
+		limit  int64
+		expect []string
+	}{
+		{"by name", []SortKey{{Col: name}}, 0, NoLimit, []string{"ann", "bob", "cy", "dee", "eve"}},
+		// ties stay in row order and nulls come last
+		{"by score", []SortKey{{Col: score}}, 0, NoLimit, []string{"eve", "cy", "bob", "ann", "dee"}},
+		{"by score desc", []SortKey{{Col: score, Desc: true}}, 0, NoLimit, []string{"dee", "ann", "cy", "bob", "eve"}},
+		{"top 2", []SortKey{{Col: score, Desc: true}}, 0, 2, []string{"dee", "ann"}},
+		{"page", []SortKey{{Col: score, Desc: true}}, 1, 2, []string{"ann", "cy"}},
+		{"offset only", []SortKey{{Col: name}}, 3, NoLimit, []string{"dee", "eve"}},
+		{"past the end", []SortKey{{Col: name}}, 5, 3, []string{}},
+		{"large limit", []SortKey{{Col: name}}, 4, 1 << 62, []string{"eve"}},
+		{"several keys", []SortKey{{Col: team, Desc: true}, {Col: score}}, 0, NoLimit, []string{"bob", "ann", "eve", "cy", "dee"}},
+		{"row order", nil, 0, 3, []string{"cy", "ann", "dee"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vals, err := tbl.GetSorted(all, []*column{name}, tt.keys, tt.offset, tt.limit)
+			require.NoError(t, err)
+			if len(tt.expect) == 0 {
+				assert.Empty(t, vals[0])
+				return
+			}
+			assert.Equal(t, tt.expect, names(vals))
+		})
+	}
+
+	c, err := tbl.SelectWhere(team, Eq(Int64Value(1)))
+	require.NoError(t, err)
+	ids, err := tbl.SortedIds(c, []SortKey{{Col: score}}, 0, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4}, ids)
+	ids, err = tbl.SortedIds(c, []SortKey{{Col: score}}, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	_, err = tbl.SortedIds(all, []SortKey{{Col: NewColumn("score")}}, 0, NoLimit)
+	assert.EqualError(t, err, "Could not sort by column score: column not found")
+	_, err = tbl.SortedIds(all, []SortKey{{Col: score}}, -1, NoLimit)
+	assert.EqualError(t, err, "Cannot sort: negative offset -1")
+	_, err = tbl.SortedIds(all, []SortKey{{Col: score}}, 0, -2)
+	assert.EqualError(t, err, "Cannot sort: negative limit -2")
+}
+
+func TestSortedIdsTopK(t *testing.T) {
+	tbl := NewTable()
+	col, err := tbl.CreateColumn("n")
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+	rows := make([][]int64, 2000)
+	for i := range rows {
+		rows[i] = []int64{rng.Int63n(100)}
+	}
+	require.NoError(t, tbl.InsertRows([]string{"n"}, rows))
+	all := tbl.Not(NewCondition())
+
+	// the heap keeps exactly the rows a full sort puts first
+	for _, desc := range []bool{false, true} {
+		keys := []SortKey{{Col: col, Desc: desc}}
+		sorted, err := tbl.SortedIds(all, keys, 0, NoLimit)
+		require.NoError(t, err)
+		for _, page := range [][2]int64{{0, 10}, {0, 1}, {37, 50}, {1990, 100}} {
+			ids, err := tbl.SortedIds(all, keys, page[0], page[1])
+			require.NoError(t, err)
+			assert.Equal(t, sorted[page[0]:min(page[0]+page[1], 2000)], ids)
+		}
+	}
+}
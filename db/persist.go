@@ -0,0 +1,326 @@
+package db
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	snapshotFileName = "modb.snapshot"
+	snapshotVersion  = 1
+)
+
+// The snapshot types mirror db, table and column with exported fields so
+// they can be gob encoded. Only the live prefix of each column is stored.
+type managerSnapshot struct {
+	Version int
+	// Lsn is the last write-ahead log record the snapshot covers.
+	Lsn int64
+	Dbs []dbSnapshot
+}
+
+type dbSnapshot struct {
+	Name   string
+	Tables []tableSnapshot
+}
+
+type tableSnapshot struct {
+	Name    string
+	NumRows int64
+	Deletes []int64
+	Schema  []columnDefSnapshot
+	// PrimaryKey and Unique hold the key constraints of the schema.
+	PrimaryKey []string
+	Unique     [][]string
+	Cols       []columnSnapshot
+	// Indexes names the columns with an ordered index.
+	Indexes []string
+	// ClusterKey names the column the rows are sorted by, if any.
+	ClusterKey string
+}
+
+type columnDefSnapshot struct {
+	Name     string
+	Type     ColumnType
+	NotNull  bool
+	Default  *valueSnapshot
+	CheckMin *valueSnapshot
+	CheckMax *valueSnapshot
+}
+
+type valueSnapshot struct {
+	Type  ColumnType
+	Int   int64
+	Float float64
+	Str   string
+	Null  bool
+}
+
+func snapshotValue(val *Value) *valueSnapshot {
+	if val == nil {
+		return nil
+	}
+	return &valueSnapshot{Type: val.typ, Int: val.i, Float: val.f, Str: val.s, Null: val.null}
+}
+
+func restoreValue(snap *valueSnapshot) *Value {
+	if snap == nil {
+		return nil
+	}
+	return &Value{typ: snap.Type, i: snap.Int, f: snap.Float, s: snap.Str, null: snap.Null}
+}
+
+func snapshotSchema(schema *Schema) []columnDefSnapshot {
+	if schema == nil {
+		return nil
+	}
+
+	defs := make([]columnDefSnapshot, len(schema.cols))
+	for i, def := range schema.cols {
+		defs[i] = columnDefSnapshot{
+			Name:     def.name,
+			Type:     def.typ,
+			NotNull:  def.notNull,
+			Default:  snapshotValue(def.def),
+			CheckMin: snapshotValue(def.checkMin),
+			CheckMax: snapshotValue(def.checkMax),
+		}
+	}
+	return defs
+}
+
+func restoreSchema(tblSnap tableSnapshot) *Schema {
+	if tblSnap.Schema == nil {
+		return nil
+	}
+
+	cols := make([]ColumnDef, len(tblSnap.Schema))
+	for i, snap := range tblSnap.Schema {
+		cols[i] = ColumnDef{
+			name:     snap.Name,
+			typ:      snap.Type,
+			notNull:  snap.NotNull,
+			def:      restoreValue(snap.Default),
+			checkMin: restoreValue(snap.CheckMin),
+			checkMax: restoreValue(snap.CheckMax),
+		}
+	}
+	return &Schema{cols: cols, primaryKey: tblSnap.PrimaryKey, unique: tblSnap.Unique}
+}
+
+type columnSnapshot struct {
+	Name     string
+	Type     ColumnType
+	Data     []int64
+	Dict     []string
+	Validity []uint64
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (col *column) snapshot() columnSnapshot {
+	col.lock.Lock()
+	defer col.lock.Unlock()
+
+	data := make([]int64, col.numItems)
+	copy(data, col.data[:col.numItems])
+	dict := make([]string, len(col.dict))
+	copy(dict, col.dict)
+	var validity []uint64
+	if col.validity != nil {
+		validity = make([]uint64, len(col.validity))
+		copy(validity, col.validity)
+	}
+	return columnSnapshot{Name: col.name, Type: col.typ, Data: data, Dict: dict, Validity: validity}
+}
+
+func (tbl *table) snapshot(name string) tableSnapshot {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+
+	snap := tableSnapshot{Name: name, NumRows: tbl.numRows, Deletes: tbl.deletes.toSlice(), Schema: snapshotSchema(tbl.schema)}
+	if tbl.schema != nil {
+		snap.PrimaryKey = tbl.schema.primaryKey
+		snap.Unique = tbl.schema.unique
+	}
+	for _, colName := range sortedKeys(tbl.cols) {
+		snap.Cols = append(snap.Cols, tbl.cols[colName].snapshot())
+	}
+	snap.Indexes = sortedKeys(tbl.btrees)
+	snap.ClusterKey = tbl.clusterKey
+	return snap
+}
+
+func (db *db) snapshot(name string) dbSnapshot {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	snap := dbSnapshot{Name: name}
+	for _, tblName := range sortedKeys(db.tables) {
+		snap.Tables = append(snap.Tables, db.tables[tblName].snapshot(tblName))
+	}
+	return snap
+}
+
+func restoreColumn(snap columnSnapshot, def ColumnDef) *column {
+	col := newColumnFromDef(def)
+	for id, s := range snap.Dict {
+		col.dict = append(col.dict, s)
+		col.dictIds[s] = int64(id)
+	}
+	if len(snap.Data) > len(col.data) {
+		col.data = make([]int64, 2*len(snap.Data))
+	}
+	copy(col.data, snap.Data)
+	col.numItems = int64(len(snap.Data))
+	if snap.Validity != nil {
+		col.validity = bitset(snap.Validity)
+	}
+	col.rebuildZones()
+	return col
+}
+
+func restoreTable(dbName string, snap tableSnapshot, w *wal) (*table, error) {
+	tbl := newTable(dbName, snap.Name, w, tableConfig{schema: restoreSchema(snap)})
+	tbl.numRows = snap.NumRows
+	for _, id := range snap.Deletes {
+		tbl.deletes.add(id)
+	}
+	for _, colSnap := range snap.Cols {
+		def := NewColumnDef(colSnap.Name, colSnap.Type)
+		if existing, ok := tbl.cols[colSnap.Name]; ok {
+			def = existing.def
+		} else {
+			tbl.numCols += 1
+		}
+		tbl.cols[colSnap.Name] = restoreColumn(colSnap, def)
+	}
+
+	if col, ok := tbl.cols[snap.ClusterKey]; ok {
+		tbl.clusterKey = snap.ClusterKey
+		col.clustered = true
+		col.rebuildSorted()
+	}
+	for _, colName := range snap.Indexes {
+		if _, ok := tbl.cols[colName]; ok {
+			tbl.btrees[colName] = nil
+		}
+	}
+
+	// indexes are not persisted, only the constraints and columns they
+	// index
+	if err := tbl.reindex(); err != nil {
+		return nil, fmt.Errorf("restoring table %s: %v", snap.Name, err)
+	}
+	return tbl, nil
+}
+
+func restoreDb(snap dbSnapshot, w *wal) (*db, error) {
+	db := newDb(snap.Name, w)
+	for _, tblSnap := range snap.Tables {
+		tbl, err := restoreTable(snap.Name, tblSnap, w)
+		if err != nil {
+			return nil, err
+		}
+		db.tables[tblSnap.Name] = tbl
+		db.numTables += 1
+	}
+	return db, nil
+}
+
+// writeSnapshot atomically replaces the snapshot in dir with the contents of
+// dbs as of the write-ahead log record lsn. The snapshot is written to a
+// temporary file, synced and renamed so a crash mid-write never leaves a
+// truncated snapshot behind.
+func writeSnapshot(dir string, dbs map[string]*db, lsn int64) error {
+	snap := managerSnapshot{Version: snapshotVersion, Lsn: lsn}
+	for _, dbName := range sortedKeys(dbs) {
+		snap.Dbs = append(snap.Dbs, dbs[dbName].snapshot(dbName))
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, snapshotFileName+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := gob.NewEncoder(w).Encode(&snap); err != nil {
+		tmp.Close()
+		return fmt.Errorf("encoding snapshot: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, snapshotFileName)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// readSnapshot loads the snapshot in dir, attaching w to every restored db
+// and table, and returns the last write-ahead log record it covers. A
+// missing snapshot yields an empty set of dbs.
+func readSnapshot(dir string, w *wal) (map[string]*db, int64, error) {
+	dbs := make(map[string]*db)
+
+	f, err := os.Open(filepath.Join(dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return dbs, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var snap managerSnapshot
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&snap); err != nil {
+		return nil, 0, fmt.Errorf("decoding snapshot: %v", err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, 0, fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	for _, dbSnap := range snap.Dbs {
+		db, err := restoreDb(dbSnap, w)
+		if err != nil {
+			return nil, 0, err
+		}
+		dbs[dbSnap.Name] = db
+	}
+	return dbs, snap.Lsn, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
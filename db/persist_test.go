@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestSaveAndStart(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewDefaultManager(zap.NewNop(), WithDataDir(dir))
+	assert.NoError(t, manager.Start(context.Background()))
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	_, err = manager.CreateDb("testdb2")
+	assert.NoError(t, err)
+
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	_, err = db1.CreateTable("tbl2")
+	assert.NoError(t, err)
+
+	_, err = tbl1.CreateColumn("col1")
+	assert.NoError(t, err)
+	_, err = tbl1.CreateColumn("col2")
+	assert.NoError(t, err)
+
+	vals1 := make([]int64, defaultColumnSize+10)
+	vals2 := make([]int64, defaultColumnSize+10)
+	for i := range defaultColumnSize + 10 {
+		vals1[i] = int64(i)
+		vals2[i] = int64(-i)
+	}
+	err = tbl1.LoadColumns([]string{"col1", "col2"}, vals1, vals2)
+	assert.NoError(t, err)
+	err = tbl1.DeleteRows([]int64{1, 5})
+	assert.NoError(t, err)
+
+	assert.NoError(t, manager.End())
+	_, err = os.Stat(filepath.Join(dir, snapshotFileName))
+	assert.NoError(t, err)
+
+	restarted := NewDefaultManager(zap.NewNop(), WithDataDir(dir))
+	assert.NoError(t, restarted.Start(context.Background()))
+	assert.Equal(t, int64(2), restarted.numDbs)
+
+	rdb1, err := restarted.GetDb("testdb1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), rdb1.numTables)
+	_, err = restarted.GetDb("testdb2")
+	assert.NoError(t, err)
+
+	rtbl1, err := rdb1.GetTable("tbl1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(defaultColumnSize+10), rtbl1.numRows)
+	assert.Equal(t, int64(2), rtbl1.numCols)
+	assert.Equal(t, []int64{1, 5}, rtbl1.deletes.toSlice())
+
+	rcol1, err := rtbl1.GetColumn("col1")
+	assert.NoError(t, err)
+	rcol2, err := rtbl1.GetColumn("col2")
+	assert.NoError(t, err)
+	assert.Equal(t, vals1, rcol1.data[:rcol1.numItems])
+	assert.Equal(t, vals2, rcol2.data[:rcol2.numItems])
+
+	// restored columns keep growing like freshly created ones
+	assert.NoError(t, rtbl1.InsertRow([]string{"col1", "col2"}, []int64{7, 8}))
+	assert.Equal(t, int64(defaultColumnSize+11), rcol1.numItems)
+}
+
+func TestStartWithoutSnapshot(t *testing.T) {
+	manager := NewDefaultManager(zap.NewNop(), WithDataDir(t.TempDir()))
+	assert.NoError(t, manager.Start(context.Background()))
+	assert.Equal(t, 0, len(manager.dbs))
+}
+
+func TestSaveWithoutDataDir(t *testing.T) {
+	manager := NewDefaultManager(zap.NewNop())
+	assert.NoError(t, manager.Start(context.Background()))
+	assert.ErrorContains(t, manager.Save(), "no data directory configured")
+	assert.NoError(t, manager.End())
+}
+
+func TestEndWithoutStart(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewDefaultManager(zap.NewNop(), WithDataDir(dir))
+	assert.NoError(t, manager.Start(context.Background()))
+	_, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	assert.NoError(t, manager.End())
+
+	// a manager that never loaded the directory leaves it alone
+	unloaded := NewDefaultManager(zap.NewNop(), WithDataDir(dir))
+	assert.ErrorContains(t, unloaded.Save(), "the data directory is not loaded")
+	assert.NoError(t, unloaded.End())
+
+	restarted := NewDefaultManager(zap.NewNop(), WithDataDir(dir))
+	assert.NoError(t, restarted.Start(context.Background()))
+	assert.Equal(t, []string{"testdb1"}, restarted.DbNames())
+	assert.NoError(t, restarted.End())
+}
+
+func TestStartCorruptSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, snapshotFileName), []byte("not a snapshot"), 0o644)
+	assert.NoError(t, err)
+
+	manager := NewDefaultManager(zap.NewNop(), WithDataDir(dir))
+	assert.ErrorContains(t, manager.Start(context.Background()), "decoding snapshot")
+	// nor does it overwrite a snapshot it failed to load
+	assert.NoError(t, manager.End())
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, "not a snapshot", string(data))
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type predicateOp int
+
+const (
+	predicateEq predicateOp = iota
+	predicateNe
+	predicateLt
+	predicateLe
+	predicateGt
+	predicateGe
+	predicateBetween
+	predicateIn
+)
+
+// Predicate matches values of a column. Like in SQL, null items never
+// match any predicate, including Ne.
+type Predicate struct {
+	op   predicateOp
+	vals []Value
+}
+
+func Eq(val Value) Predicate {
+	return Predicate{op: predicateEq, vals: []Value{val}}
+}
+
+func Ne(val Value) Predicate {
+	return Predicate{op: predicateNe, vals: []Value{val}}
+}
+
+func Lt(val Value) Predicate {
+	return Predicate{op: predicateLt, vals: []Value{val}}
+}
+
+func Le(val Value) Predicate {
+	return Predicate{op: predicateLe, vals: []Value{val}}
+}
+
+func Gt(val Value) Predicate {
+	return Predicate{op: predicateGt, vals: []Value{val}}
+}
+
+func Ge(val Value) Predicate {
+	return Predicate{op: predicateGe, vals: []Value{val}}
+}
+
+// Between matches values in [lower, upper], both ends included.
+func Between(lower Value, upper Value) Predicate {
+	return Predicate{op: predicateBetween, vals: []Value{lower, upper}}
+}
+
+// In matches values equal to any of vals. Null entries match nothing.
+func In(vals ...Value) Predicate {
+	return Predicate{op: predicateIn, vals: vals}
+}
+
+func (p Predicate) String() string {
+	switch p.op {
+	case predicateBetween:
+		return fmt.Sprintf("BETWEEN %s AND %s", p.vals[0], p.vals[1])
+	case predicateIn:
+		vals := make([]string, len(p.vals))
+		for i, val := range p.vals {
+			vals[i] = val.String()
+		}
+		return "IN (" + strings.Join(vals, ", ") + ")"
+	}
+	return fmt.Sprintf("%s %s", [...]string{"=", "!=", "<", "<=", ">", ">="}[p.op], p.vals[0])
+}
+
+// check validates the operands of p against the type of col.
+func (p Predicate) check(col *column) error {
+	for _, val := range p.vals {
+		if val.null {
+			if p.op == predicateIn {
+				continue
+			}
+			return fmt.Errorf("Select: operands of %s on column %s must not be null", p, col.name)
+		}
+		if err := col.checkType(val.typ); err != nil {
+			return fmt.Errorf("Select: %w", err)
+		}
+	}
+	return nil
+}
+
+// test reports whether a value matches p, given how the value compares to
+// each operand.
+func (p Predicate) test(compare func(i int) int) bool {
+	switch p.op {
+	case predicateEq:
+		return compare(0) == 0
+	case predicateNe:
+		return compare(0) != 0
+	case predicateLt:
+		return compare(0) < 0
+	case predicateLe:
+		return compare(0) <= 0
+	case predicateGt:
+		return compare(0) > 0
+	case predicateGe:
+		return compare(0) >= 0
+	case predicateBetween:
+		return compare(0) >= 0 && compare(1) <= 0
+	}
+	for i, val := range p.vals {
+		if !val.null && compare(i) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// zoneMatcher returns a function reporting whether a block of a column of
+// a fixed width type may hold words that match p. Ne may match any block.
+func (p Predicate) zoneMatcher() func(z zone) bool {
+	if p.op == predicateIn {
+		var words []int64
+		for _, val := range p.vals {
+			if !val.null {
+				words = append(words, val.fixedWord())
+			}
+		}
+		return func(z zone) bool {
+			for _, word := range words {
+				if z.overlaps(word, word) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	lo, hi := int64(math.MinInt64), int64(math.MaxInt64)
+	switch p.op {
+	case predicateEq:
+		lo, hi = p.vals[0].fixedWord(), p.vals[0].fixedWord()
+	case predicateLt, predicateLe:
+		hi = p.vals[0].fixedWord()
+	case predicateGt, predicateGe:
+		lo = p.vals[0].fixedWord()
+	case predicateBetween:
+		lo, hi = p.vals[0].fixedWord(), p.vals[1].fixedWord()
+	}
+	return func(z zone) bool {
+		return z.overlaps(lo, hi)
+	}
+}
+
+// wordMatcher returns a function matching the words of a column of a fixed
+// width type, whose encoding preserves the order of values.
+func (p Predicate) wordMatcher() func(word int64) bool {
+	if p.op == predicateIn {
+		words := make(map[int64]bool, len(p.vals))
+		for _, val := range p.vals {
+			if !val.null {
+				words[val.fixedWord()] = true
+			}
+		}
+		return func(word int64) bool {
+			return words[word]
+		}
+	}
+
+	bounds := make([]int64, len(p.vals))
+	for i, val := range p.vals {
+		bounds[i] = val.fixedWord()
+	}
+	return func(word int64) bool {
+		return p.test(func(i int) int {
+			return compareWords(word, bounds[i])
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredicates(t *testing.T) {
+	tbl := NewTable()
+	err := tbl.LoadValues([]string{"num", "price", "name"},
+		[]Value{Int64Value(1), Int64Value(5), NullValue(), Int64Value(7), Int64Value(9), Int64Value(100)},
+		[]Value{Float64Value(-1.5), Float64Value(0), Float64Value(2.25), NullValue(), Float64Value(10), Float64Value(2.25)},
+		[]Value{StringValue("pear"), StringValue("apple"), StringValue("fig"), StringValue("apple"), NullValue(), StringValue("kiwi")})
+	assert.NoError(t, err)
+
+	num := tbl.cols["num"]
+	price := tbl.cols["price"]
+	name := tbl.cols["name"]
+
+	tests := []struct {
+		name   string
+		col    *column
+		pred   Predicate
+		expect []int64
+	}{
+		{"eq", num, Eq(Int64Value(5)), []int64{1}},
+		{"ne skips nulls", num, Ne(Int64Value(5)), []int64{0, 3, 4, 5}},
+		{"lt", num, Lt(Int64Value(7)), []int64{0, 1}},
+		{"le", num, Le(Int64Value(7)), []int64{0, 1, 3}},
+		{"gt", num, Gt(Int64Value(9)), []int64{5}},
+		{"ge", num, Ge(Int64Value(9)), []int64{4, 5}},
+		{"between inclusive", num, Between(Int64Value(5), Int64Value(9)), []int64{1, 3, 4}},
+		{"in", num, In(Int64Value(1), Int64Value(7), Int64Value(9), NullValue()), []int64{0, 3, 4}},
+		{"empty in", num, In(), []int64{}},
+		{"float eq", price, Eq(Float64Value(2.25)), []int64{2, 5}},
+		{"negative float lt", price, Lt(Float64Value(0)), []int64{0}},
+		{"float between", price, Between(Float64Value(-1.5), Float64Value(2.25)), []int64{0, 1, 2, 5}},
+		{"string eq", name, Eq(StringValue("apple")), []int64{1, 3}},
+		{"string ne", name, Ne(StringValue("apple")), []int64{0, 2, 5}},
+		{"string ge", name, Ge(StringValue("fig")), []int64{0, 2, 5}},
+		{"string in", name, In(StringValue("kiwi"), StringValue("pear"), StringValue("plum")), []int64{0, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tbl.SelectWhere(tt.col, tt.pred)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, append([]int64{}, c.ids.toSlice()...))
+		})
+	}
+
+	t.Run("invalid operands", func(t *testing.T) {
+		_, err := tbl.SelectWhere(num, Eq(NullValue()))
+		assert.ErrorContains(t, err, "operands of = NULL on column num must not be null")
+		_, err = tbl.SelectWhere(num, Between(Int64Value(1), Float64Value(2)))
+		assert.ErrorContains(t, err, "type mismatch")
+		_, err = tbl.SelectWhere(name, In(StringValue("a"), Int64Value(1)))
+		assert.ErrorContains(t, err, "type mismatch")
+		_, err = tbl.SelectWhere(NewColumn("other"), Eq(Int64Value(1)))
+		assert.ErrorContains(t, err, "column not found")
+	})
+}
+
+func TestPredicateString(t *testing.T) {
+	assert.Equal(t, "!= 5", Ne(Int64Value(5)).String())
+	assert.Equal(t, ">= 1.5", Ge(Float64Value(1.5)).String())
+	assert.Equal(t, "BETWEEN 1 AND 3", Between(Int64Value(1), Int64Value(3)).String())
+	assert.Equal(t, "IN (1, 7, NULL)", In(Int64Value(1), Int64Value(7), NullValue()).String())
+}
+
+func TestNot(t *testing.T) {
+	tbl := NewTable()
+	err := tbl.LoadValues([]string{"num"},
+		[]Value{Int64Value(1), Int64Value(2), NullValue(), Int64Value(4), Int64Value(5)})
+	assert.NoError(t, err)
+	num := tbl.cols["num"]
+	assert.NoError(t, tbl.DeleteRows([]int64{3}))
+
+	c, err := tbl.SelectWhere(num, Lt(Int64Value(2)))
+	assert.NoError(t, err)
+
+	// NOT matches the null row and skips the deleted one
+	not := tbl.Not(c)
+	assert.Equal(t, []int64{1, 2, 4}, not.ids.toSlice())
+	assert.Equal(t, []int64{0}, c.ids.toSlice())
+
+	assert.Equal(t, []int64{0}, tbl.Not(not).ids.toSlice())
+	assert.Equal(t, []int64{0, 1, 2, 4}, tbl.Not(NewCondition()).ids.toSlice())
+}
@@ -0,0 +1,498 @@
+package db
+
+import (
+	"iter"
+	"math/bits"
+	"sort"
+)
+
+// rowBitmap is a compressed set of row ids in the style of roaring bitmaps.
+// Ids are split into chunks of 65536 by their high bits, and each non-empty
+// chunk is stored in a container: a sorted array of the low 16 bits while
+// the chunk is sparse, and a fixed 8KB bitmap once it is dense. Set
+// operations work a container, and for bitmaps a 64-bit word, at a time and
+// iteration yields ids in ascending order.
+type rowBitmap struct {
+	keys       []int64
+	containers []*container
+}
+
+const (
+	containerBits  = 16
+	containerWords = (1 << containerBits) / 64
+	// arrayMaxSize is the most ids an array container holds; beyond it a
+	// bitmap container is smaller.
+	arrayMaxSize = 4096
+)
+
+// container holds the low bits of the ids of one chunk, in array while
+// sparse and in bitmap, with array nil, while dense.
+type container struct {
+	array  []uint16
+	bitmap []uint64
+	n      int
+}
+
+func newRowBitmap() *rowBitmap {
+	return &rowBitmap{}
+}
+
+// bitmapOf returns a bitmap holding ids.
+func bitmapOf(ids ...int64) *rowBitmap {
+	b := newRowBitmap()
+	for _, id := range ids {
+		b.add(id)
+	}
+	return b
+}
+
+// rangeBitmap returns a bitmap holding every id in [lower, upper).
+func rangeBitmap(lower int64, upper int64) *rowBitmap {
+	b := newRowBitmap()
+	for start := lower; start < upper; {
+		key := start >> containerBits
+		end := min(upper, (key+1)<<containerBits)
+		lo, hi := start-key<<containerBits, end-key<<containerBits
+
+		ct := &container{n: int(hi - lo)}
+		if ct.n > arrayMaxSize {
+			ct.bitmap = make([]uint64, containerWords)
+			for i := lo; i < hi; {
+				if i&63 == 0 && i+64 <= hi {
+					ct.bitmap[i>>6] = ^uint64(0)
+					i += 64
+					continue
+				}
+				ct.bitmap[i>>6] |= 1 << (i & 63)
+				i++
+			}
+		} else {
+			ct.array = make([]uint16, 0, ct.n)
+			for i := lo; i < hi; i++ {
+				ct.array = append(ct.array, uint16(i))
+			}
+		}
+
+		b.keys = append(b.keys, key)
+		b.containers = append(b.containers, ct)
+		start = end
+	}
+	return b
+}
+
+// find returns the position of the container for key, or where it would be
+// inserted.
+func (b *rowBitmap) find(key int64) (int, bool) {
+	n := len(b.keys)
+	// ids are mostly added in ascending order
+	if n > 0 && b.keys[n-1] == key {
+		return n - 1, true
+	}
+	i := sort.Search(n, func(i int) bool { return b.keys[i] >= key })
+	return i, i < n && b.keys[i] == key
+}
+
+// add inserts id, reporting whether it was missing.
+func (b *rowBitmap) add(id int64) bool {
+	key := id >> containerBits
+	i, ok := b.find(key)
+	if !ok {
+		b.keys = append(b.keys, 0)
+		copy(b.keys[i+1:], b.keys[i:])
+		b.keys[i] = key
+		b.containers = append(b.containers, nil)
+		copy(b.containers[i+1:], b.containers[i:])
+		b.containers[i] = &container{}
+	}
+	return b.containers[i].add(uint16(id))
+}
+
+// remove deletes id, reporting whether it was present.
+func (b *rowBitmap) remove(id int64) bool {
+	i, ok := b.find(id >> containerBits)
+	if !ok || !b.containers[i].remove(uint16(id)) {
+		return false
+	}
+	if b.containers[i].n == 0 {
+		b.keys = append(b.keys[:i], b.keys[i+1:]...)
+		b.containers = append(b.containers[:i], b.containers[i+1:]...)
+	}
+	return true
+}
+
+func (b *rowBitmap) contains(id int64) bool {
+	i, ok := b.find(id >> containerBits)
+	return ok && b.containers[i].contains(uint16(id))
+}
+
+func (b *rowBitmap) cardinality() int {
+	n := 0
+	for _, ct := range b.containers {
+		n += ct.n
+	}
+	return n
+}
+
+func (b *rowBitmap) isEmpty() bool {
+	return len(b.containers) == 0
+}
+
+// and returns the ids in both b and o.
+func (b *rowBitmap) and(o *rowBitmap) *rowBitmap {
+	res := newRowBitmap()
+	for i, j := 0, 0; i < len(b.keys) && j < len(o.keys); {
+		switch {
+		case b.keys[i] < o.keys[j]:
+			i++
+		case b.keys[i] > o.keys[j]:
+			j++
+		default:
+			res.appendContainer(b.keys[i], b.containers[i].and(o.containers[j]))
+			i++
+			j++
+		}
+	}
+	return res
+}
+
+// or returns the ids in either b or o.
+func (b *rowBitmap) or(o *rowBitmap) *rowBitmap {
+	res := newRowBitmap()
+	i, j := 0, 0
+	for i < len(b.keys) || j < len(o.keys) {
+		switch {
+		case j == len(o.keys) || (i < len(b.keys) && b.keys[i] < o.keys[j]):
+			res.appendContainer(b.keys[i], b.containers[i].clone())
+			i++
+		case i == len(b.keys) || b.keys[i] > o.keys[j]:
+			res.appendContainer(o.keys[j], o.containers[j].clone())
+			j++
+		default:
+			res.appendContainer(b.keys[i], b.containers[i].or(o.containers[j]))
+			i++
+			j++
+		}
+	}
+	return res
+}
+
+// andNot returns the ids in b but not in o.
+func (b *rowBitmap) andNot(o *rowBitmap) *rowBitmap {
+	res := newRowBitmap()
+	j := 0
+	for i, key := range b.keys {
+		for j < len(o.keys) && o.keys[j] < key {
+			j++
+		}
+		if j < len(o.keys) && o.keys[j] == key {
+			res.appendContainer(key, b.containers[i].andNot(o.containers[j]))
+			continue
+		}
+		res.appendContainer(key, b.containers[i].clone())
+	}
+	return res
+}
+
+// appendContainer adds a container for a key above every existing key,
+// dropping it if empty.
+func (b *rowBitmap) appendContainer(key int64, ct *container) {
+	if ct.n == 0 {
+		return
+	}
+	b.keys = append(b.keys, key)
+	b.containers = append(b.containers, ct)
+}
+
+// forEach calls f with every id in ascending order until f returns false.
+func (b *rowBitmap) forEach(f func(id int64) bool) {
+	for i, ct := range b.containers {
+		if !ct.forEach(b.keys[i]<<containerBits, f) {
+			return
+		}
+	}
+}
+
+// All iterates over the ids in ascending order.
+func (b *rowBitmap) All() iter.Seq[int64] {
+	return b.forEach
+}
+
+// toSlice returns the ids in ascending order.
+func (b *rowBitmap) toSlice() []int64 {
+	ids := make([]int64, 0, b.cardinality())
+	b.forEach(func(id int64) bool {
+		ids = append(ids, id)
+		return true
+	})
+	return ids
+}
+
+// bitmapBuilder builds a bitmap from words of 64 ids added in ascending
+// order, filling one chunk at a time.
+type bitmapBuilder struct {
+	res   *rowBitmap
+	key   int64
+	words []uint64
+}
+
+func newBitmapBuilder() *bitmapBuilder {
+	return &bitmapBuilder{res: newRowBitmap(), key: -1}
+}
+
+// addWord adds the ids base+i for every bit i set in word. base must be a
+// multiple of 64 and not below that of earlier words.
+func (bb *bitmapBuilder) addWord(base int64, word uint64) {
+	if word == 0 {
+		return
+	}
+	key := base >> containerBits
+	if key != bb.key {
+		bb.flush()
+		bb.key = key
+		bb.words = make([]uint64, containerWords)
+	}
+	bb.words[(base&(1<<containerBits-1))>>6] |= word
+}
+
+func (bb *bitmapBuilder) flush() {
+	if bb.words != nil {
+		bb.res.appendContainer(bb.key, newBitmapContainer(bb.words))
+		bb.words = nil
+	}
+}
+
+func (bb *bitmapBuilder) bitmap() *rowBitmap {
+	bb.flush()
+	return bb.res
+}
+
+// newBitmapContainer takes ownership of a chunk bitmap, converting it to an
+// array container if it is sparse.
+func newBitmapContainer(bitmap []uint64) *container {
+	ct := &container{bitmap: bitmap}
+	for _, word := range bitmap {
+		ct.n += bits.OnesCount64(word)
+	}
+	if ct.n <= arrayMaxSize {
+		ct.toArray()
+	}
+	return ct
+}
+
+func (ct *container) toArray() {
+	array := make([]uint16, 0, ct.n)
+	ct.forEach(0, func(id int64) bool {
+		array = append(array, uint16(id))
+		return true
+	})
+	ct.array, ct.bitmap = array, nil
+}
+
+func (ct *container) toBitmap() {
+	bitmap := make([]uint64, containerWords)
+	for _, low := range ct.array {
+		bitmap[low>>6] |= 1 << (low & 63)
+	}
+	ct.array, ct.bitmap = nil, bitmap
+}
+
+// search returns the position of low in the array, or where it would be
+// inserted.
+func (ct *container) search(low uint16) (int, bool) {
+	i := sort.Search(len(ct.array), func(i int) bool { return ct.array[i] >= low })
+	return i, i < len(ct.array) && ct.array[i] == low
+}
+
+func (ct *container) contains(low uint16) bool {
+	if ct.bitmap != nil {
+		return ct.bitmap[low>>6]&(1<<(low&63)) != 0
+	}
+	_, ok := ct.search(low)
+	return ok
+}
+
+func (ct *container) add(low uint16) bool {
+	if ct.bitmap != nil {
+		bit := uint64(1) << (low & 63)
+		if ct.bitmap[low>>6]&bit != 0 {
+			return false
+		}
+		ct.bitmap[low>>6] |= bit
+		ct.n++
+		return true
+	}
+
+	if n := len(ct.array); n == 0 || ct.array[n-1] < low {
+		ct.array = append(ct.array, low)
+	} else {
+		i, ok := ct.search(low)
+		if ok {
+			return false
+		}
+		ct.array = append(ct.array, 0)
+		copy(ct.array[i+1:], ct.array[i:])
+		ct.array[i] = low
+	}
+	ct.n++
+	if ct.n > arrayMaxSize {
+		ct.toBitmap()
+	}
+	return true
+}
+
+func (ct *container) remove(low uint16) bool {
+	if ct.bitmap != nil {
+		bit := uint64(1) << (low & 63)
+		if ct.bitmap[low>>6]&bit == 0 {
+			return false
+		}
+		ct.bitmap[low>>6] &^= bit
+		ct.n--
+		if ct.n <= arrayMaxSize {
+			ct.toArray()
+		}
+		return true
+	}
+
+	i, ok := ct.search(low)
+	if !ok {
+		return false
+	}
+	ct.array = append(ct.array[:i], ct.array[i+1:]...)
+	ct.n--
+	return true
+}
+
+func (ct *container) clone() *container {
+	res := &container{n: ct.n}
+	if ct.bitmap != nil {
+		res.bitmap = append([]uint64(nil), ct.bitmap...)
+	} else {
+		res.array = append([]uint16(nil), ct.array...)
+	}
+	return res
+}
+
+func (ct *container) and(o *container) *container {
+	switch {
+	case ct.bitmap != nil && o.bitmap != nil:
+		bitmap := make([]uint64, containerWords)
+		for i := range bitmap {
+			bitmap[i] = ct.bitmap[i] & o.bitmap[i]
+		}
+		return newBitmapContainer(bitmap)
+	case ct.bitmap != nil:
+		return o.filter(ct, true)
+	case o.bitmap != nil:
+		return ct.filter(o, true)
+	}
+
+	array := make([]uint16, 0, min(len(ct.array), len(o.array)))
+	for i, j := 0, 0; i < len(ct.array) && j < len(o.array); {
+		switch {
+		case ct.array[i] < o.array[j]:
+			i++
+		case ct.array[i] > o.array[j]:
+			j++
+		default:
+			array = append(array, ct.array[i])
+			i++
+			j++
+		}
+	}
+	return &container{array: array, n: len(array)}
+}
+
+func (ct *container) or(o *container) *container {
+	if ct.bitmap != nil || o.bitmap != nil || ct.n+o.n > arrayMaxSize {
+		bitmap := make([]uint64, containerWords)
+		ct.orInto(bitmap)
+		o.orInto(bitmap)
+		return newBitmapContainer(bitmap)
+	}
+
+	array := make([]uint16, 0, ct.n+o.n)
+	i, j := 0, 0
+	for i < len(ct.array) && j < len(o.array) {
+		switch {
+		case ct.array[i] < o.array[j]:
+			array = append(array, ct.array[i])
+			i++
+		case ct.array[i] > o.array[j]:
+			array = append(array, o.array[j])
+			j++
+		default:
+			array = append(array, ct.array[i])
+			i++
+			j++
+		}
+	}
+	array = append(array, ct.array[i:]...)
+	array = append(array, o.array[j:]...)
+	return &container{array: array, n: len(array)}
+}
+
+func (ct *container) orInto(bitmap []uint64) {
+	if ct.bitmap != nil {
+		for i, word := range ct.bitmap {
+			bitmap[i] |= word
+		}
+		return
+	}
+	for _, low := range ct.array {
+		bitmap[low>>6] |= 1 << (low & 63)
+	}
+}
+
+func (ct *container) andNot(o *container) *container {
+	if ct.bitmap == nil {
+		return ct.filter(o, false)
+	}
+
+	bitmap := append([]uint64(nil), ct.bitmap...)
+	if o.bitmap != nil {
+		for i, word := range o.bitmap {
+			bitmap[i] &^= word
+		}
+	} else {
+		for _, low := range o.array {
+			bitmap[low>>6] &^= 1 << (low & 63)
+		}
+	}
+	return newBitmapContainer(bitmap)
+}
+
+// filter returns the ids of an array container that are in o when keep is
+// true, and that are not when it is false.
+func (ct *container) filter(o *container, keep bool) *container {
+	array := make([]uint16, 0, len(ct.array))
+	for _, low := range ct.array {
+		if o.contains(low) == keep {
+			array = append(array, low)
+		}
+	}
+	return &container{array: array, n: len(array)}
+}
+
+// forEach calls f with base plus every id in the container in ascending
+// order, returning false as soon as f does.
+func (ct *container) forEach(base int64, f func(id int64) bool) bool {
+	if ct.bitmap == nil {
+		for _, low := range ct.array {
+			if !f(base + int64(low)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i, word := range ct.bitmap {
+		for word != 0 {
+			if !f(base + int64(i<<6+bits.TrailingZeros64(word))) {
+				return false
+			}
+			word &= word - 1
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// randomIds returns n ids below limit along with the set they form.
+func randomIds(rng *rand.Rand, n int, limit int64) ([]int64, map[int64]bool) {
+	ids := make([]int64, n)
+	set := make(map[int64]bool, n)
+	for i := range ids {
+		ids[i] = rng.Int63n(limit)
+		set[ids[i]] = true
+	}
+	return ids, set
+}
+
+func sortedSet(set map[int64]bool) []int64 {
+	ids := make([]int64, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestRowBitmap(t *testing.T) {
+	b := newRowBitmap()
+	assert.True(t, b.isEmpty())
+	assert.True(t, b.add(70000))
+	assert.True(t, b.add(3))
+	assert.False(t, b.add(3))
+	assert.True(t, b.add(1))
+	assert.Equal(t, []int64{1, 3, 70000}, b.toSlice())
+	assert.True(t, b.contains(70000))
+	assert.False(t, b.contains(70001))
+
+	assert.True(t, b.remove(70000))
+	assert.False(t, b.remove(70000))
+	assert.Equal(t, []int64{0}, b.keys)
+	assert.Equal(t, 2, b.cardinality())
+
+	// containers switch to a bitmap past arrayMaxSize and back below it
+	dense := newRowBitmap()
+	for id := int64(0); id <= arrayMaxSize; id++ {
+		dense.add(id * 2)
+	}
+	assert.NotNil(t, dense.containers[0].bitmap)
+	dense.remove(0)
+	assert.Nil(t, dense.containers[0].bitmap)
+	assert.Equal(t, arrayMaxSize, dense.cardinality())
+
+	// iteration stops early
+	var seen []int64
+	for id := range bitmapOf(5, 6, 7).All() {
+		if id == 7 {
+			break
+		}
+		seen = append(seen, id)
+	}
+	assert.Equal(t, []int64{5, 6}, seen)
+}
+
+func TestRangeBitmap(t *testing.T) {
+	for _, r := range [][2]int64{{0, 0}, {5, 6}, {10, 5000}, {63, 64 * 70}, {65530, 65540}, {1, 200000}} {
+		b := rangeBitmap(r[0], r[1])
+		want := make(map[int64]bool)
+		for id := r[0]; id < r[1]; id++ {
+			want[id] = true
+		}
+		assert.Equal(t, sortedSet(want), b.toSlice(), "range %v", r)
+		assert.Equal(t, len(want), b.cardinality(), "range %v", r)
+	}
+}
+
+func TestRowBitmapSetOperations(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// mixes sparse, dense and missing chunks
+	for _, tt := range []struct {
+		n     int
+		limit int64
+	}{{50, 1000}, {10000, 20000}, {100000, 300000}, {5000, 1 << 20}} {
+		aIds, aSet := randomIds(rng, tt.n, tt.limit)
+		bIds, bSet := randomIds(rng, tt.n/2, tt.limit)
+		a, b := bitmapOf(aIds...), bitmapOf(bIds...)
+		assert.Equal(t, sortedSet(aSet), a.toSlice())
+
+		and, or, andNot := make(map[int64]bool), make(map[int64]bool), make(map[int64]bool)
+		for id := range aSet {
+			or[id] = true
+			if bSet[id] {
+				and[id] = true
+			} else {
+				andNot[id] = true
+			}
+		}
+		for id := range bSet {
+			or[id] = true
+		}
+
+		assert.Equal(t, sortedSet(and), a.and(b).toSlice())
+		assert.Equal(t, sortedSet(or), a.or(b).toSlice())
+		assert.Equal(t, sortedSet(andNot), a.andNot(b).toSlice())
+		assert.Equal(t, len(or), a.or(b).cardinality())
+
+		// results never alias their inputs
+		res := a.or(b)
+		res.add(tt.limit + 1)
+		for id := range aSet {
+			res.remove(id)
+		}
+		assert.Equal(t, sortedSet(aSet), a.toSlice())
+	}
+}
+
+func TestBitmapBuilder(t *testing.T) {
+	bb := newBitmapBuilder()
+	bb.addWord(0, 0b101)
+	bb.addWord(64, 0)
+	bb.addWord(1<<containerBits, 1<<63)
+	bb.addWord(3<<containerBits+64, 1)
+	assert.Equal(t, []int64{0, 2, 1<<containerBits + 63, 3<<containerBits + 64}, bb.bitmap().toSlice())
+}
@@ -0,0 +1,296 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ColumnDef declares a column and the constraints its values must satisfy.
+// Constraints are added by chaining NotNull, Default and Check.
+type ColumnDef struct {
+	name    string
+	typ     ColumnType
+	notNull bool
+	def     *Value
+	// checkMin and checkMax are the inclusive bounds of a CHECK range
+	// constraint, nil when unbounded.
+	checkMin *Value
+	checkMax *Value
+}
+
+func NewColumnDef(colName string, colType ColumnType) ColumnDef {
+	return ColumnDef{name: colName, typ: colType}
+}
+
+// NotNull rejects null values, including omitted values without a default.
+func (def ColumnDef) NotNull() ColumnDef {
+	def.notNull = true
+	return def
+}
+
+// Default sets the value stored when a row omits the column.
+func (def ColumnDef) Default(val Value) ColumnDef {
+	def.def = &val
+	return def
+}
+
+// Check rejects values outside [min, max]. A null bound leaves that side of
+// the range open.
+func (def ColumnDef) Check(min Value, max Value) ColumnDef {
+	def.checkMin, def.checkMax = nil, nil
+	if !min.null {
+		def.checkMin = &min
+	}
+	if !max.null {
+		def.checkMax = &max
+	}
+	return def
+}
+
+func (def ColumnDef) Name() string {
+	return def.name
+}
+
+func (def ColumnDef) Type() ColumnType {
+	return def.typ
+}
+
+func (def ColumnDef) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", def.name, def.typ)
+	if def.notNull {
+		b.WriteString(" NOT NULL")
+	}
+	if def.def != nil {
+		fmt.Fprintf(&b, " DEFAULT %s", def.def)
+	}
+	if def.checkMin != nil || def.checkMax != nil {
+		fmt.Fprintf(&b, " CHECK (%s)", def.checkString())
+	}
+	return b.String()
+}
+
+func (def ColumnDef) checkString() string {
+	switch {
+	case def.checkMin != nil && def.checkMax != nil:
+		return fmt.Sprintf("%s BETWEEN %s AND %s", def.name, def.checkMin, def.checkMax)
+	case def.checkMin != nil:
+		return fmt.Sprintf("%s >= %s", def.name, def.checkMin)
+	}
+	return fmt.Sprintf("%s <= %s", def.name, def.checkMax)
+}
+
+// validate checks val against the type and constraints of the column.
+func (def ColumnDef) validate(val Value) error {
+	if val.null {
+		if def.notNull {
+			return constraintErrorf("column %s violates NOT NULL constraint", def.name)
+		}
+		return nil
+	}
+
+	if val.typ != def.typ {
+		return typeMismatchError(def.name, def.typ, val.typ)
+	}
+	if (def.checkMin != nil && val.Compare(*def.checkMin) < 0) || (def.checkMax != nil && val.Compare(*def.checkMax) > 0) {
+		return constraintErrorf("column %s value %s violates CHECK (%s)", def.name, val, def.checkString())
+	}
+	return nil
+}
+
+// constraintError is an error matched by ErrConstraint. Its message is
+// left as is rather than suffixed with that of ErrConstraint.
+type constraintError struct {
+	msg string
+}
+
+func constraintErrorf(format string, args ...any) error {
+	return &constraintError{msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *constraintError) Error() string {
+	return e.msg
+}
+
+func (e *constraintError) Is(target error) bool {
+	return target == ErrConstraint
+}
+
+// invalidArgumentError is like constraintError for ErrInvalidArgument.
+type invalidArgumentError struct {
+	msg string
+}
+
+func invalidArgumentErrorf(format string, args ...any) error {
+	return &invalidArgumentError{msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *invalidArgumentError) Error() string {
+	return e.msg
+}
+
+func (e *invalidArgumentError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
+
+// missing returns the value stored for a row that omits the column.
+func (def ColumnDef) missing() Value {
+	if def.def != nil {
+		return *def.def
+	}
+	return NullValue()
+}
+
+// Schema declares the columns of a table. Tables created with a schema get
+// all of its columns up front and reject columns it does not declare.
+type Schema struct {
+	cols []ColumnDef
+	// primaryKey and unique name the columns of the PRIMARY KEY and of each
+	// UNIQUE constraint.
+	primaryKey []string
+	unique     [][]string
+}
+
+// NewSchema validates the column definitions of a table.
+func NewSchema(cols ...ColumnDef) (*Schema, error) {
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("Invalid schema: no columns")
+	}
+
+	seen := make(map[string]bool, len(cols))
+	for _, def := range cols {
+		if def.name == "" {
+			return nil, fmt.Errorf("Invalid schema: column without a name")
+		}
+		if seen[def.name] {
+			return nil, fmt.Errorf("Invalid schema: column %s declared more than once", def.name)
+		}
+		seen[def.name] = true
+
+		if def.typ > TypeTimestamp {
+			return nil, fmt.Errorf("Invalid schema: column %s has unknown type %s", def.name, def.typ)
+		}
+		for _, bound := range []*Value{def.checkMin, def.checkMax} {
+			if bound != nil && bound.typ != def.typ {
+				return nil, fmt.Errorf("Invalid schema: CHECK bound of column %s: %v", def.name, typeMismatchError(def.name, def.typ, bound.typ))
+			}
+		}
+		if def.checkMin != nil && def.checkMax != nil && def.checkMin.Compare(*def.checkMax) > 0 {
+			return nil, fmt.Errorf("Invalid schema: CHECK (%s) of column %s can never be satisfied", def.checkString(), def.name)
+		}
+		if def.def != nil {
+			if err := def.validate(*def.def); err != nil {
+				return nil, fmt.Errorf("Invalid schema: DEFAULT %s: %v", def.def, err)
+			}
+		}
+	}
+
+	return &Schema{cols: cols}, nil
+}
+
+// Columns returns the column definitions in declaration order.
+func (s *Schema) Columns() []ColumnDef {
+	cols := make([]ColumnDef, len(s.cols))
+	copy(cols, s.cols)
+	return cols
+}
+
+// PrimaryKey returns a copy of the schema whose rows are identified by the
+// values of colNames. Primary key columns are NOT NULL and no two live rows
+// may share a key.
+func (s *Schema) PrimaryKey(colNames ...string) (*Schema, error) {
+	if s.primaryKey != nil {
+		return nil, fmt.Errorf("Invalid schema: PRIMARY KEY (%s) already declared", strings.Join(s.primaryKey, ", "))
+	}
+	if err := s.checkKey("PRIMARY KEY", colNames); err != nil {
+		return nil, err
+	}
+
+	schema := s.copy()
+	schema.primaryKey = append([]string(nil), colNames...)
+	for i, def := range schema.cols {
+		for _, name := range colNames {
+			if def.name == name {
+				schema.cols[i] = def.NotNull()
+			}
+		}
+	}
+	return schema, nil
+}
+
+// Unique returns a copy of the schema in which no two live rows may share
+// the values of colNames. Rows with a null in any of the columns are exempt.
+func (s *Schema) Unique(colNames ...string) (*Schema, error) {
+	if err := s.checkKey("UNIQUE", colNames); err != nil {
+		return nil, err
+	}
+
+	schema := s.copy()
+	schema.unique = append(schema.unique, append([]string(nil), colNames...))
+	return schema, nil
+}
+
+func (s *Schema) checkKey(constraint string, colNames []string) error {
+	if len(colNames) == 0 {
+		return fmt.Errorf("Invalid schema: %s without columns", constraint)
+	}
+
+	seen := make(map[string]bool, len(colNames))
+	for _, name := range colNames {
+		if _, ok := s.column(name); !ok {
+			return fmt.Errorf("Invalid schema: %s column %s is not declared", constraint, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("Invalid schema: %s column %s given more than once", constraint, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func (s *Schema) column(colName string) (ColumnDef, bool) {
+	for _, def := range s.cols {
+		if def.name == colName {
+			return def, true
+		}
+	}
+	return ColumnDef{}, false
+}
+
+func (s *Schema) copy() *Schema {
+	schema := &Schema{cols: s.Columns(), primaryKey: s.primaryKey}
+	for _, cols := range s.unique {
+		schema.unique = append(schema.unique, cols)
+	}
+	return schema
+}
+
+func (s *Schema) String() string {
+	defs := make([]string, 0, len(s.cols)+1+len(s.unique))
+	for _, def := range s.cols {
+		defs = append(defs, def.String())
+	}
+	if s.primaryKey != nil {
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(s.primaryKey, ", ")+")")
+	}
+	for _, cols := range s.unique {
+		defs = append(defs, "UNIQUE ("+strings.Join(cols, ", ")+")")
+	}
+	return "(" + strings.Join(defs, ", ") + ")"
+}
+
+// TableOption configures optional behaviour of a table at creation.
+type TableOption func(*tableConfig)
+
+// tableConfig holds everything CreateTable needs to recreate a table, so it
+// can be logged and persisted.
+type tableConfig struct {
+	schema *Schema
+}
+
+// WithSchema declares the columns and constraints of a new table.
+func WithSchema(schema *Schema) TableOption {
+	return func(cfg *tableConfig) {
+		cfg.schema = schema
+	}
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func testSchema(t *testing.T) *Schema {
+	schema, err := NewSchema(
+		NewColumnDef("id", TypeInt64).NotNull(),
+		NewColumnDef("name", TypeString).Default(StringValue("anonymous")),
+		NewColumnDef("age", TypeInt64).Check(Int64Value(0), Int64Value(150)),
+		NewColumnDef("score", TypeFloat64).NotNull().Default(Float64Value(0)).Check(Float64Value(0), NullValue()),
+	)
+	assert.NoError(t, err)
+	return schema
+}
+
+func TestNewSchema(t *testing.T) {
+	schema := testSchema(t)
+	assert.Equal(t, "(id int64 NOT NULL, name string DEFAULT anonymous, age int64 CHECK (age BETWEEN 0 AND 150), score float64 NOT NULL DEFAULT 0 CHECK (score >= 0))", schema.String())
+	assert.Equal(t, "age", schema.Columns()[2].Name())
+
+	tests := []struct {
+		name string
+		cols []ColumnDef
+		err  string
+	}{
+		{"no columns", nil, "no columns"},
+		{"duplicate column", []ColumnDef{NewColumnDef("a", TypeInt64), NewColumnDef("a", TypeBool)}, "declared more than once"},
+		{"unnamed column", []ColumnDef{NewColumnDef("", TypeInt64)}, "without a name"},
+		{"unknown type", []ColumnDef{NewColumnDef("a", ColumnType(42))}, "unknown type"},
+		{"default type", []ColumnDef{NewColumnDef("a", TypeInt64).Default(StringValue("x"))}, "type mismatch"},
+		{"null default", []ColumnDef{NewColumnDef("a", TypeInt64).NotNull().Default(NullValue())}, "NOT NULL"},
+		{"default outside check", []ColumnDef{NewColumnDef("a", TypeInt64).Default(Int64Value(5)).Check(Int64Value(0), Int64Value(3))}, "violates CHECK"},
+		{"check type", []ColumnDef{NewColumnDef("a", TypeInt64).Check(Float64Value(0), NullValue())}, "CHECK bound"},
+		{"empty check", []ColumnDef{NewColumnDef("a", TypeInt64).Check(Int64Value(3), Int64Value(0))}, "can never be satisfied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSchema(tt.cols...)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestSchemaConstraints(t *testing.T) {
+	manager := NewDefaultManager(zap.NewNop())
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+
+	tbl1, err := db1.CreateTable("tbl1", WithSchema(testSchema(t)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), tbl1.numCols)
+	assert.Equal(t, TypeString, tbl1.cols["name"].typ)
+
+	_, err = tbl1.CreateColumn("extra")
+	assert.ErrorContains(t, err, "not declared in the table schema")
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	assert.ErrorContains(t, tbl1.DeleteColumn("age"), "declared in the table schema")
+
+	// omitted columns take their default or null
+	assert.NoError(t, tbl1.InsertRow([]string{"id"}, []int64{1}))
+	assert.NoError(t, tbl1.InsertValues([]string{"id", "name", "age", "score"}, []Value{Int64Value(2), StringValue("bo"), Int64Value(30), Float64Value(9.5)}))
+
+	c, err := tbl1.SelectNotNull(tbl1.cols["id"])
+	assert.NoError(t, err)
+	res, err := tbl1.GetValues(c, []*column{tbl1.cols["name"], tbl1.cols["age"], tbl1.cols["score"]})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{
+		{StringValue("anonymous"), StringValue("bo")},
+		{NullValue(), Int64Value(30)},
+		{Float64Value(0), Float64Value(9.5)},
+	}, res)
+
+	// rejected rows never reach any column
+	err = tbl1.InsertRow([]string{"age"}, []int64{20})
+	assert.ErrorContains(t, err, "InsertRow: column id violates NOT NULL constraint")
+	err = tbl1.InsertRow([]string{"id", "age"}, []int64{3, 151})
+	assert.ErrorContains(t, err, "InsertRow: column age value 151 violates CHECK (age BETWEEN 0 AND 150)")
+	err = tbl1.InsertValues([]string{"id", "score"}, []Value{Int64Value(3), NullValue()})
+	assert.ErrorContains(t, err, "column score violates NOT NULL constraint")
+	err = tbl1.InsertValues([]string{"id", "score"}, []Value{Int64Value(3), Float64Value(-1)})
+	assert.ErrorContains(t, err, "column score value -1 violates CHECK (score >= 0)")
+
+	assert.Equal(t, int64(2), tbl1.numRows)
+	for _, col := range tbl1.cols {
+		assert.Equal(t, int64(2), col.numItems, col.name)
+	}
+
+	// a rejected item anywhere in a load leaves every column untouched
+	tbl2, err := db1.CreateTable("tbl2", WithSchema(testSchema(t)))
+	assert.NoError(t, err)
+	err = tbl2.LoadColumns([]string{"id", "age"}, []int64{1, 2, 3}, []int64{10, 200, 30})
+	assert.ErrorContains(t, err, "LoadColumns: column age value 200 violates CHECK")
+	err = tbl2.LoadColumns([]string{"age"}, []int64{10, 20})
+	assert.ErrorContains(t, err, "LoadColumns: column id violates NOT NULL constraint")
+	err = tbl2.LoadColumns([]string{"id", "other"}, []int64{1}, []int64{2})
+	assert.ErrorContains(t, err, "column name does not exist in table: other")
+	err = tbl2.LoadValues([]string{"id", "name"}, []Value{Int64Value(1), NullValue()}, []Value{StringValue("a"), StringValue("b")})
+	assert.ErrorContains(t, err, "LoadValues: column id violates NOT NULL constraint")
+	for _, col := range tbl2.cols {
+		assert.Equal(t, int64(0), col.numItems, col.name)
+	}
+
+	err = tbl2.LoadColumns([]string{"id", "age"}, []int64{1, 2, 3}, []int64{10, 20, 30})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), tbl2.numRows)
+	c, err = tbl2.SelectNotNull(tbl2.cols["id"])
+	assert.NoError(t, err)
+	res, err = tbl2.GetValues(c, []*column{tbl2.cols["name"], tbl2.cols["score"]})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{
+		{StringValue("anonymous"), StringValue("anonymous"), StringValue("anonymous")},
+		{Float64Value(0), Float64Value(0), Float64Value(0)},
+	}, res)
+}
+
+func TestSchemaPersistence(t *testing.T) {
+	dir := t.TempDir()
+	manager := startManager(t, dir)
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	_, err = db1.CreateTable("tbl1", WithSchema(testSchema(t)))
+	assert.NoError(t, err)
+	keyed, err := testSchema(t).PrimaryKey("id")
+	assert.NoError(t, err)
+	keyed, err = keyed.Unique("name", "age")
+	assert.NoError(t, err)
+	tbl2, err := db1.CreateTable("tbl2", WithSchema(keyed))
+	assert.NoError(t, err)
+	assert.NoError(t, tbl2.InsertRow([]string{"id", "age"}, []int64{1, 20}))
+	assert.NoError(t, tbl2.InsertRow([]string{"id", "age"}, []int64{2, 30}))
+	assert.NoError(t, tbl2.DeleteRows([]int64{0}))
+
+	// the schema is replayed from the write-ahead log
+	restarted := startManager(t, dir)
+	rdb1, err := restarted.GetDb("testdb1")
+	assert.NoError(t, err)
+	rtbl1, err := rdb1.GetTable("tbl1")
+	assert.NoError(t, err)
+	assert.Equal(t, testSchema(t), rtbl1.Schema())
+	assert.ErrorContains(t, rtbl1.InsertRow([]string{"id", "age"}, []int64{1, -1}), "violates CHECK")
+	assert.NoError(t, rtbl1.InsertRow([]string{"id"}, []int64{1}))
+	rtbl2, err := rdb1.GetTable("tbl2")
+	assert.NoError(t, err)
+	assert.Equal(t, keyed, rtbl2.Schema())
+	assert.ErrorContains(t, rtbl2.InsertRow([]string{"id"}, []int64{2}), "violates PRIMARY KEY (id)")
+
+	// and restored from a snapshot
+	assert.NoError(t, restarted.End())
+	again := startManager(t, dir)
+	adb1, err := again.GetDb("testdb1")
+	assert.NoError(t, err)
+	atbl1, err := adb1.GetTable("tbl1")
+	assert.NoError(t, err)
+	assert.Equal(t, testSchema(t), atbl1.Schema())
+	assert.Equal(t, int64(1), atbl1.numRows)
+	assert.ErrorContains(t, atbl1.InsertRow([]string{"age"}, []int64{1}), "NOT NULL")
+
+	// indexes are rebuilt from the restored rows
+	atbl2, err := adb1.GetTable("tbl2")
+	assert.NoError(t, err)
+	assert.Equal(t, keyed, atbl2.Schema())
+	assert.ErrorContains(t, atbl2.InsertRow([]string{"id", "age"}, []int64{3, 30}), "duplicate key (anonymous, 30) violates UNIQUE (name, age)")
+	row, ok, err := atbl2.Lookup([]Value{Int64Value(2)})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Int64Value(30), row[2])
+	_, ok, err = atbl2.Lookup([]Value{Int64Value(1)})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSchemaKeys(t *testing.T) {
+	schema, err := NewSchema(
+		NewColumnDef("id", TypeInt64),
+		NewColumnDef("email", TypeString),
+		NewColumnDef("first", TypeString),
+		NewColumnDef("last", TypeString),
+	)
+	assert.NoError(t, err)
+
+	keyed, err := schema.PrimaryKey("id")
+	assert.NoError(t, err)
+	keyed, err = keyed.Unique("email")
+	assert.NoError(t, err)
+	keyed, err = keyed.Unique("first", "last")
+	assert.NoError(t, err)
+	assert.Equal(t, "(id int64 NOT NULL, email string, first string, last string, PRIMARY KEY (id), UNIQUE (email), UNIQUE (first, last))", keyed.String())
+
+	// deriving a keyed schema leaves the original untouched
+	assert.Equal(t, "(id int64, email string, first string, last string)", schema.String())
+
+	_, err = keyed.PrimaryKey("email")
+	assert.ErrorContains(t, err, "PRIMARY KEY (id) already declared")
+	_, err = schema.PrimaryKey()
+	assert.ErrorContains(t, err, "PRIMARY KEY without columns")
+	_, err = schema.Unique("missing")
+	assert.ErrorContains(t, err, "UNIQUE column missing is not declared")
+	_, err = schema.Unique("first", "first")
+	assert.ErrorContains(t, err, "UNIQUE column first given more than once")
+}
@@ -0,0 +1,303 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// statement is a parsed SQL statement. String renders it back as SQL.
+type statement interface {
+	String() string
+}
+
+// tableName names a table, optionally qualified with its database.
+type tableName struct {
+	db   string
+	name string
+}
+
+func (n tableName) String() string {
+	if n.db == "" {
+		return n.name
+	}
+	return n.db + "." + n.name
+}
+
+type useStmt struct {
+	db string
+}
+
+func (s *useStmt) String() string {
+	return "USE " + s.db
+}
+
+type createDbStmt struct {
+	db string
+}
+
+func (s *createDbStmt) String() string {
+	return "CREATE DATABASE " + s.db
+}
+
+type dropDbStmt struct {
+	db string
+}
+
+func (s *dropDbStmt) String() string {
+	return "DROP DATABASE " + s.db
+}
+
+// columnSpec is a column of a CREATE TABLE statement.
+type columnSpec struct {
+	name       string
+	typ        ColumnType
+	notNull    bool
+	def        sqlExpr
+	check      sqlExpr
+	primaryKey bool
+	unique     bool
+}
+
+func (c columnSpec) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", c.name, c.typ)
+	if c.notNull {
+		b.WriteString(" NOT NULL")
+	}
+	if c.def != nil {
+		fmt.Fprintf(&b, " DEFAULT %s", c.def)
+	}
+	if c.check != nil {
+		fmt.Fprintf(&b, " CHECK (%s)", c.check)
+	}
+	if c.primaryKey {
+		b.WriteString(" PRIMARY KEY")
+	}
+	if c.unique {
+		b.WriteString(" UNIQUE")
+	}
+	return b.String()
+}
+
+type createTableStmt struct {
+	table      tableName
+	cols       []columnSpec
+	primaryKey []string
+	unique     [][]string
+}
+
+func (s *createTableStmt) String() string {
+	defs := make([]string, 0, len(s.cols)+1+len(s.unique))
+	for _, col := range s.cols {
+		defs = append(defs, col.String())
+	}
+	if s.primaryKey != nil {
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(s.primaryKey, ", ")+")")
+	}
+	for _, cols := range s.unique {
+		defs = append(defs, "UNIQUE ("+strings.Join(cols, ", ")+")")
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s)", s.table, strings.Join(defs, ", "))
+}
+
+type dropTableStmt struct {
+	table tableName
+}
+
+func (s *dropTableStmt) String() string {
+	return "DROP TABLE " + s.table.String()
+}
+
+type insertStmt struct {
+	table tableName
+	// cols is nil when the statement lists no columns.
+	cols []string
+	rows [][]sqlExpr
+}
+
+func (s *insertStmt) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s", s.table)
+	if s.cols != nil {
+		fmt.Fprintf(&b, " (%s)", strings.Join(s.cols, ", "))
+	}
+	b.WriteString(" VALUES ")
+	for i, row := range s.rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "(%s)", joinExprs(row))
+	}
+	return b.String()
+}
+
+// selectItem is an expression of a select list and its optional alias.
+type selectItem struct {
+	expr  sqlExpr
+	alias string
+}
+
+func (item selectItem) String() string {
+	if item.alias == "" {
+		return item.expr.String()
+	}
+	return fmt.Sprintf("%s AS %s", item.expr, item.alias)
+}
+
+type selectStmt struct {
+	// items is nil for SELECT *.
+	items []selectItem
+	table tableName
+	where sqlExpr
+}
+
+func (s *selectStmt) String() string {
+	items := "*"
+	if s.items != nil {
+		strs := make([]string, len(s.items))
+		for i, item := range s.items {
+			strs[i] = item.String()
+		}
+		items = strings.Join(strs, ", ")
+	}
+	return fmt.Sprintf("SELECT %s FROM %s%s", items, s.table, whereString(s.where))
+}
+
+type deleteStmt struct {
+	table tableName
+	where sqlExpr
+}
+
+func (s *deleteStmt) String() string {
+	return fmt.Sprintf("DELETE FROM %s%s", s.table, whereString(s.where))
+}
+
+// assignment is a col = expr of an UPDATE statement.
+type assignment struct {
+	col  string
+	expr sqlExpr
+}
+
+type updateStmt struct {
+	table tableName
+	set   []assignment
+	where sqlExpr
+}
+
+func (s *updateStmt) String() string {
+	set := make([]string, len(s.set))
+	for i, a := range s.set {
+		set[i] = fmt.Sprintf("%s = %s", a.col, a.expr)
+	}
+	return fmt.Sprintf("UPDATE %s SET %s%s", s.table, strings.Join(set, ", "), whereString(s.where))
+}
+
+type explainStmt struct {
+	stmt statement
+}
+
+func (s *explainStmt) String() string {
+	return "EXPLAIN " + s.stmt.String()
+}
+
+func whereString(where sqlExpr) string {
+	if where == nil {
+		return ""
+	}
+	return " WHERE " + where.String()
+}
+
+// sqlExpr is a parsed SQL expression. String renders it back as SQL, fully
+// parenthesized where precedence matters.
+type sqlExpr interface {
+	String() string
+}
+
+type colRef struct {
+	name string
+}
+
+func (e *colRef) String() string {
+	return e.name
+}
+
+type literal struct {
+	val Value
+}
+
+func (e *literal) String() string {
+	switch {
+	case e.val.null:
+		return "NULL"
+	case e.val.typ == TypeString:
+		return "'" + strings.ReplaceAll(e.val.s, "'", "''") + "'"
+	case e.val.typ == TypeBool:
+		return strings.ToUpper(e.val.String())
+	}
+	return e.val.String()
+}
+
+// binaryExpr is an arithmetic operator (+ - * /), a comparison (= != < <=
+// > >=) or a logical AND or OR.
+type binaryExpr struct {
+	op    string
+	left  sqlExpr
+	right sqlExpr
+}
+
+func (e *binaryExpr) String() string {
+	return fmt.Sprintf("(%s %s %s)", e.left, e.op, e.right)
+}
+
+type notExpr struct {
+	expr sqlExpr
+}
+
+func (e *notExpr) String() string {
+	return fmt.Sprintf("(NOT %s)", e.expr)
+}
+
+type betweenExpr struct {
+	expr  sqlExpr
+	lower sqlExpr
+	upper sqlExpr
+	not   bool
+}
+
+func (e *betweenExpr) String() string {
+	return fmt.Sprintf("(%s %sBETWEEN %s AND %s)", e.expr, notString(e.not), e.lower, e.upper)
+}
+
+type inExpr struct {
+	expr sqlExpr
+	list []sqlExpr
+	not  bool
+}
+
+func (e *inExpr) String() string {
+	return fmt.Sprintf("(%s %sIN (%s))", e.expr, notString(e.not), joinExprs(e.list))
+}
+
+type isNullExpr struct {
+	expr sqlExpr
+	not  bool
+}
+
+func (e *isNullExpr) String() string {
+	return fmt.Sprintf("(%s IS %sNULL)", e.expr, notString(e.not))
+}
+
+func notString(not bool) string {
+	if not {
+		return "NOT "
+	}
+	return ""
+}
+
+func joinExprs(exprs []sqlExpr) string {
+	strs := make([]string, len(exprs))
+	for i, expr := range exprs {
+		strs[i] = expr.String()
+	}
+	return strings.Join(strs, ", ")
+}
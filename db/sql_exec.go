@@ -0,0 +1,356 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Result is the outcome of a SQL statement. Queries fill Columns, Types and
+// Rows, with one value per column in each row; other statements report the
+// number of rows they inserted, updated or deleted.
+type Result struct {
+	Columns      []string
+	Types        []ColumnType
+	Rows         [][]Value
+	RowsAffected int64
+}
+
+// Session runs SQL statements against a manager and remembers the database
+// selected with USE, against which unqualified table names resolve. A
+// Session is not safe for concurrent use.
+type Session struct {
+	dbm *defaultManager
+	db  string
+	// readOnly makes Exec refuse every statement but SELECT, EXPLAIN and
+	// USE.
+	readOnly bool
+}
+
+func (dbm *defaultManager) NewSession() *Session {
+	return &Session{dbm: dbm}
+}
+
+// Exec runs a single SQL statement in a new session, so table names must be
+// qualified with their database, e.g. SELECT * FROM shop.items.
+func (dbm *defaultManager) Exec(ctx context.Context, sql string) (*Result, error) {
+	return dbm.NewSession().Exec(ctx, sql)
+}
+
+// Database returns the database selected with USE, or "".
+func (s *Session) Database() string {
+	return s.db
+}
+
+// Use selects the database unqualified table names resolve against, like
+// a USE statement.
+func (s *Session) Use(dbName string) error {
+	if _, err := s.dbm.GetDb(dbName); err != nil {
+		return err
+	}
+	s.db = dbName
+	return nil
+}
+
+// SetReadOnly makes Exec refuse statements that write, before running
+// them, until it is called with false.
+func (s *Session) SetReadOnly(readOnly bool) {
+	s.readOnly = readOnly
+}
+
+// Exec parses, plans and runs a single SQL statement.
+func (s *Session) Exec(ctx context.Context, sql string) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stmt, err := parseSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+	if s.readOnly {
+		switch stmt.(type) {
+		case *useStmt, *selectStmt, *explainStmt:
+		default:
+			return nil, fmt.Errorf("cannot write in a read-only session: only SELECT, EXPLAIN and USE are allowed")
+		}
+	}
+
+	switch stmt := stmt.(type) {
+	case *useStmt:
+		if err := s.Use(stmt.db); err != nil {
+			return nil, err
+		}
+		return &Result{}, nil
+	case *createDbStmt:
+		_, err := s.dbm.CreateDb(stmt.db)
+		return &Result{}, err
+	case *dropDbStmt:
+		if err := s.dbm.DeleteDb(stmt.db); err != nil {
+			return nil, err
+		}
+		if s.db == stmt.db {
+			s.db = ""
+		}
+		return &Result{}, nil
+	case *createTableStmt:
+		return s.createTable(stmt)
+	case *dropTableStmt:
+		db, err := s.database(stmt.table)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{}, db.DeleteTable(stmt.table.name)
+	case *insertStmt:
+		return s.insert(stmt)
+	case *explainStmt:
+		pl, err := s.plan(stmt.stmt)
+		if err != nil {
+			return nil, err
+		}
+		res := &Result{Columns: []string{"plan"}, Types: []ColumnType{TypeString}}
+		for _, line := range strings.Split(pl.String(), "\n") {
+			res.Rows = append(res.Rows, []Value{StringValue(line)})
+		}
+		return res, nil
+	}
+
+	pl, err := s.plan(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return pl.execute(ctx)
+}
+
+// plan resolves a SELECT, UPDATE or DELETE statement.
+func (s *Session) plan(stmt statement) (plan, error) {
+	switch stmt := stmt.(type) {
+	case *selectStmt:
+		tbl, err := s.table(stmt.table)
+		if err != nil {
+			return nil, err
+		}
+		return planSelect(stmt.table, tbl, stmt)
+	case *updateStmt:
+		tbl, err := s.table(stmt.table)
+		if err != nil {
+			return nil, err
+		}
+		return planUpdate(stmt.table, tbl, stmt)
+	case *deleteStmt:
+		tbl, err := s.table(stmt.table)
+		if err != nil {
+			return nil, err
+		}
+		f, err := compileFilter(tbl, stmt.where, false)
+		if err != nil {
+			return nil, err
+		}
+		return &deletePlan{name: stmt.table, tbl: tbl, filter: f, hasWhere: stmt.where != nil}, nil
+	}
+	return nil, fmt.Errorf("cannot plan %s", stmt)
+}
+
+// database returns the database of a table name, which defaults to the one
+// selected with USE.
+func (s *Session) database(name tableName) (*db, error) {
+	dbName := name.db
+	if dbName == "" {
+		dbName = s.db
+	}
+	if dbName == "" {
+		return nil, fmt.Errorf("no database selected for table %s: qualify it as db.%s or USE a database", name.name, name.name)
+	}
+	return s.dbm.GetDb(dbName)
+}
+
+func (s *Session) table(name tableName) (*table, error) {
+	db, err := s.database(name)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetTable(name.name)
+}
+
+func (s *Session) createTable(stmt *createTableStmt) (*Result, error) {
+	db, err := s.database(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := buildSchema(stmt)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.CreateTable(stmt.table.name, WithSchema(schema))
+	return &Result{}, err
+}
+
+// buildSchema converts the column specs and constraints of a CREATE TABLE
+// statement into a Schema.
+func buildSchema(stmt *createTableStmt) (*Schema, error) {
+	defs := make([]ColumnDef, len(stmt.cols))
+	for i, spec := range stmt.cols {
+		def := NewColumnDef(spec.name, spec.typ)
+		if spec.notNull {
+			def = def.NotNull()
+		}
+		if spec.def != nil {
+			val, err := constValue(spec.def)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid schema: DEFAULT of column %s: %v", spec.name, err)
+			}
+			if val, err = coerceValue(spec.name, spec.typ, val); err != nil {
+				return nil, fmt.Errorf("Invalid schema: DEFAULT of column %s: %v", spec.name, err)
+			}
+			def = def.Default(val)
+		}
+		if spec.check != nil {
+			min, max, err := checkBounds(spec, spec.check)
+			if err != nil {
+				return nil, err
+			}
+			def = def.Check(min, max)
+		}
+		defs[i] = def
+	}
+
+	schema, err := NewSchema(defs...)
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range stmt.cols {
+		if spec.primaryKey {
+			if schema, err = schema.PrimaryKey(spec.name); err != nil {
+				return nil, err
+			}
+		}
+		if spec.unique {
+			if schema, err = schema.Unique(spec.name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if stmt.primaryKey != nil {
+		if schema, err = schema.PrimaryKey(stmt.primaryKey...); err != nil {
+			return nil, err
+		}
+	}
+	for _, cols := range stmt.unique {
+		if schema, err = schema.Unique(cols...); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
+
+// checkBounds converts a CHECK constraint into the inclusive range a
+// ColumnDef supports. The constraint may combine BETWEEN, >= and <= on the
+// column with AND. A null bound leaves that side of the range open.
+func checkBounds(spec columnSpec, expr sqlExpr) (min Value, max Value, err error) {
+	min, max = NullValue(), NullValue()
+	unsupported := fmt.Errorf("Invalid schema: unsupported CHECK (%s) of column %s: only BETWEEN, >= and <= with constants combined by AND are supported", expr, spec.name)
+
+	isColumn := func(expr sqlExpr) bool {
+		ref, ok := expr.(*colRef)
+		return ok && ref.name == spec.name
+	}
+	bound := func(expr sqlExpr) (Value, error) {
+		val, err := constValue(expr)
+		if err != nil {
+			return Value{}, fmt.Errorf("Invalid schema: CHECK of column %s: %v", spec.name, err)
+		}
+		if val, err = coerceValue(spec.name, spec.typ, val); err != nil {
+			return Value{}, fmt.Errorf("Invalid schema: CHECK of column %s: %v", spec.name, err)
+		}
+		return val, nil
+	}
+	// tighten keeps the narrower of two bounds of the same side
+	tighten := func(cur *Value, val Value, sign int) {
+		if cur.null || val.Compare(*cur)*sign > 0 {
+			*cur = val
+		}
+	}
+
+	var walk func(expr sqlExpr) error
+	walk = func(expr sqlExpr) error {
+		switch e := expr.(type) {
+		case *betweenExpr:
+			if e.not || !isColumn(e.expr) {
+				return unsupported
+			}
+			lower, err := bound(e.lower)
+			if err != nil {
+				return err
+			}
+			upper, err := bound(e.upper)
+			if err != nil {
+				return err
+			}
+			tighten(&min, lower, 1)
+			tighten(&max, upper, -1)
+			return nil
+		case *binaryExpr:
+			if e.op == "AND" {
+				if err := walk(e.left); err != nil {
+					return err
+				}
+				return walk(e.right)
+			}
+			ref, other, op := e.left, e.right, e.op
+			if !isColumn(ref) {
+				ref, other, op = e.right, e.left, flippedOps[e.op]
+			}
+			if !isColumn(ref) || (op != ">=" && op != "<=") {
+				return unsupported
+			}
+			val, err := bound(other)
+			if err != nil {
+				return err
+			}
+			if op == ">=" {
+				tighten(&min, val, 1)
+			} else {
+				tighten(&max, val, -1)
+			}
+			return nil
+		}
+		return unsupported
+	}
+	err = walk(expr)
+	return min, max, err
+}
+
+func (s *Session) insert(stmt *insertStmt) (*Result, error) {
+	tbl, err := s.table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+
+	colNames := stmt.cols
+	if colNames == nil {
+		colNames = tbl.ColumnNames()
+	}
+	cols := make([]*column, len(colNames))
+	for i, name := range colNames {
+		if cols[i], err = tbl.GetColumn(name); err != nil {
+			return nil, err
+		}
+	}
+
+	rows := make([][]Value, len(stmt.rows))
+	for r, exprs := range stmt.rows {
+		if len(exprs) != len(colNames) {
+			return nil, fmt.Errorf("INSERT has %d columns but row %d has %d values", len(colNames), r+1, len(exprs))
+		}
+		rows[r] = make([]Value, len(exprs))
+		for i, col := range cols {
+			if rows[r][i], err = columnConst(col, exprs[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tbl.InsertValueRows(colNames, rows); err != nil {
+		return nil, err
+	}
+	return &Result{RowsAffected: int64(len(rows))}, nil
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// execAll runs statements in a session, failing the test on any error, and
+// returns the result of the last one.
+func execAll(t *testing.T, s *Session, sqls ...string) *Result {
+	var res *Result
+	for _, sql := range sqls {
+		var err error
+		res, err = s.Exec(context.Background(), sql)
+		if !assert.NoError(t, err, sql) {
+			t.FailNow()
+		}
+	}
+	return res
+}
+
+func setupItems(t *testing.T) *Session {
+	s := NewDefaultManager(zap.NewNop()).NewSession()
+	execAll(t, s,
+		"CREATE DATABASE shop",
+		"USE shop",
+		`CREATE TABLE items (
+			id INT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			price FLOAT CHECK (price >= 0),
+			qty INT DEFAULT 0,
+			sold BOOL
+		)`,
+		`INSERT INTO items (id, name, price, qty, sold) VALUES
+			(1, 'apple', 0.5, 10, TRUE),
+			(2, 'pear', 0.75, NULL, FALSE),
+			(3, 'fig', 2, 3, NULL),
+			(4, 'kiwi', NULL, 7, TRUE)`,
+	)
+	return s
+}
+
+func TestExecSelect(t *testing.T) {
+	s := setupItems(t)
+
+	res := execAll(t, s, "SELECT * FROM items WHERE id = 3")
+	assert.Equal(t, []string{"id", "name", "price", "qty", "sold"}, res.Columns)
+	assert.Equal(t, []ColumnType{TypeInt64, TypeString, TypeFloat64, TypeInt64, TypeBool}, res.Types)
+	assert.Equal(t, [][]Value{{Int64Value(3), StringValue("fig"), Float64Value(2), Int64Value(3), NullValue()}}, res.Rows)
+
+	tests := []struct {
+		where  string
+		expect []int64
+	}{
+		{"", []int64{1, 2, 3, 4}},
+		{"WHERE TRUE", []int64{1, 2, 3, 4}},
+		{"WHERE NULL", []int64{}},
+		{"WHERE id != 2", []int64{1, 3, 4}},
+		{"WHERE 2 < id", []int64{3, 4}},
+		{"WHERE price > 0.5", []int64{2, 3}},
+		{"WHERE price <= 1", []int64{1, 2}},
+		{"WHERE price = 2", []int64{3}},
+		{"WHERE name >= 'kiwi'", []int64{2, 4}},
+		{"WHERE qty BETWEEN 3 AND 7", []int64{3, 4}},
+		{"WHERE qty NOT BETWEEN 3 AND 7", []int64{1}},
+		{"WHERE name IN ('fig', 'kiwi', 'plum')", []int64{3, 4}},
+		{"WHERE id NOT IN (1, 3)", []int64{2, 4}},
+		{"WHERE id NOT IN (1, NULL)", []int64{}},
+		{"WHERE qty IS NULL", []int64{2}},
+		{"WHERE price IS NOT NULL AND qty IS NOT NULL", []int64{1, 3}},
+		{"WHERE sold", []int64{1, 4}},
+		{"WHERE NOT sold", []int64{2}},
+		{"WHERE id = 1 OR id = 4 AND qty > 5", []int64{1, 4}},
+		{"WHERE (id = 1 OR id = 4) AND qty > 8", []int64{1}},
+		// NOT never matches a row whose column is null
+		{"WHERE NOT qty > 5", []int64{3}},
+		{"WHERE NOT (qty > 5 OR price > 1)", []int64{}},
+		{"WHERE NOT (qty > 5 AND price > 0.1)", []int64{3}},
+		{"WHERE NOT NOT qty > 5", []int64{1, 4}},
+		{"WHERE NOT qty IN (3, 10)", []int64{4}},
+		{"WHERE NOT qty IS NULL", []int64{1, 3, 4}},
+		{"WHERE qty = NULL OR NOT qty != NULL", []int64{}},
+		{"WHERE id = 1 + 1", []int64{2}},
+	}
+	for _, tt := range tests {
+		res := execAll(t, s, "SELECT id FROM items "+tt.where)
+		ids := []int64{}
+		for _, row := range res.Rows {
+			ids = append(ids, row[0].Int64())
+		}
+		assert.Equal(t, tt.expect, ids, tt.where)
+	}
+
+	res = execAll(t, s, "SELECT name, qty * 2 AS double, price + 1, -qty FROM items WHERE id <= 2")
+	assert.Equal(t, []string{"name", "double", "(price + 1)", "(0 - qty)"}, res.Columns)
+	assert.Equal(t, []ColumnType{TypeString, TypeInt64, TypeFloat64, TypeInt64}, res.Types)
+	assert.Equal(t, [][]Value{
+		{StringValue("apple"), Int64Value(20), Float64Value(1.5), Int64Value(-10)},
+		{StringValue("pear"), NullValue(), Float64Value(1.75), NullValue()},
+	}, res.Rows)
+
+	// deleted rows are not returned
+	assert.NoError(t, s.dbm.dbs["shop"].tables["items"].DeleteRows([]int64{0}))
+	res = execAll(t, s, "SELECT id FROM items WHERE NOT id = 3")
+	assert.Equal(t, [][]Value{{Int64Value(2)}, {Int64Value(4)}}, res.Rows)
+}
+
+func TestExecWrites(t *testing.T) {
+	s := setupItems(t)
+
+	res := execAll(t, s, "UPDATE items SET qty = qty + 1, price = 1 WHERE qty IS NOT NULL AND id < 4")
+	assert.Equal(t, int64(2), res.RowsAffected)
+	res = execAll(t, s, "SELECT id, qty, price FROM items WHERE price = 1")
+	assert.Equal(t, [][]Value{
+		{Int64Value(1), Int64Value(11), Float64Value(1)},
+		{Int64Value(3), Int64Value(4), Float64Value(1)},
+	}, res.Rows)
+
+	res = execAll(t, s, "UPDATE items SET price = NULL WHERE id = 99")
+	assert.Equal(t, int64(0), res.RowsAffected)
+
+	res = execAll(t, s, "DELETE FROM items WHERE sold")
+	assert.Equal(t, int64(2), res.RowsAffected)
+	res = execAll(t, s, "SELECT name FROM items")
+	assert.Equal(t, [][]Value{{StringValue("pear")}, {StringValue("fig")}}, res.Rows)
+
+	// omitted columns get their default and unlisted inserts use schema order
+	res = execAll(t, s, "INSERT INTO items (id, name) VALUES (5, 'plum')", "INSERT INTO items VALUES (6, 'lime', 1, 2, FALSE)")
+	assert.Equal(t, int64(1), res.RowsAffected)
+	res = execAll(t, s, "SELECT id, qty FROM items WHERE id >= 5")
+	assert.Equal(t, [][]Value{{Int64Value(5), Int64Value(0)}, {Int64Value(6), Int64Value(2)}}, res.Rows)
+
+	res = execAll(t, s, "DELETE FROM items")
+	assert.Equal(t, int64(4), res.RowsAffected)
+	res = execAll(t, s, "SELECT * FROM items")
+	assert.Empty(t, res.Rows)
+
+	// a read-only session refuses writes before running them
+	s.SetReadOnly(true)
+	for _, sql := range []string{
+		"INSERT INTO items (id, name) VALUES (7, 'date')",
+		"UPDATE items SET qty = 1",
+		"DELETE FROM items",
+		"DROP TABLE items",
+		"CREATE DATABASE farm",
+	} {
+		_, err := s.Exec(context.Background(), sql)
+		assert.EqualError(t, err, "cannot write in a read-only session: only SELECT, EXPLAIN and USE are allowed", sql)
+	}
+	execAll(t, s, "USE shop", "SELECT * FROM items", "EXPLAIN SELECT * FROM items")
+	s.SetReadOnly(false)
+
+	execAll(t, s, "DROP TABLE items", "DROP DATABASE shop")
+	assert.Equal(t, "", s.Database())
+}
+
+func TestExecErrors(t *testing.T) {
+	s := setupItems(t)
+
+	tests := []struct {
+		sql string
+		err string
+	}{
+		{"SELECT * FROM", "syntax error at position 13: expected table name, found end of statement"},
+		{"USE nope", "Cannot get db with name nope: does not exist"},
+		{"SELECT * FROM nope", "Cannot get table with name nope: does not exist"},
+		{"SELECT nope FROM items", "Cannot get column with name nope: does not exist"},
+		{"SELECT * FROM items WHERE id = 'x'", "type mismatch: column id has type int64, got string"},
+		{"SELECT * FROM items WHERE id = qty", "unsupported comparison (id = qty): WHERE can only compare a column with constants"},
+		{"SELECT * FROM items WHERE id + 1 = 2", "unsupported comparison ((id + 1) = 2): WHERE can only compare a column with constants"},
+		{"SELECT * FROM items WHERE id", "WHERE id is not a boolean: column id has type int64"},
+		{"SELECT * FROM items WHERE 1", "WHERE 1 is not a boolean"},
+		{"SELECT * FROM items WHERE id BETWEEN NULL AND 2", "unsupported (id BETWEEN NULL AND 2): BETWEEN bounds must not be null"},
+		{"SELECT id = 1 FROM items", "(id = 1) is only supported in WHERE"},
+		{"SELECT name + 1 FROM items", "cannot evaluate (name + 1): string + int64"},
+		{"SELECT id / 0 FROM items", "cannot evaluate (id / 0): division by zero"},
+		{"INSERT INTO items (id, name) VALUES (1, 'dup')", "InsertValueRows: duplicate key (1) violates PRIMARY KEY (id)"},
+		{"INSERT INTO items (id, name) VALUES (7, 'a'), (8)", "INSERT has 2 columns but row 2 has 1 values"},
+		{"INSERT INTO items (id, name) VALUES (id, 'a')", "column id is not allowed in a constant"},
+		{"INSERT INTO items (id, name, price) VALUES (7, 'a', -1)", "InsertValueRows: column price value -1 violates CHECK (price >= 0)"},
+		{"INSERT INTO items (id) VALUES ('seven')", "type mismatch: column id has type int64, got string"},
+		{"UPDATE items SET name = 1", "type mismatch: column name has type string, got int64"},
+		{"UPDATE items SET price = qty", "type mismatch: column price has type float64, got int64"},
+		{"UPDATE items SET name = 'x'", "UpdateExprs: duplicate key (x) violates UNIQUE (name)"},
+		{"CREATE TABLE items (a INT)", "Can't create db with name items: Table already exists"},
+		{"CREATE TABLE t (a INT CHECK (a > 1))", "Invalid schema: unsupported CHECK ((a > 1)) of column a: only BETWEEN, >= and <= with constants combined by AND are supported"},
+		{"CREATE TABLE t (a INT DEFAULT 'x')", "Invalid schema: DEFAULT of column a: type mismatch: column a has type int64, got string"},
+		{"CREATE TABLE t (a INT PRIMARY KEY, b INT PRIMARY KEY)", "Invalid schema: PRIMARY KEY (a) already declared"},
+		{"CREATE TABLE t (a INT, UNIQUE (b))", "Invalid schema: UNIQUE column b is not declared"},
+	}
+	for _, tt := range tests {
+		_, err := s.Exec(context.Background(), tt.sql)
+		assert.EqualError(t, err, tt.err, tt.sql)
+	}
+
+	// without USE table names must be qualified
+	manager := s.dbm
+	_, err := manager.Exec(context.Background(), "SELECT * FROM items")
+	assert.EqualError(t, err, "no database selected for table items: qualify it as db.items or USE a database")
+	res, err := manager.Exec(context.Background(), "SELECT id FROM shop.items WHERE id = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{{Int64Value(1)}}, res.Rows)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.Exec(ctx, "SELECT * FROM items")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestExecSchema(t *testing.T) {
+	s := NewDefaultManager(zap.NewNop()).NewSession()
+	execAll(t, s,
+		"CREATE DATABASE db1",
+		`CREATE TABLE db1.events (
+			id INT NOT NULL,
+			kind VARCHAR(8) DEFAULT 'click',
+			at TIMESTAMP,
+			score DOUBLE CHECK (score BETWEEN 0 AND 100 AND score >= 10),
+			PRIMARY KEY (id, kind),
+			UNIQUE (at)
+		)`,
+	)
+	tbl, err := s.dbm.dbs["db1"].GetTable("events")
+	assert.NoError(t, err)
+	assert.Equal(t, "(id int64 NOT NULL, kind string NOT NULL DEFAULT click, at timestamp, score float64 CHECK (score BETWEEN 10 AND 100), PRIMARY KEY (id, kind), UNIQUE (at))", tbl.Schema().String())
+
+	execAll(t, s, "INSERT INTO db1.events (id, at, score) VALUES (1, '2024-05-01T10:00:00Z', 50), (2, '2024-05-02', 10)")
+	res := execAll(t, s, "SELECT id, kind, at FROM db1.events WHERE at > '2024-05-01 12:00:00'")
+	assert.Equal(t, [][]Value{{Int64Value(2), StringValue("click"), TimestampValue(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC))}}, res.Rows)
+
+	_, err = s.Exec(context.Background(), "INSERT INTO db1.events (id, score) VALUES (3, 5)")
+	assert.EqualError(t, err, "InsertValueRows: column score value 5 violates CHECK (score BETWEEN 10 AND 100)")
+	_, err = s.Exec(context.Background(), "INSERT INTO db1.events (id, at) VALUES (3, 'yesterday')")
+	assert.EqualError(t, err, `column at: cannot parse "yesterday" as a timestamp`)
+}
+
+func TestExecExplain(t *testing.T) {
+	s := setupItems(t)
+
+	plan := func(sql string) []string {
+		var lines []string
+		for _, row := range execAll(t, s, sql).Rows {
+			lines = append(lines, row[0].Str())
+		}
+		return lines
+	}
+
+	assert.Equal(t, []string{
+		"Project: id, (price * 2) AS p",
+		"  Filter: ((qty < 5 OR qty > 9) AND (id NOT IN (1, 2) OR name IS NOT NULL))",
+		"    Scan: items",
+	}, plan("EXPLAIN SELECT id, price * 2 AS p FROM items WHERE qty NOT BETWEEN 5 AND 9 AND NOT (id IN (1, 2) AND name IS NULL)"))
+	assert.Equal(t, []string{"Delete: shop.items", "  Scan: shop.items"}, plan("EXPLAIN DELETE FROM shop.items"))
+	assert.Equal(t, []string{
+		"Update: items SET qty = (qty + 1)",
+		"  Filter: price >= 1",
+		"    Scan: items",
+	}, plan("EXPLAIN UPDATE items SET qty = qty + 1 WHERE NOT price < 1"))
+
+	// EXPLAIN does not run the statement
+	res := execAll(t, s, "SELECT id FROM items")
+	assert.Len(t, res.Rows, 4)
+}
+
+func TestExecPersistence(t *testing.T) {
+	dir := t.TempDir()
+	manager := startManager(t, dir)
+	s := manager.NewSession()
+	execAll(t, s,
+		"CREATE DATABASE shop",
+		"CREATE TABLE shop.items (id INT PRIMARY KEY, name TEXT)",
+		"INSERT INTO shop.items VALUES (1, 'a'), (2, 'b'), (3, 'c')",
+		"UPDATE shop.items SET name = 'z' WHERE id = 2",
+		"DELETE FROM shop.items WHERE id = 1",
+	)
+
+	// replay the write-ahead log without a checkpoint
+	restarted := startManager(t, dir)
+	res, err := restarted.Exec(context.Background(), "SELECT * FROM shop.items")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{{Int64Value(2), StringValue("z")}, {Int64Value(3), StringValue("c")}}, res.Rows)
+	assert.NoError(t, restarted.End())
+}
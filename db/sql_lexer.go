@@ -0,0 +1,248 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenInt
+	tokenFloat
+	tokenString
+	tokenSymbol
+)
+
+// token is a lexical unit of a SQL statement. Keywords are lexed as
+// identifiers and recognized by the parser, unless they were quoted.
+type token struct {
+	kind tokenKind
+	text string
+	// pos is the byte offset of the token in the statement.
+	pos    int
+	quoted bool
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of statement"
+	case tokenString:
+		return "'" + strings.ReplaceAll(t.text, "'", "''") + "'"
+	case tokenIdent:
+		if t.quoted {
+			return `"` + t.text + `"`
+		}
+	}
+	return t.text
+}
+
+// symbols lists the operators and punctuation of the SQL subset, longest
+// first so that e.g. <= is not lexed as < followed by =.
+var symbols = []string{"<=", ">=", "!=", "<>", "=", "<", ">", "+", "-", "*", "/", "(", ")", ",", ".", ";", "?"}
+
+// lexSQL splits a statement into tokens, ending with a tokenEOF.
+func lexSQL(sql string) ([]token, error) {
+	var tokens []token
+	pos := 0
+	for {
+		// skip whitespace and -- comments
+		for pos < len(sql) {
+			if isSpace(sql[pos]) {
+				pos++
+			} else if strings.HasPrefix(sql[pos:], "--") {
+				for pos < len(sql) && sql[pos] != '\n' {
+					pos++
+				}
+			} else {
+				break
+			}
+		}
+		if pos == len(sql) {
+			return append(tokens, token{kind: tokenEOF, pos: pos}), nil
+		}
+
+		start := pos
+		ch := sql[pos]
+		switch {
+		case isIdentStart(ch):
+			for pos < len(sql) && isIdentPart(sql[pos]) {
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: sql[start:pos], pos: start})
+		case isDigit(ch) || (ch == '.' && pos+1 < len(sql) && isDigit(sql[pos+1])):
+			kind := tokenInt
+			for pos < len(sql) && isDigit(sql[pos]) {
+				pos++
+			}
+			if pos < len(sql) && sql[pos] == '.' {
+				kind = tokenFloat
+				pos++
+				for pos < len(sql) && isDigit(sql[pos]) {
+					pos++
+				}
+			}
+			if pos < len(sql) && (sql[pos] == 'e' || sql[pos] == 'E') {
+				kind = tokenFloat
+				pos++
+				if pos < len(sql) && (sql[pos] == '+' || sql[pos] == '-') {
+					pos++
+				}
+				if pos == len(sql) || !isDigit(sql[pos]) {
+					return nil, fmt.Errorf("syntax error at position %d: malformed number %s", start, sql[start:pos])
+				}
+				for pos < len(sql) && isDigit(sql[pos]) {
+					pos++
+				}
+			}
+			if pos < len(sql) && isIdentStart(sql[pos]) {
+				return nil, fmt.Errorf("syntax error at position %d: malformed number %s", start, sql[start:pos+1])
+			}
+			tokens = append(tokens, token{kind: kind, text: sql[start:pos], pos: start})
+		case ch == '\'' || ch == '"':
+			// quotes are escaped by doubling them
+			what := "string"
+			if ch == '"' {
+				what = "quoted identifier"
+			}
+			var b strings.Builder
+			pos++
+			for {
+				if pos == len(sql) {
+					return nil, fmt.Errorf("syntax error at position %d: unterminated %s", start, what)
+				}
+				if sql[pos] == ch {
+					if pos+1 < len(sql) && sql[pos+1] == ch {
+						b.WriteByte(ch)
+						pos += 2
+						continue
+					}
+					pos++
+					break
+				}
+				b.WriteByte(sql[pos])
+				pos++
+			}
+			if ch == '\'' {
+				tokens = append(tokens, token{kind: tokenString, text: b.String(), pos: start})
+			} else {
+				tokens = append(tokens, token{kind: tokenIdent, text: b.String(), pos: start, quoted: true})
+			}
+		default:
+			var sym string
+			for _, s := range symbols {
+				if strings.HasPrefix(sql[pos:], s) {
+					sym = s
+					break
+				}
+			}
+			if sym == "" {
+				return nil, fmt.Errorf("syntax error at position %d: unexpected character %q", pos, ch)
+			}
+			pos += len(sym)
+			tokens = append(tokens, token{kind: tokenSymbol, text: sym, pos: start})
+		}
+	}
+}
+
+// SplitSQL splits a script into statements at the semicolons outside of
+// quotes and comments, dropping empty statements.
+func SplitSQL(sql string) ([]string, error) {
+	tokens, err := lexSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	var stmts []string
+	start := 0
+	for _, tok := range tokens {
+		if tok.kind == tokenEOF || (tok.kind == tokenSymbol && tok.text == ";") {
+			if stmt := strings.TrimSpace(sql[start:tok.pos]); stmt != "" && !onlyComments(stmt) {
+				stmts = append(stmts, stmt)
+			}
+			start = tok.pos + 1
+		}
+	}
+	return stmts, nil
+}
+
+// BindSQL replaces the ? placeholders of a statement, outside of quotes
+// and comments, with the literals of args in order.
+func BindSQL(sql string, args ...Value) (string, error) {
+	tokens, err := lexSQL(sql)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	n, start := 0, 0
+	for _, tok := range tokens {
+		if tok.kind != tokenSymbol || tok.text != "?" {
+			continue
+		}
+		if n == len(args) {
+			return "", fmt.Errorf("statement has more placeholders than the %d arguments", len(args))
+		}
+		lit, err := bindLiteral(args[n])
+		if err != nil {
+			return "", fmt.Errorf("argument %d: %v", n+1, err)
+		}
+		b.WriteString(sql[start:tok.pos])
+		b.WriteString(lit)
+		start = tok.pos + 1
+		n++
+	}
+	if n != len(args) {
+		return "", fmt.Errorf("statement has %d placeholders but %d arguments", n, len(args))
+	}
+	b.WriteString(sql[start:])
+	return b.String(), nil
+}
+
+// bindLiteral returns the SQL literal of a bound value. Negative numbers
+// are parenthesized so that a preceding minus cannot turn into a comment,
+// and timestamps are strings, which coerce to timestamp columns.
+func bindLiteral(val Value) (string, error) {
+	switch {
+	case val.null:
+		return "NULL", nil
+	case val.typ == TypeInt64 && val.i == math.MinInt64:
+		// the literal of its magnitude overflows
+		return fmt.Sprintf("(%d-1)", val.i+1), nil
+	case val.typ == TypeFloat64 && (math.IsNaN(val.f) || math.IsInf(val.f, 0)):
+		return "", fmt.Errorf("%s has no SQL literal", val)
+	case val.typ == TypeTimestamp:
+		return (&literal{val: StringValue(val.String())}).String(), nil
+	}
+	lit := (&literal{val: val}).String()
+	if strings.HasPrefix(lit, "-") {
+		return "(" + lit + ")", nil
+	}
+	return lit, nil
+}
+
+// onlyComments reports whether a piece of a script holds no tokens.
+func onlyComments(sql string) bool {
+	tokens, err := lexSQL(sql)
+	return err == nil && len(tokens) == 1
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isIdentPart(ch byte) bool {
+	return isIdentStart(ch) || isDigit(ch)
+}
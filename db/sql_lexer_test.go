@@ -0,0 +1,86 @@
+package db
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestLexSQL(t *testing.T) {
+	tokens, err := lexSQL(`SELECT "Order", x FROM t -- comment
+		WHERE name = 'it''s' AND y <= -1.5e3 AND z <> .5;`)
+	assert.NoError(t, err)
+
+	var texts []string
+	var kinds []tokenKind
+	for _, tok := range tokens {
+		texts = append(texts, tok.text)
+		kinds = append(kinds, tok.kind)
+	}
+	assert.Equal(t, []string{"SELECT", "Order", ",", "x", "FROM", "t", "WHERE", "name", "=", "it's", "AND", "y", "<=", "-", "1.5e3", "AND", "z", "<>", ".5", ";", ""}, texts)
+	assert.Equal(t, []tokenKind{
+		tokenIdent, tokenIdent, tokenSymbol, tokenIdent, tokenIdent, tokenIdent, tokenIdent, tokenIdent, tokenSymbol, tokenString,
+		tokenIdent, tokenIdent, tokenSymbol, tokenSymbol, tokenFloat, tokenIdent, tokenIdent, tokenSymbol, tokenFloat, tokenSymbol, tokenEOF,
+	}, kinds)
+	assert.True(t, tokens[1].quoted)
+	assert.Equal(t, 7, tokens[1].pos)
+
+	errTests := []struct {
+		sql string
+		err string
+	}{
+		{"SELECT 'abc", "syntax error at position 7: unterminated string"},
+		{`SELECT "abc`, "syntax error at position 7: unterminated quoted identifier"},
+		{"SELECT 12ab", "syntax error at position 7: malformed number 12a"},
+		{"SELECT 1e+", "syntax error at position 7: malformed number 1e+"},
+		{"SELECT a # b", `syntax error at position 9: unexpected character '#'`},
+	}
+	for _, tt := range errTests {
+		_, err := lexSQL(tt.sql)
+		assert.EqualError(t, err, tt.err, tt.sql)
+	}
+}
+
+func TestSplitSQL(t *testing.T) {
+	stmts, err := SplitSQL(`CREATE DATABASE a; INSERT INTO a.t VALUES ('x;y'); -- done;
+		;; SELECT "b;" FROM a.t -- trailing`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"CREATE DATABASE a",
+		"INSERT INTO a.t VALUES ('x;y')",
+		`SELECT "b;" FROM a.t -- trailing`,
+	}, stmts)
+
+	stmts, err = SplitSQL("  -- nothing here\n")
+	assert.NoError(t, err)
+	assert.Empty(t, stmts)
+
+	_, err = SplitSQL("SELECT 'a; SELECT b")
+	assert.EqualError(t, err, "syntax error at position 7: unterminated string")
+}
+
+func TestBindSQL(t *testing.T) {
+	sql, err := BindSQL("SELECT * FROM t WHERE a = ? AND b-? > 0 AND c IN (?, ?, ?) AND d = '?' -- ?\n AND e < ?",
+		StringValue("it's"), Int64Value(-2), Float64Value(1e20), BoolValue(true), NullValue(),
+		TimestampValue(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE a = 'it''s' AND b-(-2) > 0 AND c IN (1e+20, TRUE, NULL) AND d = '?' -- ?\n AND e < '2024-01-02T03:04:05Z'", sql)
+
+	sql, err = BindSQL("INSERT INTO t (a) VALUES (?)", Int64Value(math.MinInt64))
+	assert.NoError(t, err)
+	s := NewDefaultManager(zap.NewNop()).NewSession()
+	res := execAll(t, s, "CREATE DATABASE d", "USE d", "CREATE TABLE t (a INT)", sql, "SELECT a FROM t")
+	assert.Equal(t, [][]Value{{Int64Value(math.MinInt64)}}, res.Rows)
+
+	_, err = BindSQL("SELECT ?, ?", Int64Value(1))
+	assert.EqualError(t, err, "statement has more placeholders than the 1 arguments")
+	_, err = BindSQL("SELECT ?", Int64Value(1), Int64Value(2))
+	assert.EqualError(t, err, "statement has 1 placeholders but 2 arguments")
+	_, err = BindSQL("SELECT ?", Float64Value(math.NaN()))
+	assert.EqualError(t, err, "argument 1: NaN has no SQL literal")
+	_, err = parseSQL("SELECT * FROM t WHERE a = ?")
+	assert.EqualError(t, err, "syntax error at position 26: placeholder ? has no value, bind one with BindSQL")
+}
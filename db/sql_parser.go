@@ -0,0 +1,663 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// reserved lists the keywords that cannot be used as unquoted names.
+var reserved = map[string]bool{
+	"AND": true, "AS": true, "BETWEEN": true, "CHECK": true, "CREATE": true,
+	"DATABASE": true, "DEFAULT": true, "DELETE": true, "DROP": true,
+	"EXPLAIN": true, "FALSE": true, "FROM": true, "IN": true, "INSERT": true,
+	"INTO": true, "IS": true, "KEY": true, "NOT": true, "NULL": true,
+	"OR": true, "PRIMARY": true, "SELECT": true, "SET": true, "TABLE": true,
+	"TRUE": true, "UNIQUE": true, "UPDATE": true, "USE": true,
+	"VALUES": true, "WHERE": true,
+}
+
+// sqlTypes maps the type names accepted by CREATE TABLE to column types.
+var sqlTypes = map[string]ColumnType{
+	"INT": TypeInt64, "INTEGER": TypeInt64, "BIGINT": TypeInt64, "INT64": TypeInt64,
+	"FLOAT": TypeFloat64, "DOUBLE": TypeFloat64, "REAL": TypeFloat64, "FLOAT64": TypeFloat64,
+	"TEXT": TypeString, "VARCHAR": TypeString, "STRING": TypeString,
+	"BOOL": TypeBool, "BOOLEAN": TypeBool,
+	"TIMESTAMP": TypeTimestamp,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parseSQL parses a single statement, optionally terminated by a semicolon.
+func parseSQL(sql string) (statement, error) {
+	tokens, err := lexSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	stmt, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	p.symbol(";")
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "expected end of statement")
+	}
+	return stmt, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok token, format string, args ...any) error {
+	return fmt.Errorf("syntax error at position %d: %s, found %s", tok.pos, fmt.Sprintf(format, args...), tok)
+}
+
+// isKeyword reports whether tok is the unquoted keyword kw.
+func isKeyword(tok token, kw string) bool {
+	return tok.kind == tokenIdent && !tok.quoted && strings.EqualFold(tok.text, kw)
+}
+
+// keyword consumes the next token if it is the keyword kw.
+func (p *parser) keyword(kw string) bool {
+	if isKeyword(p.peek(), kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// keywords consumes a sequence of keywords, e.g. NOT NULL, if the next
+// tokens match all of them.
+func (p *parser) keywords(kws ...string) bool {
+	for i, kw := range kws {
+		if p.pos+i >= len(p.tokens) || !isKeyword(p.tokens[p.pos+i], kw) {
+			return false
+		}
+	}
+	p.pos += len(kws)
+	return true
+}
+
+func (p *parser) expectKeyword(kws ...string) error {
+	if !p.keywords(kws...) {
+		return p.errorf(p.peek(), "expected %s", strings.Join(kws, " "))
+	}
+	return nil
+}
+
+// symbol consumes the next token if it is the symbol sym.
+func (p *parser) symbol(sym string) bool {
+	if tok := p.peek(); tok.kind == tokenSymbol && tok.text == sym {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(sym string) error {
+	if !p.symbol(sym) {
+		return p.errorf(p.peek(), "expected %s", sym)
+	}
+	return nil
+}
+
+// ident parses a name, which must be quoted if it is a reserved keyword.
+func (p *parser) ident(what string) (string, error) {
+	tok := p.peek()
+	if tok.kind != tokenIdent || (!tok.quoted && reserved[strings.ToUpper(tok.text)]) {
+		return "", p.errorf(tok, "expected %s", what)
+	}
+	p.pos++
+	return tok.text, nil
+}
+
+// identList parses a parenthesized, comma separated list of names.
+func (p *parser) identList(what string) ([]string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.ident(what)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.symbol(",") {
+			break
+		}
+	}
+	return names, p.expectSymbol(")")
+}
+
+func (p *parser) tableName() (tableName, error) {
+	name, err := p.ident("table name")
+	if err != nil {
+		return tableName{}, err
+	}
+	if !p.symbol(".") {
+		return tableName{name: name}, nil
+	}
+	tbl, err := p.ident("table name")
+	if err != nil {
+		return tableName{}, err
+	}
+	return tableName{db: name, name: tbl}, nil
+}
+
+func (p *parser) statement() (statement, error) {
+	tok := p.peek()
+	switch {
+	case p.keyword("USE"):
+		name, err := p.ident("database name")
+		if err != nil {
+			return nil, err
+		}
+		return &useStmt{db: name}, nil
+	case p.keyword("CREATE"):
+		if p.keyword("DATABASE") {
+			name, err := p.ident("database name")
+			if err != nil {
+				return nil, err
+			}
+			return &createDbStmt{db: name}, nil
+		}
+		if !p.keyword("TABLE") {
+			return nil, p.errorf(p.peek(), "expected DATABASE or TABLE")
+		}
+		return p.createTable()
+	case p.keyword("DROP"):
+		if p.keyword("DATABASE") {
+			name, err := p.ident("database name")
+			if err != nil {
+				return nil, err
+			}
+			return &dropDbStmt{db: name}, nil
+		}
+		if !p.keyword("TABLE") {
+			return nil, p.errorf(p.peek(), "expected DATABASE or TABLE")
+		}
+		tbl, err := p.tableName()
+		if err != nil {
+			return nil, err
+		}
+		return &dropTableStmt{table: tbl}, nil
+	case p.keyword("INSERT"):
+		return p.insert()
+	case p.keyword("SELECT"):
+		return p.selectStmt()
+	case p.keyword("DELETE"):
+		return p.delete()
+	case p.keyword("UPDATE"):
+		return p.update()
+	case p.keyword("EXPLAIN"):
+		tok := p.peek()
+		stmt, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		switch stmt.(type) {
+		case *selectStmt, *updateStmt, *deleteStmt:
+			return &explainStmt{stmt: stmt}, nil
+		}
+		return nil, p.errorf(tok, "expected SELECT, UPDATE or DELETE after EXPLAIN")
+	}
+	return nil, p.errorf(tok, "expected a statement")
+}
+
+func (p *parser) createTable() (statement, error) {
+	tbl, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &createTableStmt{table: tbl}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		switch {
+		case p.keywords("PRIMARY", "KEY"):
+			if stmt.primaryKey != nil {
+				return nil, p.errorf(tok, "PRIMARY KEY declared more than once")
+			}
+			cols, err := p.identList("column name")
+			if err != nil {
+				return nil, err
+			}
+			stmt.primaryKey = cols
+		case p.keyword("UNIQUE"):
+			cols, err := p.identList("column name")
+			if err != nil {
+				return nil, err
+			}
+			stmt.unique = append(stmt.unique, cols)
+		default:
+			col, err := p.columnSpec()
+			if err != nil {
+				return nil, err
+			}
+			stmt.cols = append(stmt.cols, col)
+		}
+		if !p.symbol(",") {
+			break
+		}
+	}
+	return stmt, p.expectSymbol(")")
+}
+
+func (p *parser) columnSpec() (columnSpec, error) {
+	name, err := p.ident("column name")
+	if err != nil {
+		return columnSpec{}, err
+	}
+	tok := p.next()
+	typ, ok := sqlTypes[strings.ToUpper(tok.text)]
+	if tok.kind != tokenIdent || tok.quoted || !ok {
+		return columnSpec{}, p.errorf(tok, "expected type of column %s", name)
+	}
+	// the length of VARCHAR(n) is accepted but not enforced
+	if p.symbol("(") {
+		if tok := p.next(); tok.kind != tokenInt {
+			return columnSpec{}, p.errorf(tok, "expected length of column %s", name)
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return columnSpec{}, err
+		}
+	}
+
+	col := columnSpec{name: name, typ: typ}
+	for {
+		switch {
+		case p.keywords("NOT", "NULL"):
+			col.notNull = true
+		case p.keyword("NULL"):
+		case p.keyword("DEFAULT"):
+			if col.def, err = p.unary(); err != nil {
+				return columnSpec{}, err
+			}
+		case p.keyword("CHECK"):
+			if err := p.expectSymbol("("); err != nil {
+				return columnSpec{}, err
+			}
+			if col.check, err = p.expr(); err != nil {
+				return columnSpec{}, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return columnSpec{}, err
+			}
+		case p.keywords("PRIMARY", "KEY"):
+			col.primaryKey = true
+		case p.keyword("UNIQUE"):
+			col.unique = true
+		default:
+			return col, nil
+		}
+	}
+}
+
+func (p *parser) insert() (statement, error) {
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	tbl, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &insertStmt{table: tbl}
+	if p.peek().kind == tokenSymbol && p.peek().text == "(" {
+		if stmt.cols, err = p.identList("column name"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		row, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		stmt.rows = append(stmt.rows, row)
+		if !p.symbol(",") {
+			return stmt, nil
+		}
+	}
+}
+
+func (p *parser) selectStmt() (statement, error) {
+	stmt := &selectStmt{}
+	if !p.symbol("*") {
+		for {
+			expr, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			item := selectItem{expr: expr}
+			if p.keyword("AS") {
+				if item.alias, err = p.ident("column alias"); err != nil {
+					return nil, err
+				}
+			} else if tok := p.peek(); tok.kind == tokenIdent && (tok.quoted || !reserved[strings.ToUpper(tok.text)]) {
+				item.alias = p.next().text
+			}
+			stmt.items = append(stmt.items, item)
+			if !p.symbol(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	stmt.where, err = p.where()
+	return stmt, err
+}
+
+func (p *parser) delete() (statement, error) {
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	tbl, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	where, err := p.where()
+	return &deleteStmt{table: tbl, where: where}, err
+}
+
+func (p *parser) update() (statement, error) {
+	tbl, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	stmt := &updateStmt{table: tbl}
+	for {
+		col, err := p.ident("column name")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.set = append(stmt.set, assignment{col: col, expr: expr})
+		if !p.symbol(",") {
+			break
+		}
+	}
+	stmt.where, err = p.where()
+	return stmt, err
+}
+
+// where parses an optional WHERE clause.
+func (p *parser) where() (sqlExpr, error) {
+	if !p.keyword("WHERE") {
+		return nil, nil
+	}
+	return p.expr()
+}
+
+func (p *parser) exprList() ([]sqlExpr, error) {
+	var exprs []sqlExpr
+	for {
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if !p.symbol(",") {
+			return exprs, nil
+		}
+	}
+}
+
+// Expressions are parsed by precedence climbing, from loosest to tightest:
+// OR, AND, NOT, comparisons, + and -, * and /, unary minus.
+
+func (p *parser) expr() (sqlExpr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (sqlExpr, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) not() (sqlExpr, error) {
+	if p.keyword("NOT") {
+		expr, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{expr: expr}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (sqlExpr, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind == tokenSymbol {
+		switch tok.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.pos++
+			right, err := p.additive()
+			if err != nil {
+				return nil, err
+			}
+			op := tok.text
+			if op == "<>" {
+				op = "!="
+			}
+			return &binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+
+	if p.keyword("IS") {
+		not := p.keyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{expr: left, not: not}, nil
+	}
+
+	not := p.keywords("NOT", "BETWEEN") || p.keywords("NOT", "IN")
+	if not {
+		// step back onto BETWEEN or IN
+		p.pos--
+	}
+	switch {
+	case p.keyword("BETWEEN"):
+		lower, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		upper, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenExpr{expr: left, lower: lower, upper: upper, not: not}, nil
+	case p.keyword("IN"):
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var list []sqlExpr
+		if !p.symbol(")") {
+			if list, err = p.exprList(); err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+		}
+		return &inExpr{expr: left, list: list, not: not}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) additive() (sqlExpr, error) {
+	left, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokenSymbol || (op != "+" && op != "-") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) multiplicative() (sqlExpr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokenSymbol || (op != "*" && op != "/") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) unary() (sqlExpr, error) {
+	if !p.symbol("-") {
+		return p.primary()
+	}
+	tok := p.peek()
+	if tok.kind == tokenInt || tok.kind == tokenFloat {
+		// fold the sign into the literal, so the smallest int64 parses
+		p.pos++
+		return p.number(token{kind: tok.kind, text: "-" + tok.text, pos: tok.pos})
+	}
+	expr, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryExpr{op: "-", left: &literal{val: Int64Value(0)}, right: expr}, nil
+}
+
+func (p *parser) primary() (sqlExpr, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokenInt, tokenFloat:
+		p.pos++
+		return p.number(tok)
+	case tokenString:
+		p.pos++
+		return &literal{val: StringValue(tok.text)}, nil
+	case tokenSymbol:
+		if p.symbol("(") {
+			expr, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return expr, p.expectSymbol(")")
+		}
+		if tok.text == "?" {
+			return nil, fmt.Errorf("syntax error at position %d: placeholder ? has no value, bind one with BindSQL", tok.pos)
+		}
+	case tokenIdent:
+		switch {
+		case p.keyword("NULL"):
+			return &literal{val: NullValue()}, nil
+		case p.keyword("TRUE"):
+			return &literal{val: BoolValue(true)}, nil
+		case p.keyword("FALSE"):
+			return &literal{val: BoolValue(false)}, nil
+		}
+		name, err := p.ident("column name")
+		if err != nil {
+			return nil, err
+		}
+		return &colRef{name: name}, nil
+	}
+	return nil, p.errorf(tok, "expected an expression")
+}
+
+func (p *parser) number(tok token) (sqlExpr, error) {
+	if tok.kind == tokenInt {
+		i, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("syntax error at position %d: integer %s out of range", tok.pos, tok.text)
+		}
+		return &literal{val: Int64Value(i)}, nil
+	}
+	f, err := strconv.ParseFloat(tok.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("syntax error at position %d: float %s out of range", tok.pos, tok.text)
+	}
+	return &literal{val: Float64Value(f)}, nil
+}
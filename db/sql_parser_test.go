@@ -0,0 +1,94 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSQL(t *testing.T) {
+	// each statement parses and renders back to the expected SQL
+	tests := []struct {
+		sql    string
+		expect string
+	}{
+		{"use shop;", "USE shop"},
+		{"create database shop", "CREATE DATABASE shop"},
+		{"DROP DATABASE shop", "DROP DATABASE shop"},
+		{
+			"CREATE TABLE shop.items (id INT PRIMARY KEY, name VARCHAR(20) NOT NULL UNIQUE, price DOUBLE DEFAULT -1 CHECK (price >= 0), UNIQUE (name, price))",
+			"CREATE TABLE shop.items (id int64 PRIMARY KEY, name string NOT NULL UNIQUE, price float64 DEFAULT -1 CHECK ((price >= 0)), UNIQUE (name, price))",
+		},
+		{
+			"CREATE TABLE t (a BIGINT NULL, b BOOLEAN, c TIMESTAMP, PRIMARY KEY (a, b))",
+			"CREATE TABLE t (a int64, b bool, c timestamp, PRIMARY KEY (a, b))",
+		},
+		{"DROP TABLE t", "DROP TABLE t"},
+		{
+			"INSERT INTO t (a, b) VALUES (1, 'x'), (-2, NULL)",
+			"INSERT INTO t (a, b) VALUES (1, 'x'), (-2, NULL)",
+		},
+		{"INSERT INTO t VALUES (TRUE, 1.5)", "INSERT INTO t VALUES (TRUE, 1.5)"},
+		{"SELECT * FROM shop.t", "SELECT * FROM shop.t"},
+		{
+			"SELECT a, b + 1 AS c, a * -b d FROM t WHERE a = 1 AND b < 2 OR NOT c >= 3",
+			"SELECT a, (b + 1) AS c, (a * (0 - b)) AS d FROM t WHERE (((a = 1) AND (b < 2)) OR (NOT (c >= 3)))",
+		},
+		{
+			"SELECT a FROM t WHERE a + 1 * 2 - 3 / 4 <> 5",
+			"SELECT a FROM t WHERE (((a + (1 * 2)) - (3 / 4)) != 5)",
+		},
+		{
+			"SELECT a FROM t WHERE a BETWEEN 1 AND 2 AND b NOT BETWEEN 3 AND 4",
+			"SELECT a FROM t WHERE ((a BETWEEN 1 AND 2) AND (b NOT BETWEEN 3 AND 4))",
+		},
+		{
+			"SELECT a FROM t WHERE a IN (1, 2) OR b NOT IN ('x') OR c IN ()",
+			"SELECT a FROM t WHERE (((a IN (1, 2)) OR (b NOT IN ('x'))) OR (c IN ()))",
+		},
+		{
+			"SELECT a FROM t WHERE a IS NULL AND NOT (b IS NOT NULL)",
+			"SELECT a FROM t WHERE ((a IS NULL) AND (NOT (b IS NOT NULL)))",
+		},
+		{`SELECT "select" FROM "from"`, "SELECT select FROM from"},
+		{"SELECT a FROM t WHERE a = -9223372036854775808", "SELECT a FROM t WHERE (a = -9223372036854775808)"},
+		{"DELETE FROM t WHERE a = 1", "DELETE FROM t WHERE (a = 1)"},
+		{"DELETE FROM t", "DELETE FROM t"},
+		{"UPDATE t SET a = a + 1, b = 'y' WHERE c", "UPDATE t SET a = (a + 1), b = 'y' WHERE c"},
+		{"EXPLAIN SELECT * FROM t", "EXPLAIN SELECT * FROM t"},
+	}
+	for _, tt := range tests {
+		stmt, err := parseSQL(tt.sql)
+		if assert.NoError(t, err, tt.sql) {
+			assert.Equal(t, tt.expect, stmt.String(), tt.sql)
+		}
+	}
+}
+
+func TestParseSQLErrors(t *testing.T) {
+	tests := []struct {
+		sql string
+		err string
+	}{
+		{"", "syntax error at position 0: expected a statement, found end of statement"},
+		{"SELEC * FROM t", "syntax error at position 0: expected a statement, found SELEC"},
+		{"SELECT * FROM t WHERE", "syntax error at position 21: expected an expression, found end of statement"},
+		{"SELECT * FROM t t2", "syntax error at position 16: expected end of statement, found t2"},
+		{"SELECT * FROM select", "syntax error at position 14: expected table name, found select"},
+		{"SELECT a FROM t; SELECT b FROM t", "syntax error at position 17: expected end of statement, found SELECT"},
+		{"CREATE INDEX i", "syntax error at position 7: expected DATABASE or TABLE, found INDEX"},
+		{"CREATE TABLE t (a BLOB)", "syntax error at position 18: expected type of column a, found BLOB"},
+		{"CREATE TABLE t (a INT, PRIMARY KEY (a), PRIMARY KEY (a))", "syntax error at position 40: PRIMARY KEY declared more than once, found PRIMARY"},
+		{"INSERT INTO t VALUES (1", "syntax error at position 23: expected ), found end of statement"},
+		{"INSERT t VALUES (1)", "syntax error at position 7: expected INTO, found t"},
+		{"UPDATE t SET a 1", "syntax error at position 15: expected =, found 1"},
+		{"SELECT a FROM t WHERE a IS 1", "syntax error at position 27: expected NULL, found 1"},
+		{"SELECT a FROM t WHERE a BETWEEN 1 OR 2", "syntax error at position 34: expected AND, found OR"},
+		{"SELECT 99999999999999999999 FROM t", "syntax error at position 7: integer 99999999999999999999 out of range"},
+		{"EXPLAIN DROP TABLE t", "syntax error at position 8: expected SELECT, UPDATE or DELETE after EXPLAIN, found DROP"},
+	}
+	for _, tt := range tests {
+		_, err := parseSQL(tt.sql)
+		assert.EqualError(t, err, tt.err, tt.sql)
+	}
+}
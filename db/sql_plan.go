@@ -0,0 +1,476 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// plan is a statement resolved against the catalog and ready to run.
+// String describes it for EXPLAIN, one operator per line.
+type plan interface {
+	execute(ctx context.Context) (*Result, error)
+	String() string
+}
+
+// compileFilter turns a WHERE clause into a filter on tbl. Every comparison
+// must be between a column and a constant. NOT is pushed down to the
+// comparisons, so that like in SQL a row whose column is null matches
+// neither a comparison nor its negation.
+func compileFilter(tbl *table, expr sqlExpr, negate bool) (Filter, error) {
+	if expr == nil {
+		return &constFilter{match: true}, nil
+	}
+
+	switch e := expr.(type) {
+	case *notExpr:
+		return compileFilter(tbl, e.expr, !negate)
+	case *literal:
+		if e.val.null {
+			return &constFilter{match: false}, nil
+		}
+		if e.val.typ != TypeBool {
+			return nil, fmt.Errorf("WHERE %s is not a boolean", e)
+		}
+		return &constFilter{match: e.val.Bool() != negate}, nil
+	case *colRef:
+		col, err := tbl.GetColumn(e.name)
+		if err != nil {
+			return nil, err
+		}
+		if col.typ != TypeBool {
+			return nil, fmt.Errorf("WHERE %s is not a boolean: column %s has type %s", e, e.name, col.typ)
+		}
+		return Match(col.name, Eq(BoolValue(!negate))), nil
+	case *isNullExpr:
+		col, err := filterColumn(tbl, e, e.expr)
+		if err != nil {
+			return nil, err
+		}
+		return &nullFilter{col: col.name, not: e.not != negate}, nil
+	case *betweenExpr:
+		col, err := filterColumn(tbl, e, e.expr)
+		if err != nil {
+			return nil, err
+		}
+		bounds, err := constValues(col, []sqlExpr{e.lower, e.upper})
+		if err != nil {
+			return nil, err
+		}
+		if bounds[0].null || bounds[1].null {
+			return nil, fmt.Errorf("unsupported %s: BETWEEN bounds must not be null", e)
+		}
+		f := Match(col.name, Between(bounds[0], bounds[1]))
+		if e.not != negate {
+			return Not(f), nil
+		}
+		return f, nil
+	case *inExpr:
+		col, err := filterColumn(tbl, e, e.expr)
+		if err != nil {
+			return nil, err
+		}
+		vals, err := constValues(col, e.list)
+		if err != nil {
+			return nil, err
+		}
+		f := Match(col.name, In(vals...))
+		if e.not != negate {
+			return Not(f), nil
+		}
+		return f, nil
+	case *binaryExpr:
+		switch e.op {
+		case "AND", "OR":
+			left, err := compileFilter(tbl, e.left, negate)
+			if err != nil {
+				return nil, err
+			}
+			right, err := compileFilter(tbl, e.right, negate)
+			if err != nil {
+				return nil, err
+			}
+			// De Morgan: NOT (a AND b) is NOT a OR NOT b
+			if (e.op == "AND") != negate {
+				return &andFilter{left: left, right: right}, nil
+			}
+			return &orFilter{left: left, right: right}, nil
+		case "=", "!=", "<", "<=", ">", ">=":
+			return compileComparison(tbl, e, negate)
+		}
+	}
+	return nil, fmt.Errorf("WHERE %s is not a boolean", expr)
+}
+
+// flippedOps swaps the sides of a comparison and negatedOps negates it.
+var (
+	flippedOps = map[string]string{"=": "=", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+	negatedOps = map[string]string{"=": "!=", "!=": "=", "<": ">=", "<=": ">", ">": "<=", ">=": "<"}
+)
+
+func compileComparison(tbl *table, e *binaryExpr, negate bool) (Filter, error) {
+	ref, other, op := e.left, e.right, e.op
+	if _, ok := ref.(*colRef); !ok {
+		ref, other, op = e.right, e.left, flippedOps[e.op]
+	}
+	if len(exprColumns(other)) > 0 {
+		return nil, fmt.Errorf("unsupported comparison %s: WHERE can only compare a column with constants", e)
+	}
+	col, err := filterColumn(tbl, e, ref)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := constValues(col, []sqlExpr{other})
+	if err != nil {
+		return nil, err
+	}
+	if vals[0].null {
+		return &constFilter{match: false}, nil
+	}
+	if negate {
+		op = negatedOps[op]
+	}
+
+	preds := map[string]func(Value) Predicate{"=": Eq, "!=": Ne, "<": Lt, "<=": Le, ">": Gt, ">=": Ge}
+	return Match(col.name, preds[op](vals[0])), nil
+}
+
+// filterColumn resolves the column a comparison applies to.
+func filterColumn(tbl *table, cmp sqlExpr, expr sqlExpr) (*column, error) {
+	ref, ok := expr.(*colRef)
+	if !ok {
+		return nil, fmt.Errorf("unsupported comparison %s: WHERE can only compare a column with constants", cmp)
+	}
+	return tbl.GetColumn(ref.name)
+}
+
+// constValues evaluates constant expressions and converts them to the type
+// of col.
+func constValues(col *column, exprs []sqlExpr) ([]Value, error) {
+	vals := make([]Value, len(exprs))
+	for i, expr := range exprs {
+		var err error
+		if vals[i], err = columnConst(col, expr); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+// columnConst evaluates a constant expression and converts it to the type
+// of col.
+func columnConst(col *column, expr sqlExpr) (Value, error) {
+	val, err := constValue(expr)
+	if err != nil {
+		return Value{}, err
+	}
+	return coerceValue(col.name, col.typ, val)
+}
+
+// constValue evaluates an expression that reads no columns.
+func constValue(expr sqlExpr) (Value, error) {
+	compiled, _, err := compileExpr(nil, expr)
+	if err != nil {
+		return Value{}, err
+	}
+	return compiled.eval(func(colName string) (Value, error) {
+		return Value{}, fmt.Errorf("column %s is not allowed in a constant", colName)
+	})
+}
+
+// timestampLayouts are the string forms accepted for timestamp values.
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"}
+
+// coerceValue converts a constant to the type of a column: integers widen
+// to float64 and strings parse as timestamps. Other types must match.
+func coerceValue(colName string, typ ColumnType, val Value) (Value, error) {
+	switch {
+	case val.null || val.typ == typ:
+		return val, nil
+	case val.typ == TypeInt64 && typ == TypeFloat64:
+		return Float64Value(float64(val.i)), nil
+	case val.typ == TypeString && typ == TypeTimestamp:
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, val.s); err == nil {
+				return TimestampValue(t), nil
+			}
+		}
+		return Value{}, fmt.Errorf("column %s: cannot parse %q as a timestamp", colName, val.s)
+	}
+	return Value{}, typeMismatchError(colName, typ, val.typ)
+}
+
+var arithOps = map[string]func(Expr, Expr) Expr{"+": Add, "-": Sub, "*": Mul, "/": Div}
+
+// compileExpr turns an arithmetic SQL expression into an Expr, resolving
+// columns against tbl, and infers its type. An integer literal used with a
+// float64 operand is widened. tbl is nil for constant expressions.
+func compileExpr(tbl *table, expr sqlExpr) (Expr, ColumnType, error) {
+	switch e := expr.(type) {
+	case *literal:
+		return Lit(e.val), e.val.typ, nil
+	case *colRef:
+		if tbl == nil {
+			return nil, 0, fmt.Errorf("column %s is not allowed in a constant", e.name)
+		}
+		col, err := tbl.GetColumn(e.name)
+		if err != nil {
+			return nil, 0, err
+		}
+		return Col(e.name), col.typ, nil
+	case *binaryExpr:
+		newExpr, ok := arithOps[e.op]
+		if !ok {
+			break
+		}
+		left, leftType, err := compileExpr(tbl, e.left)
+		if err != nil {
+			return nil, 0, err
+		}
+		right, rightType, err := compileExpr(tbl, e.right)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// a null operand makes the result null whatever the other type
+		if isNullLiteral(e.left) {
+			return Lit(NullValue()), rightType, nil
+		}
+		if isNullLiteral(e.right) {
+			return Lit(NullValue()), leftType, nil
+		}
+		if leftType == TypeInt64 && rightType == TypeFloat64 {
+			left, leftType = widenLiteral(e.left, left)
+		} else if leftType == TypeFloat64 && rightType == TypeInt64 {
+			right, rightType = widenLiteral(e.right, right)
+		}
+		if leftType != rightType || (leftType != TypeInt64 && leftType != TypeFloat64) {
+			return nil, 0, fmt.Errorf("cannot evaluate %s: %s %s %s", e, leftType, e.op, rightType)
+		}
+		return newExpr(left, right), leftType, nil
+	}
+	return nil, 0, fmt.Errorf("%s is only supported in WHERE", expr)
+}
+
+func isNullLiteral(expr sqlExpr) bool {
+	lit, ok := expr.(*literal)
+	return ok && lit.val.null
+}
+
+// widenLiteral converts an int64 literal to float64, leaving other
+// expressions as they are.
+func widenLiteral(expr sqlExpr, compiled Expr) (Expr, ColumnType) {
+	if lit, ok := expr.(*literal); ok {
+		return Lit(Float64Value(float64(lit.val.i))), TypeFloat64
+	}
+	return compiled, TypeInt64
+}
+
+// scanString describes the filtered scan of a table under a plan operator.
+func scanString(name tableName, where Filter, hasWhere bool) string {
+	if !hasWhere {
+		return "\n  Scan: " + name.String()
+	}
+	return fmt.Sprintf("\n  Filter: %s\n    Scan: %s", where, name)
+}
+
+type selectPlan struct {
+	name     tableName
+	tbl      *table
+	filter   Filter
+	hasWhere bool
+	// cols names the result columns and types and exprs compute them from
+	// the columns in reads.
+	cols  []string
+	types []ColumnType
+	exprs []Expr
+	reads []*column
+}
+
+func planSelect(name tableName, tbl *table, stmt *selectStmt) (*selectPlan, error) {
+	f, err := compileFilter(tbl, stmt.where, false)
+	if err != nil {
+		return nil, err
+	}
+	pl := &selectPlan{name: name, tbl: tbl, filter: f, hasWhere: stmt.where != nil}
+
+	items := stmt.items
+	if items == nil {
+		for _, colName := range tbl.ColumnNames() {
+			items = append(items, selectItem{expr: &colRef{name: colName}})
+		}
+	}
+
+	reads := make(map[string]bool)
+	for _, item := range items {
+		expr, typ, err := compileExpr(tbl, item.expr)
+		if err != nil {
+			return nil, err
+		}
+		name := item.alias
+		if name == "" {
+			name = item.expr.String()
+		}
+		pl.cols = append(pl.cols, name)
+		pl.types = append(pl.types, typ)
+		pl.exprs = append(pl.exprs, expr)
+
+		for _, colName := range exprColumns(item.expr) {
+			if !reads[colName] {
+				reads[colName] = true
+				col, err := tbl.GetColumn(colName)
+				if err != nil {
+					return nil, err
+				}
+				pl.reads = append(pl.reads, col)
+			}
+		}
+	}
+	return pl, nil
+}
+
+// exprColumns returns the names of the columns an expression reads.
+func exprColumns(expr sqlExpr) []string {
+	switch e := expr.(type) {
+	case *colRef:
+		return []string{e.name}
+	case *binaryExpr:
+		return append(exprColumns(e.left), exprColumns(e.right)...)
+	}
+	return nil
+}
+
+func (pl *selectPlan) execute(ctx context.Context) (*Result, error) {
+	c, err := pl.filter.apply(pl.tbl)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := pl.tbl.GetValues(c, pl.reads)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make(map[string]int, len(pl.reads))
+	for i, col := range pl.reads {
+		positions[col.name] = i
+	}
+
+	res := &Result{Columns: pl.cols, Types: pl.types}
+	numRows := c.NumResults()
+	res.Rows = make([][]Value, numRows)
+	for r := range res.Rows {
+		if r%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		valueOf := func(colName string) (Value, error) {
+			return cols[positions[colName]][r], nil
+		}
+		row := make([]Value, len(pl.exprs))
+		for i, expr := range pl.exprs {
+			if row[i], err = expr.eval(valueOf); err != nil {
+				return nil, err
+			}
+		}
+		res.Rows[r] = row
+	}
+	return res, nil
+}
+
+func (pl *selectPlan) String() string {
+	items := make([]string, len(pl.cols))
+	for i, expr := range pl.exprs {
+		items[i] = expr.String()
+		if items[i] != pl.cols[i] {
+			items[i] += " AS " + pl.cols[i]
+		}
+	}
+	return "Project: " + strings.Join(items, ", ") + scanString(pl.name, pl.filter, pl.hasWhere)
+}
+
+type deletePlan struct {
+	name     tableName
+	tbl      *table
+	filter   Filter
+	hasWhere bool
+}
+
+func (pl *deletePlan) execute(ctx context.Context) (*Result, error) {
+	c, err := pl.filter.apply(pl.tbl)
+	if err != nil {
+		return nil, err
+	}
+	numDeleted, err := pl.tbl.DeleteMatching(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{RowsAffected: numDeleted}, nil
+}
+
+func (pl *deletePlan) String() string {
+	return "Delete: " + pl.name.String() + scanString(pl.name, pl.filter, pl.hasWhere)
+}
+
+type updatePlan struct {
+	name     tableName
+	tbl      *table
+	filter   Filter
+	hasWhere bool
+	cols     []string
+	exprs    []Expr
+}
+
+func planUpdate(name tableName, tbl *table, stmt *updateStmt) (*updatePlan, error) {
+	f, err := compileFilter(tbl, stmt.where, false)
+	if err != nil {
+		return nil, err
+	}
+	pl := &updatePlan{name: name, tbl: tbl, filter: f, hasWhere: stmt.where != nil}
+
+	for _, a := range stmt.set {
+		col, err := tbl.GetColumn(a.col)
+		if err != nil {
+			return nil, err
+		}
+		expr, typ, err := compileExpr(tbl, a.expr)
+		if err != nil {
+			return nil, err
+		}
+		if typ != col.typ {
+			// constants convert like in INSERT
+			val, err := constValue(a.expr)
+			if err != nil {
+				return nil, typeMismatchError(col.name, col.typ, typ)
+			}
+			if val, err = coerceValue(col.name, col.typ, val); err != nil {
+				return nil, err
+			}
+			expr = Lit(val)
+		}
+		pl.cols = append(pl.cols, a.col)
+		pl.exprs = append(pl.exprs, expr)
+	}
+	return pl, nil
+}
+
+func (pl *updatePlan) execute(ctx context.Context) (*Result, error) {
+	c, err := pl.filter.apply(pl.tbl)
+	if err != nil {
+		return nil, err
+	}
+	numRows, err := pl.tbl.UpdateExprs(c, pl.cols, pl.exprs)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{RowsAffected: numRows}, nil
+}
+
+func (pl *updatePlan) String() string {
+	set := make([]string, len(pl.cols))
+	for i, colName := range pl.cols {
+		set[i] = fmt.Sprintf("%s = %s", colName, pl.exprs[i])
+	}
+	return "Update: " + pl.name.String() + " SET " + strings.Join(set, ", ") + scanString(pl.name, pl.filter, pl.hasWhere)
+}
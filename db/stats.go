@@ -0,0 +1,60 @@
+package db
+
+// TableStats summarizes the rows and columns of a table.
+type TableStats struct {
+	// LiveRows counts the rows that are not deleted and DeletedRows those
+	// that are deleted but not yet vacuumed.
+	LiveRows    int64
+	DeletedRows int64
+	// ClusterKey names the column the table is clustered on, if any, and
+	// UnsortedRows counts the rows inserted out of order since the last
+	// vacuum.
+	ClusterKey   string
+	UnsortedRows int64
+	Columns      []ColumnStats
+}
+
+// ColumnStats summarizes a column of a table. Until a vacuum, the counts
+// include the items of deleted rows.
+type ColumnStats struct {
+	Name      string
+	Type      ColumnType
+	NullCount int64
+	// Distinct counts the values in the dictionary of a string column. It
+	// is 0 for other types.
+	Distinct int64
+	// Indexed reports whether the column has an ordered index.
+	Indexed bool
+	// Blocks counts the blocks of the zone map of the column and
+	// PrunedBlocks the blocks that selects have skipped since the table was
+	// opened.
+	Blocks       int64
+	PrunedBlocks int64
+}
+
+// Stats returns the statistics of the table, with its columns in the order
+// of ColumnNames.
+func (tbl *table) Stats() TableStats {
+	names := tbl.ColumnNames()
+
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+
+	deleted := int64(tbl.deletes.cardinality())
+	stats := TableStats{LiveRows: tbl.numRows - deleted, DeletedRows: deleted, ClusterKey: tbl.clusterKey, UnsortedRows: tbl.unsortedRows()}
+	for _, name := range names {
+		col, ok := tbl.cols[name]
+		if !ok {
+			continue
+		}
+		_, indexed := tbl.btrees[name]
+		colStats := ColumnStats{Name: name, Type: col.typ, NullCount: col.NullCount(), Indexed: indexed}
+		col.lock.Lock()
+		colStats.Distinct = int64(len(col.dict))
+		colStats.Blocks = (col.numItems + zoneSize - 1) / zoneSize
+		colStats.PrunedBlocks = col.prunedBlocks
+		col.lock.Unlock()
+		stats.Columns = append(stats.Columns, colStats)
+	}
+	return stats
+}
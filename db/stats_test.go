@@ -0,0 +1,32 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableStats(t *testing.T) {
+	tbl := NewTable()
+	err := tbl.LoadValues([]string{"name", "num"},
+		[]Value{StringValue("a"), StringValue("b"), NullValue(), StringValue("a")},
+		[]Value{Int64Value(1), NullValue(), NullValue(), Int64Value(4)})
+	assert.NoError(t, err)
+	assert.NoError(t, tbl.DeleteRows([]int64{1}))
+
+	assert.Equal(t, TableStats{
+		LiveRows:    3,
+		DeletedRows: 1,
+		Columns: []ColumnStats{
+			{Name: "name", Type: TypeString, NullCount: 1, Distinct: 2, Blocks: 1},
+			{Name: "num", Type: TypeInt64, NullCount: 2, Blocks: 1},
+		},
+	}, tbl.Stats())
+
+	_, err = tbl.Vacuum()
+	assert.NoError(t, err)
+	stats := tbl.Stats()
+	assert.Equal(t, int64(3), stats.LiveRows)
+	assert.Equal(t, int64(0), stats.DeletedRows)
+	assert.Equal(t, int64(1), stats.Columns[1].NullCount)
+}
@@ -2,108 +2,1048 @@ package db
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"go.uber.org/multierr"
 )
 
 type table struct {
+	name    string
+	dbName  string
+	schema  *Schema
 	cols    map[string]*column
 	numCols int64
 	numRows int64
-	deletes map[int64]bool
+	deletes *rowBitmap
+	// indexes enforce the PRIMARY KEY, which comes first, and UNIQUE
+	// constraints of the schema.
+	indexes []*hashIndex
+	// btrees are the ordered indexes made by CreateIndex, by column name.
+	btrees map[string]*btree
+	// clusterKey names the column the rows are sorted by, if any.
+	clusterKey string
+	// generation counts the vacuums, which renumber the rows. It starts at
+	// 1 so that 0 marks conditions not made by Filter.
+	generation uint64
+	// dropped is set once the table is deleted from its db. Writes through
+	// a handle kept past that fail instead of logging records that replay
+	// could not apply.
+	dropped bool
+	wal     *wal
 	lock    sync.Mutex
 }
 
-func NewTable() *table {
-	return &table{
-		cols:    make(map[string]*column),
-		numCols: 0,
-		numRows: 0,
-		deletes: make(map[int64]bool),
+func NewTable(opts ...TableOption) *table {
+	var cfg tableConfig
+	for _, opt := range opts {
+		opt(&cfg)
 	}
+	return newTable("", "", nil, cfg)
+}
+
+func newTable(dbName string, name string, w *wal, cfg tableConfig) *table {
+	tbl := &table{
+		name:       name,
+		dbName:     dbName,
+		schema:     cfg.schema,
+		cols:       make(map[string]*column),
+		numCols:    0,
+		numRows:    0,
+		deletes:    newRowBitmap(),
+		btrees:     make(map[string]*btree),
+		wal:        w,
+		generation: 1,
+	}
+	if cfg.schema != nil {
+		for _, def := range cfg.schema.cols {
+			tbl.cols[def.name] = newColumnFromDef(def)
+			tbl.numCols += 1
+		}
+		if cfg.schema.primaryKey != nil {
+			tbl.indexes = append(tbl.indexes, newHashIndex(cfg.schema.primaryKey, true))
+		}
+		for _, cols := range cfg.schema.unique {
+			tbl.indexes = append(tbl.indexes, newHashIndex(cols, false))
+		}
+	}
+	return tbl
+}
+
+// Schema returns the schema the table was created with, or nil.
+func (tbl *table) Schema() *Schema {
+	return tbl.schema
+}
+
+// record builds a write-ahead log record for an operation on this table.
+func (tbl *table) record(op walOp, colNames []string, vals ...[]int64) *walRecord {
+	return &walRecord{op: op, dbName: tbl.dbName, tblName: tbl.name, colNames: colNames, vals: vals}
 }
 
 func (tbl *table) CreateColumn(colName string) (*column, error) {
-	tbl.lock.Lock()
-	defer tbl.lock.Unlock()
+	return tbl.CreateTypedColumn(colName, TypeInt64)
+}
+
+// CreateTypedColumn creates a column holding values of the given type.
+func (tbl *table) CreateTypedColumn(colName string, colType ColumnType) (*column, error) {
+	var col *column
+	err := tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		if err := tbl.checkNewColumn(colName, colType); err != nil {
+			return 0, err
+		}
+		rec := tbl.record(walCreateColumn, []string{colName})
+		rec.colType = colType
+		return tbl.logAndApply(rec, func() {
+			col = tbl.addColumn(colName, colType)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return col, nil
+}
+
+// checkNewColumn checks that a column named colName of type colType can be
+// added to the table.
+func (tbl *table) checkNewColumn(colName string, colType ColumnType) error {
 	if _, ok := tbl.cols[colName]; ok {
-		return nil, fmt.Errorf("Can't create column with name %s: Column already exists", colName)
+		return fmt.Errorf("Can't create column with name %s: Column %w", colName, ErrAlreadyExists)
+	}
+	if tbl.schema != nil {
+		return invalidArgumentErrorf("Can't create column with name %s: not declared in the table schema", colName)
+	}
+	if colType > TypeTimestamp {
+		return invalidArgumentErrorf("Can't create column with name %s: unknown type %s", colName, colType)
 	}
+	return nil
+}
 
-	col := NewColumn(colName)
+// addColumn adds a column checked by checkNewColumn.
+func (tbl *table) addColumn(colName string, colType ColumnType) *column {
+	// existing rows have no value for the new column
+	col := NewTypedColumn(colName, colType)
+	col.insertMissing(tbl.numRows)
 	tbl.cols[colName] = col
 	tbl.numCols += 1
+	return col
+}
+
+func (tbl *table) GetColumn(colName string) (*column, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+
+	col, ok := tbl.cols[colName]
+	if !ok {
+		return nil, fmt.Errorf("Cannot get column with name %s: %w", colName, ErrNotExist)
+	}
 	return col, nil
 }
 
-func (tbl *table) InsertRow(colNames []string, vals []int64) error {
+// ColumnType returns the type of the column named colName.
+func (tbl *table) ColumnType(colName string) (ColumnType, error) {
+	col, err := tbl.GetColumn(colName)
+	if err != nil {
+		return 0, err
+	}
+	return col.typ, nil
+}
+
+// ColumnNames returns the names of the columns in schema declaration order,
+// or sorted by name for tables without a schema.
+func (tbl *table) ColumnNames() []string {
 	tbl.lock.Lock()
 	defer tbl.lock.Unlock()
 
-	if len(colNames) != len(vals) {
-		return fmt.Errorf("InsertRow: validation failed number of column names does not match number of values: %d != %d", len(colNames), len(vals))
+	if tbl.schema != nil {
+		names := make([]string, 0, len(tbl.schema.cols))
+		for _, def := range tbl.schema.cols {
+			if _, ok := tbl.cols[def.name]; ok {
+				names = append(names, def.name)
+			}
+		}
+		return names
+	}
+	names := make([]string, 0, len(tbl.cols))
+	for name := range tbl.cols {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
+// rowColumns resolves the columns named in a row, rejecting unknown and
+// repeated names.
+func (tbl *table) rowColumns(op string, colNames []string) ([]*column, error) {
+	cols := make([]*column, len(colNames))
+	seen := make(map[string]bool, len(colNames))
 	for i, name := range colNames {
-		if _, ok := tbl.cols[name]; !ok {
-			return fmt.Errorf("InsertRow: column name does not exist in table: %s", name)
+		col, ok := tbl.cols[name]
+		if !ok {
+			return nil, invalidArgumentErrorf("%s: column name does not exist in table: %s", op, name)
 		}
+		if seen[name] {
+			return nil, invalidArgumentErrorf("%s: column name given more than once: %s", op, name)
+		}
+		seen[name] = true
+		cols[i] = col
+	}
+	return cols, nil
+}
 
-		tbl.cols[name].InsertItem(vals[i])
+// logAndApply appends rec to the write-ahead log and only then applies a
+// validated write, so a write the log rejects never reaches the table. The
+// caller must hold the table lock.
+func (tbl *table) logAndApply(rec *walRecord, apply func()) (int64, error) {
+	if tbl.dropped {
+		return 0, fmt.Errorf("Cannot write to table %s: %w", tbl.name, ErrNotExist)
 	}
-	tbl.numRows += 1
+	return tbl.wal.logAndApply(rec, apply)
+}
 
-	return nil
+func (tbl *table) InsertRow(colNames []string, vals []int64) error {
+	return tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		apply, err := tbl.insertRows("InsertRow", colNames, [][]int64{vals})
+		if err != nil {
+			return 0, err
+		}
+		return tbl.logAndApply(tbl.record(walInsertRow, colNames, vals), apply)
+	})
+}
+
+// InsertRows inserts every row or, if any of them is rejected, none of them.
+// Each row holds one value per column name.
+func (tbl *table) InsertRows(colNames []string, rows [][]int64) error {
+	return tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		apply, err := tbl.insertRows("InsertRows", colNames, rows)
+		if err != nil {
+			return 0, err
+		}
+		return tbl.logAndApply(tbl.record(walInsertRows, colNames, rows...), apply)
+	})
+}
+
+func (tbl *table) insertRows(op string, colNames []string, rows [][]int64) (func(), error) {
+	cols, err := tbl.rowColumns(op, colNames)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range cols {
+		if err := col.checkType(TypeInt64); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	valRows := make([][]Value, len(rows))
+	for i, vals := range rows {
+		if len(colNames) != len(vals) {
+			return nil, invalidArgumentErrorf("%s: validation failed number of column names does not match number of values: %d != %d", op, len(colNames), len(vals))
+		}
+		valRows[i] = make([]Value, len(vals))
+		for j, val := range vals {
+			valRows[i][j] = Int64Value(val)
+		}
+	}
+
+	return tbl.prepareRows(op, cols, valRows)
+}
+
+// InsertValues is like InsertRow for columns of any type. Each value must
+// match the type of its column.
+func (tbl *table) InsertValues(colNames []string, vals []Value) error {
+	return tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		apply, err := tbl.insertValues("InsertValues", colNames, [][]Value{vals})
+		if err != nil {
+			return 0, err
+		}
+		rec := tbl.record(walInsertValues, colNames)
+		rec.values = [][]Value{vals}
+		return tbl.logAndApply(rec, apply)
+	})
+}
+
+// InsertValueRows is like InsertRows for columns of any type.
+func (tbl *table) InsertValueRows(colNames []string, rows [][]Value) error {
+	return tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		apply, err := tbl.insertValues("InsertValueRows", colNames, rows)
+		if err != nil {
+			return 0, err
+		}
+		rec := tbl.record(walInsertValues, colNames)
+		rec.values = rows
+		return tbl.logAndApply(rec, apply)
+	})
+}
+
+func (tbl *table) insertValues(op string, colNames []string, rows [][]Value) (func(), error) {
+	for _, vals := range rows {
+		if len(colNames) != len(vals) {
+			return nil, invalidArgumentErrorf("%s: validation failed number of column names does not match number of values: %d != %d", op, len(colNames), len(vals))
+		}
+	}
+
+	cols, err := tbl.rowColumns(op, colNames)
+	if err != nil {
+		return nil, err
+	}
+
+	return tbl.prepareRows(op, cols, rows)
+}
+
+// prepareRows completes rows with the missing value of every column they do
+// not name and checks them against the column constraints and keys, both of
+// the table and of each other. It returns a function that appends the rows,
+// which cannot fail, so a batch with a rejected row never reaches any
+// column. The caller must hold the table lock.
+func (tbl *table) prepareRows(op string, cols []*column, rows [][]Value) (func(), error) {
+	named := make(map[*column]bool, len(cols))
+	for _, col := range cols {
+		named[col] = true
+	}
+	var missing []*column
+	for _, col := range tbl.cols {
+		if !named[col] {
+			missing = append(missing, col)
+		}
+	}
+	allCols := append(append([]*column(nil), cols...), missing...)
+
+	positions := make(map[string]int, len(allCols))
+	for i, col := range allCols {
+		positions[col.name] = i
+	}
+
+	complete := make([][]Value, len(rows))
+	keys := make([]map[string]int64, len(tbl.indexes))
+	for i := range keys {
+		keys[i] = make(map[string]int64)
+	}
+	for r, vals := range rows {
+		row := append(make([]Value, 0, len(allCols)), vals...)
+		for _, col := range missing {
+			row = append(row, col.def.missing())
+		}
+		for i, col := range allCols {
+			if err := col.checkValue(row[i]); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		valueOf := func(colName string) Value {
+			if pos, ok := positions[colName]; ok {
+				return row[pos]
+			}
+			return NullValue()
+		}
+		for i, idx := range tbl.indexes {
+			key, ok := idx.key(valueOf)
+			if !ok {
+				continue
+			}
+			if _, dup := idx.rows[key]; dup {
+				return nil, idx.duplicateError(op, valueOf)
+			}
+			if _, dup := keys[i][key]; dup {
+				return nil, idx.duplicateError(op, valueOf)
+			}
+			keys[i][key] = tbl.numRows + int64(r)
+		}
+		complete[r] = row
+	}
+
+	return func() {
+		for i, col := range allCols {
+			col.lock.Lock()
+			for _, row := range complete {
+				col.insertValue(row[i])
+			}
+			col.lock.Unlock()
+		}
+		for i, idx := range tbl.indexes {
+			for key, id := range keys[i] {
+				idx.rows[key] = id
+			}
+		}
+		if len(tbl.btrees) > 0 {
+			ids := make([]int64, len(complete))
+			for r := range ids {
+				ids[r] = tbl.numRows + int64(r)
+			}
+			for _, col := range allCols {
+				tbl.indexItems(col, ids)
+			}
+		}
+		tbl.numRows += int64(len(complete))
+	}, nil
 }
 
 func (tbl *table) LoadColumns(colNames []string, cols ...[]int64) error {
-	tbl.lock.Lock()
-	defer tbl.lock.Unlock()
+	return tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		apply, err := tbl.loadColumns(colNames, cols...)
+		if err != nil {
+			return 0, err
+		}
+		return tbl.logAndApply(tbl.record(walLoadColumns, colNames, cols...), apply)
+	})
+}
 
+func (tbl *table) loadColumns(colNames []string, cols ...[]int64) (func(), error) {
 	if len(colNames) != len(cols) {
-		return fmt.Errorf("LoadColumns: validation failed: number of column names does not match number of values: %d != %d", len(colNames), len(cols))
+		return nil, invalidArgumentErrorf("LoadColumns: validation failed: number of column names does not match number of values: %d != %d", len(colNames), len(cols))
+	}
+
+	lengths := make([]int, len(cols))
+	colTypes := make([]ColumnType, len(cols))
+	for i, col := range cols {
+		lengths[i] = len(col)
+		colTypes[i] = TypeInt64
 	}
 
+	err := tbl.validateLoad("LoadColumns", colNames, lengths, colTypes)
+	if err != nil {
+		return nil, err
+	}
 	if len(cols) == 0 {
+		return func() {}, nil
+	}
+	for i, name := range colNames {
+		if existing, ok := tbl.cols[name]; ok {
+			if err := existing.checkItems(cols[i]); err != nil {
+				return nil, fmt.Errorf("LoadColumns: %w", err)
+			}
+		}
+	}
+	indexRows, err := tbl.loadIndexes("LoadColumns", colNames, lengths[0], func(i int, id int64) Value {
+		return Int64Value(cols[i][id])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		for i, target := range tbl.loadTargets(colNames, colTypes, lengths[0]) {
+			target.lock.Lock()
+			target.loadWords(cols[i])
+			target.lock.Unlock()
+		}
+		for i, idx := range tbl.indexes {
+			idx.rows = indexRows[i]
+		}
+		tbl.numRows = int64(lengths[0])
+		tbl.rebuildBtrees()
+	}, nil
+}
+
+// LoadValues is like LoadColumns for columns of any type. Missing columns
+// are created with the type of their values.
+func (tbl *table) LoadValues(colNames []string, cols ...[]Value) error {
+	return tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		apply, err := tbl.loadValues(colNames, cols...)
+		if err != nil {
+			return 0, err
+		}
+		rec := tbl.record(walLoadValues, colNames)
+		rec.values = cols
+		return tbl.logAndApply(rec, apply)
+	})
+}
+
+func (tbl *table) loadValues(colNames []string, cols ...[]Value) (func(), error) {
+	if len(colNames) != len(cols) {
+		return nil, invalidArgumentErrorf("LoadValues: validation failed: number of column names does not match number of values: %d != %d", len(colNames), len(cols))
+	}
+
+	lengths := make([]int, len(cols))
+	colTypes := make([]ColumnType, len(cols))
+	for i, vals := range cols {
+		lengths[i] = len(vals)
+		if existing, ok := tbl.cols[colNames[i]]; ok {
+			colTypes[i] = existing.typ
+		} else if typ, ok := firstType(vals); ok {
+			colTypes[i] = typ
+		} else {
+			return nil, invalidArgumentErrorf("LoadValues: cannot infer type of new column %s without values", colNames[i])
+		}
+	}
+
+	err := tbl.validateLoad("LoadValues", colNames, lengths, colTypes)
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return func() {}, nil
+	}
+	for i, name := range colNames {
+		def := NewColumnDef(name, colTypes[i])
+		if existing, ok := tbl.cols[name]; ok {
+			def = existing.def
+		}
+		for _, val := range cols[i] {
+			if err := def.validate(val); err != nil {
+				return nil, fmt.Errorf("LoadValues: %w", err)
+			}
+		}
+	}
+	indexRows, err := tbl.loadIndexes("LoadValues", colNames, lengths[0], func(i int, id int64) Value {
+		return cols[i][id]
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		for i, target := range tbl.loadTargets(colNames, colTypes, lengths[0]) {
+			target.lock.Lock()
+			target.loadValues(cols[i])
+			target.lock.Unlock()
+		}
+		for i, idx := range tbl.indexes {
+			idx.rows = indexRows[i]
+		}
+		tbl.numRows = int64(lengths[0])
+		tbl.rebuildBtrees()
+	}, nil
+}
+
+// Update sets the int64 columns colNames to vals in every live row matched
+// by c, keeping row ids stable.
+func (tbl *table) Update(c *condition, colNames []string, vals []int64) error {
+	exprs := make([]Expr, len(vals))
+	for i, val := range vals {
+		exprs[i] = Lit(Int64Value(val))
+	}
+	_, err := tbl.update("Update", c, colNames, exprs)
+	return err
+}
+
+// UpdateValues is like Update for columns of any type.
+func (tbl *table) UpdateValues(c *condition, colNames []string, vals []Value) error {
+	exprs := make([]Expr, len(vals))
+	for i, val := range vals {
+		exprs[i] = Lit(val)
+	}
+	_, err := tbl.update("UpdateValues", c, colNames, exprs)
+	return err
+}
+
+// UpdateExprs sets each of colNames to the result of its expression in every
+// live row matched by c, e.g. Add(Col("col1"), Lit(Int64Value(1))).
+// Expressions see the values of a row from before the update. It returns
+// how many rows it updated.
+func (tbl *table) UpdateExprs(c *condition, colNames []string, exprs []Expr) (int64, error) {
+	return tbl.update("UpdateExprs", c, colNames, exprs)
+}
+
+func (tbl *table) update(op string, c *condition, colNames []string, exprs []Expr) (int64, error) {
+	if len(colNames) != len(exprs) {
+		return 0, invalidArgumentErrorf("%s: validation failed number of column names does not match number of values: %d != %d", op, len(colNames), len(exprs))
+	}
+
+	var numUpdated int64
+	err := tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		if err := tbl.checkGeneration(c); err != nil {
+			return 0, err
+		}
+		ids := tbl.liveIds(c)
+		cols := make([][]Value, len(colNames))
+		for i := range cols {
+			cols[i] = make([]Value, len(ids))
+		}
+		for r, id := range ids {
+			valueOf := func(colName string) (Value, error) {
+				if _, ok := tbl.cols[colName]; !ok {
+					return Value{}, fmt.Errorf("column name does not exist in table: %s", colName)
+				}
+				return tbl.rowValue(colName, id), nil
+			}
+			for i, expr := range exprs {
+				val, err := expr.eval(valueOf)
+				if err != nil {
+					return 0, fmt.Errorf("%s: %w", op, err)
+				}
+				cols[i][r] = val
+			}
+		}
+
+		apply, err := tbl.updateRows(op, ids, colNames, cols)
+		if err != nil || len(ids) == 0 {
+			return 0, err
+		}
+		rec := tbl.record(walUpdateRows, colNames, ids)
+		rec.values = cols
+		numUpdated = int64(len(ids))
+		return tbl.logAndApply(rec, apply)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return numUpdated, nil
+}
+
+// UpdateRows sets colNames in the live rows ids. cols holds the new values
+// of each column in the order of ids.
+func (tbl *table) UpdateRows(ids []int64, colNames []string, cols [][]Value) error {
+	return tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		apply, err := tbl.updateRows("UpdateRows", ids, colNames, cols)
+		if err != nil {
+			return 0, err
+		}
+		rec := tbl.record(walUpdateRows, colNames, ids)
+		rec.values = cols
+		return tbl.logAndApply(rec, apply)
+	})
+}
+
+// updateRows checks new values for rows against the column constraints and
+// keys and returns a function that writes them in place, which cannot fail.
+// The caller must hold the table lock.
+func (tbl *table) updateRows(op string, ids []int64, colNames []string, cols [][]Value) (func(), error) {
+	if len(colNames) != len(cols) {
+		return nil, invalidArgumentErrorf("%s: validation failed: number of column names does not match number of values: %d != %d", op, len(colNames), len(cols))
+	}
+	targets, err := tbl.rowColumns(op, colNames)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if id < 0 || id >= tbl.numRows || tbl.deletes.contains(id) {
+			return nil, fmt.Errorf("%s: row with id %d does not exist", op, id)
+		}
+		if updated[id] {
+			return nil, invalidArgumentErrorf("%s: row id given more than once: %d", op, id)
+		}
+		updated[id] = true
+	}
+	for i, col := range targets {
+		if len(cols[i]) != len(ids) {
+			return nil, invalidArgumentErrorf("%s: validation failed: column %s has %d values for %d rows", op, col.name, len(cols[i]), len(ids))
+		}
+		for _, val := range cols[i] {
+			if err := col.checkValue(val); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	// only the indexes over updated columns change; each updated row gives
+	// up its old key, so keys may move between updated rows
+	positions := make(map[string]int, len(colNames))
+	for i, name := range colNames {
+		positions[name] = i
+	}
+	var indexes []*hashIndex
+	var newKeys []map[string]int64
+	for _, idx := range tbl.indexes {
+		affected := false
+		for _, name := range idx.cols {
+			_, ok := positions[name]
+			affected = affected || ok
+		}
+		if !affected {
+			continue
+		}
+
+		keys := make(map[string]int64, len(ids))
+		for r, id := range ids {
+			valueOf := func(colName string) Value {
+				if pos, ok := positions[colName]; ok {
+					return cols[pos][r]
+				}
+				return tbl.rowValue(colName, id)
+			}
+			key, ok := idx.key(valueOf)
+			if !ok {
+				continue
+			}
+			if other, dup := idx.rows[key]; dup && !updated[other] {
+				return nil, idx.duplicateError(op, valueOf)
+			}
+			if _, dup := keys[key]; dup {
+				return nil, idx.duplicateError(op, valueOf)
+			}
+			keys[key] = id
+		}
+		indexes = append(indexes, idx)
+		newKeys = append(newKeys, keys)
+	}
+
+	return func() {
+		for _, idx := range indexes {
+			for _, id := range ids {
+				key, ok := idx.key(func(colName string) Value {
+					return tbl.rowValue(colName, id)
+				})
+				if ok && idx.rows[key] == id {
+					delete(idx.rows, key)
+				}
+			}
+		}
+		for i, col := range targets {
+			tbl.unindexItems(col, ids)
+			col.lock.Lock()
+			for r, id := range ids {
+				col.setValue(id, cols[i][r])
+			}
+			col.lock.Unlock()
+			tbl.indexItems(col, ids)
+		}
+		for i, idx := range indexes {
+			for key, id := range newKeys[i] {
+				idx.rows[key] = id
+			}
+		}
+	}, nil
+}
+
+// liveIds returns the ids matched by c that are live rows of the table, in
+// ascending order. The caller must hold the table lock.
+func (tbl *table) liveIds(c *condition) []int64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var ids []int64
+	c.ids.andNot(tbl.deletes).forEach(func(id int64) bool {
+		if id >= tbl.numRows {
+			return false
+		}
+		ids = append(ids, id)
+		return true
+	})
+	return ids
+}
+
+// matchingIds returns the ids of the live rows matched by c in ascending
+// order.
+func (tbl *table) matchingIds(c *condition) []int64 {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+	return tbl.liveIds(c)
+}
+
+// firstType returns the type of the first non-null value.
+func firstType(vals []Value) (ColumnType, bool) {
+	for _, val := range vals {
+		if !val.null {
+			return val.typ, true
+		}
+	}
+	return 0, false
+}
+
+// validateLoad checks that loading columns with the given lengths and value
+// types is consistent with the table, including the columns the load leaves
+// out. The caller must hold the table lock.
+func (tbl *table) validateLoad(op string, colNames []string, lengths []int, colTypes []ColumnType) error {
+	if len(lengths) == 0 {
 		return nil
 	}
 
-	length := len(cols[0])
+	length := lengths[0]
 
 	// validate incoming columns for length consistency
-	for _, col := range cols[1:] {
-		if len(col) != length {
-			return fmt.Errorf("LoadColumns: cannot insert: inconsistent column lengths")
+	for _, l := range lengths[1:] {
+		if l != length {
+			return invalidArgumentErrorf("%s: cannot insert: inconsistent column lengths", op)
 		}
 	}
 
 	if tbl.numRows != int64(0) && tbl.numRows != int64(length) {
-		return fmt.Errorf("LoadColumns: cannot insert: inconsistent column lengths with existing columns")
+		return invalidArgumentErrorf("%s: cannot insert: inconsistent column lengths with existing columns", op)
 	}
 
+	seen := make(map[string]bool, len(colNames))
 	for i, name := range colNames {
-		if _, ok := tbl.cols[name]; !ok {
-			_, err := tbl.CreateColumn(name)
-			if err != nil {
-				return fmt.Errorf("LoadColumns: %v", err)
+		if seen[name] {
+			return invalidArgumentErrorf("%s: column name given more than once: %s", op, name)
+		}
+		seen[name] = true
+
+		col, ok := tbl.cols[name]
+		if !ok && tbl.schema != nil {
+			return invalidArgumentErrorf("%s: column name does not exist in table: %s", op, name)
+		}
+		if ok {
+			if err := col.checkType(colTypes[i]); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
 			}
 		}
+	}
 
-		err := tbl.cols[name].LoadColumn(cols[i])
+	// loading into an empty table fills the other columns with their
+	// missing value
+	if tbl.numRows == 0 && length > 0 {
+		for name, col := range tbl.cols {
+			if seen[name] {
+				continue
+			}
+			if err := col.checkValue(col.def.missing()); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadIndexes builds the index entries the table would have after loading
+// length rows, rejecting duplicate keys. loaded returns the value of row id
+// of the i-th loaded column; the columns the load leaves out keep their
+// items, or their missing value when the table is empty. The caller must
+// hold the table lock.
+func (tbl *table) loadIndexes(op string, colNames []string, length int, loaded func(i int, id int64) Value) ([]map[string]int64, error) {
+	positions := make(map[string]int, len(colNames))
+	for i, name := range colNames {
+		positions[name] = i
+	}
+
+	indexRows := make([]map[string]int64, len(tbl.indexes))
+	for i, idx := range tbl.indexes {
+		rows, err := tbl.buildIndex(op, idx, int64(length), func(colName string, id int64) Value {
+			if pos, ok := positions[colName]; ok {
+				return loaded(pos, id)
+			}
+			if tbl.numRows == 0 {
+				if col, ok := tbl.cols[colName]; ok {
+					return col.def.missing()
+				}
+				return NullValue()
+			}
+			return tbl.rowValue(colName, id)
+		})
 		if err != nil {
-			return fmt.Errorf("LoadColumns: %v", err)
+			return nil, err
 		}
+		indexRows[i] = rows
 	}
-	tbl.numRows = int64(length)
+	return indexRows, nil
+}
 
+// buildIndex maps the key of each of the first numRows live rows to its id,
+// rejecting duplicate keys. The caller must hold the table lock.
+func (tbl *table) buildIndex(op string, idx *hashIndex, numRows int64, valueAt func(colName string, id int64) Value) (map[string]int64, error) {
+	rows := make(map[string]int64, numRows)
+	for id := int64(0); id < numRows; id++ {
+		if tbl.deletes.contains(id) {
+			continue
+		}
+		valueOf := func(colName string) Value {
+			return valueAt(colName, id)
+		}
+		key, ok := idx.key(valueOf)
+		if !ok {
+			continue
+		}
+		if _, dup := rows[key]; dup {
+			return nil, idx.duplicateError(op, valueOf)
+		}
+		rows[key] = id
+	}
+	return rows, nil
+}
+
+// reindex rebuilds every index from the rows of the table. The caller must
+// hold the table lock.
+func (tbl *table) reindex() error {
+	for _, idx := range tbl.indexes {
+		rows, err := tbl.buildIndex("reindex", idx, tbl.numRows, tbl.rowValue)
+		if err != nil {
+			return err
+		}
+		idx.rows = rows
+	}
+	tbl.rebuildBtrees()
 	return nil
 }
 
+// unindexRow removes a row from every index. The caller must hold the table
+// lock.
+func (tbl *table) unindexRow(id int64) {
+	for _, idx := range tbl.indexes {
+		key, ok := idx.key(func(colName string) Value {
+			return tbl.rowValue(colName, id)
+		})
+		if ok && idx.rows[key] == id {
+			delete(idx.rows, key)
+		}
+	}
+	for name := range tbl.btrees {
+		tbl.unindexItems(tbl.cols[name], []int64{id})
+	}
+}
+
+// rowValue returns the value of a column in row id, or null if the column
+// no longer exists. The caller must hold the table lock.
+func (tbl *table) rowValue(colName string, id int64) Value {
+	col, ok := tbl.cols[colName]
+	if !ok {
+		return NullValue()
+	}
+
+	col.lock.Lock()
+	defer col.lock.Unlock()
+	if id >= col.numItems {
+		return NullValue()
+	}
+	return col.value(id)
+}
+
+// loadTargets returns the columns a validated load writes to, creating
+// missing ones and filling the columns it leaves out of an empty table.
+func (tbl *table) loadTargets(colNames []string, colTypes []ColumnType, length int) []*column {
+	targets := make([]*column, len(colNames))
+	named := make(map[string]bool, len(colNames))
+	for i, name := range colNames {
+		named[name] = true
+		if _, ok := tbl.cols[name]; !ok {
+			// validateLoad already ruled out the errors checkNewColumn checks for
+			tbl.addColumn(name, colTypes[i])
+		}
+		targets[i] = tbl.cols[name]
+	}
+
+	if tbl.numRows == 0 {
+		for name, col := range tbl.cols {
+			if !named[name] {
+				col.lock.Lock()
+				col.insertMissing(int64(length))
+				col.lock.Unlock()
+			}
+		}
+	}
+	return targets
+}
+
+// Lookup returns the live row whose primary key is key, with one value per
+// schema column in declaration order. ok is false if no row has the key.
+func (tbl *table) Lookup(key []Value) (row []Value, ok bool, err error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+
+	if tbl.schema == nil || tbl.schema.primaryKey == nil {
+		return nil, false, fmt.Errorf("Lookup: table %s has no primary key", tbl.name)
+	}
+	idx := tbl.indexes[0]
+	if len(key) != len(idx.cols) {
+		return nil, false, fmt.Errorf("Lookup: key has %d values but %s has %d columns", len(key), idx, len(idx.cols))
+	}
+	for i, name := range idx.cols {
+		def, _ := tbl.schema.column(name)
+		if !key[i].null && key[i].typ != def.typ {
+			return nil, false, fmt.Errorf("Lookup: %w", typeMismatchError(name, def.typ, key[i].typ))
+		}
+	}
+
+	positions := make(map[string]int, len(idx.cols))
+	for i, name := range idx.cols {
+		positions[name] = i
+	}
+	k, ok := idx.key(func(colName string) Value {
+		return key[positions[colName]]
+	})
+	if !ok {
+		return nil, false, nil
+	}
+	id, ok := idx.rows[k]
+	if !ok {
+		return nil, false, nil
+	}
+
+	row = make([]Value, len(tbl.schema.cols))
+	for i, def := range tbl.schema.cols {
+		row[i] = tbl.rowValue(def.name, id)
+	}
+	return row, true, nil
+}
+
 func (tbl *table) Get(c *condition, cols []*column) ([][]int64, error) {
 	tbl.lock.Lock()
 	defer tbl.lock.Unlock()
 
+	if err := tbl.checkGeneration(c); err != nil {
+		return nil, err
+	}
+	existingCols, errors := tbl.existingColumns(c, cols)
+	res, err := c.Get(existingCols)
+	if err != nil {
+		return nil, multierr.Append(errors, err)
+	}
+	return res, errors
+}
+
+// GetValues is like Get for columns of any type.
+func (tbl *table) GetValues(c *condition, cols []*column) ([][]Value, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+
+	if err := tbl.checkGeneration(c); err != nil {
+		return nil, err
+	}
+	existingCols, errors := tbl.existingColumns(c, cols)
+	return c.GetValues(existingCols), errors
+}
+
+// GetColumns is like GetValues for the columns named colNames.
+func (tbl *table) GetColumns(c *condition, colNames []string) ([][]Value, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+
+	if err := tbl.checkGeneration(c); err != nil {
+		return nil, err
+	}
+	cols := make([]*column, len(colNames))
+	for i, colName := range colNames {
+		col, ok := tbl.cols[colName]
+		if !ok {
+			return nil, fmt.Errorf("Could not fetch column %s: column not found", colName)
+		}
+		cols[i] = col
+	}
+	existingCols, errors := tbl.existingColumns(c, cols)
+	return c.GetValues(existingCols), errors
+}
+
+// checkGeneration rejects a condition made by Filter before a vacuum
+// renumbered the rows it matched. The caller must hold the table lock.
+func (tbl *table) checkGeneration(c *condition) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.generation != 0 && c.generation != tbl.generation {
+		return fmt.Errorf("Cannot use condition: the table was vacuumed after it was filtered, filter it again")
+	}
+	return nil
+}
+
+// existingColumns drops deleted columns from cols and deleted rows from c.
+// The caller must hold the table lock.
+func (tbl *table) existingColumns(c *condition, cols []*column) ([]*column, error) {
 	var errors error
 	var existingCols []*column
 	for _, col := range cols {
@@ -115,68 +1055,257 @@ func (tbl *table) Get(c *condition, cols []*column) ([][]int64, error) {
 	}
 
 	c.lock.Lock()
-	for id := range c.ids {
-		if _, ok := tbl.deletes[id]; ok {
-			delete(c.ids, id)
-			c.numResults -= 1
-		}
-	}
+	c.ids = c.ids.andNot(tbl.deletes)
 	c.lock.Unlock()
 
-	return c.Get(existingCols), errors
+	return existingCols, errors
+}
+
+// lockColumns checks that every column belongs to the table and locks each
+// once, in name order, as a column may appear in several roles. The
+// returned func unlocks them. The caller must hold the table lock.
+func (tbl *table) lockColumns(op string, cols ...*column) (func(), error) {
+	byName := make(map[string]*column)
+	for _, col := range cols {
+		if tbl.cols[col.name] != col {
+			return nil, fmt.Errorf("%s column %s: column not found", op, col.name)
+		}
+		byName[col.name] = col
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		byName[name].lock.Lock()
+	}
+	return func() {
+		for _, name := range names {
+			byName[name].lock.Unlock()
+		}
+	}, nil
 }
 
 func (tbl *table) Select(col *column, lower int64, upper int64) (*condition, error) {
 	tbl.lock.Lock()
 	defer tbl.lock.Unlock()
 
+	if _, ok := tbl.cols[col.name]; !ok {
+		return nil, fmt.Errorf("Could not select from column %s: column not found", col.name)
+	}
+	if col.typ == TypeInt64 {
+		lowerKey, upperKey := btreeKey{word: lower}, btreeKey{word: upper}
+		if c, ok := tbl.indexSelect(col, []keyRange{{lower: &lowerKey, upper: &upperKey, upperExclusive: true}}); ok {
+			return c, nil
+		}
+	}
+
+	c := NewCondition()
+	if err := c.Select(col, lower, upper); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SelectWhere returns a condition matching the rows where col matches p.
+func (tbl *table) SelectWhere(col *column, p Predicate) (*condition, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+
+	if _, ok := tbl.cols[col.name]; !ok {
+		return nil, fmt.Errorf("Could not select from column %s: column not found", col.name)
+	}
+	if err := p.check(col); err != nil {
+		return nil, err
+	}
+	if ranges, ok := predicateRanges(p); ok {
+		if c, ok := tbl.indexSelect(col, ranges); ok {
+			return c, nil
+		}
+	}
+
+	c := NewCondition()
+	if err := c.SelectWhere(col, p); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Not returns a condition matching the live rows of the table that c does
+// not match. c itself is left unchanged.
+func (tbl *table) Not(c *condition) *condition {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	res := NewCondition()
+	res.ids = rangeBitmap(0, tbl.numRows).andNot(tbl.deletes).andNot(c.ids)
+	return res
+}
+
+// SelectNull returns a condition matching the rows where col is null.
+func (tbl *table) SelectNull(col *column) (*condition, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+
+	if _, ok := tbl.cols[col.name]; !ok {
+		return nil, fmt.Errorf("Could not select from column %s: column not found", col.name)
+	}
+
+	c := NewCondition()
+	c.SelectNull(col)
+	return c, nil
+}
+
+// SelectNotNull returns a condition matching the rows where col is not null.
+func (tbl *table) SelectNotNull(col *column) (*condition, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+
 	if _, ok := tbl.cols[col.name]; !ok {
 		return nil, fmt.Errorf("Could not select from column %s: column not found", col.name)
 	}
 
 	c := NewCondition()
-	c.Select(col, lower, upper)
+	c.SelectNotNull(col)
+	return c, nil
+}
+
+// SelectValues is like Select for columns of any type.
+func (tbl *table) SelectValues(col *column, lower Value, upper Value) (*condition, error) {
+	tbl.lock.Lock()
+	defer tbl.lock.Unlock()
+
+	if _, ok := tbl.cols[col.name]; !ok {
+		return nil, fmt.Errorf("Could not select from column %s: column not found", col.name)
+	}
+	if err := checkRange(col, lower, upper); err != nil {
+		return nil, err
+	}
+	lowerKey, upperKey := btreeKeyOf(lower), btreeKeyOf(upper)
+	if c, ok := tbl.indexSelect(col, []keyRange{{lower: &lowerKey, upper: &upperKey, upperExclusive: true}}); ok {
+		return c, nil
+	}
+
+	c := NewCondition()
+	if err := c.SelectValues(col, lower, upper); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
 func (tbl *table) DeleteColumnInternal(colName string) error {
 	if _, ok := tbl.cols[colName]; !ok {
-		return fmt.Errorf("Cannot delete column with name %s: does not exist", colName)
+		return fmt.Errorf("Cannot delete column with name %s: %w", colName, ErrNotExist)
 	}
+	tbl.dropColumn(colName)
+	return nil
+}
 
+// dropColumn removes the existing column colName. The caller must hold the
+// table lock.
+func (tbl *table) dropColumn(colName string) {
 	delete(tbl.cols, colName)
+	delete(tbl.btrees, colName)
+	if colName == tbl.clusterKey {
+		tbl.clusterKey = ""
+	}
 	tbl.numCols -= 1
-	return nil
 }
 
 func (tbl *table) DeleteColumn(colName string) error {
-	tbl.lock.Lock()
-	defer tbl.lock.Unlock()
+	return tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
 
-	return tbl.DeleteColumnInternal(colName)
+		if tbl.schema != nil {
+			return 0, invalidArgumentErrorf("Cannot delete column with name %s: declared in the table schema", colName)
+		}
+
+		if _, ok := tbl.cols[colName]; !ok {
+			return 0, fmt.Errorf("Cannot delete column with name %s: %w", colName, ErrNotExist)
+		}
+		return tbl.logAndApply(tbl.record(walDeleteColumn, []string{colName}), func() {
+			tbl.dropColumn(colName)
+		})
+	})
 }
 
 func (tbl *table) DeleteColumns() error {
-	tbl.lock.Lock()
-	defer tbl.lock.Unlock()
+	return tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
 
-	var errors, err error
+		return tbl.logAndApply(tbl.record(walDeleteColumns, nil), tbl.dropColumns)
+	})
+}
+
+// dropColumns removes every column. The caller must hold the table lock.
+func (tbl *table) dropColumns() {
 	for name := range tbl.cols {
-		err = tbl.DeleteColumnInternal(name)
-		errors = multierr.Append(errors, err)
+		tbl.dropColumn(name)
 	}
+}
+
+// DeleteMatching deletes the live rows matched by c and returns how many
+// it deleted.
+func (tbl *table) DeleteMatching(c *condition) (int64, error) {
+	var numDeleted int64
+	err := tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
 
-	return errors
+		if err := tbl.checkGeneration(c); err != nil {
+			return 0, err
+		}
+		ids := tbl.liveIds(c)
+		if len(ids) == 0 {
+			return 0, nil
+		}
+		return tbl.logAndApply(tbl.record(walDeleteRows, nil, ids), func() {
+			for _, idx := range ids {
+				tbl.deletes.add(idx)
+				tbl.unindexRow(idx)
+			}
+			numDeleted = int64(len(ids))
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return numDeleted, nil
 }
 
+// DeleteRows marks the given row ids as deleted. Ids that do not exist are
+// reported in the returned error and skipped.
 func (tbl *table) DeleteRows(ids []int64) error {
 	var errors error
-	for _, idx := range ids {
-		if idx > tbl.numRows {
-			errors = multierr.Append(errors, fmt.Errorf("Cannot delete row with id %d: does not exist", idx))
+	err := tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		var deleted []int64
+		for _, idx := range ids {
+			if idx < 0 || idx >= tbl.numRows {
+				errors = multierr.Append(errors, fmt.Errorf("Cannot delete row with id %d: does not exist", idx))
+				continue
+			}
+			deleted = append(deleted, idx)
 		}
 
-		tbl.deletes[idx] = true
-	}
-	return errors
+		if len(deleted) == 0 {
+			return 0, nil
+		}
+		return tbl.logAndApply(tbl.record(walDeleteRows, nil, deleted), func() {
+			for _, idx := range deleted {
+				if tbl.deletes.add(idx) {
+					tbl.unindexRow(idx)
+				}
+			}
+		})
+	})
+	return multierr.Append(errors, err)
 }
@@ -103,6 +103,7 @@ func TestLoadColumns(t *testing.T) {
 
 	err = tbl1.LoadColumns([]string{"col1", "col2"}, [][]int64{{3, 4}, {5, 6}}...)
 	assert.ErrorContains(t, err, "inconsistent column lengths with existing columns")
+	assert.ErrorIs(t, err, ErrInvalidArgument)
 }
 
 func TestDeleteColumn(t *testing.T) {
@@ -207,3 +208,395 @@ func TestDeleteRow(t *testing.T) {
 	assert.ElementsMatch(t, res[0], col1.data[3:9])
 	assert.ElementsMatch(t, res[1], col2.data[3:9])
 }
+
+func TestTypedColumns(t *testing.T) {
+	manager := NewDefaultManager(zap.NewNop())
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+
+	id, err := tbl1.CreateColumn("id")
+	assert.NoError(t, err)
+	name, err := tbl1.CreateTypedColumn("name", TypeString)
+	assert.NoError(t, err)
+	active, err := tbl1.CreateTypedColumn("active", TypeBool)
+	assert.NoError(t, err)
+	assert.Equal(t, TypeString, name.Type())
+
+	err = tbl1.InsertValues([]string{"id", "name", "active"}, []Value{Int64Value(1), StringValue("ann"), BoolValue(true)})
+	assert.NoError(t, err)
+	err = tbl1.InsertValues([]string{"id", "name", "active"}, []Value{Int64Value(2), StringValue("bob"), BoolValue(false)})
+	assert.NoError(t, err)
+
+	// a mismatch anywhere in the row leaves every column untouched
+	err = tbl1.InsertValues([]string{"id", "name", "active"}, []Value{Int64Value(3), Int64Value(3), BoolValue(false)})
+	assert.ErrorContains(t, err, "InsertValues: type mismatch: column name has type string, got int64")
+	err = tbl1.InsertRow([]string{"id", "name"}, []int64{3, 3})
+	assert.ErrorContains(t, err, "InsertRow: type mismatch: column name has type string, got int64")
+	assert.Equal(t, int64(2), tbl1.numRows)
+	assert.Equal(t, int64(2), id.numItems)
+
+	c, err := tbl1.SelectValues(active, BoolValue(true), BoolValue(true))
+	assert.NoError(t, err)
+	res, err := tbl1.GetValues(c, []*column{id, name})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{}, res)
+
+	c, err = tbl1.SelectValues(name, StringValue("b"), StringValue("c"))
+	assert.NoError(t, err)
+	res, err = tbl1.GetValues(c, []*column{id, name})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{{Int64Value(2)}, {StringValue("bob")}}, res)
+
+	_, err = tbl1.Get(c, []*column{id, name})
+	assert.ErrorContains(t, err, "type mismatch")
+
+	_, err = tbl1.SelectValues(name, StringValue("a"), Float64Value(1))
+	assert.ErrorContains(t, err, "type mismatch")
+}
+
+func TestLoadValues(t *testing.T) {
+	tbl1 := NewTable()
+	_, err := tbl1.CreateTypedColumn("score", TypeFloat64)
+	assert.NoError(t, err)
+
+	err = tbl1.LoadValues([]string{"score", "label"},
+		[]Value{Float64Value(1), Int64Value(2)},
+		[]Value{StringValue("a"), StringValue("b")})
+	assert.ErrorContains(t, err, "LoadValues: type mismatch: column score has type float64, got int64")
+	assert.Equal(t, 1, len(tbl1.cols))
+
+	err = tbl1.LoadColumns([]string{"score"}, []int64{1, 2})
+	assert.ErrorContains(t, err, "LoadColumns: type mismatch")
+
+	err = tbl1.LoadValues([]string{"score", "label"},
+		[]Value{Float64Value(1), Float64Value(2)},
+		[]Value{StringValue("a"), StringValue("b")})
+	assert.NoError(t, err)
+	assert.Equal(t, TypeString, tbl1.cols["label"].typ)
+	assert.Equal(t, int64(2), tbl1.numRows)
+
+	_, err = tbl1.CreateTypedColumn("bad", ColumnType(42))
+	assert.ErrorContains(t, err, "unknown type")
+}
+
+func TestInsertRowNulls(t *testing.T) {
+	tbl1 := NewTable()
+	col1, err := tbl1.CreateColumn("col1")
+	assert.NoError(t, err)
+	col2, err := tbl1.CreateTypedColumn("col2", TypeString)
+	assert.NoError(t, err)
+
+	// omitted and explicit nulls keep every column aligned on row ids
+	assert.NoError(t, tbl1.InsertRow([]string{"col1"}, []int64{1}))
+	assert.NoError(t, tbl1.InsertValues([]string{"col1", "col2"}, []Value{NullValue(), StringValue("b")}))
+	assert.NoError(t, tbl1.InsertValues([]string{"col2", "col1"}, []Value{StringValue("c"), Int64Value(3)}))
+	assert.Equal(t, int64(3), tbl1.numRows)
+	assert.Equal(t, int64(3), col1.numItems)
+	assert.Equal(t, int64(3), col2.numItems)
+
+	// a column created later is null for existing rows
+	col3, err := tbl1.CreateColumn("col3")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), col3.NullCount())
+
+	c, err := tbl1.SelectNotNull(col2)
+	assert.NoError(t, err)
+	res, err := tbl1.GetValues(c, []*column{col1, col2, col3})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{
+		{NullValue(), Int64Value(3)},
+		{StringValue("b"), StringValue("c")},
+		{NullValue(), NullValue()},
+	}, res)
+
+	c, err = tbl1.SelectNull(col1)
+	assert.NoError(t, err)
+	res, err = tbl1.GetValues(c, []*column{col2})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{{StringValue("b")}}, res)
+
+	// loading a subset of the columns of an empty table leaves the others null
+	tbl2 := NewTable()
+	_, err = tbl2.CreateColumn("col1")
+	assert.NoError(t, err)
+	other, err := tbl2.CreateColumn("col2")
+	assert.NoError(t, err)
+	assert.NoError(t, tbl2.LoadColumns([]string{"col1"}, []int64{1, 2}))
+	assert.Equal(t, int64(2), other.NullCount())
+}
+
+func TestKeyConstraints(t *testing.T) {
+	manager := NewDefaultManager(zap.NewNop())
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+
+	schema, err := NewSchema(
+		NewColumnDef("id", TypeInt64),
+		NewColumnDef("email", TypeString),
+		NewColumnDef("age", TypeInt64),
+	)
+	assert.NoError(t, err)
+	schema, err = schema.PrimaryKey("id")
+	assert.NoError(t, err)
+	schema, err = schema.Unique("email")
+	assert.NoError(t, err)
+	tbl1, err := db1.CreateTable("tbl1", WithSchema(schema))
+	assert.NoError(t, err)
+
+	names := []string{"id", "email", "age"}
+	assert.NoError(t, tbl1.InsertValues(names, []Value{Int64Value(1), StringValue("a@x"), Int64Value(30)}))
+	assert.NoError(t, tbl1.InsertValues(names, []Value{Int64Value(2), StringValue("b@x"), Int64Value(40)}))
+
+	err = tbl1.InsertRow([]string{"id", "age"}, []int64{1, 50})
+	assert.ErrorContains(t, err, "InsertRow: duplicate key (1) violates PRIMARY KEY (id)")
+	err = tbl1.InsertValues(names, []Value{Int64Value(3), StringValue("a@x"), Int64Value(50)})
+	assert.ErrorContains(t, err, "InsertValues: duplicate key (a@x) violates UNIQUE (email)")
+	err = tbl1.InsertRow([]string{"age"}, []int64{50})
+	assert.ErrorContains(t, err, "column id violates NOT NULL constraint")
+	assert.Equal(t, int64(2), tbl1.numRows)
+
+	// nulls never collide in a UNIQUE constraint
+	assert.NoError(t, tbl1.InsertRow([]string{"id"}, []int64{3}))
+	assert.NoError(t, tbl1.InsertRow([]string{"id"}, []int64{4}))
+
+	// deleted rows free their keys
+	assert.NoError(t, tbl1.DeleteRows([]int64{0}))
+	assert.NoError(t, tbl1.InsertValues(names, []Value{Int64Value(1), StringValue("a@x"), Int64Value(31)}))
+
+	row, ok, err := tbl1.Lookup([]Value{Int64Value(1)})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []Value{Int64Value(1), StringValue("a@x"), Int64Value(31)}, row)
+	row, ok, err = tbl1.Lookup([]Value{Int64Value(3)})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []Value{Int64Value(3), NullValue(), NullValue()}, row)
+	_, ok, err = tbl1.Lookup([]Value{Int64Value(42)})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = tbl1.Lookup([]Value{StringValue("1")})
+	assert.ErrorContains(t, err, "Lookup: type mismatch: column id has type int64, got string")
+	_, _, err = tbl1.Lookup([]Value{Int64Value(1), Int64Value(2)})
+	assert.ErrorContains(t, err, "Lookup: key has 2 values but PRIMARY KEY (id) has 1 columns")
+	_, _, err = NewTable().Lookup([]Value{Int64Value(1)})
+	assert.ErrorContains(t, err, "has no primary key")
+
+	// loads are checked as a whole, against themselves and the rows they keep
+	tbl2, err := db1.CreateTable("tbl2", WithSchema(schema))
+	assert.NoError(t, err)
+	err = tbl2.LoadColumns([]string{"id", "age"}, []int64{1, 2, 1}, []int64{10, 20, 30})
+	assert.ErrorContains(t, err, "LoadColumns: duplicate key (1) violates PRIMARY KEY (id)")
+	assert.Equal(t, int64(0), tbl2.numRows)
+	for _, col := range tbl2.cols {
+		assert.Equal(t, int64(0), col.numItems, col.name)
+	}
+
+	assert.NoError(t, tbl2.LoadColumns([]string{"id", "age"}, []int64{1, 2, 3}, []int64{10, 20, 30}))
+	err = tbl2.LoadValues([]string{"email"}, []Value{StringValue("a"), NullValue(), StringValue("a")})
+	assert.ErrorContains(t, err, "LoadValues: duplicate key (a) violates UNIQUE (email)")
+	assert.NoError(t, tbl2.LoadValues([]string{"email"}, []Value{StringValue("a"), NullValue(), StringValue("c")}))
+
+	// reloading the key column replaces its index entries
+	assert.NoError(t, tbl2.LoadColumns([]string{"id"}, []int64{7, 8, 9}))
+	_, ok, err = tbl2.Lookup([]Value{Int64Value(1)})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	row, ok, err = tbl2.Lookup([]Value{Int64Value(9)})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []Value{Int64Value(9), StringValue("c"), Int64Value(30)}, row)
+	err = tbl2.InsertValues([]string{"id", "email"}, []Value{Int64Value(10), StringValue("c")})
+	assert.ErrorContains(t, err, "duplicate key (c) violates UNIQUE (email)")
+}
+
+func TestInsertRows(t *testing.T) {
+	manager := NewDefaultManager(zap.NewNop())
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	col1, err := tbl1.CreateColumn("col1")
+	assert.NoError(t, err)
+	col2, err := tbl1.CreateColumn("col2")
+	assert.NoError(t, err)
+	col3, err := tbl1.CreateTypedColumn("col3", TypeString)
+	assert.NoError(t, err)
+
+	err = tbl1.InsertRows([]string{"col1", "col2"}, [][]int64{{1, 2}, {3}})
+	assert.ErrorContains(t, err, "InsertRows: validation failed number of column names does not match number of values: 2 != 1")
+	err = tbl1.InsertRows([]string{"col1", "col7"}, [][]int64{{1, 2}})
+	assert.ErrorContains(t, err, "InsertRows: column name does not exist in table: col7")
+	err = tbl1.InsertRows([]string{"col1", "col1"}, [][]int64{{1, 2}})
+	assert.ErrorContains(t, err, "InsertRows: column name given more than once: col1")
+	err = tbl1.InsertRows([]string{"col1", "col3"}, [][]int64{{1, 2}})
+	assert.ErrorContains(t, err, "InsertRows: type mismatch: column col3 has type string, got int64")
+
+	for _, col := range []*column{col1, col2, col3} {
+		assert.Equal(t, int64(0), col.numItems, col.name)
+	}
+
+	err = tbl1.InsertRows([]string{"col2", "col1"}, [][]int64{{2, 1}, {4, 3}, {6, 5}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), tbl1.numRows)
+	assert.Equal(t, []int64{1, 3, 5}, col1.data[0:3])
+	assert.Equal(t, []int64{2, 4, 6}, col2.data[0:3])
+	assert.Equal(t, int64(3), col3.NullCount())
+
+	// a batch that conflicts with itself or the table is rejected whole
+	schema, err := NewSchema(NewColumnDef("id", TypeInt64), NewColumnDef("val", TypeInt64).Check(Int64Value(0), NullValue()))
+	assert.NoError(t, err)
+	schema, err = schema.PrimaryKey("id")
+	assert.NoError(t, err)
+	tbl2, err := db1.CreateTable("tbl2", WithSchema(schema))
+	assert.NoError(t, err)
+	assert.NoError(t, tbl2.InsertRows([]string{"id", "val"}, [][]int64{{1, 10}}))
+
+	err = tbl2.InsertRows([]string{"id", "val"}, [][]int64{{2, 20}, {3, 30}, {2, 40}})
+	assert.ErrorContains(t, err, "InsertRows: duplicate key (2) violates PRIMARY KEY (id)")
+	err = tbl2.InsertRows([]string{"id", "val"}, [][]int64{{2, 20}, {1, 30}})
+	assert.ErrorContains(t, err, "InsertRows: duplicate key (1) violates PRIMARY KEY (id)")
+	err = tbl2.InsertRows([]string{"id", "val"}, [][]int64{{2, 20}, {3, -1}})
+	assert.ErrorContains(t, err, "InsertRows: column val value -1 violates CHECK (val >= 0)")
+	err = tbl2.InsertRows([]string{"val"}, [][]int64{{20}})
+	assert.ErrorContains(t, err, "InsertRows: column id violates NOT NULL constraint")
+	assert.Equal(t, int64(1), tbl2.numRows)
+	for _, col := range tbl2.cols {
+		assert.Equal(t, int64(1), col.numItems, col.name)
+	}
+
+	assert.NoError(t, tbl2.InsertRows([]string{"id", "val"}, [][]int64{{2, 20}, {3, 30}}))
+	row, ok, err := tbl2.Lookup([]Value{Int64Value(3)})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []Value{Int64Value(3), Int64Value(30)}, row)
+}
+
+func TestInsertValueRows(t *testing.T) {
+	schema, err := NewSchema(NewColumnDef("id", TypeInt64), NewColumnDef("name", TypeString).Default(StringValue("?")))
+	assert.NoError(t, err)
+	schema, err = schema.PrimaryKey("id")
+	assert.NoError(t, err)
+	tbl := NewTable(WithSchema(schema))
+
+	err = tbl.InsertValueRows([]string{"id", "name"}, [][]Value{{Int64Value(1), StringValue("a")}, {Int64Value(2)}})
+	assert.ErrorContains(t, err, "InsertValueRows: validation failed number of column names does not match number of values: 2 != 1")
+	err = tbl.InsertValueRows([]string{"id"}, [][]Value{{Int64Value(1)}, {StringValue("b")}})
+	assert.ErrorContains(t, err, "InsertValueRows: type mismatch: column id has type int64, got string")
+	err = tbl.InsertValueRows([]string{"id"}, [][]Value{{Int64Value(1)}, {Int64Value(1)}})
+	assert.ErrorContains(t, err, "InsertValueRows: duplicate key (1) violates PRIMARY KEY (id)")
+	assert.Equal(t, int64(0), tbl.numRows)
+
+	err = tbl.InsertValueRows([]string{"id"}, [][]Value{{Int64Value(1)}, {Int64Value(2)}})
+	assert.NoError(t, err)
+	row, ok, err := tbl.Lookup([]Value{Int64Value(2)})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []Value{Int64Value(2), StringValue("?")}, row)
+}
+
+func TestUpdate(t *testing.T) {
+	manager := NewDefaultManager(zap.NewNop())
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.LoadColumns([]string{"col1", "col2"}, []int64{1, 2, 3, 4}, []int64{10, 20, 30, 40}))
+	col1, col2 := tbl1.cols["col1"], tbl1.cols["col2"]
+	assert.NoError(t, tbl1.DeleteRows([]int64{2}))
+
+	// every live matched row is rewritten in place
+	c, err := tbl1.Select(col1, 2, 10)
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.Update(c, []string{"col2"}, []int64{0}))
+	assert.Equal(t, []int64{10, 0, 30, 0}, col2.data[:4])
+
+	// expressions see the row as it was before the update
+	c, err = tbl1.Select(col1, 0, 10)
+	assert.NoError(t, err)
+	numUpdated, err := tbl1.UpdateExprs(c, []string{"col1", "col2"}, []Expr{Col("col2"), Add(Col("col1"), Lit(Int64Value(1)))})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), numUpdated)
+	assert.Equal(t, []int64{10, 0, 3, 0}, col1.data[:4])
+	assert.Equal(t, []int64{2, 3, 30, 5}, col2.data[:4])
+	assert.Equal(t, int64(4), tbl1.numRows)
+
+	// a rejected update leaves every row untouched
+	c, err = tbl1.Select(col1, 0, 100)
+	assert.NoError(t, err)
+	err = tbl1.Update(c, []string{"col1", "col7"}, []int64{1, 2})
+	assert.ErrorContains(t, err, "Update: column name does not exist in table: col7")
+	err = tbl1.Update(c, []string{"col1"}, []int64{1, 2})
+	assert.ErrorContains(t, err, "number of column names does not match number of values")
+	_, err = tbl1.UpdateExprs(c, []string{"col1"}, []Expr{Div(Lit(Int64Value(100)), Col("col1"))})
+	assert.ErrorContains(t, err, "UpdateExprs: cannot evaluate (100 / col1): division by zero")
+	err = tbl1.UpdateValues(c, []string{"col1"}, []Value{StringValue("x")})
+	assert.ErrorContains(t, err, "UpdateValues: type mismatch: column col1 has type int64, got string")
+	err = tbl1.UpdateRows([]int64{2}, []string{"col1"}, [][]Value{{Int64Value(1)}})
+	assert.ErrorContains(t, err, "UpdateRows: row with id 2 does not exist")
+	err = tbl1.UpdateRows([]int64{0, 0}, []string{"col1"}, [][]Value{{Int64Value(1), Int64Value(2)}})
+	assert.ErrorContains(t, err, "UpdateRows: row id given more than once: 0")
+	assert.Equal(t, []int64{10, 0, 3, 0}, col1.data[:4])
+	assert.Equal(t, []int64{2, 3, 30, 5}, col2.data[:4])
+
+	// typed columns and nulls
+	col3, err := tbl1.CreateTypedColumn("col3", TypeString)
+	assert.NoError(t, err)
+	c, err = tbl1.Select(col1, 10, 11)
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.UpdateValues(c, []string{"col3"}, []Value{StringValue("ten")}))
+	assert.Equal(t, int64(3), col3.NullCount())
+	c = NewCondition()
+	c.SelectNotNull(col3)
+	assert.NoError(t, tbl1.UpdateValues(c, []string{"col3"}, []Value{NullValue()}))
+	assert.Equal(t, int64(4), col3.NullCount())
+}
+
+func TestUpdateKeys(t *testing.T) {
+	manager := NewDefaultManager(zap.NewNop())
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+
+	schema, err := NewSchema(NewColumnDef("id", TypeInt64), NewColumnDef("val", TypeInt64).Check(Int64Value(0), NullValue()))
+	assert.NoError(t, err)
+	schema, err = schema.PrimaryKey("id")
+	assert.NoError(t, err)
+	tbl1, err := db1.CreateTable("tbl1", WithSchema(schema))
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.InsertRows([]string{"id", "val"}, [][]int64{{1, 10}, {2, 20}, {3, 30}}))
+
+	c, err := tbl1.Select(tbl1.cols["id"], 1, 2)
+	assert.NoError(t, err)
+	err = tbl1.Update(c, []string{"id"}, []int64{2})
+	assert.ErrorContains(t, err, "Update: duplicate key (2) violates PRIMARY KEY (id)")
+	err = tbl1.Update(c, []string{"val"}, []int64{-1})
+	assert.ErrorContains(t, err, "Update: column val value -1 violates CHECK (val >= 0)")
+
+	all, err := tbl1.Select(tbl1.cols["id"], 0, 10)
+	assert.NoError(t, err)
+	err = tbl1.Update(all, []string{"id"}, []int64{7})
+	assert.ErrorContains(t, err, "Update: duplicate key (7) violates PRIMARY KEY (id)")
+
+	// keys may move between the updated rows
+	_, err = tbl1.UpdateExprs(all, []string{"id"}, []Expr{Add(Col("id"), Lit(Int64Value(1)))})
+	assert.NoError(t, err)
+	_, ok, err := tbl1.Lookup([]Value{Int64Value(1)})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	row, ok, err := tbl1.Lookup([]Value{Int64Value(4)})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []Value{Int64Value(4), Int64Value(30)}, row)
+	assert.ErrorContains(t, tbl1.InsertRow([]string{"id", "val"}, []int64{2, 0}), "duplicate key (2)")
+	assert.NoError(t, tbl1.InsertRow([]string{"id", "val"}, []int64{1, 0}))
+}
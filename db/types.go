@@ -0,0 +1,204 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ColumnType is the type of the values stored in a column.
+type ColumnType uint8
+
+const (
+	TypeInt64 ColumnType = iota
+	TypeFloat64
+	TypeString
+	TypeBool
+	TypeTimestamp
+)
+
+func (t ColumnType) String() string {
+	switch t {
+	case TypeInt64:
+		return "int64"
+	case TypeFloat64:
+		return "float64"
+	case TypeString:
+		return "string"
+	case TypeBool:
+		return "bool"
+	case TypeTimestamp:
+		return "timestamp"
+	}
+	return fmt.Sprintf("ColumnType(%d)", uint8(t))
+}
+
+// ParseColumnType returns the ColumnType with the given name.
+func ParseColumnType(name string) (ColumnType, error) {
+	for t := TypeInt64; t <= TypeTimestamp; t++ {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown column type %s", name)
+}
+
+// Value is a single typed value that can be inserted into or read from a
+// column. A null Value matches columns of every type.
+type Value struct {
+	typ ColumnType
+	// i holds int64 values, bools as 0 or 1 and timestamps as unix nanos
+	i    int64
+	f    float64
+	s    string
+	null bool
+}
+
+// NullValue returns the value of a missing item.
+func NullValue() Value {
+	return Value{null: true}
+}
+
+func Int64Value(v int64) Value {
+	return Value{typ: TypeInt64, i: v}
+}
+
+func Float64Value(v float64) Value {
+	return Value{typ: TypeFloat64, f: v}
+}
+
+func StringValue(v string) Value {
+	return Value{typ: TypeString, s: v}
+}
+
+func BoolValue(v bool) Value {
+	if v {
+		return Value{typ: TypeBool, i: 1}
+	}
+	return Value{typ: TypeBool, i: 0}
+}
+
+func TimestampValue(v time.Time) Value {
+	return Value{typ: TypeTimestamp, i: v.UnixNano()}
+}
+
+func (v Value) Type() ColumnType {
+	return v.typ
+}
+
+func (v Value) IsNull() bool {
+	return v.null
+}
+
+func (v Value) Int64() int64 {
+	return v.i
+}
+
+func (v Value) Float64() float64 {
+	return v.f
+}
+
+func (v Value) Str() string {
+	return v.s
+}
+
+func (v Value) Bool() bool {
+	return v.i != 0
+}
+
+func (v Value) Time() time.Time {
+	return time.Unix(0, v.i).UTC()
+}
+
+func (v Value) String() string {
+	if v.null {
+		return "NULL"
+	}
+	switch v.typ {
+	case TypeInt64:
+		return strconv.FormatInt(v.i, 10)
+	case TypeFloat64:
+		return strconv.FormatFloat(v.f, 'g', -1, 64)
+	case TypeString:
+		return v.s
+	case TypeBool:
+		return strconv.FormatBool(v.Bool())
+	case TypeTimestamp:
+		return v.Time().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("Value(%s)", v.typ)
+}
+
+// Columns store every value as a 64-bit word. The encoding preserves order
+// for every fixed width type, so words of the same column can be compared
+// as plain int64s. Strings are dictionary encoded and their words are
+// indexes into the column dictionary instead.
+
+// encodeFloat maps a float64 onto an int64 with the same ordering.
+func encodeFloat(f float64) int64 {
+	if f == 0 {
+		// fold -0 into +0 so they compare equal
+		f = 0
+	}
+	bits := math.Float64bits(f)
+	if bits>>63 == 1 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return int64(bits ^ (1 << 63))
+}
+
+func decodeFloat(word int64) float64 {
+	bits := uint64(word) ^ (1 << 63)
+	if bits>>63 == 1 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
+
+// fixedWord returns the word for a value of a fixed width type.
+func (v Value) fixedWord() int64 {
+	if v.typ == TypeFloat64 {
+		return encodeFloat(v.f)
+	}
+	return v.i
+}
+
+func fixedValue(typ ColumnType, word int64) Value {
+	if typ == TypeFloat64 {
+		return Float64Value(decodeFloat(word))
+	}
+	return Value{typ: typ, i: word}
+}
+
+// Compare orders two values of the same type, returning -1, 0 or 1.
+func (v Value) Compare(other Value) int {
+	if v.typ == TypeString {
+		switch {
+		case v.s < other.s:
+			return -1
+		case v.s > other.s:
+			return 1
+		}
+		return 0
+	}
+	return compareWords(v.fixedWord(), other.fixedWord())
+}
+
+func compareWords(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func typeMismatchError(colName string, colType ColumnType, valType ColumnType) error {
+	return constraintErrorf("type mismatch: column %s has type %s, got %s", colName, colType, valType)
+}
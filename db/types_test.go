@@ -0,0 +1,51 @@
+package db
+
+import (
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFloatEncodingPreservesOrder(t *testing.T) {
+	floats := []float64{math.Inf(-1), -1e300, -2.5, -1, -math.SmallestNonzeroFloat64, 0, math.SmallestNonzeroFloat64, 0.5, 1, 3.75, 1e300, math.Inf(1)}
+
+	words := make([]int64, len(floats))
+	for i, f := range floats {
+		words[i] = encodeFloat(f)
+		assert.Equal(t, f, decodeFloat(words[i]))
+	}
+	assert.True(t, sort.SliceIsSorted(words, func(i, j int) bool { return words[i] < words[j] }))
+
+	assert.Equal(t, encodeFloat(0), encodeFloat(math.Copysign(0, -1)))
+}
+
+func TestValue(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, "42", Int64Value(42).String())
+	assert.Equal(t, "2.5", Float64Value(2.5).String())
+	assert.Equal(t, "abc", StringValue("abc").String())
+	assert.Equal(t, "true", BoolValue(true).String())
+	assert.Equal(t, "2024-03-01T12:30:00Z", TimestampValue(ts).String())
+
+	assert.Equal(t, ts, TimestampValue(ts).Time())
+	assert.False(t, BoolValue(false).Bool())
+
+	assert.Equal(t, -1, Float64Value(-2).Compare(Float64Value(1)))
+	assert.Equal(t, 1, StringValue("b").Compare(StringValue("a")))
+	assert.Equal(t, 0, Int64Value(3).Compare(Int64Value(3)))
+}
+
+func TestParseColumnType(t *testing.T) {
+	for typ := TypeInt64; typ <= TypeTimestamp; typ++ {
+		parsed, err := ParseColumnType(typ.String())
+		assert.NoError(t, err)
+		assert.Equal(t, typ, parsed)
+	}
+
+	_, err := ParseColumnType("decimal")
+	assert.ErrorContains(t, err, "unknown column type")
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// VacuumStats reports what a vacuum removed.
+type VacuumStats struct {
+	RowsRemoved int64
+	// BytesReclaimed counts the column words and validity bitmap words the
+	// removed rows occupied.
+	BytesReclaimed int64
+}
+
+// Vacuum physically removes deleted rows from every column. The remaining
+// rows keep their order but are renumbered from 0, so conditions built
+// before a vacuum must not be reused after it; Filter's are rejected. On a
+// clustered table, a vacuum also sorts the rows inserted out of order into
+// place.
+func (tbl *table) Vacuum() (VacuumStats, error) {
+	var stats VacuumStats
+	err := tbl.wal.logged(func() (int64, error) {
+		tbl.lock.Lock()
+		defer tbl.lock.Unlock()
+
+		if tbl.deletes.isEmpty() && tbl.unsortedRows() == 0 {
+			return 0, nil
+		}
+		return tbl.logAndApply(tbl.record(walVacuum, nil), func() {
+			stats = tbl.vacuum()
+		})
+	})
+	return stats, err
+}
+
+// vacuum compacts every column down to the live rows, in the order of the
+// cluster key if the table has one. The caller must hold the table lock.
+func (tbl *table) vacuum() VacuumStats {
+	keep := rangeBitmap(0, tbl.numRows).andNot(tbl.deletes).toSlice()
+	tbl.clusterOrder(keep)
+
+	stats := VacuumStats{RowsRemoved: tbl.numRows - int64(len(keep))}
+	for _, col := range tbl.cols {
+		col.lock.Lock()
+		stats.BytesReclaimed += col.compact(keep)
+		col.lock.Unlock()
+	}
+
+	tbl.numRows = int64(len(keep))
+	tbl.deletes = newRowBitmap()
+	tbl.generation++
+	// the same rows are kept under new ids, so keys cannot start to collide
+	tbl.reindex()
+	return stats
+}
+
+// WithVacuumInterval makes Start launch a goroutine that vacuums every table
+// with deleted rows once per interval until End.
+func WithVacuumInterval(interval time.Duration) ManagerOption {
+	return func(dbm *defaultManager) {
+		dbm.vacuumInterval = interval
+	}
+}
+
+// startVacuum launches the background vacuum if one is configured.
+func (dbm *defaultManager) startVacuum(ctx context.Context) {
+	if dbm.vacuumInterval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	dbm.stopVacuum = func() {
+		cancel()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(dbm.vacuumInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				dbm.vacuumAll()
+			}
+		}
+	}()
+}
+
+// vacuumAll vacuums every table that has deleted rows.
+func (dbm *defaultManager) vacuumAll() {
+	dbm.lock.Lock()
+	dbs := make(map[string]*db, len(dbm.dbs))
+	for name, db := range dbm.dbs {
+		dbs[name] = db
+	}
+	dbm.lock.Unlock()
+
+	for dbName, db := range dbs {
+		db.lock.Lock()
+		tables := make(map[string]*table, len(db.tables))
+		for name, tbl := range db.tables {
+			tables[name] = tbl
+		}
+		db.lock.Unlock()
+
+		for tblName, tbl := range tables {
+			stats, err := tbl.Vacuum()
+			if err != nil {
+				dbm.logger.Warn("vacuum failed", zap.String("db", dbName), zap.String("table", tblName), zap.Error(err))
+				continue
+			}
+			if stats.RowsRemoved > 0 {
+				dbm.logger.Info("vacuumed table",
+					zap.String("db", dbName),
+					zap.String("table", tblName),
+					zap.Int64("rowsRemoved", stats.RowsRemoved),
+					zap.Int64("bytesReclaimed", stats.BytesReclaimed))
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestVacuum(t *testing.T) {
+	manager := NewDefaultManager(zap.NewNop())
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+
+	schema, err := NewSchema(
+		NewColumnDef("id", TypeInt64),
+		NewColumnDef("name", TypeString),
+	)
+	assert.NoError(t, err)
+	schema, err = schema.PrimaryKey("id")
+	assert.NoError(t, err)
+	tbl1, err := db1.CreateTable("tbl1", WithSchema(schema))
+	assert.NoError(t, err)
+
+	err = tbl1.LoadValues([]string{"id", "name"},
+		[]Value{Int64Value(1), Int64Value(2), Int64Value(3), Int64Value(4), Int64Value(5)},
+		[]Value{StringValue("a"), NullValue(), StringValue("c"), NullValue(), StringValue("e")})
+	assert.NoError(t, err)
+
+	// nothing to reclaim
+	stats, err := tbl1.Vacuum()
+	assert.NoError(t, err)
+	assert.Equal(t, VacuumStats{}, stats)
+
+	assert.NoError(t, tbl1.DeleteRows([]int64{0, 1, 3}))
+	stale, err := tbl1.Filter(Match("id", Ge(Int64Value(3))))
+	assert.NoError(t, err)
+	stats, err = tbl1.Vacuum()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats.RowsRemoved)
+	// 3 words per column and the bitmap of name, which has no nulls left
+	assert.Equal(t, int64((3*2+1)*8), stats.BytesReclaimed)
+
+	assert.Equal(t, int64(2), tbl1.numRows)
+	assert.True(t, tbl1.deletes.isEmpty())
+	for _, col := range tbl1.cols {
+		assert.Equal(t, int64(2), col.numItems, col.name)
+	}
+	assert.Nil(t, tbl1.cols["name"].validity)
+
+	// surviving rows keep their order under new ids
+	c, err := tbl1.SelectNotNull(tbl1.cols["id"])
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, 1}, c.ids.toSlice())
+	res, err := tbl1.GetValues(c, []*column{tbl1.cols["id"], tbl1.cols["name"]})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{
+		{Int64Value(3), Int64Value(5)},
+		{StringValue("c"), StringValue("e")},
+	}, res)
+
+	// filtered conditions do not outlive the old ids
+	_, err = tbl1.GetColumns(stale, []string{"id"})
+	assert.ErrorContains(t, err, "the table was vacuumed after it was filtered")
+	_, err = tbl1.DeleteMatching(stale)
+	assert.ErrorContains(t, err, "the table was vacuumed after it was filtered")
+	assert.ErrorContains(t, tbl1.UpdateValues(stale, []string{"name"}, []Value{NullValue()}), "the table was vacuumed after it was filtered")
+	assert.Equal(t, int64(2), tbl1.Stats().LiveRows)
+
+	// the primary key index follows the new ids
+	row, ok, err := tbl1.Lookup([]Value{Int64Value(5)})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []Value{Int64Value(5), StringValue("e")}, row)
+	_, ok, err = tbl1.Lookup([]Value{Int64Value(1)})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, tbl1.InsertValues([]string{"id"}, []Value{Int64Value(1)}))
+	assert.ErrorContains(t, tbl1.InsertValues([]string{"id"}, []Value{Int64Value(3)}), "duplicate key (3)")
+}
+
+func TestVacuumStaleConditions(t *testing.T) {
+	tbl := NewTable()
+	ids := make([]int64, 50)
+	for i := range ids {
+		ids[i] = int64(i)
+	}
+	require.NoError(t, tbl.LoadColumns([]string{"id"}, ids))
+	col, _ := tbl.GetColumn("id")
+	stale, err := tbl.Filter(Match("id", Ge(Int64Value(30))))
+	require.NoError(t, err)
+	require.NoError(t, tbl.DeleteRows([]int64{0, 1}))
+	_, err = tbl.Vacuum()
+	require.NoError(t, err)
+
+	keys := []SortKey{{Col: col}}
+	for name, use := range map[string]func() error{
+		"aggregate": func() error {
+			_, err := tbl.Sum(stale, col)
+			return err
+		},
+		"count rows": func() error {
+			_, err := tbl.CountRows(stale)
+			return err
+		},
+		"group by": func() error {
+			_, err := tbl.GroupBy(stale, []*column{col}, []Aggregation{{Func: AggCount}})
+			return err
+		},
+		"sorted ids": func() error {
+			_, err := tbl.SortedIds(stale, keys, 0, NoLimit)
+			return err
+		},
+		"get sorted": func() error {
+			_, err := tbl.GetSorted(stale, []*column{col}, keys, 0, NoLimit)
+			return err
+		},
+		"join": func() error {
+			side := JoinSide{Table: tbl, Cond: stale, Col: col}
+			_, err := Join(side, JoinSide{Table: tbl, Col: col}, InnerJoin)
+			return err
+		},
+	} {
+		assert.ErrorContains(t, use(), "the table was vacuumed after it was filtered", name)
+	}
+}
+
+func TestColumnCompact(t *testing.T) {
+	col := NewColumn("col1")
+	for i := int64(0); i < 130; i++ {
+		col.insertValue(Int64Value(i))
+	}
+	col.markNull(1)
+	col.markNull(129)
+
+	reclaimed := col.compact([]int64{0, 1, 2, 129})
+	assert.Equal(t, int64(4), col.numItems)
+	assert.Equal(t, []Value{Int64Value(0), NullValue(), Int64Value(2), NullValue()},
+		[]Value{col.value(0), col.value(1), col.value(2), col.value(3)})
+	assert.Equal(t, int64(2), col.NullCount())
+	// 126 words and 2 of the 3 bitmap words
+	assert.Equal(t, int64((126+2)*8), reclaimed)
+
+	// oversized storage shrinks
+	big := NewColumn("col2")
+	big.loadWords(make([]int64, 4*defaultColumnSize))
+	big.compact([]int64{0})
+	assert.Equal(t, defaultColumnSize, len(big.data))
+}
+
+func TestVacuumReplay(t *testing.T) {
+	dir := t.TempDir()
+	manager := startManager(t, dir)
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.LoadColumns([]string{"col1"}, []int64{1, 2, 3, 4}))
+	assert.NoError(t, tbl1.DeleteRows([]int64{1}))
+	_, err = tbl1.Vacuum()
+	assert.NoError(t, err)
+	// row ids after the vacuum refer to the compacted table
+	assert.NoError(t, tbl1.DeleteRows([]int64{1}))
+
+	restarted := startManager(t, dir)
+	rdb1, err := restarted.GetDb("testdb1")
+	assert.NoError(t, err)
+	rtbl1, err := rdb1.GetTable("tbl1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), rtbl1.numRows)
+	assert.Equal(t, []int64{1, 3, 4}, rtbl1.cols["col1"].data[:3])
+	assert.Equal(t, []int64{1}, rtbl1.deletes.toSlice())
+}
+
+func TestBackgroundVacuum(t *testing.T) {
+	manager := NewDefaultManager(zap.NewNop(), WithVacuumInterval(time.Millisecond))
+	assert.NoError(t, manager.Start(context.Background()))
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.LoadColumns([]string{"col1"}, []int64{1, 2, 3}))
+	assert.NoError(t, tbl1.DeleteRows([]int64{0, 2}))
+
+	assert.Eventually(t, func() bool {
+		tbl1.lock.Lock()
+		defer tbl1.lock.Unlock()
+		return tbl1.numRows == 1
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, manager.End())
+	assert.Nil(t, manager.stopVacuum)
+
+	col1, err := tbl1.GetColumn("col1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), col1.data[0])
+}
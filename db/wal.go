@@ -0,0 +1,714 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	walFileName = "modb.wal"
+	// every record is prefixed by the payload length and its crc32c checksum
+	walHeaderSize            = 8
+	walMaxRecordSize         = 1 << 30
+	walBufferSize            = 1 << 16
+	defaultGroupCommitWindow = 2 * time.Millisecond
+)
+
+var (
+	walCrcTable  = crc32.MakeTable(crc32.Castagnoli)
+	errWalClosed = errors.New("write-ahead log is closed")
+)
+
+// WalSyncMode controls when records appended to the write-ahead log are
+// fsynced to disk.
+type WalSyncMode int
+
+const (
+	// WalSyncAlways fsyncs before every logged operation returns. Operations
+	// that commit concurrently share a single fsync.
+	WalSyncAlways WalSyncMode = iota
+	// WalSyncGroup waits up to the group commit window before fsyncing so
+	// that more concurrent operations can share the same fsync.
+	WalSyncGroup
+	// WalSyncNone hands records to the OS but only fsyncs on checkpoint, so
+	// a machine crash may lose recent operations.
+	WalSyncNone
+)
+
+// WithWalSync sets how the write-ahead log is synced to disk.
+func WithWalSync(mode WalSyncMode) ManagerOption {
+	return func(dbm *defaultManager) {
+		dbm.walSyncMode = mode
+	}
+}
+
+// WithGroupCommitWindow sets how long WalSyncGroup waits to batch commits
+// before issuing an fsync.
+func WithGroupCommitWindow(window time.Duration) ManagerOption {
+	return func(dbm *defaultManager) {
+		dbm.groupCommitWindow = window
+	}
+}
+
+type walOp uint8
+
+const (
+	walCreateDb walOp = iota + 1
+	walDeleteDb
+	walCreateTable
+	walDeleteTable
+	walDeleteTables
+	walCreateColumn
+	walDeleteColumn
+	walDeleteColumns
+	walInsertRow
+	walLoadColumns
+	walDeleteRows
+	walInsertValues
+	walLoadValues
+	walInsertRows
+	walUpdateRows
+	walVacuum
+	walCreateIndex
+	walClusterBy
+)
+
+// walRecord describes one logged operation. Which fields are set depends on
+// the op: vals holds the row for InsertRow, the rows for InsertRows, one
+// slice per column for LoadColumns and the row ids for DeleteRows and
+// UpdateRows, while values holds the typed equivalents for InsertValues and
+// LoadValues and the new values of each column for UpdateRows.
+// CreateTable records carry the table schema, if any.
+type walRecord struct {
+	lsn      int64
+	op       walOp
+	dbName   string
+	tblName  string
+	colNames []string
+	vals     [][]int64
+	colType  ColumnType
+	values   [][]Value
+	schema   *Schema
+}
+
+func appendWalString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// walNullValue marks a null in place of the type of a value.
+const walNullValue = 0xff
+
+func appendWalValue(buf []byte, val Value) []byte {
+	if val.null {
+		return append(buf, walNullValue)
+	}
+	buf = append(buf, byte(val.typ))
+	switch val.typ {
+	case TypeFloat64:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(val.f))
+	case TypeString:
+		return appendWalString(buf, val.s)
+	}
+	return binary.AppendVarint(buf, val.i)
+}
+
+const (
+	walNotNull = 1 << iota
+	walHasDefault
+	walHasCheckMin
+	walHasCheckMax
+)
+
+func appendWalSchema(buf []byte, schema *Schema) []byte {
+	if schema == nil {
+		return binary.AppendUvarint(buf, 0)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(schema.cols)))
+	for _, def := range schema.cols {
+		buf = appendWalString(buf, def.name)
+		buf = append(buf, byte(def.typ))
+
+		var flags byte
+		var vals []Value
+		if def.notNull {
+			flags |= walNotNull
+		}
+		if def.def != nil {
+			flags |= walHasDefault
+			vals = append(vals, *def.def)
+		}
+		if def.checkMin != nil {
+			flags |= walHasCheckMin
+			vals = append(vals, *def.checkMin)
+		}
+		if def.checkMax != nil {
+			flags |= walHasCheckMax
+			vals = append(vals, *def.checkMax)
+		}
+		buf = append(buf, flags)
+		for _, val := range vals {
+			buf = appendWalValue(buf, val)
+		}
+	}
+
+	buf = appendWalStrings(buf, schema.primaryKey)
+	buf = binary.AppendUvarint(buf, uint64(len(schema.unique)))
+	for _, cols := range schema.unique {
+		buf = appendWalStrings(buf, cols)
+	}
+	return buf
+}
+
+func appendWalStrings(buf []byte, strs []string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(strs)))
+	for _, s := range strs {
+		buf = appendWalString(buf, s)
+	}
+	return buf
+}
+
+func (rec *walRecord) encode() []byte {
+	buf := make([]byte, walHeaderSize, 64)
+	buf = binary.AppendUvarint(buf, uint64(rec.lsn))
+	buf = append(buf, byte(rec.op))
+	buf = appendWalString(buf, rec.dbName)
+	buf = appendWalString(buf, rec.tblName)
+
+	buf = appendWalStrings(buf, rec.colNames)
+
+	buf = binary.AppendUvarint(buf, uint64(len(rec.vals)))
+	for _, vals := range rec.vals {
+		buf = binary.AppendUvarint(buf, uint64(len(vals)))
+		for _, val := range vals {
+			buf = binary.AppendVarint(buf, val)
+		}
+	}
+
+	// typed fields come last so records written before columns were typed
+	// still decode
+	buf = append(buf, byte(rec.colType))
+	buf = binary.AppendUvarint(buf, uint64(len(rec.values)))
+	for _, vals := range rec.values {
+		buf = binary.AppendUvarint(buf, uint64(len(vals)))
+		for _, val := range vals {
+			buf = appendWalValue(buf, val)
+		}
+	}
+
+	buf = appendWalSchema(buf, rec.schema)
+
+	payload := buf[walHeaderSize:]
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, walCrcTable))
+	return buf
+}
+
+// walDecoder reads the fields of a record payload, remembering the first
+// error so callers can check once at the end.
+type walDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *walDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	val, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("invalid uvarint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return val
+}
+
+func (d *walDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	val, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("invalid varint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return val
+}
+
+func (d *walDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) == 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+// length reads a count and checks it against the bytes left so a corrupt
+// count cannot trigger a huge allocation.
+func (d *walDecoder) length() int {
+	n := d.uvarint()
+	if d.err == nil && n > uint64(len(d.buf)) {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	return int(n)
+}
+
+func (d *walDecoder) string() string {
+	n := d.length()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *walDecoder) value() Value {
+	typ := d.byte()
+	if typ == walNullValue {
+		return NullValue()
+	}
+
+	switch ColumnType(typ) {
+	case TypeFloat64:
+		if d.err == nil && len(d.buf) < 8 {
+			d.err = io.ErrUnexpectedEOF
+		}
+		if d.err != nil {
+			return Value{}
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+		d.buf = d.buf[8:]
+		return Float64Value(f)
+	case TypeString:
+		return StringValue(d.string())
+	}
+	return Value{typ: ColumnType(typ), i: d.varint()}
+}
+
+func (d *walDecoder) schema() *Schema {
+	numCols := d.length()
+	if numCols == 0 {
+		return nil
+	}
+
+	cols := make([]ColumnDef, 0, numCols)
+	for i := 0; i < numCols && d.err == nil; i++ {
+		def := NewColumnDef(d.string(), ColumnType(d.byte()))
+		flags := d.byte()
+		if flags&walNotNull != 0 {
+			def = def.NotNull()
+		}
+		if flags&walHasDefault != 0 {
+			def = def.Default(d.value())
+		}
+		if flags&walHasCheckMin != 0 {
+			val := d.value()
+			def.checkMin = &val
+		}
+		if flags&walHasCheckMax != 0 {
+			val := d.value()
+			def.checkMax = &val
+		}
+		cols = append(cols, def)
+	}
+	schema := &Schema{cols: cols}
+
+	// records written before key constraints existed end after the columns
+	if d.err != nil || len(d.buf) == 0 {
+		return schema
+	}
+	schema.primaryKey = d.strings()
+	numUnique := d.length()
+	for i := 0; i < numUnique && d.err == nil; i++ {
+		schema.unique = append(schema.unique, d.strings())
+	}
+	return schema
+}
+
+// strings reads a list of strings, returning nil for an empty list.
+func (d *walDecoder) strings() []string {
+	var strs []string
+	n := d.length()
+	for i := 0; i < n && d.err == nil; i++ {
+		strs = append(strs, d.string())
+	}
+	return strs
+}
+
+func decodeWalRecord(payload []byte) (*walRecord, error) {
+	d := &walDecoder{buf: payload}
+	rec := &walRecord{}
+	rec.lsn = int64(d.uvarint())
+	rec.op = walOp(d.byte())
+	rec.dbName = d.string()
+	rec.tblName = d.string()
+
+	rec.colNames = d.strings()
+
+	numVals := d.length()
+	for i := 0; i < numVals && d.err == nil; i++ {
+		n := d.length()
+		vals := make([]int64, 0, n)
+		for j := 0; j < n && d.err == nil; j++ {
+			vals = append(vals, d.varint())
+		}
+		rec.vals = append(rec.vals, vals)
+	}
+
+	if d.err == nil && len(d.buf) > 0 {
+		rec.colType = ColumnType(d.byte())
+		numValues := d.length()
+		for i := 0; i < numValues && d.err == nil; i++ {
+			n := d.length()
+			vals := make([]Value, 0, n)
+			for j := 0; j < n && d.err == nil; j++ {
+				vals = append(vals, d.value())
+			}
+			rec.values = append(rec.values, vals)
+		}
+	}
+
+	if d.err == nil && len(d.buf) > 0 {
+		rec.schema = d.schema()
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("corrupt write-ahead log record: %v", d.err)
+	}
+	if len(d.buf) != 0 {
+		return nil, fmt.Errorf("corrupt write-ahead log record: trailing bytes")
+	}
+	return rec, nil
+}
+
+// wal is an append-only, checksummed log of every mutating operation since
+// the last checkpoint. Operations append a record while holding the lock of
+// the object they modify, so the log order matches the order in which they
+// were applied, and then wait in commit for the record to become durable.
+type wal struct {
+	file   *os.File
+	writer *bufio.Writer
+	mode   WalSyncMode
+	window time.Duration
+	logger *zap.Logger
+
+	lsn       int64
+	syncedLsn int64
+	syncing   bool
+	replaying bool
+	closed    bool
+	err       error
+	lock      sync.Mutex
+	cond      *sync.Cond
+
+	// checkpointLock is held for reading by every logged operation and for
+	// writing by a checkpoint, so a snapshot never misses an operation
+	// whose record is about to be truncated.
+	checkpointLock sync.RWMutex
+}
+
+func openWal(path string, mode WalSyncMode, window time.Duration, logger *zap.Logger) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wal{
+		file:   file,
+		writer: bufio.NewWriterSize(file, walBufferSize),
+		mode:   mode,
+		window: window,
+		logger: logger,
+	}
+	w.cond = sync.NewCond(&w.lock)
+	return w, nil
+}
+
+// replay calls apply for every record after checkpointLsn in log order. A
+// torn or corrupt record ends the log: it and everything after it are
+// truncated away since they were never acknowledged as durable.
+func (w *wal) replay(checkpointLsn int64, apply func(*walRecord) error) (int, error) {
+	w.lock.Lock()
+	w.lsn = checkpointLsn
+	w.syncedLsn = checkpointLsn
+	w.replaying = true
+	w.lock.Unlock()
+
+	defer func() {
+		w.lock.Lock()
+		w.replaying = false
+		w.lock.Unlock()
+	}()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReaderSize(w.file, walBufferSize)
+	header := make([]byte, walHeaderSize)
+	var offset int64
+	applied := 0
+	for {
+		rec, size, err := readWalRecord(reader, header)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.logger.Warn("truncating write-ahead log at invalid record", zap.Int64("offset", offset), zap.Error(err))
+			if err := w.file.Truncate(offset); err != nil {
+				return applied, err
+			}
+			break
+		}
+		offset += size
+
+		if rec.lsn <= checkpointLsn {
+			continue
+		}
+		if err := apply(rec); err != nil {
+			return applied, fmt.Errorf("replaying write-ahead log record %d: %v", rec.lsn, err)
+		}
+		applied += 1
+
+		w.lock.Lock()
+		w.lsn = rec.lsn
+		w.syncedLsn = rec.lsn
+		w.lock.Unlock()
+	}
+
+	return applied, nil
+}
+
+func readWalRecord(reader *bufio.Reader, header []byte) (*walRecord, int64, error) {
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, fmt.Errorf("torn record header: %v", err)
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	checksum := binary.LittleEndian.Uint32(header[4:8])
+	if length > walMaxRecordSize {
+		return nil, 0, fmt.Errorf("record length %d exceeds maximum", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, 0, fmt.Errorf("torn record payload: %v", err)
+	}
+	if crc32.Checksum(payload, walCrcTable) != checksum {
+		return nil, 0, fmt.Errorf("checksum mismatch")
+	}
+
+	rec, err := decodeWalRecord(payload)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rec, int64(walHeaderSize + len(payload)), nil
+}
+
+// logged runs op, which applies an operation and appends its record, while
+// holding off checkpoints and then waits for the record to become durable.
+// A nil wal simply runs op.
+func (w *wal) logged(op func() (int64, error)) error {
+	if w == nil {
+		_, err := op()
+		return err
+	}
+
+	w.checkpointLock.RLock()
+	lsn, err := op()
+	w.checkpointLock.RUnlock()
+	if err != nil {
+		return err
+	}
+	return w.commit(lsn)
+}
+
+// logAndApply appends rec and only then applies a validated write, so a
+// write the log rejects never changes the state in memory.
+func (w *wal) logAndApply(rec *walRecord, apply func()) (int64, error) {
+	lsn, err := w.append(rec)
+	if err != nil {
+		return 0, err
+	}
+	apply()
+	return lsn, nil
+}
+
+// append assigns the next lsn to rec and buffers it. Records produced while
+// replaying are dropped since they are already in the log.
+func (w *wal) append(rec *walRecord) (int64, error) {
+	if w == nil {
+		return 0, nil
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.replaying {
+		return 0, nil
+	}
+	if w.closed {
+		return 0, errWalClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.lsn += 1
+	rec.lsn = w.lsn
+	if _, err := w.writer.Write(rec.encode()); err != nil {
+		w.err = err
+		return 0, err
+	}
+	return rec.lsn, nil
+}
+
+// commit blocks until the record with the given lsn is as durable as the
+// sync mode promises. The first waiter becomes the leader and syncs on
+// behalf of everyone that appended before it flushed.
+func (w *wal) commit(lsn int64) error {
+	if w == nil || lsn == 0 {
+		return nil
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.mode == WalSyncNone {
+		if w.err == nil {
+			w.err = w.writer.Flush()
+		}
+		return w.err
+	}
+
+	for w.syncedLsn < lsn && w.err == nil {
+		if w.syncing {
+			w.cond.Wait()
+			continue
+		}
+
+		w.syncing = true
+		if w.mode == WalSyncGroup && w.window > 0 {
+			w.lock.Unlock()
+			time.Sleep(w.window)
+			w.lock.Lock()
+		}
+
+		target := w.lsn
+		err := w.writer.Flush()
+		if err == nil {
+			w.lock.Unlock()
+			err = w.file.Sync()
+			w.lock.Lock()
+		}
+
+		if err != nil {
+			w.err = err
+		} else if target > w.syncedLsn {
+			w.syncedLsn = target
+		}
+		w.syncing = false
+		w.cond.Broadcast()
+	}
+
+	return w.err
+}
+
+func (w *wal) beginCheckpoint() {
+	if w != nil {
+		w.checkpointLock.Lock()
+	}
+}
+
+func (w *wal) endCheckpoint() {
+	if w != nil {
+		w.checkpointLock.Unlock()
+	}
+}
+
+func (w *wal) lastLsn() int64 {
+	if w == nil {
+		return 0
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.lsn
+}
+
+// truncate drops every record once a checkpoint has made them redundant.
+// The lsn keeps counting up so records written afterwards are still newer
+// than the checkpoint.
+func (w *wal) truncate() error {
+	if w == nil {
+		return nil
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return errWalClosed
+	}
+
+	w.writer.Reset(w.file)
+	if err := w.file.Truncate(0); err != nil {
+		w.err = err
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.err = err
+		return err
+	}
+	w.syncedLsn = w.lsn
+	w.err = nil
+	w.cond.Broadcast()
+	return nil
+}
+
+func (w *wal) close() error {
+	if w == nil {
+		return nil
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	err := w.writer.Flush()
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.cond.Broadcast()
+	return err
+}
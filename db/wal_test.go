@@ -0,0 +1,375 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func startManager(t *testing.T, dir string, opts ...ManagerOption) *defaultManager {
+	opts = append([]ManagerOption{WithDataDir(dir)}, opts...)
+	manager := NewDefaultManager(zap.NewNop(), opts...)
+	assert.NoError(t, manager.Start(context.Background()))
+	return manager
+}
+
+func TestWalRecordEncoding(t *testing.T) {
+	rec := &walRecord{
+		lsn:      42,
+		op:       walLoadColumns,
+		dbName:   "testdb1",
+		tblName:  "tbl1",
+		colNames: []string{"col1", "col2"},
+		vals:     [][]int64{{1, -2, 3}, {-1 << 62, 0, 1 << 62}},
+	}
+
+	buf := rec.encode()
+	decoded, err := decodeWalRecord(buf[walHeaderSize:])
+	assert.NoError(t, err)
+	assert.Equal(t, rec, decoded)
+
+	_, err = decodeWalRecord(buf[walHeaderSize : len(buf)-8])
+	assert.ErrorContains(t, err, "corrupt write-ahead log record")
+}
+
+func TestWalReplay(t *testing.T) {
+	dir := t.TempDir()
+	manager := startManager(t, dir)
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	_, err = manager.CreateDb("testdb2")
+	assert.NoError(t, err)
+	assert.NoError(t, manager.DeleteDb("testdb2"))
+
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	_, err = db1.CreateTable("tbl2")
+	assert.NoError(t, err)
+	assert.NoError(t, db1.DeleteTable("tbl2"))
+
+	_, err = tbl1.CreateColumn("col1")
+	assert.NoError(t, err)
+	_, err = tbl1.CreateColumn("col2")
+	assert.NoError(t, err)
+	_, err = tbl1.CreateColumn("col3")
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.DeleteColumn("col3"))
+
+	err = tbl1.LoadColumns([]string{"col1", "col2"}, []int64{1, 2, 3}, []int64{1, 4, 9})
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.InsertRow([]string{"col1", "col2"}, []int64{4, 16}))
+	assert.NoError(t, tbl1.InsertRows([]string{"col2", "col1"}, [][]int64{{25, 5}, {36, 6}}))
+	assert.NoError(t, tbl1.DeleteRows([]int64{0, 2}))
+	c, err := tbl1.Select(tbl1.cols["col1"], 0, 3)
+	assert.NoError(t, err)
+	_, err = tbl1.UpdateExprs(c, []string{"col2"}, []Expr{Mul(Col("col2"), Lit(Int64Value(10)))})
+	assert.NoError(t, err)
+
+	// failed operations are not logged
+	_, err = tbl1.CreateColumn("col1")
+	assert.Error(t, err)
+	assert.Error(t, tbl1.InsertRow([]string{"col1"}, []int64{1, 2}))
+
+	// simulate a crash: the manager is dropped without End or Save
+	restarted := startManager(t, dir)
+
+	assert.Equal(t, int64(1), restarted.numDbs)
+	rdb1, err := restarted.GetDb("testdb1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rdb1.numTables)
+
+	rtbl1, err := rdb1.GetTable("tbl1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), rtbl1.numRows)
+	assert.Equal(t, int64(2), rtbl1.numCols)
+	assert.Equal(t, []int64{0, 2}, rtbl1.deletes.toSlice())
+	assert.Equal(t, []int64{1, 2, 3, 4, 5, 6}, rtbl1.cols["col1"].data[:6])
+	assert.Equal(t, []int64{1, 40, 9, 16, 25, 36}, rtbl1.cols["col2"].data[:6])
+
+	// the replayed state keeps logging new operations
+	assert.NoError(t, rtbl1.InsertRow([]string{"col1", "col2"}, []int64{7, 49}))
+	again := startManager(t, dir)
+	adb1, err := again.GetDb("testdb1")
+	assert.NoError(t, err)
+	atbl1, err := adb1.GetTable("tbl1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), atbl1.numRows)
+}
+
+func TestWalCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	manager := startManager(t, dir)
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	_, err = tbl1.CreateColumn("col1")
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.InsertRow([]string{"col1"}, []int64{1}))
+
+	assert.NoError(t, manager.Save())
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+
+	assert.NoError(t, tbl1.InsertRow([]string{"col1"}, []int64{2}))
+
+	restarted := startManager(t, dir)
+	rdb1, err := restarted.GetDb("testdb1")
+	assert.NoError(t, err)
+	rtbl1, err := rdb1.GetTable("tbl1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), rtbl1.numRows)
+	assert.Equal(t, []int64{1, 2}, rtbl1.cols["col1"].data[:2])
+	assert.Equal(t, int64(5), restarted.wal.lastLsn())
+}
+
+func TestWalSkipsRecordsCoveredBySnapshot(t *testing.T) {
+	dir := t.TempDir()
+	manager := startManager(t, dir)
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	_, err = tbl1.CreateColumn("col1")
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.InsertRow([]string{"col1"}, []int64{1}))
+
+	// a crash between writing the snapshot and truncating the log leaves
+	// records behind that the snapshot already covers
+	manager.lock.Lock()
+	err = writeSnapshot(dir, manager.dbs, manager.wal.lastLsn())
+	manager.lock.Unlock()
+	assert.NoError(t, err)
+
+	restarted := startManager(t, dir)
+	rdb1, err := restarted.GetDb("testdb1")
+	assert.NoError(t, err)
+	rtbl1, err := rdb1.GetTable("tbl1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rtbl1.numRows)
+}
+
+func TestWalTornTail(t *testing.T) {
+	dir := t.TempDir()
+	manager := startManager(t, dir)
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	_, err = tbl1.CreateColumn("col1")
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.InsertRow([]string{"col1"}, []int64{1}))
+
+	path := filepath.Join(dir, walFileName)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	goodSize := info.Size()
+
+	// a partially written record at the end of the log
+	torn := tbl1.record(walInsertRow, []string{"col1"}, []int64{2})
+	torn.lsn = 5
+	buf := torn.encode()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.NoError(t, err)
+	_, err = f.Write(buf[:len(buf)-3])
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	restarted := startManager(t, dir)
+	rdb1, err := restarted.GetDb("testdb1")
+	assert.NoError(t, err)
+	rtbl1, err := rdb1.GetTable("tbl1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rtbl1.numRows)
+
+	info, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, goodSize, info.Size())
+}
+
+func TestWalGroupCommit(t *testing.T) {
+	for _, mode := range []WalSyncMode{WalSyncAlways, WalSyncGroup, WalSyncNone} {
+		t.Run(fmt.Sprintf("mode %d", mode), func(t *testing.T) {
+			dir := t.TempDir()
+			manager := startManager(t, dir, WithWalSync(mode))
+
+			db1, err := manager.CreateDb("testdb1")
+			assert.NoError(t, err)
+			tbl1, err := db1.CreateTable("tbl1")
+			assert.NoError(t, err)
+			_, err = tbl1.CreateColumn("col1")
+			assert.NoError(t, err)
+
+			var wg sync.WaitGroup
+			for i := range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := range 25 {
+						assert.NoError(t, tbl1.InsertRow([]string{"col1"}, []int64{int64(i*100 + j)}))
+					}
+				}()
+			}
+			wg.Wait()
+
+			restarted := startManager(t, dir)
+			rdb1, err := restarted.GetDb("testdb1")
+			assert.NoError(t, err)
+			rtbl1, err := rdb1.GetTable("tbl1")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(200), rtbl1.numRows)
+			assert.ElementsMatch(t, tbl1.cols["col1"].data[:200], rtbl1.cols["col1"].data[:200])
+		})
+	}
+}
+
+func TestWalClosedAfterEnd(t *testing.T) {
+	manager := startManager(t, t.TempDir())
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	col1, err := tbl1.CreateColumn("col1")
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.InsertRow([]string{"col1"}, []int64{1}))
+	assert.NoError(t, manager.End())
+
+	_, err = db1.CreateTable("tbl2")
+	assert.ErrorIs(t, err, errWalClosed)
+
+	// writes the log rejects are never applied
+	assert.ErrorIs(t, tbl1.InsertRow([]string{"col1"}, []int64{2}), errWalClosed)
+	assert.ErrorIs(t, tbl1.InsertRows([]string{"col1"}, [][]int64{{2}, {3}}), errWalClosed)
+	assert.ErrorIs(t, tbl1.LoadColumns([]string{"col1"}, []int64{4}), errWalClosed)
+	assert.Equal(t, int64(1), tbl1.numRows)
+	assert.Equal(t, int64(1), col1.numItems)
+	assert.Equal(t, int64(1), col1.data[0])
+
+	_, err = manager.CreateDb("testdb2")
+	assert.ErrorIs(t, err, errWalClosed)
+	_, err = tbl1.CreateColumn("col2")
+	assert.ErrorIs(t, err, errWalClosed)
+	assert.ErrorIs(t, tbl1.DeleteRows([]int64{0}), errWalClosed)
+	_, err = tbl1.DeleteMatching(tbl1.Not(NewCondition()))
+	assert.ErrorIs(t, err, errWalClosed)
+	assert.ErrorIs(t, tbl1.DeleteColumn("col1"), errWalClosed)
+	assert.ErrorIs(t, tbl1.DeleteColumns(), errWalClosed)
+	assert.ErrorIs(t, db1.DeleteTable("tbl1"), errWalClosed)
+	assert.ErrorIs(t, db1.DeleteTables(), errWalClosed)
+	assert.ErrorIs(t, manager.DeleteDb("testdb1"), errWalClosed)
+	assert.Equal(t, []string{"testdb1"}, manager.DbNames())
+	assert.Equal(t, []string{"tbl1"}, db1.TableNames())
+	assert.Equal(t, int64(1), tbl1.numCols)
+	assert.Equal(t, int64(1), tbl1.Stats().LiveRows)
+}
+
+func TestWalStaleHandles(t *testing.T) {
+	dir := t.TempDir()
+	manager := startManager(t, dir)
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	assert.NoError(t, tbl1.LoadColumns([]string{"col1"}, []int64{1}))
+	assert.NoError(t, db1.DeleteTable("tbl1"))
+
+	// writes through a deleted table fail before they are logged, even
+	// once a new table takes its name
+	assert.ErrorIs(t, tbl1.LoadColumns([]string{"col1"}, []int64{2}), ErrNotExist)
+	_, err = tbl1.CreateColumn("col2")
+	assert.ErrorIs(t, err, ErrNotExist)
+	tbl2, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, tbl1.LoadColumns([]string{"col1"}, []int64{3}), ErrNotExist)
+	assert.NoError(t, tbl2.LoadColumns([]string{"col1"}, []int64{4}))
+
+	// and so do writes through a deleted db and its tables
+	assert.NoError(t, manager.DeleteDb("testdb1"))
+	_, err = db1.CreateTable("tbl2")
+	assert.ErrorIs(t, err, ErrNotExist)
+	assert.ErrorIs(t, db1.DeleteTables(), ErrNotExist)
+	assert.ErrorIs(t, tbl2.LoadColumns([]string{"col1"}, []int64{5}), ErrNotExist)
+	_, err = manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, tbl2.DeleteRows([]int64{0}), ErrNotExist)
+
+	// the log replays without the rejected writes
+	restarted := startManager(t, dir)
+	d, err := restarted.GetDb("testdb1")
+	assert.NoError(t, err)
+	assert.Empty(t, d.TableNames())
+	assert.NoError(t, restarted.End())
+}
+
+func TestWalReplayTypedColumns(t *testing.T) {
+	dir := t.TempDir()
+	manager := startManager(t, dir)
+	ts := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	db1, err := manager.CreateDb("testdb1")
+	assert.NoError(t, err)
+	tbl1, err := db1.CreateTable("tbl1")
+	assert.NoError(t, err)
+	_, err = tbl1.CreateTypedColumn("name", TypeString)
+	assert.NoError(t, err)
+	_, err = tbl1.CreateTypedColumn("at", TypeTimestamp)
+	assert.NoError(t, err)
+
+	err = tbl1.LoadValues([]string{"name", "at", "score"},
+		[]Value{StringValue("a"), StringValue("b")},
+		[]Value{TimestampValue(ts), TimestampValue(ts.Add(time.Hour))},
+		[]Value{Float64Value(0.5), Float64Value(-0.5)})
+	assert.NoError(t, err)
+	err = tbl1.InsertValues([]string{"name", "at", "score"}, []Value{StringValue("a"), TimestampValue(ts), Float64Value(2)})
+	assert.NoError(t, err)
+	err = tbl1.InsertValues([]string{"name", "at", "score"}, []Value{NullValue(), TimestampValue(ts), Float64Value(5)})
+	assert.NoError(t, err)
+
+	restarted := startManager(t, dir)
+	rdb1, err := restarted.GetDb("testdb1")
+	assert.NoError(t, err)
+	rtbl1, err := rdb1.GetTable("tbl1")
+	assert.NoError(t, err)
+
+	c, err := rtbl1.SelectValues(rtbl1.cols["score"], Float64Value(-1), Float64Value(3))
+	assert.NoError(t, err)
+	nulls, err := rtbl1.SelectNull(rtbl1.cols["name"])
+	assert.NoError(t, err)
+	c.Or(nulls)
+	assert.NoError(t, err)
+	res, err := rtbl1.GetValues(c, []*column{rtbl1.cols["name"], rtbl1.cols["at"], rtbl1.cols["score"]})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Value{
+		{StringValue("a"), StringValue("b"), StringValue("a"), NullValue()},
+		{TimestampValue(ts), TimestampValue(ts.Add(time.Hour)), TimestampValue(ts), TimestampValue(ts)},
+		{Float64Value(0.5), Float64Value(-0.5), Float64Value(2), Float64Value(5)},
+	}, res)
+
+	// the typed state also survives a checkpoint
+	assert.NoError(t, restarted.End())
+	again := startManager(t, dir)
+	adb1, err := again.GetDb("testdb1")
+	assert.NoError(t, err)
+	atbl1, err := adb1.GetTable("tbl1")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeString, atbl1.cols["name"].typ)
+	assert.Equal(t, []string{"a", "b"}, atbl1.cols["name"].dict)
+	assert.Equal(t, int64(1), atbl1.cols["name"].NullCount())
+	assert.NoError(t, atbl1.InsertValues([]string{"name", "at", "score"}, []Value{StringValue("c"), TimestampValue(ts), Float64Value(1)}))
+	assert.Equal(t, int64(2), atbl1.cols["name"].data[4])
+	assert.Equal(t, int64(1), atbl1.cols["name"].NullCount())
+}
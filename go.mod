@@ -4,12 +4,12 @@ go 1.23.6
 
 require (
 	github.com/stretchr/testify v1.8.1
+	go.uber.org/multierr v1.10.0
 	go.uber.org/zap v1.27.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	go.uber.org/multierr v1.10.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,354 @@
+// Package httpapi exposes a db.Manager as a JSON REST API:
+//
+//	GET    /dbs                               list databases
+//	PUT    /dbs/{db}                          create a database
+//	GET    /dbs/{db}                          list the tables of a database
+//	DELETE /dbs/{db}                          drop a database
+//	PUT    /dbs/{db}/tables/{table}           create a table, with an optional schema
+//	GET    /dbs/{db}/tables/{table}           describe a table
+//	DELETE /dbs/{db}/tables/{table}           drop a table
+//	POST   /dbs/{db}/tables/{table}/rows      insert rows or load columns
+//	DELETE /dbs/{db}/tables/{table}/rows      delete the rows matching a condition
+//	POST   /dbs/{db}/tables/{table}/query     read the rows matching a condition
+//
+// Request and response bodies are JSON objects. Errors are answered with
+// {"error": "..."} and status 404 for a database, table or column that does
+// not exist, 409 for one that already exists, 400 for a malformed request,
+// a value that violates a column constraint or a write the table rejects as
+// invalid, and 500 otherwise.
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/moh-osman3/MoDb/db"
+	"go.uber.org/zap"
+)
+
+// maxBodySize bounds the size of a request body.
+const maxBodySize = 32 << 20
+
+// table is the part of the table API the handler uses.
+type table interface {
+	ColumnNames() []string
+	ColumnType(colName string) (db.ColumnType, error)
+	Schema() *db.Schema
+	Stats() db.TableStats
+	InsertValueRows(colNames []string, rows [][]db.Value) error
+	LoadValues(colNames []string, cols ...[]db.Value) error
+	Query(f db.Filter, colNames []string) (*db.Result, error)
+	DeleteWhere(f db.Filter) (int64, error)
+}
+
+type handler struct {
+	dbm    db.Manager
+	logger *zap.Logger
+	mux    *http.ServeMux
+}
+
+// NewHandler returns a handler serving the REST API for dbm.
+func NewHandler(dbm db.Manager, logger *zap.Logger) http.Handler {
+	h := &handler{dbm: dbm, logger: logger, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /dbs", h.listDbs)
+	h.mux.HandleFunc("PUT /dbs/{db}", h.createDb)
+	h.mux.HandleFunc("GET /dbs/{db}", h.listTables)
+	h.mux.HandleFunc("DELETE /dbs/{db}", h.dropDb)
+	h.mux.HandleFunc("PUT /dbs/{db}/tables/{table}", h.createTable)
+	h.mux.HandleFunc("GET /dbs/{db}/tables/{table}", h.describeTable)
+	h.mux.HandleFunc("DELETE /dbs/{db}/tables/{table}", h.dropTable)
+	h.mux.HandleFunc("POST /dbs/{db}/tables/{table}/rows", h.insertRows)
+	h.mux.HandleFunc("DELETE /dbs/{db}/tables/{table}/rows", h.deleteRows)
+	h.mux.HandleFunc("POST /dbs/{db}/tables/{table}/query", h.query)
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// requestError is an error in a request that could not be parsed or is
+// invalid, answered with 400 Bad Request.
+type requestError struct {
+	err error
+}
+
+func badRequest(err error) error {
+	return &requestError{err: err}
+}
+
+func badRequestf(format string, args ...any) error {
+	return badRequest(fmt.Errorf(format, args...))
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// statusCode maps an error to the status it is answered with. Errors not
+// known to be caused by the request, such as a failing write-ahead log,
+// are server errors.
+func statusCode(err error) int {
+	var reqErr *requestError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, db.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &reqErr), errors.Is(err, db.ErrConstraint), errors.Is(err, db.ErrInvalidArgument):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.logger.Warn("cannot write response", zap.Error(err))
+	}
+}
+
+func (h *handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := statusCode(err)
+	if status == http.StatusInternalServerError {
+		h.logger.Error("request failed", zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Error(err))
+	}
+	h.writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// readJSON decodes the request body into v, rejecting unknown fields. An
+// empty body leaves v unchanged if optional.
+func readJSON(w http.ResponseWriter, r *http.Request, v any, optional bool) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			if optional {
+				return nil
+			}
+			return badRequestf("invalid request body: empty")
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return err
+		}
+		return badRequestf("invalid request body: %v", err)
+	}
+	if dec.More() {
+		return badRequestf("invalid request body: more than one JSON value")
+	}
+	return nil
+}
+
+func (h *handler) table(r *http.Request) (table, error) {
+	d, err := h.dbm.GetDb(r.PathValue("db"))
+	if err != nil {
+		return nil, err
+	}
+	tbl, err := d.GetTable(r.PathValue("table"))
+	if err != nil {
+		return nil, err
+	}
+	return tbl, nil
+}
+
+func (h *handler) listDbs(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, dbsResponse{Dbs: h.dbm.DbNames()})
+}
+
+func (h *handler) createDb(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.dbm.CreateDb(r.PathValue("db")); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *handler) listTables(w http.ResponseWriter, r *http.Request) {
+	d, err := h.dbm.GetDb(r.PathValue("db"))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, tablesResponse{Tables: d.TableNames()})
+}
+
+func (h *handler) dropDb(w http.ResponseWriter, r *http.Request) {
+	if err := h.dbm.DeleteDb(r.PathValue("db")); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) createTable(w http.ResponseWriter, r *http.Request) {
+	var req createTableRequest
+	if err := readJSON(w, r, &req, true); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	var opts []db.TableOption
+	if len(req.Columns) > 0 || len(req.PrimaryKey) > 0 || len(req.Unique) > 0 {
+		schema, err := req.schema()
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		opts = append(opts, db.WithSchema(schema))
+	}
+
+	d, err := h.dbm.GetDb(r.PathValue("db"))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if _, err := d.CreateTable(r.PathValue("table"), opts...); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *handler) describeTable(w http.ResponseWriter, r *http.Request) {
+	tbl, err := h.table(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	stats := tbl.Stats()
+	resp := describeResponse{LiveRows: stats.LiveRows, DeletedRows: stats.DeletedRows, Columns: []columnStats{}}
+	if schema := tbl.Schema(); schema != nil {
+		resp.Schema = schema.String()
+	}
+	for _, col := range stats.Columns {
+		resp.Columns = append(resp.Columns, columnStats{Name: col.Name, Type: col.Type.String(), NullCount: col.NullCount})
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) dropTable(w http.ResponseWriter, r *http.Request) {
+	d, err := h.dbm.GetDb(r.PathValue("db"))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if err := d.DeleteTable(r.PathValue("table")); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// insertRows appends "rows" like InsertRow, or replaces the contents of the
+// table with the columns in "load" like LoadColumns.
+func (h *handler) insertRows(w http.ResponseWriter, r *http.Request) {
+	var req rowsRequest
+	if err := readJSON(w, r, &req, false); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	tbl, err := h.table(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if (req.Rows == nil) == (req.Load == nil) {
+		h.writeError(w, r, badRequestf("invalid request body: give exactly one of rows and load"))
+		return
+	}
+
+	if req.Rows != nil {
+		rows, err := rowValues(tbl, req.Columns, req.Rows)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		if err := tbl.InsertValueRows(req.Columns, rows); err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, countResponse{RowsAffected: int64(len(rows))})
+		return
+	}
+
+	cols, err := columnValues(tbl, req.Columns, req.Load)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if err := tbl.LoadValues(req.Columns, cols...); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	var numRows int64
+	if len(cols) > 0 {
+		numRows = int64(len(cols[0]))
+	}
+	h.writeJSON(w, http.StatusOK, countResponse{RowsAffected: numRows})
+}
+
+func (h *handler) deleteRows(w http.ResponseWriter, r *http.Request) {
+	var req deleteRequest
+	if err := readJSON(w, r, &req, false); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if req.Where == nil {
+		h.writeError(w, r, badRequestf(`invalid request body: missing where, use {"and": []} to delete every row`))
+		return
+	}
+	tbl, err := h.table(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	f, err := req.Where.filter(tbl)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	numDeleted, err := tbl.DeleteWhere(f)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, countResponse{RowsAffected: numDeleted})
+}
+
+func (h *handler) query(w http.ResponseWriter, r *http.Request) {
+	var req queryRequest
+	if err := readJSON(w, r, &req, true); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	tbl, err := h.table(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	f := db.And()
+	if req.Where != nil {
+		if f, err = req.Where.filter(tbl); err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+	}
+	res, err := tbl.Query(f, req.Columns)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, newQueryResponse(res))
+}
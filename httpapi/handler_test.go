@@ -0,0 +1,251 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func startServer(t *testing.T) *httptest.Server {
+	dbm := db.NewDefaultManager(zap.NewNop())
+	require.NoError(t, dbm.Start(context.Background()))
+	srv := httptest.NewServer(NewHandler(dbm, zap.NewNop()))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// do sends a request and returns the status and the body of the response.
+func do(t *testing.T, srv *httptest.Server, method, path, body string) (int, string) {
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+func TestHandler(t *testing.T) {
+	srv := startServer(t)
+
+	status, _ := do(t, srv, "PUT", "/dbs/shop", "")
+	assert.Equal(t, http.StatusCreated, status)
+	status, body := do(t, srv, "PUT", "/dbs/shop", "")
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, `{"error":"Can't create db with name shop: Db already exists"}`, body)
+
+	status, _ = do(t, srv, "PUT", "/dbs/shop/tables/items", `{
+		"columns": [
+			{"name": "id", "type": "int64", "notNull": true},
+			{"name": "name", "type": "string"},
+			{"name": "price", "type": "float64", "default": 1.5},
+			{"name": "added", "type": "timestamp"}
+		],
+		"primaryKey": ["id"]
+	}`)
+	assert.Equal(t, http.StatusCreated, status)
+	status, _ = do(t, srv, "PUT", "/dbs/shop/tables/items", "")
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, body = do(t, srv, "POST", "/dbs/shop/tables/items/rows", `{
+		"columns": ["id", "name", "price", "added"],
+		"rows": [
+			[1, "fig", 2.5, "2024-01-02T03:04:05Z"],
+			[2, "kiwi", null, null],
+			[3, null, 10, null]
+		]
+	}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"rowsAffected":3}`, body)
+	status, body = do(t, srv, "POST", "/dbs/shop/tables/items/rows", `{"columns": ["id"], "rows": [[4]]}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	t.Run("list", func(t *testing.T) {
+		status, body := do(t, srv, "GET", "/dbs", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, `{"dbs":["shop"]}`, body)
+		status, body = do(t, srv, "GET", "/dbs/shop", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, `{"tables":["items"]}`, body)
+
+		status, body = do(t, srv, "GET", "/dbs/shop/tables/items", "")
+		assert.Equal(t, http.StatusOK, status)
+		var resp describeResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &resp))
+		assert.Equal(t, int64(4), resp.LiveRows)
+		assert.Contains(t, resp.Schema, "PRIMARY KEY (id)")
+		assert.Contains(t, resp.Columns, columnStats{Name: "name", Type: "string", NullCount: 2})
+	})
+
+	t.Run("query", func(t *testing.T) {
+		status, body := do(t, srv, "POST", "/dbs/shop/tables/items/query", `{
+			"where": {"or": [
+				{"col": "price", "op": "<", "value": 5},
+				{"col": "name", "op": "IS NULL"}
+			]},
+			"columns": ["id", "name", "price", "added"]
+		}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{
+			"columns": ["id", "name", "price", "added"],
+			"types": ["int64", "string", "float64", "timestamp"],
+			"rows": [[1, "fig", 2.5, "2024-01-02T03:04:05Z"], [3, null, 10, null], [4, null, 1.5, null]],
+			"count": 3
+		}`, body)
+
+		status, body = do(t, srv, "POST", "/dbs/shop/tables/items/query", `{
+			"where": {"not": {"col": "id", "op": "between", "values": [2, 3]}},
+			"columns": ["id"]
+		}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"columns": ["id"], "types": ["int64"], "rows": [[1], [4]], "count": 2}`, body)
+
+		// without a body every row matches
+		status, body = do(t, srv, "POST", "/dbs/shop/tables/items/query", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, `"count":4`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			method string
+			path   string
+			body   string
+			status int
+			err    string
+		}{
+			{"missing db", "GET", "/dbs/other", "", http.StatusNotFound, "Cannot get db with name other: does not exist"},
+			{"missing table", "POST", "/dbs/shop/tables/other/query", "", http.StatusNotFound, "Cannot get table with name other: does not exist"},
+			{"missing column", "POST", "/dbs/shop/tables/items/query", `{"where": {"col": "other", "op": "=", "value": 1}}`, http.StatusNotFound, "Cannot get column with name other: does not exist"},
+			{"unknown field", "POST", "/dbs/shop/tables/items/query", `{"filter": {}}`, http.StatusBadRequest, `invalid request body: json: unknown field "filter"`},
+			{"wrong type", "POST", "/dbs/shop/tables/items/query", `{"where": {"col": "id", "op": "=", "value": "x"}}`, http.StatusBadRequest, `column id has type int64: cannot use "x"`},
+			{"unknown op", "POST", "/dbs/shop/tables/items/query", `{"where": {"col": "id", "op": "like"}}`, http.StatusBadRequest, `invalid condition on column id: unknown op "like"`},
+			{"ambiguous condition", "POST", "/dbs/shop/tables/items/query", `{"where": {"col": "id", "and": []}}`, http.StatusBadRequest, "invalid condition: give exactly one of col, and, or and not"},
+			{"between", "POST", "/dbs/shop/tables/items/query", `{"where": {"col": "id", "op": "between", "values": [1]}}`, http.StatusBadRequest, "invalid condition on column id: between takes 2 values, got 1"},
+			{"rows and load", "POST", "/dbs/shop/tables/items/rows", `{"columns": ["id"]}`, http.StatusBadRequest, "invalid request body: give exactly one of rows and load"},
+			{"short row", "POST", "/dbs/shop/tables/items/rows", `{"columns": ["id", "name"], "rows": [[5]]}`, http.StatusBadRequest, "invalid request body: 2 columns but row 1 has 1 values"},
+			{"duplicate key", "POST", "/dbs/shop/tables/items/rows", `{"columns": ["id"], "rows": [[1]]}`, http.StatusBadRequest, "duplicate"},
+			{"not null", "POST", "/dbs/shop/tables/items/rows", `{"columns": ["id", "name"], "rows": [[null, "x"]]}`, http.StatusBadRequest, "column id violates NOT NULL constraint"},
+			{"repeated column", "POST", "/dbs/shop/tables/items/rows", `{"columns": ["id", "id"], "rows": [[7, 8]]}`, http.StatusBadRequest, "invalid request body: column id given more than once"},
+			{"empty body", "DELETE", "/dbs/shop/tables/items/rows", "", http.StatusBadRequest, "invalid request body: empty"},
+			{"missing where", "DELETE", "/dbs/shop/tables/items/rows", "{}", http.StatusBadRequest, "invalid request body: missing where"},
+			{"invalid schema", "PUT", "/dbs/shop/tables/bad", `{"columns": [{"name": "id", "type": "decimal"}]}`, http.StatusBadRequest, "Invalid schema: column id"},
+			{"method", "PATCH", "/dbs/shop", "", http.StatusMethodNotAllowed, ""},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				status, body := do(t, srv, tt.method, tt.path, tt.body)
+				assert.Equal(t, tt.status, status)
+				if tt.err != "" {
+					var resp errorResponse
+					require.NoError(t, json.Unmarshal([]byte(body), &resp))
+					assert.Contains(t, resp.Error, tt.err)
+				}
+			})
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		status, body := do(t, srv, "DELETE", "/dbs/shop/tables/items/rows", `{"where": {"col": "name", "op": "in", "values": ["fig", "kiwi"]}}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, `{"rowsAffected":2}`, body)
+		status, body = do(t, srv, "DELETE", "/dbs/shop/tables/items/rows", `{"where": {"and": []}}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, `{"rowsAffected":2}`, body)
+
+		status, _ = do(t, srv, "DELETE", "/dbs/shop/tables/items", "")
+		assert.Equal(t, http.StatusNoContent, status)
+		status, _ = do(t, srv, "DELETE", "/dbs/shop/tables/items", "")
+		assert.Equal(t, http.StatusNotFound, status)
+		status, _ = do(t, srv, "DELETE", "/dbs/shop", "")
+		assert.Equal(t, http.StatusNoContent, status)
+		status, _ = do(t, srv, "DELETE", "/dbs/shop", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+}
+
+func TestLoad(t *testing.T) {
+	srv := startServer(t)
+	do(t, srv, "PUT", "/dbs/shop", "")
+	do(t, srv, "PUT", "/dbs/shop/tables/items", "")
+
+	status, body := do(t, srv, "POST", "/dbs/shop/tables/items/rows", `{
+		"columns": ["id", "price", "name", "sold"],
+		"load": [[1, 2, 3], [2.5, 1e300, null], ["fig", "kiwi", "pear"], [true, false, null]]
+	}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"rowsAffected":3}`, body)
+
+	status, body = do(t, srv, "POST", "/dbs/shop/tables/items/query", `{"where": {"col": "sold", "op": "=", "value": true}}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{
+		"columns": ["id", "name", "price", "sold"],
+		"types": ["int64", "string", "float64", "bool"],
+		"rows": [[1, "fig", 2.5, true]],
+		"count": 1
+	}`, body)
+
+	status, body = do(t, srv, "POST", "/dbs/shop/tables/items/rows", `{"columns": ["id"], "load": [[{"a": 1}]]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, `column id has type int64: cannot use {\"a\":1}`)
+	status, body = do(t, srv, "POST", "/dbs/shop/tables/items/rows", `{"columns": ["id", "name"], "load": [[1]]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "invalid request body: 2 columns but load has 1")
+	status, body = do(t, srv, "POST", "/dbs/shop/tables/items/rows", `{"columns": ["id", "name"], "load": [[1, 2], ["fig"]]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "invalid request body: column name has 1 values but column id has 2")
+	status, body = do(t, srv, "POST", "/dbs/shop/tables/items/rows", `{"columns": ["id", "new"], "load": [[], []]}`)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Contains(t, body, "Cannot get column with name new: does not exist")
+	status, body = do(t, srv, "POST", "/dbs/shop/tables/items/rows", `{"columns": ["id", "x"], "load": [[4], [5]]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "inconsistent column lengths with existing columns")
+	status, body = do(t, srv, "POST", "/dbs/shop/tables/items/rows", `{"columns": ["y"], "load": [[null]]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "cannot infer type of new column y")
+}
+
+func TestServerError(t *testing.T) {
+	dbm := db.NewDefaultManager(zap.NewNop(), db.WithDataDir(t.TempDir()))
+	require.NoError(t, dbm.Start(context.Background()))
+	srv := httptest.NewServer(NewHandler(dbm, zap.NewNop()))
+	t.Cleanup(srv.Close)
+
+	status, _ := do(t, srv, "PUT", "/dbs/shop", "")
+	assert.Equal(t, http.StatusCreated, status)
+	require.NoError(t, dbm.End())
+
+	// the write-ahead log is closed, which is no fault of the request
+	status, body := do(t, srv, "PUT", "/dbs/other", "")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Contains(t, body, "write-ahead log is closed")
+}
+
+func TestJSONValue(t *testing.T) {
+	assert.Nil(t, jsonValue(db.NullValue()))
+	assert.Equal(t, "NaN", jsonValue(db.Float64Value(nan())))
+	assert.Equal(t, int64(7), jsonValue(db.Int64Value(7)))
+
+	val, err := dbValue("n", db.TypeInt64, json.Number("1.5"))
+	assert.EqualError(t, err, "column n has type int64: cannot use 1.5")
+	assert.Equal(t, db.Value{}, val)
+	val, err = inferValue("n", json.Number("1.5"))
+	assert.NoError(t, err)
+	assert.Equal(t, db.Float64Value(1.5), val)
+}
+
+func nan() float64 {
+	var zero float64
+	return zero / zero
+}
@@ -0,0 +1,390 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/moh-osman3/MoDb/db"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type dbsResponse struct {
+	Dbs []string `json:"dbs"`
+}
+
+type tablesResponse struct {
+	Tables []string `json:"tables"`
+}
+
+type countResponse struct {
+	RowsAffected int64 `json:"rowsAffected"`
+}
+
+// columnDef declares a column of a table schema, e.g.
+// {"name": "id", "type": "int64", "notNull": true}.
+type columnDef struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	NotNull bool   `json:"notNull"`
+	Default any    `json:"default"`
+}
+
+type createTableRequest struct {
+	Columns    []columnDef `json:"columns"`
+	PrimaryKey []string    `json:"primaryKey"`
+	Unique     [][]string  `json:"unique"`
+}
+
+func (req *createTableRequest) schema() (*db.Schema, error) {
+	defs := make([]db.ColumnDef, len(req.Columns))
+	for i, col := range req.Columns {
+		typ, err := db.ParseColumnType(col.Type)
+		if err != nil {
+			return nil, badRequestf("Invalid schema: column %s: %v", col.Name, err)
+		}
+		defs[i] = db.NewColumnDef(col.Name, typ)
+		if col.NotNull {
+			defs[i] = defs[i].NotNull()
+		}
+		if col.Default != nil {
+			val, err := dbValue(col.Name, typ, col.Default)
+			if err != nil {
+				return nil, badRequestf("Invalid schema: default of %v", err)
+			}
+			defs[i] = defs[i].Default(val)
+		}
+	}
+
+	schema, err := db.NewSchema(defs...)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	if len(req.PrimaryKey) > 0 {
+		if schema, err = schema.PrimaryKey(req.PrimaryKey...); err != nil {
+			return nil, badRequest(err)
+		}
+	}
+	for _, cols := range req.Unique {
+		if schema, err = schema.Unique(cols...); err != nil {
+			return nil, badRequest(err)
+		}
+	}
+	return schema, nil
+}
+
+type columnStats struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	NullCount int64  `json:"nullCount"`
+}
+
+type describeResponse struct {
+	Schema      string        `json:"schema,omitempty"`
+	LiveRows    int64         `json:"liveRows"`
+	DeletedRows int64         `json:"deletedRows"`
+	Columns     []columnStats `json:"columns"`
+}
+
+// rowsRequest holds either rows of values in the order of Columns or, in
+// Load, one array of values per column.
+type rowsRequest struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+	Load    [][]any  `json:"load"`
+}
+
+type deleteRequest struct {
+	Where *condition `json:"where"`
+}
+
+type queryRequest struct {
+	Where   *condition `json:"where"`
+	Columns []string   `json:"columns"`
+}
+
+type queryResponse struct {
+	Columns []string `json:"columns"`
+	Types   []string `json:"types"`
+	Rows    [][]any  `json:"rows"`
+	Count   int      `json:"count"`
+}
+
+func newQueryResponse(res *db.Result) *queryResponse {
+	resp := &queryResponse{Columns: res.Columns, Types: make([]string, len(res.Types)), Rows: make([][]any, len(res.Rows)), Count: len(res.Rows)}
+	for i, typ := range res.Types {
+		resp.Types[i] = typ.String()
+	}
+	for r, row := range res.Rows {
+		resp.Rows[r] = make([]any, len(row))
+		for i, val := range row {
+			resp.Rows[r][i] = jsonValue(val)
+		}
+	}
+	return resp
+}
+
+// condition is the JSON form of a db.Filter. Exactly one of Col, And, Or
+// and Not is set:
+//
+//	{"col": "price", "op": "<", "value": 10}
+//	{"col": "id", "op": "between", "values": [1, 5]}
+//	{"col": "name", "op": "in", "values": ["fig", "kiwi"]}
+//	{"col": "name", "op": "is null"}
+//	{"and": [...]}, {"or": [...]}, {"not": {...}}
+type condition struct {
+	Col    string       `json:"col"`
+	Op     string       `json:"op"`
+	Value  any          `json:"value"`
+	Values []any        `json:"values"`
+	And    []*condition `json:"and"`
+	Or     []*condition `json:"or"`
+	Not    *condition   `json:"not"`
+}
+
+var comparisons = map[string]func(db.Value) db.Predicate{
+	"=": db.Eq, "!=": db.Ne, "<": db.Lt, "<=": db.Le, ">": db.Gt, ">=": db.Ge,
+}
+
+// filter converts c into a filter on tbl, converting its values to the
+// types of the columns they are compared with.
+func (c *condition) filter(tbl table) (db.Filter, error) {
+	if c == nil {
+		return nil, badRequestf("invalid condition: null")
+	}
+	set := 0
+	for _, ok := range []bool{c.Col != "", c.And != nil, c.Or != nil, c.Not != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, badRequestf("invalid condition: give exactly one of col, and, or and not")
+	}
+
+	switch {
+	case c.And != nil, c.Or != nil:
+		operands := c.And
+		if c.Or != nil {
+			operands = c.Or
+		}
+		filters := make([]db.Filter, len(operands))
+		for i, operand := range operands {
+			var err error
+			if filters[i], err = operand.filter(tbl); err != nil {
+				return nil, err
+			}
+		}
+		if c.And != nil {
+			return db.And(filters...), nil
+		}
+		return db.Or(filters...), nil
+	case c.Not != nil:
+		operand, err := c.Not.filter(tbl)
+		if err != nil {
+			return nil, err
+		}
+		return db.Not(operand), nil
+	}
+
+	op := strings.ToLower(c.Op)
+	switch op {
+	case "is null":
+		return db.IsNull(c.Col), nil
+	case "is not null":
+		return db.IsNotNull(c.Col), nil
+	}
+	typ, err := tbl.ColumnType(c.Col)
+	if err != nil {
+		return nil, err
+	}
+	if newPred, ok := comparisons[op]; ok {
+		val, err := dbValue(c.Col, typ, c.Value)
+		if err != nil {
+			return nil, err
+		}
+		return db.Match(c.Col, newPred(val)), nil
+	}
+
+	vals := make([]db.Value, len(c.Values))
+	for i, v := range c.Values {
+		if vals[i], err = dbValue(c.Col, typ, v); err != nil {
+			return nil, err
+		}
+	}
+	switch op {
+	case "between":
+		if len(vals) != 2 {
+			return nil, badRequestf("invalid condition on column %s: between takes 2 values, got %d", c.Col, len(vals))
+		}
+		return db.Match(c.Col, db.Between(vals[0], vals[1])), nil
+	case "in":
+		return db.Match(c.Col, db.In(vals...)), nil
+	}
+	return nil, badRequestf("invalid condition on column %s: unknown op %q", c.Col, c.Op)
+}
+
+// jsonValue converts a value to its JSON form. Timestamps are RFC 3339
+// strings, and floats JSON cannot represent are strings like "NaN".
+func jsonValue(val db.Value) any {
+	if val.IsNull() {
+		return nil
+	}
+	switch val.Type() {
+	case db.TypeFloat64:
+		f := val.Float64()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return val.String()
+		}
+		return f
+	case db.TypeString:
+		return val.Str()
+	case db.TypeBool:
+		return val.Bool()
+	case db.TypeTimestamp:
+		return val.Time().UTC().Format(time.RFC3339Nano)
+	}
+	return val.Int64()
+}
+
+// dbValue converts a JSON value decoded with UseNumber to a value of the
+// type of column colName.
+func dbValue(colName string, typ db.ColumnType, v any) (db.Value, error) {
+	if v == nil {
+		return db.NullValue(), nil
+	}
+	switch typ {
+	case db.TypeInt64:
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				return db.Int64Value(i), nil
+			}
+		}
+	case db.TypeFloat64:
+		if n, ok := v.(json.Number); ok {
+			if f, err := n.Float64(); err == nil {
+				return db.Float64Value(f), nil
+			}
+		}
+	case db.TypeString:
+		if s, ok := v.(string); ok {
+			return db.StringValue(s), nil
+		}
+	case db.TypeBool:
+		if b, ok := v.(bool); ok {
+			return db.BoolValue(b), nil
+		}
+	case db.TypeTimestamp:
+		if s, ok := v.(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return db.TimestampValue(t), nil
+			}
+		}
+	}
+	encoded, _ := json.Marshal(v)
+	return db.Value{}, badRequestf("column %s has type %s: cannot use %s", colName, typ, encoded)
+}
+
+// inferValue converts a JSON value decoded with UseNumber to a value of
+// the type it looks like: integers to int64, other numbers to float64.
+func inferValue(colName string, v any) (db.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return db.NullValue(), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return db.Int64Value(i), nil
+		}
+		if f, err := v.Float64(); err == nil {
+			return db.Float64Value(f), nil
+		}
+	case string:
+		return db.StringValue(v), nil
+	case bool:
+		return db.BoolValue(v), nil
+	}
+	encoded, _ := json.Marshal(v)
+	return db.Value{}, badRequestf("column %s: cannot use %s as a value", colName, encoded)
+}
+
+// rowValues converts rows of JSON values to the types of the columns.
+func rowValues(tbl table, colNames []string, rows [][]any) ([][]db.Value, error) {
+	if err := checkColumnNames(colNames); err != nil {
+		return nil, err
+	}
+	types := make([]db.ColumnType, len(colNames))
+	for i, colName := range colNames {
+		var err error
+		if types[i], err = tbl.ColumnType(colName); err != nil {
+			return nil, err
+		}
+	}
+
+	res := make([][]db.Value, len(rows))
+	for r, row := range rows {
+		if len(row) != len(colNames) {
+			return nil, badRequestf("invalid request body: %d columns but row %d has %d values", len(colNames), r+1, len(row))
+		}
+		res[r] = make([]db.Value, len(row))
+		for i, v := range row {
+			var err error
+			if res[r][i], err = dbValue(colNames[i], types[i], v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// columnValues converts columns of JSON values to the types of the
+// existing columns. New columns get the type of their values.
+func columnValues(tbl table, colNames []string, cols [][]any) ([][]db.Value, error) {
+	if len(cols) != len(colNames) {
+		return nil, badRequestf("invalid request body: %d columns but load has %d", len(colNames), len(cols))
+	}
+	if err := checkColumnNames(colNames); err != nil {
+		return nil, err
+	}
+
+	res := make([][]db.Value, len(cols))
+	for i, col := range cols {
+		if len(col) != len(cols[0]) {
+			return nil, badRequestf("invalid request body: column %s has %d values but column %s has %d", colNames[i], len(col), colNames[0], len(cols[0]))
+		}
+		typ, typeErr := tbl.ColumnType(colNames[i])
+		if typeErr != nil && (tbl.Schema() != nil || len(col) == 0) {
+			// only tables without a schema take new columns, typed by
+			// their values
+			return nil, typeErr
+		}
+		res[i] = make([]db.Value, len(col))
+		for r, v := range col {
+			var err error
+			if typeErr == nil {
+				res[i][r], err = dbValue(colNames[i], typ, v)
+			} else {
+				res[i][r], err = inferValue(colNames[i], v)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// checkColumnNames rejects a column named more than once.
+func checkColumnNames(colNames []string) error {
+	seen := make(map[string]bool, len(colNames))
+	for _, name := range colNames {
+		if seen[name] {
+			return badRequestf("invalid request body: column %s given more than once", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Package netserver holds the listeners, connection tracking and graceful
+// shutdown shared by the servers of the server and pgwire packages, which
+// only add their wire protocol:
+//
+//	base := netserver.New(serveConn, admitConn)
+//	go base.Serve(l)
+//	...
+//	err := base.Shutdown(ctx)
+package netserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// DefaultMaxConnections is the number of connections a server serves at
+// once unless configured otherwise.
+const DefaultMaxConnections = 100
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown.
+var ErrServerClosed = errors.New("server closed")
+
+// ServeFunc serves a connection until it ends and closes it. ctx is
+// cancelled when Shutdown gives up waiting, which should abort the running
+// request.
+type ServeFunc func(ctx context.Context, netConn net.Conn)
+
+// AdmitFunc decides whether a new connection is served, given the number
+// of connections already being served. It runs with the server locked, so
+// it must not call back into the server other than through Go. A
+// connection it turns away is its to close.
+type AdmitFunc func(netConn net.Conn, numConns int) bool
+
+// Server accepts connections and serves each on a goroutine of its own
+// until Shutdown.
+type Server struct {
+	serve ServeFunc
+	admit AdmitFunc
+
+	// ctx is cancelled when Shutdown gives up waiting for connections.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lock      sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	// wg tracks the goroutines serving connections.
+	wg sync.WaitGroup
+}
+
+// New returns a server that serves connections with serve once admit, if
+// not nil, lets them in.
+func New(serve ServeFunc, admit AdmitFunc) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		serve:     serve,
+		admit:     admit,
+		ctx:       ctx,
+		cancel:    cancel,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections
+// until Shutdown.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Shutdown, which closes l. It always
+// returns a non-nil error, ErrServerClosed after Shutdown.
+func (s *Server) Serve(l net.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.listeners, l)
+		s.lock.Unlock()
+	}()
+
+	for {
+		netConn, err := l.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.track(netConn)
+	}
+}
+
+// track starts serving a new connection unless the server is shutting down
+// or admit turns it away.
+func (s *Server) track(netConn net.Conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		netConn.Close()
+		return
+	}
+	if s.admit != nil && !s.admit(netConn, len(s.conns)) {
+		return
+	}
+
+	s.conns[netConn] = struct{}{}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serve(s.ctx, netConn)
+
+		s.lock.Lock()
+		delete(s.conns, netConn)
+		s.lock.Unlock()
+	}()
+}
+
+// Go runs fn on a goroutine that Shutdown waits for, e.g. to tell a client
+// turned away by admit why.
+func (s *Server) Go(fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
+}
+
+// LiftReadDeadline clears the read deadline of a connection being served,
+// e.g. one set for its startup, unless Shutdown has begun and set a
+// deadline of its own.
+func (s *Server) LiftReadDeadline(netConn net.Conn) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrServerClosed
+	}
+	return netConn.SetReadDeadline(time.Time{})
+}
+
+// Shutdown stops the server gracefully. It closes the listeners, lets
+// every connection finish the request it is running and disconnects it:
+// idle connections waiting for a request return at once, busy ones after
+// answering theirs. If ctx ends first, the context passed to ServeFunc is
+// cancelled and the connections closed, and Shutdown returns the context's
+// error once they have returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return ErrServerClosed
+	}
+	s.closed = true
+
+	var errs error
+	for l := range s.listeners {
+		errs = multierr.Append(errs, l.Close())
+	}
+	for netConn := range s.conns {
+		netConn.SetReadDeadline(time.Now())
+	}
+	s.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = multierr.Append(errs, ctx.Err())
+		s.cancel()
+		s.lock.Lock()
+		for netConn := range s.conns {
+			netConn.Close()
+		}
+		s.lock.Unlock()
+		<-done
+	}
+	s.cancel()
+	return errs
+}
+
+// Addrs returns the addresses the server is listening on.
+func (s *Server) Addrs() []net.Addr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	addrs := make([]net.Addr, 0, len(s.listeners))
+	for l := range s.listeners {
+		addrs = append(addrs, l.Addr())
+	}
+	return addrs
+}
+
+// NumConnections returns the number of connections being served.
+func (s *Server) NumConnections() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.conns)
+}
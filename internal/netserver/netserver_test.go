@@ -0,0 +1,105 @@
+package netserver
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echo answers every line with itself until the connection ends.
+func echo(ctx context.Context, netConn net.Conn) {
+	defer netConn.Close()
+	r := bufio.NewReader(netConn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		netConn.Write([]byte(line))
+	}
+}
+
+func start(t *testing.T, s *Server) (string, chan error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(l)
+	}()
+	return l.Addr().String(), served
+}
+
+func roundTrip(t *testing.T, netConn net.Conn, line string) string {
+	_, err := netConn.Write([]byte(line + "\n"))
+	require.NoError(t, err)
+	resp, err := bufio.NewReader(netConn).ReadString('\n')
+	require.NoError(t, err)
+	return resp[:len(resp)-1]
+}
+
+func TestServer(t *testing.T) {
+	rejected := make(chan struct{})
+	var s *Server
+	s = New(echo, func(netConn net.Conn, numConns int) bool {
+		if numConns < 1 {
+			return true
+		}
+		s.Go(func() {
+			netConn.Close()
+			close(rejected)
+		})
+		return false
+	})
+	addr, served := start(t, s)
+
+	first, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer first.Close()
+	assert.Equal(t, "hi", roundTrip(t, first, "hi"))
+	assert.Equal(t, 1, s.NumConnections())
+	assert.Len(t, s.Addrs(), 1)
+
+	// admit turns away a second connection
+	second, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer second.Close()
+	<-rejected
+	assert.Equal(t, 1, s.NumConnections())
+
+	// Shutdown disconnects the idle connection
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+	assert.Equal(t, 0, s.NumConnections())
+	assert.ErrorIs(t, s.LiftReadDeadline(first), ErrServerClosed)
+	assert.ErrorIs(t, s.Shutdown(context.Background()), ErrServerClosed)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.Serve(l), ErrServerClosed)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	// a connection that ignores its read deadline until ctx is cancelled
+	started := make(chan struct{})
+	s := New(func(ctx context.Context, netConn net.Conn) {
+		defer netConn.Close()
+		close(started)
+		<-ctx.Done()
+	}, nil)
+	addr, _ := start(t, s)
+
+	netConn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer netConn.Close()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	assert.Equal(t, 0, s.NumConnections())
+}
@@ -0,0 +1,317 @@
+package pgwire
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/moh-osman3/MoDb/db"
+	"go.uber.org/zap"
+)
+
+// serverVersion is reported to clients, which use it to pick the features
+// they rely on.
+const serverVersion = "14.0"
+
+// SQLSTATE codes sent with errors.
+const (
+	stateUndefinedObject    = "42704"
+	stateDuplicateObject    = "42710"
+	stateSyntaxError        = "42601"
+	stateConstraint         = "23000"
+	stateQueryCanceled      = "57014"
+	stateFeatureUnsupported = "0A000"
+	stateProtocolViolation  = "08P01"
+	stateTooManyConnections = "53300"
+	stateAdminShutdown      = "57P01"
+	stateInternalError      = "XX000"
+)
+
+// conn serves the queries of one client connection in order.
+type conn struct {
+	srv     *Server
+	netConn net.Conn
+	logger  *zap.Logger
+	session *db.Session
+	w       *bufio.Writer
+	// processID and secretKey identify the session in cancel requests.
+	processID int32
+	secretKey int32
+	// discarding is set after an error in the extended query protocol,
+	// whose messages are skipped until the next Sync.
+	discarding bool
+
+	lock sync.Mutex
+	// cancel cancels the running statement, if any.
+	cancel context.CancelFunc
+}
+
+func newConn(srv *Server, netConn net.Conn) *conn {
+	return &conn{
+		srv:     srv,
+		netConn: netConn,
+		logger:  srv.logger.With(zap.Stringer("remote", netConn.RemoteAddr())),
+		session: srv.dbm.NewSession(),
+		w:       bufio.NewWriter(netConn),
+	}
+}
+
+// serve runs the startup handshake then answers messages until the client
+// terminates, the connection fails or the server shuts down.
+func (c *conn) serve(ctx context.Context) {
+	defer c.netConn.Close()
+
+	if !c.startup() {
+		return
+	}
+	c.logger.Debug("client connected", zap.Int32("process_id", c.processID))
+
+	r := bufio.NewReader(c.netConn)
+	for {
+		typ, body, err := readMessage(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed):
+				c.logger.Debug("client disconnected")
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				c.fatal(stateAdminShutdown, fmt.Errorf("terminating connection due to administrator command"))
+			default:
+				c.logger.Warn("closing connection", zap.Error(err))
+			}
+			return
+		}
+
+		switch typ {
+		case msgQuery:
+			sql, _, err := cString(body)
+			if err != nil {
+				c.send(errorResponse("ERROR", stateProtocolViolation, fmt.Errorf("invalid query message: %v", err)))
+			} else {
+				c.query(ctx, sql)
+			}
+			c.send(readyForQuery())
+		case msgTerminate:
+			c.logger.Debug("client disconnected")
+			return
+		case msgSync:
+			c.discarding = false
+			c.send(readyForQuery())
+		case msgParse, msgBind, msgDescribe, msgExecute, msgClose, msgFlush:
+			if !c.discarding {
+				c.send(errorResponse("ERROR", stateFeatureUnsupported,
+					fmt.Errorf("the extended query protocol is not supported: send queries without parameters")))
+				c.discarding = true
+			}
+		case msgFuncCall:
+			c.send(errorResponse("ERROR", stateFeatureUnsupported, fmt.Errorf("function calls are not supported")))
+			c.send(readyForQuery())
+		default:
+			c.fatal(stateProtocolViolation, fmt.Errorf("invalid frontend message type %q", typ))
+			return
+		}
+		if err := c.w.Flush(); err != nil {
+			c.logger.Warn("closing connection", zap.Error(err))
+			return
+		}
+	}
+}
+
+// startup reads startup packets until the client asks to start a session,
+// answering SSL and GSSAPI encryption requests with 'N' as the server only
+// speaks plain text. It reports whether the session started.
+func (c *conn) startup() bool {
+	st, err := readStartup(c.netConn)
+	for err == nil && (st.code == sslRequestCode || st.code == gssEncRequestCode) {
+		if _, err := c.netConn.Write([]byte{'N'}); err != nil {
+			return false
+		}
+		st, err = readStartup(c.netConn)
+	}
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			c.logger.Debug("invalid startup", zap.Error(err))
+			c.fatal(stateProtocolViolation, err)
+		}
+		return false
+	}
+	if st.code == cancelRequestCode {
+		c.srv.cancelQuery(st.processID, st.secretKey)
+		return false
+	}
+
+	if err := c.srv.register(c); err != nil {
+		code := stateTooManyConnections
+		if errors.Is(err, ErrServerClosed) {
+			code = stateAdminShutdown
+		}
+		c.fatal(code, err)
+		return false
+	}
+	if st.code != protocolVersion || len(st.unknownOptions) > 0 {
+		// carry on with 3.0 and without the options
+		m := newMessage(msgNegotiateProtocol).int32(0).int32(int32(len(st.unknownOptions)))
+		for _, opt := range st.unknownOptions {
+			m.string(opt)
+		}
+		c.send(m)
+	}
+	if dbName := st.params["database"]; dbName != "" {
+		// psql asks for the database named after the user by default
+		if err := c.session.Use(dbName); err != nil {
+			c.logger.Debug("not selecting a database", zap.Error(err))
+		}
+	}
+
+	c.send(newMessage(msgAuthentication).int32(0))
+	for _, param := range [][2]string{
+		{"server_version", serverVersion},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"TimeZone", "UTC"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+	} {
+		c.send(newMessage(msgParameterStatus).string(param[0]).string(param[1]))
+	}
+	c.send(newMessage(msgBackendKeyData).int32(c.processID).int32(c.secretKey))
+	c.send(readyForQuery())
+	if err := c.w.Flush(); err != nil {
+		c.logger.Warn("closing connection", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// query runs the statements of a simple query in order, stopping at the
+// first error. Unlike PostgreSQL, statements that succeeded before an
+// error are not rolled back.
+func (c *conn) query(ctx context.Context, sql string) {
+	stmts, err := db.SplitSQL(sql)
+	if err != nil {
+		c.send(errorResponse("ERROR", sqlState(err), err))
+		return
+	}
+	if len(stmts) == 0 {
+		c.send(newMessage(msgEmptyQuery))
+		return
+	}
+
+	for _, stmt := range stmts {
+		res, err := c.exec(ctx, stmt)
+		if err != nil {
+			c.send(errorResponse("ERROR", sqlState(err), err))
+			return
+		}
+		if len(res.Columns) > 0 {
+			c.send(rowDescription(res))
+			for _, row := range res.Rows {
+				c.send(dataRow(row))
+			}
+		}
+		c.send(newMessage(msgCommandComplete).string(commandTag(stmt, res)))
+	}
+}
+
+// exec runs a statement that cancel requests for the session can cancel.
+func (c *conn) exec(ctx context.Context, sql string) (*db.Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.lock.Lock()
+	c.cancel = cancel
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		c.cancel = nil
+		c.lock.Unlock()
+	}()
+
+	res, err := c.session.Exec(ctx, sql)
+	if errors.Is(err, context.Canceled) {
+		return nil, fmt.Errorf("canceling statement due to user request: %w", err)
+	}
+	return res, err
+}
+
+func (c *conn) cancelQuery() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// send buffers a message, which serve flushes once the message it answers
+// is handled. Write errors resurface on flush.
+func (c *conn) send(m *message) {
+	c.w.Write(m.bytes())
+}
+
+// fatal reports an error that ends the connection.
+func (c *conn) fatal(code string, err error) {
+	c.send(errorResponse("FATAL", code, err))
+	c.w.Flush()
+}
+
+// sqlState returns the SQLSTATE code of an error.
+func sqlState(err error) string {
+	msg := err.Error()
+	switch {
+	case errors.Is(err, db.ErrNotExist):
+		return stateUndefinedObject
+	case errors.Is(err, db.ErrAlreadyExists):
+		return stateDuplicateObject
+	case errors.Is(err, context.Canceled):
+		return stateQueryCanceled
+	case strings.HasPrefix(msg, "syntax error"):
+		return stateSyntaxError
+	case strings.Contains(msg, "violates"):
+		return stateConstraint
+	}
+	return stateInternalError
+}
+
+// commandTag returns the tag a CommandComplete message reports for a
+// statement, e.g. "INSERT 0 3" or "CREATE TABLE".
+func commandTag(stmt string, res *db.Result) string {
+	words := strings.Fields(strings.ToUpper(stripComments(stmt)))
+	if len(words) == 0 {
+		return ""
+	}
+	switch words[0] {
+	case "SELECT":
+		return fmt.Sprintf("SELECT %d", len(res.Rows))
+	case "INSERT":
+		// the 0 is the OID field, always 0 in PostgreSQL too
+		return fmt.Sprintf("INSERT 0 %d", res.RowsAffected)
+	case "UPDATE", "DELETE":
+		return fmt.Sprintf("%s %d", words[0], res.RowsAffected)
+	case "CREATE", "DROP":
+		if len(words) > 1 {
+			return words[0] + " " + words[1]
+		}
+	}
+	return words[0]
+}
+
+// stripComments drops the -- comments a statement starts with.
+func stripComments(stmt string) string {
+	for {
+		stmt = strings.TrimSpace(stmt)
+		if !strings.HasPrefix(stmt, "--") {
+			return stmt
+		}
+		end := strings.IndexByte(stmt, '\n')
+		if end < 0 {
+			return ""
+		}
+		stmt = stmt[end+1:]
+	}
+}
@@ -0,0 +1,288 @@
+package pgwire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/moh-osman3/MoDb/db"
+)
+
+const (
+	// protocolVersion is version 3.0 of the protocol, the only one served.
+	protocolVersion = 3 << 16
+	// sslRequestCode, gssEncRequestCode and cancelRequestCode take the
+	// place of the protocol version in the special startup packets.
+	sslRequestCode    = 80877103
+	gssEncRequestCode = 80877104
+	cancelRequestCode = 80877102
+
+	// maxStartupSize bounds the startup packet, like in PostgreSQL.
+	maxStartupSize = 10000
+	// maxMessageSize bounds every other message a client sends.
+	maxMessageSize = 16 << 20
+)
+
+// Messages sent by the frontend.
+const (
+	msgQuery     = 'Q'
+	msgTerminate = 'X'
+	msgSync      = 'S'
+	msgParse     = 'P'
+	msgBind      = 'B'
+	msgDescribe  = 'D'
+	msgExecute   = 'E'
+	msgClose     = 'C'
+	msgFlush     = 'H'
+	msgFuncCall  = 'F'
+)
+
+// Messages sent by the backend.
+const (
+	msgAuthentication     = 'R'
+	msgParameterStatus    = 'S'
+	msgBackendKeyData     = 'K'
+	msgReadyForQuery      = 'Z'
+	msgRowDescription     = 'T'
+	msgDataRow            = 'D'
+	msgCommandComplete    = 'C'
+	msgEmptyQuery         = 'I'
+	msgErrorResponse      = 'E'
+	msgNegotiateProtocol  = 'v'
+	transactionStatusIdle = 'I'
+)
+
+// Type OIDs of the PostgreSQL types the column types map onto.
+const (
+	oidBool        = 16
+	oidInt8        = 20
+	oidText        = 25
+	oidFloat8      = 701
+	oidTimestamp   = 1114
+	timestampStyle = "2006-01-02 15:04:05.999999"
+)
+
+// typeOID returns the OID and size of the PostgreSQL type of a column type.
+func typeOID(typ db.ColumnType) (int32, int16) {
+	switch typ {
+	case db.TypeInt64:
+		return oidInt8, 8
+	case db.TypeFloat64:
+		return oidFloat8, 8
+	case db.TypeBool:
+		return oidBool, 1
+	case db.TypeTimestamp:
+		return oidTimestamp, 8
+	}
+	return oidText, -1
+}
+
+// appendText appends the text format of a value the way PostgreSQL prints
+// its type.
+func appendText(buf []byte, val db.Value) []byte {
+	switch val.Type() {
+	case db.TypeInt64:
+		return strconv.AppendInt(buf, val.Int64(), 10)
+	case db.TypeFloat64:
+		f := val.Float64()
+		switch {
+		case math.IsNaN(f):
+			return append(buf, "NaN"...)
+		case math.IsInf(f, 1):
+			return append(buf, "Infinity"...)
+		case math.IsInf(f, -1):
+			return append(buf, "-Infinity"...)
+		}
+		// PostgreSQL switches to exponents for large and small magnitudes
+		if abs := math.Abs(f); f == 0 || (abs >= 1e-4 && abs < 1e15) {
+			return strconv.AppendFloat(buf, f, 'f', -1, 64)
+		}
+		return strconv.AppendFloat(buf, f, 'e', -1, 64)
+	case db.TypeBool:
+		if val.Bool() {
+			return append(buf, 't')
+		}
+		return append(buf, 'f')
+	case db.TypeTimestamp:
+		return val.Time().AppendFormat(buf, timestampStyle)
+	}
+	return append(buf, val.Str()...)
+}
+
+// message builds a backend message: a type byte, the length of the rest
+// of the message as a 4-byte big-endian integer, then the body.
+type message struct {
+	buf []byte
+}
+
+func newMessage(typ byte) *message {
+	return &message{buf: []byte{typ, 0, 0, 0, 0}}
+}
+
+func (m *message) int16(n int16) *message {
+	m.buf = binary.BigEndian.AppendUint16(m.buf, uint16(n))
+	return m
+}
+
+func (m *message) int32(n int32) *message {
+	m.buf = binary.BigEndian.AppendUint32(m.buf, uint32(n))
+	return m
+}
+
+func (m *message) byte(b byte) *message {
+	m.buf = append(m.buf, b)
+	return m
+}
+
+// string appends s as a null-terminated string.
+func (m *message) string(s string) *message {
+	m.buf = append(append(m.buf, s...), 0)
+	return m
+}
+
+func (m *message) bytes() []byte {
+	binary.BigEndian.PutUint32(m.buf[1:5], uint32(len(m.buf)-1))
+	return m.buf
+}
+
+// startup is a decoded startup packet.
+type startup struct {
+	code   uint32
+	params map[string]string
+	// unknownOptions lists the protocol options, named "_pq_.*", that are
+	// not supported.
+	unknownOptions []string
+	// cancel request fields
+	processID int32
+	secretKey int32
+}
+
+// readStartup reads the untyped first packet a client sends.
+func readStartup(r io.Reader) (*startup, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if size < 8 || size > maxStartupSize {
+		return nil, fmt.Errorf("invalid startup packet length %d", size)
+	}
+	body := make([]byte, size-8)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	s := &startup{code: binary.BigEndian.Uint32(header[4:]), params: make(map[string]string)}
+	switch {
+	case s.code == sslRequestCode, s.code == gssEncRequestCode:
+		return s, nil
+	case s.code == cancelRequestCode:
+		if len(body) != 8 {
+			return nil, fmt.Errorf("invalid cancel request length %d", size)
+		}
+		s.processID = int32(binary.BigEndian.Uint32(body))
+		s.secretKey = int32(binary.BigEndian.Uint32(body[4:]))
+		return s, nil
+	case s.code>>16 != protocolVersion>>16:
+		return nil, fmt.Errorf("unsupported frontend protocol %d.%d: server supports 3.0", s.code>>16, s.code&0xffff)
+	}
+
+	// pairs of null-terminated names and values end with an empty name
+	for {
+		name, rest, err := cString(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid startup packet: %v", err)
+		}
+		if name == "" {
+			break
+		}
+		value, rest, err := cString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid startup packet: %v", err)
+		}
+		if strings.HasPrefix(name, "_pq_.") {
+			s.unknownOptions = append(s.unknownOptions, name)
+		} else {
+			s.params[name] = value
+		}
+		body = rest
+	}
+	return s, nil
+}
+
+// readMessage reads a typed message and returns its type and body.
+func readMessage(r *bufio.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size < 4 || size-4 > maxMessageSize {
+		return 0, nil, fmt.Errorf("invalid length %d of message %q", size, header[0])
+	}
+	body := make([]byte, size-4)
+	if _, err := io.ReadFull(r, body); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return header[0], body, nil
+}
+
+// cString splits a null-terminated string off the front of b.
+func cString(b []byte) (string, []byte, error) {
+	for i, ch := range b {
+		if ch == 0 {
+			return string(b[:i]), b[i+1:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("missing string terminator")
+}
+
+// rowDescription describes the columns of a result, all in text format.
+func rowDescription(res *db.Result) *message {
+	m := newMessage(msgRowDescription).int16(int16(len(res.Columns)))
+	for i, name := range res.Columns {
+		oid, size := typeOID(res.Types[i])
+		// no table OID or attribute number, type modifier -1, text format
+		m.string(name).int32(0).int16(0).int32(oid).int16(size).int32(-1).int16(0)
+	}
+	return m
+}
+
+// dataRow encodes a row in text format, with length -1 for nulls.
+func dataRow(row []db.Value) *message {
+	m := newMessage(msgDataRow).int16(int16(len(row)))
+	for _, val := range row {
+		if val.IsNull() {
+			m.int32(-1)
+			continue
+		}
+		lenPos := len(m.buf)
+		m.int32(0)
+		m.buf = appendText(m.buf, val)
+		binary.BigEndian.PutUint32(m.buf[lenPos:], uint32(len(m.buf)-lenPos-4))
+	}
+	return m
+}
+
+// errorResponse reports err with the given severity, e.g. "ERROR" or
+// "FATAL", and SQLSTATE code.
+func errorResponse(severity string, code string, err error) *message {
+	m := newMessage(msgErrorResponse)
+	m.byte('S').string(severity)
+	m.byte('V').string(severity)
+	m.byte('C').string(code)
+	m.byte('M').string(err.Error())
+	return m.byte(0)
+}
+
+func readyForQuery() *message {
+	return newMessage(msgReadyForQuery).byte(transactionStatusIdle)
+}
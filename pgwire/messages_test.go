@@ -0,0 +1,51 @@
+package pgwire
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendText(t *testing.T) {
+	tests := []struct {
+		val    db.Value
+		expect string
+	}{
+		{db.Int64Value(-42), "-42"},
+		{db.Float64Value(2.5), "2.5"},
+		{db.Float64Value(0), "0"},
+		{db.Float64Value(123456789), "123456789"},
+		{db.Float64Value(1e15), "1e+15"},
+		{db.Float64Value(0.00001), "1e-05"},
+		{db.Float64Value(math.Inf(-1)), "-Infinity"},
+		{db.Float64Value(math.NaN()), "NaN"},
+		{db.StringValue("fig"), "fig"},
+		{db.BoolValue(true), "t"},
+		{db.BoolValue(false), "f"},
+		{db.TimestampValue(time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC)), "2024-01-02 03:04:05.6"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expect, string(appendText(nil, tt.val)))
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	msg := newMessage(msgQuery).string("SELECT 1").bytes()
+	typ, body, err := readMessage(bufio.NewReader(bytes.NewReader(msg)))
+	assert.NoError(t, err)
+	assert.Equal(t, byte(msgQuery), typ)
+	assert.Equal(t, "SELECT 1\x00", string(body))
+
+	_, _, err = readMessage(bufio.NewReader(bytes.NewReader(msg[:len(msg)-1])))
+	assert.ErrorContains(t, err, "unexpected EOF")
+	_, _, err = readMessage(bufio.NewReader(bytes.NewReader([]byte{'Q', 0xff, 0, 0, 0})))
+	assert.EqualError(t, err, `invalid length 4278190080 of message 'Q'`)
+
+	_, err = readStartup(bytes.NewReader([]byte{0, 0, 0, 9, 0, 3, 0, 0, 'x'}))
+	assert.EqualError(t, err, "invalid startup packet: missing string terminator")
+}
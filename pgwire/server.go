@@ -0,0 +1,189 @@
+// Package pgwire serves a db.Manager to PostgreSQL clients such as psql
+// with a subset of version 3.0 of the PostgreSQL frontend/backend
+// protocol:
+//
+//	srv := pgwire.New(dbm, logger)
+//	go srv.ListenAndServe(":5432")
+//	...
+//	err := srv.Shutdown(ctx)
+//
+// Clients connect without TLS or a password and send SQL with the simple
+// query protocol. Results are sent in text format, with int64 columns as
+// int8, float64 as float8, string as text, bool as bool and timestamp as
+// timestamp. The extended query protocol, used for prepared statements and
+// bind parameters, is answered with an error.
+//
+// Every connection has its own db.Session. The database named in the
+// startup packet is selected as if with USE if it exists; otherwise tables
+// must be qualified with their database until a USE statement.
+package pgwire
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/moh-osman3/MoDb/internal/netserver"
+	"go.uber.org/zap"
+)
+
+// DefaultMaxConnections is the number of sessions a server serves at once
+// unless configured with WithMaxConnections.
+const DefaultMaxConnections = netserver.DefaultMaxConnections
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown.
+var ErrServerClosed = netserver.ErrServerClosed
+
+// startupTimeout bounds the time a client gets to send its startup packet.
+const startupTimeout = 10 * time.Second
+
+// Server accepts PostgreSQL connections and runs their queries against a
+// manager.
+type Server struct {
+	// base runs the listeners and connections.
+	base *netserver.Server
+
+	dbm      db.Manager
+	logger   *zap.Logger
+	maxConns int
+
+	lock sync.Mutex
+	// sessions maps the process IDs sent in BackendKeyData to the
+	// connections past startup, for cancel requests.
+	sessions      map[int32]*conn
+	nextProcessID int32
+}
+
+// Option configures optional behaviour of a Server.
+type Option func(*Server)
+
+// WithMaxConnections limits the number of sessions served at once. A
+// client connecting over the limit gets a "too many clients" error and is
+// disconnected. n <= 0 removes the limit.
+func WithMaxConnections(n int) Option {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
+// New returns a server for dbm, which must already be started.
+func New(dbm db.Manager, logger *zap.Logger, opts ...Option) *Server {
+	s := &Server{
+		dbm:           dbm,
+		logger:        logger,
+		maxConns:      DefaultMaxConnections,
+		sessions:      make(map[int32]*conn),
+		nextProcessID: 1,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.base = netserver.New(s.serve, s.admit)
+	return s
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections
+// until Shutdown.
+func (s *Server) ListenAndServe(addr string) error {
+	return s.base.ListenAndServe(addr)
+}
+
+// Serve accepts connections on l until Shutdown, which closes l. It always
+// returns a non-nil error, ErrServerClosed after Shutdown.
+func (s *Server) Serve(l net.Listener) error {
+	return s.base.Serve(l)
+}
+
+// admit gives a new connection until startupTimeout to send its startup
+// packet. The connection limit is checked after startup, since cancel
+// requests arrive on connections of their own.
+func (s *Server) admit(netConn net.Conn, numConns int) bool {
+	netConn.SetReadDeadline(time.Now().Add(startupTimeout))
+	return true
+}
+
+// serve serves a connection and then forgets its session.
+func (s *Server) serve(ctx context.Context, netConn net.Conn) {
+	c := newConn(s, netConn)
+	c.serve(ctx)
+
+	s.lock.Lock()
+	if s.sessions[c.processID] == c {
+		delete(s.sessions, c.processID)
+	}
+	s.lock.Unlock()
+}
+
+// errTooManyClients rejects a connection over the limit, with the message
+// PostgreSQL uses.
+var errTooManyClients = errors.New("sorry, too many clients already")
+
+// register admits a connection past startup, lifting its startup deadline,
+// and assigns it the process ID and secret key that cancel requests for it
+// must quote. It fails when the server is shutting down or at its
+// connection limit.
+func (s *Server) register(c *conn) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// through the base, so that Shutdown's deadline is not lifted
+	if err := s.base.LiftReadDeadline(c.netConn); err != nil {
+		return err
+	}
+	if s.maxConns > 0 && len(s.sessions) >= s.maxConns {
+		s.logger.Warn("rejecting connection over the limit",
+			zap.Stringer("remote", c.netConn.RemoteAddr()), zap.Int("max_connections", s.maxConns))
+		return errTooManyClients
+	}
+
+	for s.sessions[s.nextProcessID] != nil || s.nextProcessID <= 0 {
+		s.nextProcessID++
+	}
+	c.processID = s.nextProcessID
+	s.nextProcessID++
+	var key [4]byte
+	rand.Read(key[:])
+	c.secretKey = int32(binary.BigEndian.Uint32(key[:]))
+	s.sessions[c.processID] = c
+	return nil
+}
+
+// cancelQuery cancels the statement running on the session with the given
+// process ID if secretKey matches. Like PostgreSQL it reports nothing back.
+func (s *Server) cancelQuery(processID int32, secretKey int32) {
+	s.lock.Lock()
+	c := s.sessions[processID]
+	s.lock.Unlock()
+	if c == nil || c.secretKey != secretKey {
+		s.logger.Debug("ignoring cancel request for an unknown session", zap.Int32("process_id", processID))
+		return
+	}
+	c.cancelQuery()
+}
+
+// Shutdown stops the server gracefully. It closes the listeners, lets
+// every connection finish the query it is running and disconnects it. If
+// ctx ends first, running queries are cancelled and their connections
+// closed, and Shutdown returns the context's error once they have
+// returned. Unlike server.Server it does not end the manager, which other
+// servers may share.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.base.Shutdown(ctx)
+}
+
+// Addrs returns the addresses the server is listening on.
+func (s *Server) Addrs() []net.Addr {
+	return s.base.Addrs()
+}
+
+// NumConnections returns the number of sessions being served.
+func (s *Server) NumConnections() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.sessions)
+}
@@ -0,0 +1,363 @@
+package pgwire
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// frontend is a minimal PostgreSQL client speaking the simple query
+// protocol.
+type frontend struct {
+	t         *testing.T
+	conn      net.Conn
+	r         *bufio.Reader
+	processID int32
+	secretKey int32
+	params    map[string]string
+}
+
+type backendMsg struct {
+	typ  byte
+	body []byte
+}
+
+func startupPacket(code uint32, params ...string) []byte {
+	buf := []byte{0, 0, 0, 0}
+	buf = binary.BigEndian.AppendUint32(buf, code)
+	for _, p := range params {
+		buf = append(append(buf, p...), 0)
+	}
+	if code == protocolVersion {
+		buf = append(buf, 0)
+	}
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)))
+	return buf
+}
+
+func dial(t *testing.T, addr string) *frontend {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return &frontend{t: t, conn: conn, r: bufio.NewReader(conn), params: make(map[string]string)}
+}
+
+// connect starts a session and reads the server's greeting.
+func connect(t *testing.T, addr string, params ...string) *frontend {
+	f := dial(t, addr)
+	_, err := f.conn.Write(startupPacket(protocolVersion, append([]string{"user", "analyst"}, params...)...))
+	require.NoError(t, err)
+	msgs := f.readUntilReady()
+	require.Equal(t, byte(msgAuthentication), msgs[0].typ)
+	for _, m := range msgs[1:] {
+		switch m.typ {
+		case msgParameterStatus:
+			name, rest, _ := cString(m.body)
+			value, _, _ := cString(rest)
+			f.params[name] = value
+		case msgBackendKeyData:
+			f.processID = int32(binary.BigEndian.Uint32(m.body))
+			f.secretKey = int32(binary.BigEndian.Uint32(m.body[4:]))
+		}
+	}
+	return f
+}
+
+func (f *frontend) send(typ byte, body []byte) {
+	buf := append([]byte{typ, 0, 0, 0, 0}, body...)
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(body)+4))
+	_, err := f.conn.Write(buf)
+	require.NoError(f.t, err)
+}
+
+func (f *frontend) recv() backendMsg {
+	typ, body, err := readMessage(f.r)
+	require.NoError(f.t, err)
+	return backendMsg{typ, body}
+}
+
+func (f *frontend) readUntilReady() []backendMsg {
+	var msgs []backendMsg
+	for {
+		m := f.recv()
+		if m.typ == msgErrorResponse && errorField(m, 'S') == "FATAL" {
+			f.t.Fatalf("fatal error: %s", errorField(m, 'M'))
+		}
+		msgs = append(msgs, m)
+		if m.typ == msgReadyForQuery {
+			return msgs
+		}
+	}
+}
+
+func (f *frontend) query(sql string) []backendMsg {
+	f.send(msgQuery, append([]byte(sql), 0))
+	return f.readUntilReady()
+}
+
+// result is what a query returned, with nil for null values.
+type result struct {
+	columns []string
+	oids    []int32
+	rows    [][]*string
+	tags    []string
+	errs    []string
+	codes   []string
+}
+
+func (f *frontend) result(sql string) *result {
+	res := &result{}
+	for _, m := range f.query(sql) {
+		switch m.typ {
+		case msgRowDescription:
+			body := m.body[2:]
+			for range binary.BigEndian.Uint16(m.body) {
+				name, rest, err := cString(body)
+				require.NoError(f.t, err)
+				res.columns = append(res.columns, name)
+				res.oids = append(res.oids, int32(binary.BigEndian.Uint32(rest[6:])))
+				body = rest[18:]
+			}
+		case msgDataRow:
+			body := m.body[2:]
+			var row []*string
+			for range binary.BigEndian.Uint16(m.body) {
+				size := int32(binary.BigEndian.Uint32(body))
+				body = body[4:]
+				if size < 0 {
+					row = append(row, nil)
+					continue
+				}
+				val := string(body[:size])
+				row = append(row, &val)
+				body = body[size:]
+			}
+			res.rows = append(res.rows, row)
+		case msgCommandComplete:
+			tag, _, _ := cString(m.body)
+			res.tags = append(res.tags, tag)
+		case msgErrorResponse:
+			res.errs = append(res.errs, errorField(m, 'M'))
+			res.codes = append(res.codes, errorField(m, 'C'))
+		}
+	}
+	return res
+}
+
+func errorField(m backendMsg, field byte) string {
+	body := m.body
+	for len(body) > 0 && body[0] != 0 {
+		value, rest, _ := cString(body[1:])
+		if body[0] == field {
+			return value
+		}
+		body = rest
+	}
+	return ""
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func startServer(t *testing.T, opts ...Option) (*Server, db.Manager, string) {
+	dbm := db.NewDefaultManager(zap.NewNop())
+	require.NoError(t, dbm.Start(context.Background()))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := New(dbm, zap.NewNop(), opts...)
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return srv, dbm, l.Addr().String()
+}
+
+func TestQuery(t *testing.T) {
+	_, _, addr := startServer(t)
+	f := connect(t, addr)
+	assert.Equal(t, "UTF8", f.params["client_encoding"])
+	assert.Equal(t, serverVersion, f.params["server_version"])
+
+	res := f.result(`CREATE DATABASE shop; USE shop;
+		CREATE TABLE items (id INT PRIMARY KEY, name TEXT, price FLOAT, sold BOOL, added TIMESTAMP)`)
+	assert.Empty(t, res.errs)
+	assert.Equal(t, []string{"CREATE DATABASE", "USE", "CREATE TABLE"}, res.tags)
+
+	res = f.result("INSERT INTO items (id, name, price, sold) VALUES (1, 'fig', 2.5, TRUE), (2, NULL, 1e20, FALSE)")
+	assert.Empty(t, res.errs)
+	assert.Equal(t, []string{"INSERT 0 2"}, res.tags)
+
+	res = f.result("-- the cheap ones\nSELECT id, name, price, sold, added FROM items WHERE id >= 1;")
+	assert.Empty(t, res.errs)
+	assert.Equal(t, []string{"id", "name", "price", "sold", "added"}, res.columns)
+	assert.Equal(t, []int32{oidInt8, oidText, oidFloat8, oidBool, oidTimestamp}, res.oids)
+	assert.Equal(t, [][]*string{
+		{str("1"), str("fig"), str("2.5"), str("t"), nil},
+		{str("2"), nil, str("1e+20"), str("f"), nil},
+	}, res.rows)
+	assert.Equal(t, []string{"SELECT 2"}, res.tags)
+
+	res = f.result("UPDATE items SET price = 3 WHERE id = 1; DELETE FROM items WHERE id = 2")
+	assert.Equal(t, []string{"UPDATE 1", "DELETE 1"}, res.tags)
+
+	// an empty query
+	msgs := f.query(" ; ")
+	assert.Equal(t, byte(msgEmptyQuery), msgs[0].typ)
+
+	t.Run("errors", func(t *testing.T) {
+		res := f.result("SELECT * FROM items; SELECT * FROM missing; SELECT * FROM items")
+		assert.Equal(t, []string{"SELECT 1"}, res.tags)
+		assert.Equal(t, []string{"Cannot get table with name missing: does not exist"}, res.errs)
+		assert.Equal(t, []string{stateUndefinedObject}, res.codes)
+
+		res = f.result("SELEC 1")
+		assert.Equal(t, []string{stateSyntaxError}, res.codes)
+		res = f.result("CREATE DATABASE shop")
+		assert.Equal(t, []string{stateDuplicateObject}, res.codes)
+		res = f.result("INSERT INTO items (id) VALUES (1)")
+		assert.Equal(t, []string{stateConstraint}, res.codes)
+
+		// the session still works after errors
+		res = f.result("SELECT id FROM items")
+		assert.Equal(t, [][]*string{{str("1")}}, res.rows)
+	})
+
+	t.Run("extended query", func(t *testing.T) {
+		f.send(msgParse, []byte("\x00SELECT 1\x00\x00\x00"))
+		f.send(msgBind, []byte("\x00\x00\x00\x00\x00\x00\x00\x00"))
+		f.send(msgSync, nil)
+		msgs := f.readUntilReady()
+		require.Len(t, msgs, 2)
+		assert.Equal(t, stateFeatureUnsupported, errorField(msgs[0], 'C'))
+
+		res := f.result("SELECT id FROM items")
+		assert.Equal(t, []string{"SELECT 1"}, res.tags)
+	})
+
+	f.send(msgTerminate, nil)
+	_, err := f.r.ReadByte()
+	assert.Error(t, err)
+}
+
+func TestStartup(t *testing.T) {
+	srv, dbm, addr := startServer(t, WithMaxConnections(1))
+	_, err := dbm.CreateDb("shop")
+	require.NoError(t, err)
+
+	t.Run("ssl request", func(t *testing.T) {
+		f := dial(t, addr)
+		_, err := f.conn.Write(startupPacket(sslRequestCode))
+		require.NoError(t, err)
+		b, err := f.r.ReadByte()
+		require.NoError(t, err)
+		assert.Equal(t, byte('N'), b)
+
+		// the client carries on without TLS and selects a database
+		_, err = f.conn.Write(startupPacket(protocolVersion, "user", "analyst", "database", "shop"))
+		require.NoError(t, err)
+		f.readUntilReady()
+		res := f.result("CREATE TABLE items (id INT)")
+		assert.Empty(t, res.errs)
+		assert.Equal(t, 1, srv.NumConnections())
+
+		// over the connection limit
+		other := dial(t, addr)
+		_, err = other.conn.Write(startupPacket(protocolVersion, "user", "analyst"))
+		require.NoError(t, err)
+		m := other.recv()
+		assert.Equal(t, "FATAL", errorField(m, 'S'))
+		assert.Equal(t, stateTooManyConnections, errorField(m, 'C'))
+		f.send(msgTerminate, nil)
+	})
+
+	t.Run("unknown database", func(t *testing.T) {
+		require.Eventually(t, func() bool { return srv.NumConnections() == 0 }, time.Second, time.Millisecond)
+		f := connect(t, addr, "database", "analyst")
+		res := f.result("CREATE TABLE items (id INT)")
+		assert.Contains(t, res.errs[0], "no database selected")
+		f.conn.Close()
+	})
+
+	t.Run("newer protocol", func(t *testing.T) {
+		require.Eventually(t, func() bool { return srv.NumConnections() == 0 }, time.Second, time.Millisecond)
+		f := dial(t, addr)
+		_, err := f.conn.Write(startupPacket(protocolVersion|2, "user", "analyst", "_pq_.feature", "on", "", ""))
+		require.NoError(t, err)
+		m := f.recv()
+		require.Equal(t, byte(msgNegotiateProtocol), m.typ)
+		assert.Equal(t, append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, "_pq_.feature\x00"...), m.body)
+		f.readUntilReady()
+		f.conn.Close()
+	})
+
+	t.Run("old protocol", func(t *testing.T) {
+		f := dial(t, addr)
+		_, err := f.conn.Write(startupPacket(2 << 16))
+		require.NoError(t, err)
+		m := f.recv()
+		assert.Equal(t, "unsupported frontend protocol 2.0: server supports 3.0", errorField(m, 'M'))
+	})
+}
+
+func TestCancel(t *testing.T) {
+	srv, _, addr := startServer(t)
+	f := connect(t, addr)
+
+	// a cancel request with the wrong key is ignored
+	c := dial(t, addr)
+	packet := startupPacket(cancelRequestCode)
+	packet = binary.BigEndian.AppendUint32(packet, uint32(f.processID))
+	packet = binary.BigEndian.AppendUint32(packet, uint32(f.secretKey+1))
+	binary.BigEndian.PutUint32(packet, uint32(len(packet)))
+	_, err := c.conn.Write(packet)
+	require.NoError(t, err)
+	_, err = c.r.ReadByte()
+	assert.Error(t, err)
+
+	// with the right key it cancels the running statement
+	var conn *conn
+	srv.lock.Lock()
+	conn = srv.sessions[f.processID]
+	srv.lock.Unlock()
+	require.NotNil(t, conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	conn.lock.Lock()
+	conn.cancel = cancel
+	conn.lock.Unlock()
+	srv.cancelQuery(f.processID, f.secretKey)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.Equal(t, stateQueryCanceled, sqlState(context.Canceled))
+}
+
+func TestShutdown(t *testing.T) {
+	dbm := db.NewDefaultManager(zap.NewNop())
+	require.NoError(t, dbm.Start(context.Background()))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := New(dbm, zap.NewNop())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+
+	f := connect(t, l.Addr().String())
+	require.NoError(t, srv.Shutdown(context.Background()))
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+
+	// idle clients are told why they are disconnected
+	m := f.recv()
+	assert.Equal(t, stateAdminShutdown, errorField(m, 'C'))
+	assert.Equal(t, 0, srv.NumConnections())
+
+	// the manager is still running
+	_, err = dbm.CreateDb("shop")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, srv.Shutdown(context.Background()), ErrServerClosed)
+}
@@ -0,0 +1,434 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/moh-osman3/MoDb/db"
+)
+
+// nullValue marks a null in place of the type of a value.
+const nullValue = 0xff
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendStrings(buf []byte, strs []string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(strs)))
+	for _, s := range strs {
+		buf = appendString(buf, s)
+	}
+	return buf
+}
+
+func appendValue(buf []byte, val db.Value) []byte {
+	if val.IsNull() {
+		return append(buf, nullValue)
+	}
+	buf = append(buf, byte(val.Type()))
+	switch val.Type() {
+	case db.TypeFloat64:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(val.Float64()))
+	case db.TypeString:
+		return appendString(buf, val.Str())
+	case db.TypeBool:
+		if val.Bool() {
+			return binary.AppendVarint(buf, 1)
+		}
+		return binary.AppendVarint(buf, 0)
+	case db.TypeTimestamp:
+		return binary.AppendVarint(buf, val.Time().UnixNano())
+	}
+	return binary.AppendVarint(buf, val.Int64())
+}
+
+func appendValues(buf []byte, vals []db.Value) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(vals)))
+	for _, val := range vals {
+		buf = appendValue(buf, val)
+	}
+	return buf
+}
+
+func appendFilter(buf []byte, f *Filter) []byte {
+	buf = append(buf, byte(f.Kind))
+	switch f.Kind {
+	case FilterMatch:
+		buf = appendString(buf, f.Col)
+		buf = append(buf, byte(f.Op))
+		return appendValues(buf, f.Values)
+	case FilterNull, FilterNotNull:
+		return appendString(buf, f.Col)
+	case FilterAnd, FilterOr:
+		buf = binary.AppendUvarint(buf, uint64(len(f.Filters)))
+		for _, operand := range f.Filters {
+			buf = appendFilter(buf, operand)
+		}
+		return buf
+	case FilterNot:
+		return appendFilter(buf, f.Filters[0])
+	}
+	return buf
+}
+
+// checkFilter rejects filters appendFilter cannot encode.
+func checkFilter(f *Filter) error {
+	if f == nil {
+		return fmt.Errorf("invalid filter: missing operand")
+	}
+	switch f.Kind {
+	case FilterMatch, FilterNull, FilterNotNull:
+		return nil
+	case FilterNot:
+		if len(f.Filters) != 1 {
+			return fmt.Errorf("invalid filter: NOT takes 1 operand, got %d", len(f.Filters))
+		}
+	case FilterAnd, FilterOr:
+	default:
+		return fmt.Errorf("invalid filter: unknown kind %d", f.Kind)
+	}
+	for _, operand := range f.Filters {
+		if err := checkFilter(operand); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendRequest(buf []byte, req *Request) ([]byte, error) {
+	buf = append(buf, byte(req.Op))
+	switch req.Op {
+	case OpExec:
+		return appendString(buf, req.SQL), nil
+	case OpCreateDb, OpDropDb:
+		return appendString(buf, req.Db), nil
+	case OpCreateTable:
+		buf = appendString(buf, req.Db)
+		buf = appendString(buf, req.Table)
+		buf = binary.AppendUvarint(buf, uint64(len(req.Columns)))
+		for _, col := range req.Columns {
+			buf = appendString(buf, col.Name)
+			buf = append(buf, byte(col.Type))
+			if col.NotNull {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+		}
+		return appendStrings(buf, req.PrimaryKey), nil
+	case OpDropTable:
+		buf = appendString(buf, req.Db)
+		return appendString(buf, req.Table), nil
+	case OpInsert:
+		buf = appendString(buf, req.Db)
+		buf = appendString(buf, req.Table)
+		buf = appendStrings(buf, req.ColNames)
+		buf = binary.AppendUvarint(buf, uint64(len(req.Rows)))
+		for i, row := range req.Rows {
+			if len(row) != len(req.ColNames) {
+				return nil, fmt.Errorf("insert has %d columns but row %d has %d values", len(req.ColNames), i+1, len(row))
+			}
+			for _, val := range row {
+				buf = appendValue(buf, val)
+			}
+		}
+		return buf, nil
+	case OpSelect:
+		f := req.Filter
+		if f == nil {
+			f = And()
+		}
+		if err := checkFilter(f); err != nil {
+			return nil, err
+		}
+		buf = appendString(buf, req.Db)
+		buf = appendString(buf, req.Table)
+		return appendFilter(buf, f), nil
+	case OpGet:
+		buf = binary.AppendUvarint(buf, req.Handle)
+		return appendStrings(buf, req.ColNames), nil
+	case OpDelete, OpRelease:
+		return binary.AppendUvarint(buf, req.Handle), nil
+	}
+	return nil, fmt.Errorf("unknown op %s", req.Op)
+}
+
+func appendResponse(buf []byte, resp *Response) []byte {
+	if resp.Err != "" {
+		buf = append(buf, byte(StatusError))
+		return appendString(buf, resp.Err)
+	}
+
+	buf = append(buf, byte(StatusOK))
+	buf = binary.AppendUvarint(buf, resp.Handle)
+	buf = binary.AppendUvarint(buf, uint64(resp.RowsAffected))
+	buf = binary.AppendUvarint(buf, uint64(len(resp.Columns)))
+	for i, name := range resp.Columns {
+		buf = appendString(buf, name)
+		buf = append(buf, byte(resp.Types[i]))
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(resp.Rows)))
+	for _, row := range resp.Rows {
+		for _, val := range row {
+			buf = appendValue(buf, val)
+		}
+	}
+	return buf
+}
+
+// decoder reads the fields of a payload, remembering the first error so
+// callers can check once at the end.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	val, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("invalid uvarint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return val
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	val, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("invalid varint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return val
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) == 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+// length reads a count and checks it against the bytes left, each counted
+// item taking at least one byte, so a corrupt count cannot trigger a huge
+// allocation.
+func (d *decoder) length() int {
+	n := d.uvarint()
+	if d.err == nil && n > uint64(len(d.buf)) {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *decoder) strings() []string {
+	n := d.length()
+	strs := make([]string, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		strs = append(strs, d.string())
+	}
+	return strs
+}
+
+func (d *decoder) columnType() db.ColumnType {
+	typ := db.ColumnType(d.byte())
+	if d.err == nil && typ > db.TypeTimestamp {
+		d.err = fmt.Errorf("unknown column type %d", typ)
+	}
+	return typ
+}
+
+func (d *decoder) value() db.Value {
+	if d.err == nil && len(d.buf) > 0 && d.buf[0] == nullValue {
+		d.buf = d.buf[1:]
+		return db.NullValue()
+	}
+
+	switch d.columnType() {
+	case db.TypeFloat64:
+		if d.err == nil && len(d.buf) < 8 {
+			d.err = io.ErrUnexpectedEOF
+		}
+		if d.err != nil {
+			return db.Value{}
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+		d.buf = d.buf[8:]
+		return db.Float64Value(f)
+	case db.TypeString:
+		return db.StringValue(d.string())
+	case db.TypeBool:
+		return db.BoolValue(d.varint() != 0)
+	case db.TypeTimestamp:
+		return db.TimestampValue(time.Unix(0, d.varint()))
+	}
+	return db.Int64Value(d.varint())
+}
+
+func (d *decoder) values() []db.Value {
+	n := d.length()
+	vals := make([]db.Value, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		vals = append(vals, d.value())
+	}
+	return vals
+}
+
+func (d *decoder) filter(depth int) *Filter {
+	if d.err == nil && depth > maxFilterDepth {
+		d.err = fmt.Errorf("filter nested deeper than %d", maxFilterDepth)
+	}
+	f := &Filter{Kind: FilterKind(d.byte())}
+	if d.err != nil {
+		return f
+	}
+	switch f.Kind {
+	case FilterMatch:
+		f.Col = d.string()
+		f.Op = PredicateOp(d.byte())
+		f.Values = d.values()
+	case FilterNull, FilterNotNull:
+		f.Col = d.string()
+	case FilterAnd, FilterOr:
+		n := d.length()
+		for i := 0; i < n && d.err == nil; i++ {
+			f.Filters = append(f.Filters, d.filter(depth+1))
+		}
+	case FilterNot:
+		f.Filters = []*Filter{d.filter(depth + 1)}
+	default:
+		d.err = fmt.Errorf("invalid filter: unknown kind %d", f.Kind)
+	}
+	return f
+}
+
+// rows reads numRows rows of numCols values each.
+func (d *decoder) rows(numCols int) [][]db.Value {
+	n := d.length()
+	rows := make([][]db.Value, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		row := make([]db.Value, numCols)
+		for j := range row {
+			row[j] = d.value()
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// finish returns the first decoding error, or an error if bytes are left
+// over after the last field.
+func (d *decoder) finish(what string) error {
+	if d.err == nil && len(d.buf) > 0 {
+		d.err = fmt.Errorf("%d unexpected trailing bytes", len(d.buf))
+	}
+	if d.err != nil {
+		return fmt.Errorf("malformed %s: %v", what, d.err)
+	}
+	return nil
+}
+
+// DecodeRequest decodes the payload of a request frame.
+func DecodeRequest(payload []byte) (*Request, error) {
+	d := &decoder{buf: payload}
+	req := &Request{Op: Op(d.byte())}
+	switch req.Op {
+	case OpExec:
+		req.SQL = d.string()
+	case OpCreateDb, OpDropDb:
+		req.Db = d.string()
+	case OpCreateTable:
+		req.Db = d.string()
+		req.Table = d.string()
+		n := d.length()
+		for i := 0; i < n && d.err == nil; i++ {
+			col := Column{Name: d.string(), Type: d.columnType()}
+			col.NotNull = d.byte() != 0
+			req.Columns = append(req.Columns, col)
+		}
+		req.PrimaryKey = d.strings()
+	case OpDropTable:
+		req.Db = d.string()
+		req.Table = d.string()
+	case OpInsert:
+		req.Db = d.string()
+		req.Table = d.string()
+		req.ColNames = d.strings()
+		req.Rows = d.rows(len(req.ColNames))
+	case OpSelect:
+		req.Db = d.string()
+		req.Table = d.string()
+		req.Filter = d.filter(0)
+	case OpGet:
+		req.Handle = d.uvarint()
+		req.ColNames = d.strings()
+	case OpDelete, OpRelease:
+		req.Handle = d.uvarint()
+	default:
+		if d.err == nil {
+			return nil, fmt.Errorf("malformed request: unknown op %d", uint8(req.Op))
+		}
+	}
+	if err := d.finish("request"); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// DecodeResponse decodes the payload of a response frame.
+func DecodeResponse(payload []byte) (*Response, error) {
+	d := &decoder{buf: payload}
+	resp := &Response{}
+	switch Status(d.byte()) {
+	case StatusOK:
+		resp.Handle = d.uvarint()
+		resp.RowsAffected = int64(d.uvarint())
+		n := d.length()
+		for i := 0; i < n && d.err == nil; i++ {
+			resp.Columns = append(resp.Columns, d.string())
+			resp.Types = append(resp.Types, d.columnType())
+		}
+		resp.Rows = d.rows(len(resp.Columns))
+	case StatusError:
+		resp.Err = d.string()
+		if d.err == nil && resp.Err == "" {
+			d.err = fmt.Errorf("empty error message")
+		}
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown status %d", payload[0])
+		}
+	}
+	if err := d.finish("response"); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,136 @@
+package protocol
+
+import (
+	"fmt"
+
+	"github.com/moh-osman3/MoDb/db"
+)
+
+// FilterKind is the kind of a Filter node.
+type FilterKind uint8
+
+const (
+	FilterMatch FilterKind = iota + 1
+	FilterNull
+	FilterNotNull
+	FilterAnd
+	FilterOr
+	FilterNot
+)
+
+// PredicateOp names a db.Predicate constructor.
+type PredicateOp uint8
+
+const (
+	PredicateEq PredicateOp = iota + 1
+	PredicateNe
+	PredicateLt
+	PredicateLe
+	PredicateGt
+	PredicateGe
+	PredicateBetween
+	PredicateIn
+)
+
+// maxFilterDepth bounds the nesting of a decoded filter.
+const maxFilterDepth = 64
+
+// Filter is the wire form of a db.Filter, a tree of predicates on the
+// columns of a table.
+type Filter struct {
+	Kind FilterKind
+	// Col is the column of FilterMatch, FilterNull and FilterNotNull.
+	Col    string
+	Op     PredicateOp
+	Values []db.Value
+	// Filters are the operands of FilterAnd and FilterOr, or the one
+	// operand of FilterNot.
+	Filters []*Filter
+}
+
+// Match matches the rows where col matches the predicate op on vals.
+func Match(col string, op PredicateOp, vals ...db.Value) *Filter {
+	return &Filter{Kind: FilterMatch, Col: col, Op: op, Values: vals}
+}
+
+func IsNull(col string) *Filter {
+	return &Filter{Kind: FilterNull, Col: col}
+}
+
+func IsNotNull(col string) *Filter {
+	return &Filter{Kind: FilterNotNull, Col: col}
+}
+
+func And(filters ...*Filter) *Filter {
+	return &Filter{Kind: FilterAnd, Filters: filters}
+}
+
+func Or(filters ...*Filter) *Filter {
+	return &Filter{Kind: FilterOr, Filters: filters}
+}
+
+func Not(f *Filter) *Filter {
+	return &Filter{Kind: FilterNot, Filters: []*Filter{f}}
+}
+
+// DbFilter converts f into the db.Filter it describes.
+func (f *Filter) DbFilter() (db.Filter, error) {
+	switch f.Kind {
+	case FilterMatch:
+		p, err := f.predicate()
+		if err != nil {
+			return nil, err
+		}
+		return db.Match(f.Col, p), nil
+	case FilterNull:
+		return db.IsNull(f.Col), nil
+	case FilterNotNull:
+		return db.IsNotNull(f.Col), nil
+	case FilterAnd, FilterOr:
+		filters := make([]db.Filter, len(f.Filters))
+		for i, operand := range f.Filters {
+			var err error
+			if filters[i], err = operand.DbFilter(); err != nil {
+				return nil, err
+			}
+		}
+		if f.Kind == FilterAnd {
+			return db.And(filters...), nil
+		}
+		return db.Or(filters...), nil
+	case FilterNot:
+		if len(f.Filters) != 1 {
+			return nil, fmt.Errorf("invalid filter: NOT takes 1 operand, got %d", len(f.Filters))
+		}
+		operand, err := f.Filters[0].DbFilter()
+		if err != nil {
+			return nil, err
+		}
+		return db.Not(operand), nil
+	}
+	return nil, fmt.Errorf("invalid filter: unknown kind %d", f.Kind)
+}
+
+func (f *Filter) predicate() (db.Predicate, error) {
+	unary := map[PredicateOp]func(db.Value) db.Predicate{
+		PredicateEq: db.Eq, PredicateNe: db.Ne, PredicateLt: db.Lt,
+		PredicateLe: db.Le, PredicateGt: db.Gt, PredicateGe: db.Ge,
+	}
+	if newPred, ok := unary[f.Op]; ok {
+		if len(f.Values) != 1 {
+			return db.Predicate{}, fmt.Errorf("invalid filter on column %s: predicate takes 1 operand, got %d", f.Col, len(f.Values))
+		}
+		return newPred(f.Values[0]), nil
+	}
+
+	switch f.Op {
+	case PredicateBetween:
+		if len(f.Values) != 2 {
+			return db.Predicate{}, fmt.Errorf("invalid filter on column %s: BETWEEN takes 2 operands, got %d", f.Col, len(f.Values))
+		}
+		return db.Between(f.Values[0], f.Values[1]), nil
+	case PredicateIn:
+		return db.In(f.Values...), nil
+	}
+	return db.Predicate{}, fmt.Errorf("invalid filter on column %s: unknown predicate %d", f.Col, f.Op)
+}
@@ -0,0 +1,189 @@
+// Package protocol defines the binary wire protocol between a MoDB server
+// and its clients.
+//
+// Every message is a frame: a 4-byte big-endian payload length followed by
+// that many bytes of payload, at most MaxFrameSize. A client sends request
+// frames over one TCP connection and the server answers each in order with
+// one response frame.
+//
+// A request payload is an Op byte followed by the fields of the op. A
+// response payload is a Status byte followed by an error message string
+// for StatusError, or by a result for StatusOK. Fields are encoded as:
+//
+//	uvarint  unsigned varint, as encoding/binary.AppendUvarint
+//	string   uvarint byte length, then the bytes
+//	strings  uvarint count, then that many strings
+//	value    type byte (a db.ColumnType), then for int64, bool and
+//	         timestamp (unix nanoseconds) a signed varint, for float64 the
+//	         8-byte little-endian IEEE 754 bits and for string a string.
+//	         Type 0xff is a null and has nothing after it.
+//	filter   kind byte, then for FilterMatch a column string, a
+//	         PredicateOp byte and the operands as a uvarint count and
+//	         values, for FilterNull and FilterNotNull a column string, for
+//	         FilterAnd and FilterOr a uvarint count and that many filters
+//	         and for FilterNot one filter.
+//
+// The fields of each op are:
+//
+//	OpExec         sql string
+//	OpCreateDb     db string
+//	OpDropDb       db string
+//	OpCreateTable  db string, table string, uvarint column count, then for
+//	               each column a name string, type byte and not null byte,
+//	               then primary key strings
+//	OpDropTable    db string, table string
+//	OpInsert       db string, table string, column strings, uvarint row
+//	               count, then for each row one value per column
+//	OpSelect       db string, table string, filter
+//	OpGet          uvarint handle, column strings
+//	OpDelete       uvarint handle
+//	OpRelease      uvarint handle
+//
+// An empty db string names the database the connection selected with a
+// USE statement. OpSelect answers with a handle to the matched rows that
+// OpGet reads columns of and OpDelete deletes, until OpRelease frees it.
+//
+// A result is a uvarint handle, a uvarint count of rows affected or
+// matched, a uvarint column count, a name string and type byte for each
+// column, a uvarint row count and one value per column for each row.
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/moh-osman3/MoDb/db"
+)
+
+// MaxFrameSize is the largest payload a frame may carry.
+const MaxFrameSize = 16 << 20
+
+// Op is the kind of a request.
+type Op uint8
+
+const (
+	OpExec Op = iota + 1
+	OpCreateDb
+	OpDropDb
+	OpCreateTable
+	OpDropTable
+	OpInsert
+	OpSelect
+	OpGet
+	OpDelete
+	OpRelease
+)
+
+func (op Op) String() string {
+	names := [...]string{"", "Exec", "CreateDb", "DropDb", "CreateTable", "DropTable", "Insert", "Select", "Get", "Delete", "Release"}
+	if op == 0 || int(op) >= len(names) {
+		return fmt.Sprintf("Op(%d)", uint8(op))
+	}
+	return names[op]
+}
+
+// Status tells whether a request succeeded.
+type Status uint8
+
+const (
+	StatusOK Status = iota
+	StatusError
+)
+
+// Column declares a column of a table created with OpCreateTable.
+type Column struct {
+	Name    string
+	Type    db.ColumnType
+	NotNull bool
+}
+
+// Request is a decoded request frame. Only the fields of its Op are encoded.
+type Request struct {
+	Op         Op
+	SQL        string
+	Db         string
+	Table      string
+	Columns    []Column
+	PrimaryKey []string
+	ColNames   []string
+	Rows       [][]db.Value
+	// Filter selects the rows of OpSelect, every row if nil.
+	Filter *Filter
+	Handle uint64
+}
+
+// Response is a decoded response frame. Err is set for StatusError and the
+// other fields for StatusOK.
+type Response struct {
+	Err          string
+	Handle       uint64
+	RowsAffected int64
+	Columns      []string
+	Types        []db.ColumnType
+	Rows         [][]db.Value
+}
+
+// WriteFrame writes payload to w behind its length.
+func WriteFrame(w io.Writer, payload []byte) error {
+	if len(payload) > MaxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds the maximum of %d", len(payload), MaxFrameSize)
+	}
+	buf := make([]byte, 4, 4+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	_, err := w.Write(append(buf, payload...))
+	return err
+}
+
+// ReadFrame reads the payload of the next frame from r. It returns io.EOF
+// if r ends before a frame starts.
+func ReadFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if n > MaxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the maximum of %d", n, MaxFrameSize)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, nil
+}
+
+// WriteRequest encodes req and writes it to w as one frame.
+func WriteRequest(w io.Writer, req *Request) error {
+	payload, err := appendRequest(nil, req)
+	if err != nil {
+		return err
+	}
+	return WriteFrame(w, payload)
+}
+
+// ReadRequest reads and decodes the next request frame from r.
+func ReadRequest(r io.Reader) (*Request, error) {
+	payload, err := ReadFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeRequest(payload)
+}
+
+// WriteResponse encodes resp and writes it to w as one frame.
+func WriteResponse(w io.Writer, resp *Response) error {
+	return WriteFrame(w, appendResponse(nil, resp))
+}
+
+// ReadResponse reads and decodes the next response frame from r.
+func ReadResponse(r io.Reader) (*Response, error) {
+	payload, err := ReadFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeResponse(payload)
+}
@@ -0,0 +1,161 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 0, 5, time.UTC)
+	requests := []*Request{
+		{Op: OpExec, SQL: "SELECT * FROM shop.items"},
+		{Op: OpCreateDb, Db: "shop"},
+		{Op: OpDropDb, Db: "shop"},
+		{Op: OpCreateTable, Db: "shop", Table: "items",
+			Columns:    []Column{{Name: "id", Type: db.TypeInt64, NotNull: true}, {Name: "name", Type: db.TypeString}},
+			PrimaryKey: []string{"id"}},
+		{Op: OpDropTable, Db: "shop", Table: "items"},
+		{Op: OpInsert, Db: "", Table: "items", ColNames: []string{"id", "price", "name", "ok", "at"},
+			Rows: [][]db.Value{
+				{db.Int64Value(-7), db.Float64Value(2.5), db.StringValue("fig"), db.BoolValue(true), db.TimestampValue(ts)},
+				{db.Int64Value(1 << 40), db.NullValue(), db.StringValue(""), db.BoolValue(false), db.NullValue()},
+			}},
+		{Op: OpSelect, Db: "shop", Table: "items", Filter: And(
+			Match("id", PredicateBetween, db.Int64Value(1), db.Int64Value(9)),
+			Not(Or(IsNull("name"), IsNotNull("price"), Match("name", PredicateIn, db.StringValue("a"), db.NullValue()))),
+		)},
+		{Op: OpGet, Handle: 300, ColNames: []string{"id", "name"}},
+		{Op: OpDelete, Handle: 1},
+		{Op: OpRelease, Handle: 2},
+	}
+
+	var buf bytes.Buffer
+	for _, req := range requests {
+		assert.NoError(t, WriteRequest(&buf, req))
+	}
+	for _, req := range requests {
+		got, err := ReadRequest(&buf)
+		assert.NoError(t, err)
+		normalize(req)
+		assert.Equal(t, req, got, req.Op.String())
+	}
+	_, err := ReadRequest(&buf)
+	assert.Equal(t, io.EOF, err)
+}
+
+// normalize turns nil slices into the empty ones the decoder returns.
+func normalize(req *Request) {
+	switch req.Op {
+	case OpCreateTable:
+		if req.PrimaryKey == nil {
+			req.PrimaryKey = []string{}
+		}
+	case OpGet, OpInsert:
+		if req.ColNames == nil {
+			req.ColNames = []string{}
+		}
+		if req.Op == OpInsert && req.Rows == nil {
+			req.Rows = [][]db.Value{}
+		}
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	responses := []*Response{
+		{Err: "Cannot get table with name items: does not exist"},
+		{Handle: 3, RowsAffected: 2, Rows: [][]db.Value{}},
+		{Columns: []string{"id", "name"}, Types: []db.ColumnType{db.TypeInt64, db.TypeString},
+			Rows: [][]db.Value{{db.Int64Value(1), db.StringValue("fig")}, {db.Int64Value(2), db.NullValue()}}},
+	}
+
+	var buf bytes.Buffer
+	for _, resp := range responses {
+		assert.NoError(t, WriteResponse(&buf, resp))
+	}
+	for _, resp := range responses {
+		got, err := ReadResponse(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, resp, got)
+	}
+}
+
+func TestMalformedFrames(t *testing.T) {
+	t.Run("oversized frame", func(t *testing.T) {
+		var header [4]byte
+		binary.BigEndian.PutUint32(header[:], MaxFrameSize+1)
+		_, err := ReadFrame(bytes.NewReader(header[:]))
+		assert.ErrorContains(t, err, "exceeds the maximum")
+	})
+
+	t.Run("truncated frame", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteFrame(&buf, []byte{1, 2, 3}))
+		_, err := ReadFrame(bytes.NewReader(buf.Bytes()[:5]))
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	})
+
+	tests := []struct {
+		name    string
+		payload []byte
+		err     string
+	}{
+		{"empty", nil, "malformed request: unexpected EOF"},
+		{"unknown op", []byte{99}, "malformed request: unknown op 99"},
+		{"trailing bytes", []byte{byte(OpDelete), 1, 0}, "malformed request: 1 unexpected trailing bytes"},
+		{"huge count", []byte{byte(OpExec), 0xff, 0xff, 0x03}, "malformed request: unexpected EOF"},
+		{"unknown type", []byte{byte(OpInsert), 0, 1, 't', 1, 1, 'x', 1, 9}, "malformed request: unknown column type 9"},
+		{"unknown filter", []byte{byte(OpSelect), 0, 1, 't', 42}, "malformed request: invalid filter: unknown kind 42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeRequest(tt.payload)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+
+	deep := IsNull("x")
+	for i := 0; i <= maxFilterDepth; i++ {
+		deep = Not(deep)
+	}
+	payload, err := appendRequest(nil, &Request{Op: OpSelect, Table: "t", Filter: deep})
+	assert.NoError(t, err)
+	_, err = DecodeRequest(payload)
+	assert.ErrorContains(t, err, "filter nested deeper than 64")
+
+	_, err = DecodeResponse([]byte{7})
+	assert.EqualError(t, err, "malformed response: unknown status 7")
+}
+
+func TestWriteInvalidRequest(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteRequest(&buf, &Request{Op: OpInsert, ColNames: []string{"a", "b"}, Rows: [][]db.Value{{db.Int64Value(1)}}})
+	assert.EqualError(t, err, "insert has 2 columns but row 1 has 1 values")
+	err = WriteRequest(&buf, &Request{Op: OpSelect, Filter: And(IsNull("a"), nil)})
+	assert.EqualError(t, err, "invalid filter: missing operand")
+	err = WriteRequest(&buf, &Request{Op: 0})
+	assert.EqualError(t, err, "unknown op Op(0)")
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestDbFilter(t *testing.T) {
+	f, err := And(
+		Match("id", PredicateGe, db.Int64Value(3)),
+		Not(Match("name", PredicateIn, db.StringValue("a"), db.StringValue("b"))),
+		Or(IsNull("price"), Match("price", PredicateBetween, db.Float64Value(1), db.Float64Value(2))),
+	).DbFilter()
+	assert.NoError(t, err)
+	assert.Equal(t, "((id >= 3 AND name NOT IN (a, b)) AND (price IS NULL OR price BETWEEN 1 AND 2))", f.String())
+
+	_, err = Match("id", PredicateEq).DbFilter()
+	assert.EqualError(t, err, "invalid filter on column id: predicate takes 1 operand, got 0")
+	_, err = Match("id", PredicateBetween, db.Int64Value(1)).DbFilter()
+	assert.EqualError(t, err, "invalid filter on column id: BETWEEN takes 2 operands, got 1")
+	_, err = Match("id", 77, db.Int64Value(1)).DbFilter()
+	assert.EqualError(t, err, "invalid filter on column id: unknown predicate 77")
+}
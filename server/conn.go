@@ -0,0 +1,289 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/moh-osman3/MoDb/protocol"
+	"go.uber.org/zap"
+)
+
+// cursor holds the rows matched by an OpSelect until OpRelease.
+type cursor struct {
+	// get reads the named columns of the matched rows, by default all of
+	// them, and returns them with their types.
+	get func(colNames []string) ([]string, []db.ColumnType, [][]db.Value, error)
+	// delete deletes the matched rows that are still live.
+	delete func() (int64, error)
+}
+
+// conn serves the requests of one client connection in order.
+type conn struct {
+	srv     *Server
+	netConn net.Conn
+	logger  *zap.Logger
+	session *db.Session
+	cursors map[uint64]*cursor
+	// nextHandle is the handle of the next cursor, starting at 1 so that 0
+	// never names one.
+	nextHandle uint64
+}
+
+func newConn(srv *Server, netConn net.Conn) *conn {
+	return &conn{
+		srv:        srv,
+		netConn:    netConn,
+		logger:     srv.logger.With(zap.Stringer("remote", netConn.RemoteAddr())),
+		session:    srv.dbm.NewSession(),
+		cursors:    make(map[uint64]*cursor),
+		nextHandle: 1,
+	}
+}
+
+// serve answers requests until the client disconnects, the connection
+// fails or the server shuts down.
+func (c *conn) serve(ctx context.Context) {
+	defer c.netConn.Close()
+	c.logger.Debug("client connected")
+
+	r := bufio.NewReader(c.netConn)
+	w := bufio.NewWriter(c.netConn)
+	for {
+		payload, err := protocol.ReadFrame(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, io.EOF), errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, net.ErrClosed):
+				c.logger.Debug("client disconnected")
+			default:
+				c.logger.Warn("closing connection", zap.Error(err))
+			}
+			return
+		}
+
+		var resp *protocol.Response
+		req, err := protocol.DecodeRequest(payload)
+		if err == nil {
+			resp, err = c.handle(ctx, req)
+		}
+		if err != nil {
+			resp = &protocol.Response{Err: err.Error()}
+		}
+
+		if err := protocol.WriteResponse(w, resp); err != nil {
+			// the result does not fit in a frame, but the client still
+			// expects an answer
+			resp = &protocol.Response{Err: err.Error()}
+			if err := protocol.WriteResponse(w, resp); err != nil {
+				c.logger.Warn("closing connection", zap.Error(err))
+				return
+			}
+		}
+		if err := w.Flush(); err != nil {
+			c.logger.Warn("closing connection", zap.Error(err))
+			return
+		}
+	}
+}
+
+func (c *conn) handle(ctx context.Context, req *protocol.Request) (*protocol.Response, error) {
+	dbm := c.srv.dbm
+	switch req.Op {
+	case protocol.OpExec:
+		res, err := c.session.Exec(ctx, req.SQL)
+		if err != nil {
+			return nil, err
+		}
+		return &protocol.Response{RowsAffected: res.RowsAffected, Columns: res.Columns, Types: res.Types, Rows: res.Rows}, nil
+	case protocol.OpCreateDb:
+		_, err := dbm.CreateDb(req.Db)
+		return &protocol.Response{}, err
+	case protocol.OpDropDb:
+		return &protocol.Response{}, dbm.DeleteDb(req.Db)
+	case protocol.OpCreateTable:
+		return &protocol.Response{}, c.createTable(req)
+	case protocol.OpDropTable:
+		dbName, err := c.dbName(req)
+		if err != nil {
+			return nil, err
+		}
+		d, err := dbm.GetDb(dbName)
+		if err != nil {
+			return nil, err
+		}
+		return &protocol.Response{}, d.DeleteTable(req.Table)
+	case protocol.OpInsert:
+		return c.insert(req)
+	case protocol.OpSelect:
+		return c.selectRows(req)
+	case protocol.OpGet:
+		cur, err := c.cursor(req.Handle)
+		if err != nil {
+			return nil, err
+		}
+		names, types, rows, err := cur.get(req.ColNames)
+		if err != nil {
+			return nil, err
+		}
+		return &protocol.Response{Handle: req.Handle, Columns: names, Types: types, Rows: rows}, nil
+	case protocol.OpDelete:
+		cur, err := c.cursor(req.Handle)
+		if err != nil {
+			return nil, err
+		}
+		numDeleted, err := cur.delete()
+		if err != nil {
+			return nil, err
+		}
+		return &protocol.Response{Handle: req.Handle, RowsAffected: numDeleted}, nil
+	case protocol.OpRelease:
+		if _, err := c.cursor(req.Handle); err != nil {
+			return nil, err
+		}
+		delete(c.cursors, req.Handle)
+		return &protocol.Response{}, nil
+	}
+	return nil, fmt.Errorf("unknown op %s", req.Op)
+}
+
+// dbName returns the database of a request, by default the one the
+// session selected with USE.
+func (c *conn) dbName(req *protocol.Request) (string, error) {
+	if req.Db != "" {
+		return req.Db, nil
+	}
+	if name := c.session.Database(); name != "" {
+		return name, nil
+	}
+	return "", fmt.Errorf("no database selected for table %s: name one in the request or USE a database", req.Table)
+}
+
+func (c *conn) createTable(req *protocol.Request) error {
+	dbName, err := c.dbName(req)
+	if err != nil {
+		return err
+	}
+	d, err := c.srv.dbm.GetDb(dbName)
+	if err != nil {
+		return err
+	}
+	defs := make([]db.ColumnDef, len(req.Columns))
+	for i, col := range req.Columns {
+		defs[i] = db.NewColumnDef(col.Name, col.Type)
+		if col.NotNull {
+			defs[i] = defs[i].NotNull()
+		}
+	}
+	schema, err := db.NewSchema(defs...)
+	if err != nil {
+		return err
+	}
+	if len(req.PrimaryKey) > 0 {
+		if schema, err = schema.PrimaryKey(req.PrimaryKey...); err != nil {
+			return err
+		}
+	}
+	_, err = d.CreateTable(req.Table, db.WithSchema(schema))
+	return err
+}
+
+func (c *conn) insert(req *protocol.Request) (*protocol.Response, error) {
+	dbName, err := c.dbName(req)
+	if err != nil {
+		return nil, err
+	}
+	d, err := c.srv.dbm.GetDb(dbName)
+	if err != nil {
+		return nil, err
+	}
+	tbl, err := d.GetTable(req.Table)
+	if err != nil {
+		return nil, err
+	}
+	if err := tbl.InsertValueRows(req.ColNames, req.Rows); err != nil {
+		return nil, err
+	}
+	return &protocol.Response{RowsAffected: int64(len(req.Rows))}, nil
+}
+
+// selectRows filters a table and keeps the matched rows under a new handle.
+// The handle fails once a vacuum renumbers the rows of the table.
+func (c *conn) selectRows(req *protocol.Request) (*protocol.Response, error) {
+	if n := c.srv.maxCursors; n > 0 && len(c.cursors) >= n {
+		return nil, fmt.Errorf("too many open cursors: release one of the %d first", n)
+	}
+	dbName, err := c.dbName(req)
+	if err != nil {
+		return nil, err
+	}
+	d, err := c.srv.dbm.GetDb(dbName)
+	if err != nil {
+		return nil, err
+	}
+	tbl, err := d.GetTable(req.Table)
+	if err != nil {
+		return nil, err
+	}
+	f, err := req.Filter.DbFilter()
+	if err != nil {
+		return nil, err
+	}
+	matched, err := tbl.Filter(f)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := c.nextHandle
+	c.nextHandle++
+	c.cursors[handle] = &cursor{
+		get: func(colNames []string) ([]string, []db.ColumnType, [][]db.Value, error) {
+			if len(colNames) == 0 {
+				colNames = tbl.ColumnNames()
+			}
+			types := make([]db.ColumnType, len(colNames))
+			for i, colName := range colNames {
+				col, err := tbl.GetColumn(colName)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				types[i] = col.Type()
+			}
+			cols, err := tbl.GetColumns(matched, colNames)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			return colNames, types, transpose(cols, matched.NumResults()), nil
+		},
+		delete: func() (int64, error) {
+			return tbl.DeleteMatching(matched)
+		},
+	}
+	return &protocol.Response{Handle: handle, RowsAffected: int64(matched.NumResults())}, nil
+}
+
+func (c *conn) cursor(handle uint64) (*cursor, error) {
+	cur, ok := c.cursors[handle]
+	if !ok {
+		return nil, fmt.Errorf("unknown handle %d: select rows first or check it was not released", handle)
+	}
+	return cur, nil
+}
+
+// transpose turns the columns of numRows values that GetColumns returns
+// into rows.
+func transpose(cols [][]db.Value, numRows int) [][]db.Value {
+	rows := make([][]db.Value, numRows)
+	for r := range rows {
+		row := make([]db.Value, len(cols))
+		for i, col := range cols {
+			row[i] = col[r]
+		}
+		rows[r] = row
+	}
+	return rows
+}
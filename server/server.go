@@ -0,0 +1,146 @@
+// Package server serves a db.Manager over TCP with the binary wire protocol
+// of the protocol package:
+//
+//	srv := server.New(dbm, logger, server.WithMaxConnections(32))
+//	go srv.ListenAndServe(":7070")
+//	...
+//	err := srv.Shutdown(ctx)
+//
+// Every connection has its own db.Session, so a USE statement sent with
+// OpExec selects the database of the following requests on that
+// connection only, and its own handles to the rows it selected.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/moh-osman3/MoDb/internal/netserver"
+	"github.com/moh-osman3/MoDb/protocol"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// DefaultMaxConnections is the number of connections a server serves at
+// once unless configured with WithMaxConnections.
+const DefaultMaxConnections = netserver.DefaultMaxConnections
+
+// DefaultMaxCursors is the number of cursors a connection keeps open at
+// once unless configured with WithMaxCursors.
+const DefaultMaxCursors = 1000
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown.
+var ErrServerClosed = netserver.ErrServerClosed
+
+// rejectTimeout bounds the time spent telling a client over the connection
+// limit why it is disconnected.
+const rejectTimeout = time.Second
+
+// Server accepts connections and answers their requests against a manager.
+type Server struct {
+	// base runs the listeners and connections.
+	base *netserver.Server
+
+	dbm        db.Manager
+	logger     *zap.Logger
+	maxConns   int
+	maxCursors int
+}
+
+// Option configures optional behaviour of a Server.
+type Option func(*Server)
+
+// WithMaxConnections limits the number of connections served at once. A
+// client connecting over the limit gets an error response and is
+// disconnected. n <= 0 removes the limit.
+func WithMaxConnections(n int) Option {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
+// WithMaxCursors limits the number of cursors each connection keeps open.
+// Selecting rows over the limit fails until the client releases a cursor.
+// n <= 0 removes the limit.
+func WithMaxCursors(n int) Option {
+	return func(s *Server) {
+		s.maxCursors = n
+	}
+}
+
+// New returns a server for dbm, which must already be started.
+func New(dbm db.Manager, logger *zap.Logger, opts ...Option) *Server {
+	s := &Server{
+		dbm:        dbm,
+		logger:     logger,
+		maxConns:   DefaultMaxConnections,
+		maxCursors: DefaultMaxCursors,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.base = netserver.New(func(ctx context.Context, netConn net.Conn) {
+		newConn(s, netConn).serve(ctx)
+	}, s.admit)
+	return s
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections
+// until Shutdown.
+func (s *Server) ListenAndServe(addr string) error {
+	return s.base.ListenAndServe(addr)
+}
+
+// Serve accepts connections on l until Shutdown, which closes l. It always
+// returns a non-nil error, ErrServerClosed after Shutdown.
+func (s *Server) Serve(l net.Listener) error {
+	return s.base.Serve(l)
+}
+
+// admit rejects a connection over the connection limit.
+func (s *Server) admit(netConn net.Conn, numConns int) bool {
+	if s.maxConns <= 0 || numConns < s.maxConns {
+		return true
+	}
+	s.logger.Warn("rejecting connection over the limit",
+		zap.Stringer("remote", netConn.RemoteAddr()), zap.Int("max_connections", s.maxConns))
+	s.base.Go(func() {
+		s.reject(netConn, fmt.Sprintf("too many connections: the server accepts at most %d", s.maxConns))
+	})
+	return false
+}
+
+// reject answers a connection with an error and closes it.
+func (s *Server) reject(netConn net.Conn, msg string) {
+	defer netConn.Close()
+	netConn.SetWriteDeadline(time.Now().Add(rejectTimeout))
+	protocol.WriteResponse(netConn, &protocol.Response{Err: msg})
+}
+
+// Shutdown stops the server gracefully and ends its manager. It closes the
+// listeners, lets every connection finish the request it is running and
+// disconnects it, then calls Manager.End, which checkpoints a manager with
+// a data directory. If ctx ends first, running requests are cancelled and
+// their connections closed, and Shutdown returns the context's error along
+// with any from End once they have returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.base.Shutdown(ctx)
+	if errors.Is(err, ErrServerClosed) {
+		return err
+	}
+	return multierr.Append(err, s.dbm.End())
+}
+
+// Addrs returns the addresses the server is listening on.
+func (s *Server) Addrs() []net.Addr {
+	return s.base.Addrs()
+}
+
+// NumConnections returns the number of connections being served.
+func (s *Server) NumConnections() int {
+	return s.base.NumConnections()
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/moh-osman3/MoDb/client"
+	"github.com/moh-osman3/MoDb/db"
+	"github.com/moh-osman3/MoDb/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// startServer serves dbm on a local port and returns the server with its
+// address and the error channel of Serve.
+func startServer(t *testing.T, dbm db.Manager, opts ...Option) (*Server, string, chan error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := New(dbm, zap.NewNop(), opts...)
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(l)
+	}()
+	return srv, l.Addr().String(), served
+}
+
+func startManager(t *testing.T, opts ...db.ManagerOption) db.Manager {
+	dbm := db.NewDefaultManager(zap.NewNop(), opts...)
+	require.NoError(t, dbm.Start(context.Background()))
+	return dbm
+}
+
+func dial(t *testing.T, addr string) *client.Client {
+	c, err := client.Dial(context.Background(), addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	srv, addr, _ := startServer(t, startManager(t))
+	defer srv.Shutdown(ctx)
+
+	first := dial(t, addr)
+	second := dial(t, addr)
+	require.NoError(t, first.CreateDb(ctx, "shop"))
+	_, err := first.Exec(ctx, "USE shop")
+	require.NoError(t, err)
+	require.NoError(t, first.CreateTable(ctx, "", "items", []protocol.Column{{Name: "a", Type: db.TypeInt64}}))
+
+	// the second connection has not selected a database
+	err = second.CreateTable(ctx, "", "other", []protocol.Column{{Name: "a", Type: db.TypeInt64}})
+	assert.EqualError(t, err, "no database selected for table other: name one in the request or USE a database")
+	_, err = second.Exec(ctx, "SELECT * FROM items")
+	assert.ErrorContains(t, err, "no database selected for table items")
+
+	// cursors belong to the connection that selected them
+	cur, err := first.Select(ctx, "", "items", nil)
+	require.NoError(t, err)
+	_, err = first.Insert(ctx, "", "items", []string{"a"}, [][]db.Value{{db.Int64Value(1)}})
+	require.NoError(t, err)
+	other, err := second.Select(ctx, "shop", "items", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), other.Count)
+	require.NoError(t, cur.Release(ctx))
+	res, err := other.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, [][]db.Value{{db.Int64Value(1)}}, res.Rows)
+}
+
+func TestMaxConnections(t *testing.T) {
+	ctx := context.Background()
+	srv, addr, _ := startServer(t, startManager(t), WithMaxConnections(2))
+	defer srv.Shutdown(ctx)
+
+	first := dial(t, addr)
+	second := dial(t, addr)
+	require.NoError(t, first.CreateDb(ctx, "a"))
+	require.NoError(t, second.CreateDb(ctx, "b"))
+	assert.Equal(t, 2, srv.NumConnections())
+
+	third := dial(t, addr)
+	_, err := third.Exec(ctx, "USE x")
+	var serverErr *client.ServerError
+	assert.ErrorAs(t, err, &serverErr)
+	assert.EqualError(t, err, "too many connections: the server accepts at most 2")
+
+	// a slot frees up when a client disconnects
+	require.NoError(t, first.Close())
+	assert.Eventually(t, func() bool { return srv.NumConnections() == 1 }, time.Second, time.Millisecond)
+	fourth := dial(t, addr)
+	assert.NoError(t, fourth.CreateDb(ctx, "x"))
+}
+
+func TestCursors(t *testing.T) {
+	ctx := context.Background()
+	dbm := startManager(t)
+	srv, addr, _ := startServer(t, dbm, WithMaxCursors(2))
+	defer srv.Shutdown(ctx)
+
+	c := dial(t, addr)
+	require.NoError(t, c.CreateDb(ctx, "shop"))
+	require.NoError(t, c.CreateTable(ctx, "shop", "items", []protocol.Column{{Name: "a", Type: db.TypeInt64}}))
+	_, err := c.Insert(ctx, "shop", "items", []string{"a"}, [][]db.Value{{db.Int64Value(1)}, {db.Int64Value(2)}, {db.Int64Value(3)}})
+	require.NoError(t, err)
+
+	first, err := c.Select(ctx, "shop", "items", protocol.Match("a", protocol.PredicateLt, db.Int64Value(2)))
+	require.NoError(t, err)
+	second, err := c.Select(ctx, "shop", "items", protocol.Match("a", protocol.PredicateGt, db.Int64Value(2)))
+	require.NoError(t, err)
+	_, err = c.Select(ctx, "shop", "items", nil)
+	assert.EqualError(t, err, "too many open cursors: release one of the 2 first")
+
+	// a vacuum renumbers the rows, so cursors from before it fail
+	_, err = first.Delete(ctx)
+	require.NoError(t, err)
+	require.NoError(t, first.Release(ctx))
+	d, err := dbm.GetDb("shop")
+	require.NoError(t, err)
+	tbl, err := d.GetTable("items")
+	require.NoError(t, err)
+	_, err = tbl.Vacuum()
+	require.NoError(t, err)
+	_, err = second.Get(ctx)
+	assert.ErrorContains(t, err, "the table was vacuumed after it was filtered")
+	_, err = second.Delete(ctx)
+	assert.ErrorContains(t, err, "the table was vacuumed after it was filtered")
+	require.NoError(t, second.Release(ctx))
+
+	fresh, err := c.Select(ctx, "shop", "items", protocol.Match("a", protocol.PredicateGt, db.Int64Value(2)))
+	require.NoError(t, err)
+	res, err := fresh.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, [][]db.Value{{db.Int64Value(3)}}, res.Rows)
+}
+
+func TestMalformedRequest(t *testing.T) {
+	ctx := context.Background()
+	srv, addr, _ := startServer(t, startManager(t))
+	defer srv.Shutdown(ctx)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, protocol.WriteFrame(conn, []byte{byte(protocol.OpCreateDb), 5, 'a'}))
+	resp, err := protocol.ReadResponse(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "malformed request: unexpected EOF", resp.Err)
+
+	// the connection is still in sync
+	require.NoError(t, protocol.WriteRequest(conn, &protocol.Request{Op: protocol.OpCreateDb, Db: "a"}))
+	resp, err = protocol.ReadResponse(conn)
+	require.NoError(t, err)
+	assert.Empty(t, resp.Err)
+
+	require.NoError(t, protocol.WriteRequest(conn, &protocol.Request{Op: protocol.OpGet, Handle: 7}))
+	resp, err = protocol.ReadResponse(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "unknown handle 7: select rows first or check it was not released", resp.Err)
+}
+
+func TestShutdown(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	srv, addr, served := startServer(t, startManager(t, db.WithDataDir(dir)))
+
+	c := dial(t, addr)
+	idle := dial(t, addr)
+	_, err := c.Exec(ctx, "CREATE DATABASE shop")
+	require.NoError(t, err)
+	_, err = c.Exec(ctx, "CREATE TABLE shop.items (id INT PRIMARY KEY, name TEXT)")
+	require.NoError(t, err)
+	_, err = c.Exec(ctx, "INSERT INTO shop.items VALUES (1, 'fig'), (2, 'kiwi')")
+	require.NoError(t, err)
+	_, err = idle.Exec(ctx, "USE shop")
+	require.NoError(t, err)
+
+	require.NoError(t, srv.Shutdown(ctx))
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+	assert.Equal(t, 0, srv.NumConnections())
+	assert.ErrorIs(t, srv.Shutdown(ctx), ErrServerClosed)
+
+	_, err = idle.Exec(ctx, "SELECT * FROM items")
+	assert.Error(t, err)
+	_, err = client.Dial(ctx, addr)
+	assert.Error(t, err)
+
+	// Shutdown ended the manager, which checkpointed the data directory
+	dbm := startManager(t, db.WithDataDir(dir))
+	defer dbm.End()
+	res, err := dbm.Exec(ctx, "SELECT name FROM shop.items WHERE id = 2")
+	require.NoError(t, err)
+	assert.Equal(t, [][]db.Value{{db.StringValue("kiwi")}}, res.Rows)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	srv, addr, _ := startServer(t, startManager(t))
+
+	// a client that sent half a frame is cut off rather than waited for
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte{0, 0, 0, 10, byte(protocol.OpExec)})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return srv.NumConnections() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, srv.NumConnections())
+}
+
+func TestServeAfterShutdown(t *testing.T) {
+	srv := New(startManager(t), zap.NewNop())
+	require.NoError(t, srv.Shutdown(context.Background()))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.ErrorIs(t, srv.Serve(l), ErrServerClosed)
+	_, err = net.Dial("tcp", l.Addr().String())
+	assert.Error(t, err, "Serve closes the listener")
+}
@@ -0,0 +1,297 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/moh-osman3/MoDb/db"
+)
+
+// conn runs statements in a session of the manager of a data directory.
+type conn struct {
+	dataDir string
+	dbm     db.Manager
+	session *db.Session
+	// tx is the open transaction, if any.
+	tx     *tx
+	closed bool
+}
+
+var (
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.ConnPrepareContext = (*conn)(nil)
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.Pinger             = (*conn)(nil)
+	_ driver.SessionResetter    = (*conn)(nil)
+	_ driver.Validator          = (*conn)(nil)
+)
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext checks that query lexes; it is parsed each time it runs.
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if _, err := db.SplitSQL(query); err != nil {
+		return nil, err
+	}
+	return &stmt{conn: c, query: query}, nil
+}
+
+// Close releases the connection's use of the manager, which checkpoints
+// the data directory when it is the last connection to it.
+func (c *conn) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return managers.release(c.dataDir)
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx starts a transaction. Statements apply as they run and cannot be
+// undone, so a transaction only reads: its session refuses writes until
+// Commit or Rollback. Only the default isolation level is accepted.
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, fmt.Errorf("a transaction is already open on this connection")
+	}
+	if sql.IsolationLevel(opts.Isolation) != sql.LevelDefault {
+		return nil, fmt.Errorf("isolation level %s is not supported", sql.IsolationLevel(opts.Isolation))
+	}
+	if opts.ReadOnly {
+		return nil, fmt.Errorf("read-only transactions are not supported")
+	}
+	c.tx = &tx{conn: c}
+	c.session.SetReadOnly(true)
+	return c.tx, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.exec(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return result(res.RowsAffected), nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res, err := c.exec(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{res: res}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if c.closed {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+// ResetSession forgets the database selected with USE before the
+// connection is reused.
+func (c *conn) ResetSession(ctx context.Context) error {
+	c.session = c.dbm.NewSession()
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	return !c.closed
+}
+
+// exec binds args to the placeholders of a single statement and runs it.
+func (c *conn) exec(ctx context.Context, query string, args []driver.NamedValue) (*db.Result, error) {
+	vals := make([]db.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("named argument %s is not supported: use ? placeholders", arg.Name)
+		}
+		var err error
+		if vals[i], err = dbValue(arg.Value); err != nil {
+			return nil, fmt.Errorf("argument %d: %v", arg.Ordinal, err)
+		}
+	}
+	query, err := db.BindSQL(query, vals...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.session.Exec(ctx, query)
+}
+
+// dbValue converts a driver value to a db value.
+func dbValue(v driver.Value) (db.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return db.NullValue(), nil
+	case int64:
+		return db.Int64Value(v), nil
+	case float64:
+		return db.Float64Value(v), nil
+	case bool:
+		return db.BoolValue(v), nil
+	case string:
+		return db.StringValue(v), nil
+	case []byte:
+		return db.StringValue(string(v)), nil
+	case time.Time:
+		return db.TimestampValue(v), nil
+	}
+	return db.Value{}, fmt.Errorf("unsupported type %T", v)
+}
+
+// driverValue converts a db value to a driver value.
+func driverValue(val db.Value) driver.Value {
+	if val.IsNull() {
+		return nil
+	}
+	switch val.Type() {
+	case db.TypeFloat64:
+		return val.Float64()
+	case db.TypeString:
+		return val.Str()
+	case db.TypeBool:
+		return val.Bool()
+	case db.TypeTimestamp:
+		return val.Time()
+	}
+	return val.Int64()
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+var (
+	_ driver.StmtExecContext  = (*stmt)(nil)
+	_ driver.StmtQueryContext = (*stmt)(nil)
+)
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput returns -1, leaving it to BindSQL to check the number of
+// arguments.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// result reports the rows a statement affected. MoDB has no insert ids.
+type result int64
+
+func (r result) LastInsertId() (int64, error) {
+	return 0, fmt.Errorf("LastInsertId is not supported")
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+// rows iterates over the rows of a result.
+type rows struct {
+	res *db.Result
+	pos int
+}
+
+var (
+	_ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+	_ driver.RowsColumnTypeScanType         = (*rows)(nil)
+)
+
+func (r *rows) Columns() []string {
+	return r.res.Columns
+}
+
+func (r *rows) Close() error {
+	r.pos = len(r.res.Rows)
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.res.Rows) {
+		return io.EOF
+	}
+	for i, val := range r.res.Rows[r.pos] {
+		dest[i] = driverValue(val)
+	}
+	r.pos++
+	return nil
+}
+
+// ColumnTypeDatabaseTypeName returns the type name of a column, e.g.
+// "INT64".
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(r.res.Types[index].String())
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	switch r.res.Types[index] {
+	case db.TypeFloat64:
+		return reflect.TypeOf(float64(0))
+	case db.TypeString:
+		return reflect.TypeOf("")
+	case db.TypeBool:
+		return reflect.TypeOf(false)
+	case db.TypeTimestamp:
+		return reflect.TypeOf(time.Time{})
+	}
+	return reflect.TypeOf(int64(0))
+}
+
+// tx is a read-only transaction, which has nothing to commit or undo.
+type tx struct {
+	conn *conn
+}
+
+func (t *tx) Commit() error {
+	t.end()
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	t.end()
+	return nil
+}
+
+func (t *tx) end() {
+	t.conn.tx = nil
+	t.conn.session.SetReadOnly(false)
+}
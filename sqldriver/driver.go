@@ -0,0 +1,127 @@
+// Package sqldriver registers an embedded MoDB as the database/sql driver
+// "modb". The data source name is the data directory, which is created if
+// missing:
+//
+//	sqlDb, err := sql.Open("modb", "file:/var/lib/modb")
+//	_, err = sqlDb.Exec("CREATE DATABASE shop")
+//	rows, err := sqlDb.Query("SELECT id, name FROM shop.items WHERE price < ?", 10.5)
+//
+// Connections to the same directory share one manager, which replays the
+// directory's write-ahead log when the first connection opens and
+// checkpoints it when the last one closes. Statements are SQL as accepted
+// by db.Session, with ? placeholders bound from the arguments.
+//
+// Each connection is a db.Session whose USE statements last until the
+// connection returns to the pool, so they only carry over to later
+// statements within a sql.Conn or sql.Tx. Elsewhere qualify table names
+// with their database.
+//
+// MoDB applies every statement as it runs and cannot undo it, so
+// transactions are read-only: a statement that writes fails in a
+// transaction before it runs. Commit and Rollback always succeed.
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/moh-osman3/MoDb/db"
+	"go.uber.org/zap"
+)
+
+func init() {
+	sql.Register("modb", &Driver{})
+}
+
+// Driver opens connections to embedded MoDB data directories.
+type Driver struct{}
+
+// Open opens a connection to the data directory named by dsn, of the form
+// file:/path.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+// OpenConnector parses dsn once for every connection of a sql.DB.
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	path, ok := strings.CutPrefix(dsn, "file:")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("invalid data source name %q: want file:/path/to/data/dir", dsn)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{driver: d, dataDir: path}, nil
+}
+
+type connector struct {
+	driver  *Driver
+	dataDir string
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dbm, err := managers.acquire(c.dataDir)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{dataDir: c.dataDir, dbm: dbm, session: dbm.NewSession()}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// managers holds the manager of every open data directory.
+var managers = &managerRegistry{managers: make(map[string]*sharedManager)}
+
+type sharedManager struct {
+	dbm  db.Manager
+	refs int
+}
+
+type managerRegistry struct {
+	lock     sync.Mutex
+	managers map[string]*sharedManager
+}
+
+// acquire returns the manager of a data directory, starting it if no
+// connection uses it yet.
+func (r *managerRegistry) acquire(dataDir string) (db.Manager, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if m, ok := r.managers[dataDir]; ok {
+		m.refs++
+		return m.dbm, nil
+	}
+	dbm := db.NewDefaultManager(zap.NewNop(), db.WithDataDir(dataDir))
+	if err := dbm.Start(context.Background()); err != nil {
+		return nil, err
+	}
+	r.managers[dataDir] = &sharedManager{dbm: dbm, refs: 1}
+	return dbm, nil
+}
+
+// release drops a connection's use of a manager, ending the manager with
+// the last one.
+func (r *managerRegistry) release(dataDir string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	m := r.managers[dataDir]
+	if m.refs--; m.refs > 0 {
+		return nil
+	}
+	delete(r.managers, dataDir)
+	return m.dbm.End()
+}
@@ -0,0 +1,166 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func open(t *testing.T, dataDir string) *sql.DB {
+	sqlDb, err := sql.Open("modb", "file:"+dataDir)
+	require.NoError(t, err)
+	return sqlDb
+}
+
+func TestDriver(t *testing.T) {
+	dataDir := t.TempDir()
+	sqlDb := open(t, dataDir)
+	defer sqlDb.Close()
+
+	_, err := sqlDb.Exec("CREATE DATABASE shop")
+	require.NoError(t, err)
+	_, err = sqlDb.Exec("CREATE TABLE shop.items (id INT PRIMARY KEY, name TEXT, price FLOAT, sold BOOL, added TIMESTAMP)")
+	require.NoError(t, err)
+
+	added := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	res, err := sqlDb.Exec("INSERT INTO shop.items (id, name, price, sold, added) VALUES (?, ?, ?, ?, ?), (2, 'kiwi', NULL, FALSE, NULL)",
+		1, "it's", 2.5, true, added)
+	require.NoError(t, err)
+	n, err := res.RowsAffected()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	_, err = res.LastInsertId()
+	assert.Error(t, err)
+
+	t.Run("query", func(t *testing.T) {
+		rows, err := sqlDb.Query("SELECT id, name, price, sold, added FROM shop.items WHERE id >= ?", 1)
+		require.NoError(t, err)
+		defer rows.Close()
+
+		cols, err := rows.ColumnTypes()
+		require.NoError(t, err)
+		assert.Equal(t, "INT64", cols[0].DatabaseTypeName())
+		assert.Equal(t, "TIMESTAMP", cols[4].DatabaseTypeName())
+
+		var (
+			id    int64
+			name  string
+			price sql.NullFloat64
+			sold  bool
+			when  sql.NullTime
+		)
+		require.True(t, rows.Next())
+		require.NoError(t, rows.Scan(&id, &name, &price, &sold, &when))
+		assert.Equal(t, int64(1), id)
+		assert.Equal(t, "it's", name)
+		assert.Equal(t, sql.NullFloat64{Float64: 2.5, Valid: true}, price)
+		assert.True(t, sold)
+		assert.Equal(t, added, when.Time)
+
+		require.True(t, rows.Next())
+		require.NoError(t, rows.Scan(&id, &name, &price, &sold, &when))
+		assert.Equal(t, int64(2), id)
+		assert.False(t, price.Valid)
+		assert.False(t, when.Valid)
+		assert.False(t, rows.Next())
+		assert.NoError(t, rows.Err())
+	})
+
+	t.Run("prepared statement", func(t *testing.T) {
+		stmt, err := sqlDb.Prepare("SELECT name FROM shop.items WHERE id = ?")
+		require.NoError(t, err)
+		defer stmt.Close()
+		var name string
+		require.NoError(t, stmt.QueryRow(2).Scan(&name))
+		assert.Equal(t, "kiwi", name)
+		assert.ErrorIs(t, stmt.QueryRow(3).Scan(&name), sql.ErrNoRows)
+
+		_, err = sqlDb.Prepare("SELECT 'x")
+		assert.EqualError(t, err, "syntax error at position 7: unterminated string")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := sqlDb.Exec("SELECT * FROM shop.items WHERE id = ?")
+		assert.EqualError(t, err, "statement has more placeholders than the 0 arguments")
+		_, err = sqlDb.Exec("SELECT * FROM shop.items WHERE id = :id", sql.Named("id", 1))
+		assert.EqualError(t, err, "named argument id is not supported: use ? placeholders")
+		_, err = sqlDb.Exec("INSERT INTO shop.items (id) VALUES (1)")
+		assert.ErrorContains(t, err, "duplicate key")
+	})
+
+	t.Run("session", func(t *testing.T) {
+		ctx := context.Background()
+		c, err := sqlDb.Conn(ctx)
+		require.NoError(t, err)
+		_, err = c.ExecContext(ctx, "USE shop")
+		require.NoError(t, err)
+		var id int64
+		require.NoError(t, c.QueryRowContext(ctx, "SELECT id FROM items WHERE id = 1").Scan(&id))
+		require.NoError(t, c.Close())
+
+		// USE does not outlive the connection's checkout
+		sqlDb.SetMaxOpenConns(1)
+		_, err = sqlDb.Exec("SELECT id FROM items")
+		assert.ErrorContains(t, err, "no database selected")
+	})
+
+	t.Run("transactions", func(t *testing.T) {
+		_, err := sqlDb.Exec("UPDATE shop.items SET price = ? WHERE id = 2", 4.0)
+		require.NoError(t, err)
+
+		tx, err := sqlDb.Begin()
+		require.NoError(t, err)
+		var price float64
+		require.NoError(t, tx.QueryRow("SELECT price FROM shop.items WHERE id = 2").Scan(&price))
+		assert.Equal(t, 4.0, price)
+		assert.NoError(t, tx.Commit())
+
+		// writes fail before they run, so a rollback has nothing to undo
+		tx, err = sqlDb.Begin()
+		require.NoError(t, err)
+		_, err = tx.Exec("DELETE FROM shop.items WHERE id = 2")
+		assert.EqualError(t, err, "cannot write in a read-only session: only SELECT, EXPLAIN and USE are allowed")
+		assert.NoError(t, tx.Rollback())
+		require.NoError(t, sqlDb.QueryRow("SELECT price FROM shop.items WHERE id = 2").Scan(&price))
+		assert.Equal(t, 4.0, price)
+
+		// the pool's only connection writes again once the transaction ends
+		_, err = sqlDb.Exec("DELETE FROM shop.items WHERE id = 2")
+		assert.NoError(t, err)
+
+		_, err = sqlDb.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+		assert.EqualError(t, err, "isolation level Serializable is not supported")
+	})
+
+	// closing the last connection checkpoints the directory
+	require.NoError(t, sqlDb.Close())
+	assert.Empty(t, managers.managers)
+	reopened := open(t, dataDir)
+	defer reopened.Close()
+	var count int64
+	rows, err := reopened.Query("SELECT id FROM shop.items")
+	require.NoError(t, err)
+	for rows.Next() {
+		count++
+	}
+	assert.Equal(t, int64(1), count)
+}
+
+func TestOpen(t *testing.T) {
+	_, err := sql.Open("modb", "/tmp/modb")
+	assert.EqualError(t, err, `invalid data source name "/tmp/modb": want file:/path/to/data/dir`)
+
+	// connections to one directory share a manager
+	dataDir := t.TempDir()
+	first, second := open(t, dataDir), open(t, dataDir)
+	defer first.Close()
+	defer second.Close()
+	_, err = first.Exec("CREATE DATABASE shop")
+	require.NoError(t, err)
+	_, err = second.Exec("CREATE DATABASE shop")
+	assert.ErrorContains(t, err, "already exists")
+}